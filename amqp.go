@@ -1,77 +1,657 @@
 package londo
 
 import (
+	"errors"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/alexyermolaev/londo/logger"
 	"github.com/sirupsen/logrus"
 	"github.com/streadway/amqp"
 )
 
+const (
+	// reconnect backoff doubles after every failed attempt, up to a maximum
+	MinReconnectDelay = time.Second
+	MaxReconnectDelay = 30 * time.Second
+)
+
+// ConfirmTimeout limits how long a publisher waits for a broker to confirm a message
+const ConfirmTimeout = 10 * time.Second
+
+var (
+	ErrNotConnected = errors.New("amqp connection is not available")
+	ErrUnroutable   = errors.New("message is unroutable")
+	ErrNacked       = errors.New("message was not confirmed by broker")
+	ErrNoConfirm    = errors.New("timed out waiting for broker to confirm message")
+)
+
+// AMQP keeps a connection to RabbitMQ alive. Exchanges and queues declared through it are
+// remembered and declared again after a reconnect, and consumers of those queues resume.
 type AMQP struct {
 	connection *amqp.Connection
 	config     *Config
-	db         *MongoDB
+	db         Store
+
+	pub publisher
+
+	mu       sync.RWMutex
+	ready    chan struct{} // closed while connected, replaced on disconnect
+	topology []func(ch *amqp.Channel) error
+	queues   map[string]bool
+	replies  map[string]bool
+	closed   bool
+
+	stopping chan struct{}
+	stopOnce sync.Once
 }
 
 func (a *AMQP) Shutdown() {
-	a.connection.Close()
+	a.mu.Lock()
+	a.closed = true
+	conn := a.connection
+	a.mu.Unlock()
+
+	conn.Close()
+}
+
+func (a *AMQP) Stop() {
+	a.stopOnce.Do(func() { close(a.stopping) })
 }
 
-func NewMQConnection(c *Config, db *MongoDB) (*AMQP, error) {
+func NewMQConnection(c *Config, db Store) (*AMQP, error) {
 	mq := &AMQP{
-		config: c,
-		db:     db,
+		config:   c,
+		db:       db,
+		ready:    make(chan struct{}),
+		queues:   make(map[string]bool),
+		replies:  make(map[string]bool),
+		stopping: make(chan struct{}),
 	}
 
-	var err error
-
-	mq.connection, err = amqp.Dial(
-		"AMQP://" + c.AMQP.Username + ":" + c.AMQP.Password + "@" + c.AMQP.Hostname + ":" +
-			strconv.Itoa(c.AMQP.Port))
+	conn, err := mq.dial()
 	if err != nil {
 		return mq, err
 	}
 
-	return mq, err
+	mq.connected(conn)
+	return mq, nil
 }
 
-func (a *AMQP) Emit(exchange string, key string, msg amqp.Publishing) error {
-	ch, err := a.connection.Channel()
+func (a *AMQP) dial() (*amqp.Connection, error) {
+	c := a.config.AMQP
+
+	return amqp.Dial(
+		"AMQP://" + c.Username + ":" + c.Password + "@" + c.Hostname + ":" + strconv.Itoa(c.Port))
+}
+
+// connected makes a connection current, and watches it for close notifications
+func (a *AMQP) connected(conn *amqp.Connection) {
+	a.mu.Lock()
+	a.connection = conn
+	close(a.ready)
+	a.mu.Unlock()
+
+	go a.watch(conn.NotifyClose(make(chan *amqp.Error, 1)))
+}
+
+// watch waits for a connection to close, and reconnects unless it was closed by Shutdown
+func (a *AMQP) watch(notify chan *amqp.Error) {
+	reason := <-notify
+
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return
+	}
+	a.ready = make(chan struct{})
+	a.mu.Unlock()
+
+	log.WithFields(logrus.Fields{logger.Service: "amqp", logger.Reason: reason}).Error("disconnected")
+
+	delay := MinReconnectDelay
+
+	for {
+		time.Sleep(delay)
+
+		conn, err := a.dial()
+		if err == nil {
+			if err = a.redeclare(conn); err == nil {
+				log.WithFields(logrus.Fields{
+					logger.Service: "amqp",
+					logger.IP:      a.config.AMQP.Hostname,
+					logger.Port:    a.config.AMQP.Port}).Info("reconnected")
+
+				a.connected(conn)
+				return
+			}
+			conn.Close()
+		}
+
+		log.WithFields(logrus.Fields{
+			logger.Service: "amqp", logger.Reason: err, logger.Delay: delay.String()}).Warn(logger.Retry)
+
+		if delay *= 2; delay > MaxReconnectDelay {
+			delay = MaxReconnectDelay
+		}
+	}
+}
+
+// redeclare replays every remembered declaration on a new connection
+func (a *AMQP) redeclare(conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
 	defer ch.Close()
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	for _, f := range a.topology {
+		if err := f(ch); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Ready reports whether there is a usable connection
+func (a *AMQP) Ready() bool {
+	select {
+	case <-a.wait():
+		return true
+	default:
+		return false
+	}
+}
+
+func (a *AMQP) wait() chan struct{} {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return a.ready
+}
+
+func (a *AMQP) channel() (*amqp.Channel, error) {
+	if !a.Ready() {
+		return nil, ErrNotConnected
+	}
+
+	a.mu.RLock()
+	conn := a.connection
+	a.mu.RUnlock()
+
+	return conn.Channel()
+}
+
+// declare applies a declaration, and remembers it for reconnects
+func (a *AMQP) declare(f func(ch *amqp.Channel) error) error {
+	ch, err := a.channel()
 	if err != nil {
 		return err
 	}
+	defer ch.Close()
+
+	if err := f(ch); err != nil {
+		return err
+	}
 
-	return ch.Publish(exchange, key, false, false, msg)
+	a.mu.Lock()
+	a.topology = append(a.topology, f)
+	a.mu.Unlock()
+
+	return nil
+}
+
+func (a *AMQP) DeclareExchange(exchange string, kind string) error {
+	return a.declare(func(ch *amqp.Channel) error {
+		log.WithFields(logrus.Fields{logger.Exchange: exchange}).Info("declaring")
+		return ch.ExchangeDeclare(exchange, kind, true, false, false, false, nil)
+	})
 }
 
-func (a *AMQP) Consume(queue string, wg *sync.WaitGroup, f func(d amqp.Delivery) bool) {
-	if wg != nil {
-		defer wg.Done()
+// Declare declares an exchange and a durable queue bound to it with a routing key of the queue name
+func (a *AMQP) Declare(exchange string, queue string, kind string, args amqp.Table) error {
+	if err := a.DeclareExchange(exchange, kind); err != nil {
+		return err
+	}
+
+	err := a.declareQueue(exchange, queue, args)
+
+	if err == nil {
+		a.mu.Lock()
+		a.queues[queue] = true
+		a.mu.Unlock()
+	}
+
+	return err
+}
+
+// DeclareQueue declares a durable queue which isn't bound to any exchange, i.e. a delay queue
+func (a *AMQP) DeclareQueue(queue string, args amqp.Table) error {
+	return a.declareQueue("", queue, args)
+}
+
+// declareQueue declares a durable queue, and binds it unless exchange is empty. A queue which already
+// exists with different options, i.e. one declared before queues became durable, is migrated.
+func (a *AMQP) declareQueue(exchange string, queue string, args amqp.Table) error {
+	f := func(ch *amqp.Channel) error {
+		log.WithFields(logrus.Fields{logger.Queue: queue}).Info("declaring")
+		if _, err := ch.QueueDeclare(queue, true, false, false, false, args); err != nil {
+			return err
+		}
+
+		if exchange == "" {
+			return nil
+		}
+
+		log.WithFields(logrus.Fields{logger.Queue: queue}).Info("binding")
+		return ch.QueueBind(queue, queue, exchange, false, nil)
 	}
 
-	log.WithFields(logrus.Fields{logger.Queue: queue}).Info("consuming")
+	err := a.declare(f)
+
+	if e, ok := err.(*amqp.Error); ok && e.Code == amqp.PreconditionFailed {
+		log.WithFields(logrus.Fields{logger.Queue: queue, logger.Reason: e.Reason}).Warn("migrating")
+
+		if err = a.migrateQueue(exchange, queue, args); err != nil {
+			return errors.New("cannot migrate queue " + queue + ": " + err.Error())
+		}
+
+		err = a.declare(f)
+	}
 
-	ch, err := a.connection.Channel()
+	return err
+}
+
+// migrateQueue replaces a queue with a durable one, keeping its messages. A holding queue takes
+// the queue's binding over meanwhile, so whatever is published during a migration is kept too.
+// A queue still consumed by a daemon of an older version can't be migrated, so those have to be stopped.
+func (a *AMQP) migrateQueue(exchange string, queue string, args amqp.Table) error {
+	ch, err := a.channel()
+	if err != nil {
+		return err
+	}
 	defer ch.Close()
+
+	hold := queue + ".migrating"
+
+	if _, err := ch.QueueDeclare(hold, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	if exchange != "" {
+		if err := ch.QueueBind(hold, queue, exchange, false, nil); err != nil {
+			return err
+		}
+
+		if err := ch.QueueUnbind(queue, queue, exchange, nil); err != nil {
+			return err
+		}
+	}
+
+	if _, err := move(ch, queue, hold); err != nil {
+		return err
+	}
+
+	if _, err := ch.QueueDelete(queue, false, false, false); err != nil {
+		return err
+	}
+
+	if _, err := ch.QueueDeclare(queue, true, false, false, false, args); err != nil {
+		return err
+	}
+
+	if exchange != "" {
+		if err := ch.QueueBind(queue, queue, exchange, false, nil); err != nil {
+			return err
+		}
+
+		if err := ch.QueueUnbind(hold, queue, exchange, nil); err != nil {
+			return err
+		}
+	}
+
+	n, err := move(ch, hold, queue)
 	if err != nil {
-		log.Error(err)
-		return
+		return err
 	}
 
-	delivery, err := ch.Consume(
-		queue, "", false, true, false, false, nil)
+	if _, err := ch.QueueDelete(hold, false, false, false); err != nil {
+		return err
+	}
+
+	log.WithFields(logrus.Fields{logger.Queue: queue, logger.Count: n}).Info("migrated")
+	return nil
+}
+
+// move republishes every message of one queue to another
+func move(ch *amqp.Channel, from string, to string) (int, error) {
+	var n int
+
+	for {
+		d, ok, err := ch.Get(from, false)
+		if err != nil || !ok {
+			return n, err
+		}
+
+		if err := ch.Publish("", to, false, false, publishing(&d)); err != nil {
+			return n, err
+		}
+
+		if err := d.Ack(false); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// publishing copies a delivery, so it can be published again. Copies are always persistent.
+func publishing(d *amqp.Delivery) amqp.Publishing {
+	msg := amqp.Publishing{
+		Headers:       amqp.Table{},
+		ContentType:   d.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: d.CorrelationId,
+		ReplyTo:       d.ReplyTo,
+		MessageId:     d.MessageId,
+		AppId:         d.AppId,
+		Timestamp:     d.Timestamp,
+		Type:          d.Type,
+		Body:          d.Body,
+	}
+
+	for k, v := range d.Headers {
+		msg.Headers[k] = v
+	}
+
+	return msg
+}
+
+// DeclareReplyQueue declares an exclusive queue, which is gone with its connection,
+// so it is declared again after a reconnect
+func (a *AMQP) DeclareReplyQueue(exchange string, queue string) error {
+	err := a.declare(func(ch *amqp.Channel) error {
+		log.WithFields(logrus.Fields{logger.Queue: queue}).Info("declaring")
+		if _, err := ch.QueueDeclare(queue, false, true, true, false, nil); err != nil {
+			return err
+		}
+
+		log.WithFields(logrus.Fields{logger.Queue: queue}).Info("binding")
+		return ch.QueueBind(queue, queue, exchange, false, nil)
+	})
+
+	if err == nil {
+		a.mu.Lock()
+		a.queues[queue] = true
+		a.replies[queue] = true
+		a.mu.Unlock()
+	}
+
+	return err
+}
+
+// publisher is a long-lived channel in confirm mode. Messages are published one at a time,
+// so a confirmation and a returned message always belong to the last published message.
+type publisher struct {
+	mu       sync.Mutex
+	ch       *amqp.Channel
+	confirms chan amqp.Confirmation
+	returns  chan amqp.Return
+	closed   chan *amqp.Error
+}
+
+// open puts a new channel in confirm mode, unless a current one is still open
+func (p *publisher) open(a *AMQP) error {
+	if p.ch != nil {
+		select {
+		case <-p.closed:
+			p.ch = nil
+		default:
+			return nil
+		}
+	}
+
+	ch, err := a.channel()
 	if err != nil {
-		log.Error(err)
+		return err
 	}
 
-	for d := range delivery {
-		if f(d) {
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return err
+	}
+
+	p.ch = ch
+	p.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	p.returns = ch.NotifyReturn(make(chan amqp.Return, 1))
+	p.closed = ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	return nil
+}
+
+// reset drops a channel which may still deliver a confirmation of a message given up on
+func (p *publisher) reset() {
+	if p.ch != nil {
+		p.ch.Close()
+		p.ch = nil
+	}
+}
+
+// Emit publishes a message, and waits until a broker confirms it. A message which can't be
+// routed to any queue is an error too.
+func (a *AMQP) Emit(exchange string, key string, msg amqp.Publishing) error {
+	p := &a.pub
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := p.open(a); err != nil {
+		return err
+	}
+
+	if err := p.ch.Publish(exchange, key, true, false, msg); err != nil {
+		p.reset()
+		return err
+	}
+
+	select {
+	case c, ok := <-p.confirms:
+		if !ok {
+			p.reset()
+			return ErrNotConnected
+		}
+
+		// a broker returns an unroutable message before it confirms it
+		select {
+		case r := <-p.returns:
+			return errors.New(ErrUnroutable.Error() + ": " + r.Exchange + "/" + r.RoutingKey + ": " + r.ReplyText)
+		default:
+		}
+
+		if !c.Ack {
+			return ErrNacked
+		}
+		return nil
+
+	case <-time.After(ConfirmTimeout):
+		p.reset()
+		return ErrNoConfirm
+	}
+}
+
+func (a *AMQP) Drain(queue string, max int, f func(d *amqp.Delivery) bool) error {
+	ch, err := a.channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	var n int
+
+	for max <= 0 || n < max {
+		d, ok, err := ch.Get(queue, false)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
 			break
 		}
+		n++
+
+		if f(&d) {
+			if err := d.Ack(false); err != nil {
+				return err
+			}
+		}
+	}
+
+	if n == 0 {
+		return nil
+	}
+
+	// tag zero with multiple is every unacknowledged message of a channel
+	return ch.Nack(0, true, true)
+}
+
+func (a *AMQP) Count(queue string) (int, error) {
+	ch, err := a.channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	q, err := ch.QueueInspect(queue)
+	return q.Messages, err
+}
+
+func (a *AMQP) Purge(queue string) (int, error) {
+	ch, err := a.channel()
+	if err != nil {
+		return 0, err
+	}
+	defer ch.Close()
+
+	return ch.QueuePurge(queue, false)
+}
+
+// Consume passes deliveries to a pool of workers running f, until f returns true. A consumer of
+// a queue declared with Declare resumes after a reconnect, a consumer of a temporary queue stops.
+// Replicas share a queue, only a reply queue of a single daemon is consumed exclusively.
+func (a *AMQP) Consume(queue string, p Pool, f func(d amqp.Delivery) bool) {
+	a.mu.RLock()
+	resume := a.queues[queue]
+	exclusive := a.replies[queue]
+	a.mu.RUnlock()
+
+	// a reply queue is consumed until Shutdown
+	stop := a.stopping
+	if exclusive {
+		stop = nil
+	}
+
+	for {
+		if resume {
+			select {
+			case <-a.wait():
+			case <-stop:
+			}
+		}
+
+		if isDone(stop) || a.consume(queue, exclusive, stop, p, f) {
+			log.WithFields(logrus.Fields{logger.Queue: queue}).Debug("stopped")
+			return
+		}
+
+		a.mu.RLock()
+		closed := a.closed
+		a.mu.RUnlock()
+
+		if !resume || closed || isDone(stop) {
+			log.WithFields(logrus.Fields{logger.Queue: queue}).Debug("closed")
+			return
+		}
+
+		log.WithFields(logrus.Fields{logger.Queue: queue}).Warn(logger.Lost)
+
+		// a connection may not be known as closed yet
+		time.Sleep(MinReconnectDelay)
 	}
+}
+
+// consume runs a single consumer, and tells whether f has asked to stop. Deliveries are acknowledged
+// by f once they are handled, so a broker doesn't send more than a pool's prefetch ahead.
+func (a *AMQP) consume(queue string, exclusive bool, stop chan struct{}, p Pool, f func(d amqp.Delivery) bool) bool {
+	log.WithFields(logrus.Fields{
+		logger.Queue: queue, logger.Workers: p.workers(), logger.Prefetch: p.Prefetch}).Info("consuming")
+
+	ch, err := a.channel()
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.Queue: queue, logger.Reason: err}).Error()
+		return false
+	}
+	defer ch.Close()
+
+	if err := ch.Qos(p.Prefetch, 0, false); err != nil {
+		log.WithFields(logrus.Fields{logger.Queue: queue, logger.Reason: err}).Error()
+		return false
+	}
+
+	tag := queue + "." + newID()[:8]
+
+	delivery, err := ch.Consume(
+		queue, tag, false, exclusive, false, false, nil)
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.Queue: queue, logger.Reason: err}).Error()
+		return false
+	}
+
+	return work(p, delivery, stop, func() { ch.Cancel(tag, false) }, f)
+}
+
+// work passes deliveries to a pool's workers until there are no more. Once f asks to stop or stop
+// is closed, cancel stops deliveries. Deliveries which are being handled are finished before it
+// returns, it tells whether f has asked to stop.
+func work(p Pool, delivery <-chan amqp.Delivery, stop chan struct{}, cancel func(), f func(d amqp.Delivery) bool) bool {
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		stopped  bool
+		finished = make(chan struct{})
+	)
+
+	go func() {
+		select {
+		case <-stop:
+			once.Do(cancel)
+		case <-finished:
+		}
+	}()
+
+	for i := 0; i < p.workers(); i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for d := range delivery {
+				if f(d) {
+					once.Do(func() {
+						stopped = true
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(finished)
 
-	log.WithFields(logrus.Fields{logger.Queue: queue}).Debug("closed")
+	return stopped
 }
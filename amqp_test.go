@@ -0,0 +1,109 @@
+package londo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// TestAMQPDisconnected checks an AMQP which has lost its connection, without a broker
+func TestAMQPDisconnected(t *testing.T) {
+	a := &AMQP{
+		ready:    make(chan struct{}),
+		queues:   map[string]bool{"durable": true},
+		replies:  make(map[string]bool),
+		stopping: make(chan struct{}),
+	}
+
+	if a.Ready() {
+		t.Error("Ready() while disconnected")
+	}
+
+	if _, err := a.channel(); err != ErrNotConnected {
+		t.Errorf("channel() = %v, want %v", err, ErrNotConnected)
+	}
+
+	if err := a.DeclareExchange("londo", amqp.ExchangeDirect); err != ErrNotConnected {
+		t.Errorf("DeclareExchange() = %v, want %v", err, ErrNotConnected)
+	}
+
+	if len(a.topology) != 0 {
+		t.Error("a failed declaration is declared again after a reconnect")
+	}
+
+	tests := []struct {
+		name  string
+		queue string
+		stop  bool
+	}{
+		// a temporary queue is gone with its connection
+		{"temporary", "temporary", false},
+
+		// a declared queue is consumed again once connected, unless stopping
+		{"declared", "durable", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.stop {
+				a.Stop()
+			}
+
+			done := make(chan struct{})
+			go func() {
+				a.Consume(tt.queue, Single, func(d amqp.Delivery) bool { return true })
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case <-time.After(5 * time.Second):
+				t.Fatal("Consume() has not returned")
+			}
+		})
+	}
+}
+
+func TestPublishing(t *testing.T) {
+	d := &amqp.Delivery{
+		Headers:       amqp.Table{AttemptsHeader: int32(1)},
+		ContentType:   ContentType,
+		DeliveryMode:  amqp.Transient,
+		CorrelationId: "correlation",
+		ReplyTo:       "reply",
+		MessageId:     "id",
+		AppId:         "test",
+		Type:          DbGetSubjectCmd,
+		Body:          []byte("{}"),
+	}
+
+	msg := publishing(d)
+
+	if msg.DeliveryMode != amqp.Persistent {
+		t.Error("a copy of a transient message isn't persistent")
+	}
+
+	if msg.CorrelationId != d.CorrelationId || msg.ReplyTo != d.ReplyTo || msg.MessageId != d.MessageId ||
+		msg.AppId != d.AppId || msg.Type != d.Type || string(msg.Body) != string(d.Body) {
+		t.Errorf("publishing() = %+v, want a copy of %+v", msg, d)
+	}
+
+	// headers of a copy change without changing a delivery
+	msg.Headers[AttemptsHeader] = int32(2)
+	if Attempts(d) != 1 {
+		t.Error("publishing() shares headers with a delivery")
+	}
+}
+
+func TestPublishPersistent(t *testing.T) {
+	l := newTestDbd(t)
+
+	if err := l.Publish(GRPCServerExchange, testReplyQueue, "", DbGetSubjectCmd, GetSubjectEvent{Subject: "a.example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if d := get(t, l.Bus.(*MemoryBus), testReplyQueue); d.DeliveryMode != amqp.Persistent {
+		t.Errorf("delivery mode = %d, want %d", d.DeliveryMode, amqp.Persistent)
+	}
+}
@@ -0,0 +1,87 @@
+package londo
+
+import (
+	"context"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+
+	// actor of requests coming from localhost, which aren't authenticated
+	localActor = "localhost"
+)
+
+// AuditEntry records who did what to which subject. Entries are only ever appended.
+type AuditEntry struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	Timestamp time.Time          `bson:"timestamp"`
+	Actor     string             `bson:"actor"`
+	SourceIP  string             `bson:"source_ip,omitempty"`
+	Action    string             `bson:"action"`
+	Subject   string             `bson:"subject,omitempty"`
+	Outcome   string             `bson:"outcome"`
+	Reason    string             `bson:"reason,omitempty"`
+}
+
+func (AuditEntry) EventName() string {
+	return "audit.entry"
+}
+
+type GetAuditLogEvent struct {
+	From  time.Time
+	To    time.Time
+	Actor string
+}
+
+func (GetAuditLogEvent) EventName() string {
+	return "audit.get"
+}
+
+type actorKey struct{}
+
+// WithActor stores an authenticated caller in a request context
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns a caller stored by AuthIntercept
+func ActorFromContext(ctx context.Context) string {
+	if a, ok := ctx.Value(actorKey{}).(string); ok {
+		return a
+	}
+	return logger.Unknown
+}
+
+// Audit publishes an entry to londo-dbd. Auditing must never break an operation,
+// so a failure to publish is only logged.
+func (l *Londo) Audit(actor string, ip string, action string, subject string, err error) {
+	e := AuditEntry{
+		Timestamp: time.Now(),
+		Actor:     actor,
+		SourceIP:  ip,
+		Action:    action,
+		Subject:   subject,
+		Outcome:   AuditSuccess,
+	}
+
+	if err != nil {
+		e.Outcome = AuditFailure
+		e.Reason = err.Error()
+	}
+
+	if err := l.Publish(DbReplyExchange, DbReplyQueue, "", DbAuditCmd, e); err != nil {
+		log.WithFields(logrus.Fields{
+			logger.Exchange: DbReplyExchange,
+			logger.Queue:    DbReplyQueue,
+			logger.Cmd:      DbAuditCmd,
+			logger.Action:   action,
+			logger.Subject:  subject,
+			logger.Reason:   err}).Error(logger.Skip)
+	}
+}
@@ -0,0 +1,78 @@
+package londo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+)
+
+func TestActorFromContext(t *testing.T) {
+	if a := ActorFromContext(context.Background()); a != logger.Unknown {
+		t.Errorf("actor of an anonymous context = %q, want %q", a, logger.Unknown)
+	}
+
+	if a := ActorFromContext(WithActor(context.Background(), "alice")); a != "alice" {
+		t.Errorf("actor = %q, want %q", a, "alice")
+	}
+}
+
+// TestAudit publishes entries through londo-dbd, and reads them back filtered
+func TestAudit(t *testing.T) {
+	l := newTestDbd(t)
+	b := l.Bus.(*MemoryBus)
+
+	// timestamps are stored in milliseconds
+	start := time.Now().Add(-time.Second)
+
+	l.Audit("alice", "10.0.0.1", "DeleteSubject", "a.example.com", nil)
+	l.Audit("bob", "10.0.0.2", "GetSubject", "a.example.com", errors.New("denied"))
+
+	for i := 0; i < 2; i++ {
+		l.dbAudit(get(t, b, DbReplyQueue))
+	}
+
+	end := time.Now().Add(time.Second)
+
+	tests := []struct {
+		name     string
+		from, to time.Time
+		actor    string
+		want     []string
+	}{
+		{"all", start, end, "", []string{"alice", "bob"}},
+		{"actor", start, end, "bob", []string{"bob"}},
+		{"before", start.Add(-time.Hour), start.Add(-time.Minute), "", nil},
+		{"unknown actor", start, end, "carol", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := l.Db.FindAuditEntries(tt.from, tt.to, tt.actor)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(entries), len(tt.want))
+			}
+
+			for i, e := range entries {
+				if e.Actor != tt.want[i] {
+					t.Errorf("entry %d is of %q, want %q", i, e.Actor, tt.want[i])
+				}
+			}
+		})
+	}
+
+	entries, err := l.Db.FindAuditEntries(start, end, "bob")
+	if err != nil || len(entries) != 1 {
+		t.Fatal(entries, err)
+	}
+
+	if e := entries[0]; e.Outcome != AuditFailure || e.Reason != "denied" || e.SourceIP != "10.0.0.2" || e.Action != "GetSubject" {
+		t.Errorf("failure entry = %+v", e)
+	}
+}
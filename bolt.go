@@ -0,0 +1,796 @@
+package londo
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	subjBucket = []byte("subjects")
+
+	// certificates bucket keeps a nested bucket of records per subject, keyed by version
+	certBucket = []byte("certificates")
+
+	// audit entries are keyed by a sequence, so they are kept in order of insertion
+	auditBucket = []byte("audit")
+
+	// enrollments are keyed by a subject, there is only the latest one of each
+	enrollBucket = []byte("enrollments")
+
+	metaBucket = []byte("metadata")
+	schemaKey  = []byte("schema")
+)
+
+// BoltDB keeps subjects in a single embedded file, so small installations don't need
+// a MongoDB server. Documents are stored bson encoded, keyed by their object id.
+type BoltDB struct {
+	db   *bbolt.DB
+	Path string
+}
+
+func NewBoltDB(c *Config) (*BoltDB, error) {
+	if c.Storage.Path == "" {
+		return nil, errors.New("storage path is required by " + BoltBackend + " backend")
+	}
+
+	b := &BoltDB{Path: c.Storage.Path}
+
+	db, err := bbolt.Open(b.Path, 0600, &bbolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{subjBucket, certBucket, auditBucket, enrollBucket, metaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	b.db = db
+	return b, nil
+}
+
+func (b *BoltDB) Disconnect() error {
+	return b.db.Close()
+}
+
+// EnsureIndexes is a no-op, bolt backend is meant for small installations and scans its buckets.
+// Uniqueness of subjects and certificate ids is enforced by InsertSubject.
+func (b *BoltDB) EnsureIndexes() error {
+	return nil
+}
+
+func (b *BoltDB) FindAllSubjects() ([]*Subject, error) {
+	var results []*Subject
+
+	err := b.forEach(func(s *Subject) error {
+		results = append(results, s)
+		return nil
+	})
+
+	return results, err
+}
+
+func (b *BoltDB) FindExpiringSubjects(hours int) ([]*Subject, error) {
+	var res []*Subject
+
+	deadline := time.Now().Add(time.Duration(hours) * time.Hour)
+
+	err := b.forEach(func(s *Subject) error {
+		if s.NotAfter.Before(deadline) {
+			res = append(res, s)
+		}
+		return nil
+	})
+
+	// soonest first, like mongodb returns them
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].NotAfter.Before(res[j].NotAfter)
+	})
+
+	return res, err
+}
+
+func (b *BoltDB) InsertSubject(s *Subject) error {
+	s.ID = primitive.NewObjectID()
+
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(subjBucket).ForEach(func(k, v []byte) error {
+			e, err := decodeSubject(v)
+			if err != nil {
+				return err
+			}
+
+			if e.Subject == s.Subject && e.Deleted == nil || e.CertID == s.CertID {
+				return ErrConflict
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		return putSubject(tx, s)
+	})
+}
+
+func (b *BoltDB) DeleteSubject(hexId string, certid int, rev int64, t *Tombstone) error {
+	if _, err := primitive.ObjectIDFromHex(hexId); err != nil {
+		return err
+	}
+
+	return b.update(rev, func(s *Subject) bool {
+		return s.ID.Hex() == hexId && s.CertID == certid
+	}, func(s *Subject) {
+		s.Deleted = t
+	})
+}
+
+func (b *BoltDB) ImportSubject(s *Subject, replace bool) ([]string, error) {
+	var fields []string
+
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(subjBucket)
+
+		var (
+			keys      [][]byte
+			conflicts []Subject
+		)
+
+		if err := bkt.ForEach(func(k, v []byte) error {
+			e, err := decodeSubject(v)
+			if err != nil {
+				return err
+			}
+
+			if e.CertID == s.CertID || (e.Subject == s.Subject && e.Deleted == nil && s.Deleted == nil) {
+				keys = append(keys, k)
+				conflicts = append(conflicts, *e)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		fields = conflictFields(s, conflicts)
+
+		if len(fields) != 0 && !replace {
+			return nil
+		}
+
+		for _, k := range keys {
+			if err := bkt.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return putSubject(tx, s)
+	})
+
+	return fields, err
+}
+
+func (b *BoltDB) FindDeletedSubjects() ([]*Subject, error) {
+	var res []*Subject
+
+	err := b.scan(true, func(s *Subject) error {
+		res = append(res, s)
+		return nil
+	})
+
+	return res, err
+}
+
+func (b *BoltDB) RestoreSubject(s string) (Subject, error) {
+	var res *Subject
+
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.Bucket(subjBucket).ForEach(func(k, v []byte) error {
+			e, err := decodeSubject(v)
+			if err != nil || e.Subject != s {
+				return err
+			}
+
+			if e.Deleted == nil {
+				return ErrSubjectExists
+			}
+
+			if res == nil || e.Deleted.At.After(res.Deleted.At) {
+				res = e
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if res == nil {
+			return ErrSubjectNotFound
+		}
+
+		res.Deleted = nil
+		res.UnresolvableAt = time.Time{}
+		res.UpdatedAt = time.Now()
+		res.Revision++
+
+		return putSubject(tx, res)
+	})
+
+	if err != nil {
+		return Subject{}, err
+	}
+	return *res, nil
+}
+
+func (b *BoltDB) PurgeSubject(hexId string, rev int64) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(subjBucket)
+
+		s, err := decodeSubject(bkt.Get([]byte(hexId)))
+		if err != nil {
+			return err
+		}
+
+		if s.Deleted == nil || s.Revision != rev {
+			return ErrConflict
+		}
+
+		return bkt.Delete([]byte(hexId))
+	})
+}
+
+func (b *BoltDB) UpdateSubjCert(certId *int, rev int64, cert *string, na *time.Time, sn *big.Int) error {
+	return b.update(rev, func(s *Subject) bool {
+		return s.CertID == *certId
+	}, func(s *Subject) {
+		s.Certificate = *cert
+		s.NotAfter = *na
+		s.Serial = sn.String()
+		s.UpdatedAt = time.Now()
+		s.Match = false
+	})
+}
+
+func (b *BoltDB) FindSubject(s string) (Subject, error) {
+	var res Subject
+
+	err := b.forEach(func(subj *Subject) error {
+		if subj.Subject == s {
+			res = *subj
+			return errStop
+		}
+		return nil
+	})
+
+	switch err {
+	case errStop:
+		return res, nil
+	case nil:
+		return res, ErrSubjectNotFound
+	default:
+		return res, err
+	}
+}
+
+func (b *BoltDB) FindManySubjects(s []string, filter string) ([]Subject, error) {
+	var res []Subject
+
+	err := b.forEach(func(subj *Subject) error {
+		var field []string
+
+		switch filter {
+		case "targets":
+			field = subj.Targets
+		case "outdated":
+			field = subj.Outdated
+		case "alt_names":
+			field = subj.AltNames
+		case "subject":
+			field = []string{subj.Subject}
+		default:
+			return errors.New("unsupported filter " + filter)
+		}
+
+		if containsAny(field, s) {
+			res = append(res, *subj)
+		}
+		return nil
+	})
+
+	return res, err
+}
+
+func (b *BoltDB) ListSubjects(f *SubjectFilter) ([]Subject, string, error) {
+	var res []Subject
+
+	err := b.scan(f.Deleted, func(s *Subject) error {
+		if f.Matches(s) {
+			res = append(res, *s)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	res, next := f.Page(res)
+	return res, next, nil
+}
+
+func (b *BoltDB) UpdateUnreachable(e *CheckCertEvent) error {
+	return b.update(e.Revision, func(s *Subject) bool {
+		return s.ID.Hex() == e.ID
+	}, func(s *Subject) {
+		s.UnresolvableAt = e.Unresolvable
+		s.Match = e.Match
+		s.Targets = e.Targets
+		s.Outdated = e.Outdated
+		s.UpdatedAt = time.Now()
+	})
+}
+
+// UpdateSubjKey looks a subject up by its key, so keys of deleted subjects are rewrapped too
+func (b *BoltDB) UpdateSubjKey(hexId string, rev int64, k *EncryptedKey) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(subjBucket).Get([]byte(hexId))
+		if v == nil {
+			return ErrSubjectNotFound
+		}
+
+		s, err := decodeSubject(v)
+		if err != nil {
+			return err
+		}
+
+		if s.Revision != rev {
+			return ErrConflict
+		}
+
+		s.Revision++
+		s.PrivateKey = ""
+		s.EncryptedKey = k
+		s.UpdatedAt = time.Now()
+
+		return putSubject(tx, s)
+	})
+}
+
+func (b *BoltDB) FindSubjectByCertID(certId int) (Subject, error) {
+	var res Subject
+
+	err := b.forEach(func(subj *Subject) error {
+		if subj.CertID == certId {
+			res = *subj
+			return errStop
+		}
+		return nil
+	})
+
+	switch err {
+	case errStop:
+		return res, nil
+	case nil:
+		return res, ErrSubjectNotFound
+	default:
+		return res, err
+	}
+}
+
+func (b *BoltDB) InsertCertRecord(r *CertRecord) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.Bucket(certBucket).CreateBucketIfNotExists([]byte(r.Subject))
+		if err != nil {
+			return err
+		}
+
+		seq, err := bkt.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		r.ID = primitive.NewObjectID()
+		r.Version = int(seq)
+
+		return putCertRecord(bkt, r)
+	})
+}
+
+func (b *BoltDB) FindCertHistory(s string) ([]CertRecord, error) {
+	var res []CertRecord
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(certBucket).Bucket([]byte(s))
+		if bkt == nil {
+			return nil
+		}
+
+		return bkt.ForEach(func(k, v []byte) error {
+			var r CertRecord
+			if err := bson.Unmarshal(v, &r); err != nil {
+				return err
+			}
+			res = append(res, r)
+			return nil
+		})
+	})
+
+	return res, err
+}
+
+func (b *BoltDB) FindAllCertRecords() ([]CertRecord, error) {
+	var res []CertRecord
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(certBucket).ForEach(func(name, _ []byte) error {
+			return tx.Bucket(certBucket).Bucket(name).ForEach(func(k, v []byte) error {
+				var r CertRecord
+				if err := bson.Unmarshal(v, &r); err != nil {
+					return err
+				}
+				res = append(res, r)
+				return nil
+			})
+		})
+	})
+
+	return res, err
+}
+
+// ImportCertRecord keeps a version of an imported record, and moves a sequence past it,
+// so records inserted later don't collide.
+func (b *BoltDB) ImportCertRecord(r *CertRecord) (bool, error) {
+	var ok bool
+
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		bkt, err := tx.Bucket(certBucket).CreateBucketIfNotExists([]byte(r.Subject))
+		if err != nil {
+			return err
+		}
+
+		if bkt.Get(seqKey(uint64(r.Version))) != nil {
+			return nil
+		}
+
+		if uint64(r.Version) > bkt.Sequence() {
+			if err := bkt.SetSequence(uint64(r.Version)); err != nil {
+				return err
+			}
+		}
+
+		r.ID = primitive.NewObjectID()
+		ok = true
+
+		return putCertRecord(bkt, r)
+	})
+
+	return ok, err
+}
+
+func (b *BoltDB) RevokeCertRecord(certId int, reason string, at time.Time) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(certBucket).ForEach(func(name, _ []byte) error {
+			bkt := tx.Bucket(certBucket).Bucket(name)
+
+			var revoked []CertRecord
+
+			if err := bkt.ForEach(func(k, v []byte) error {
+				var r CertRecord
+				if err := bson.Unmarshal(v, &r); err != nil {
+					return err
+				}
+
+				if r.CertID == certId {
+					r.RevokedAt = at
+					r.RevocationReason = reason
+					revoked = append(revoked, r)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+
+			for i := range revoked {
+				if err := putCertRecord(bkt, &revoked[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (b *BoltDB) InsertAuditEntry(e *AuditEntry) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(auditBucket)
+
+		seq, err := bkt.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		e.ID = primitive.NewObjectID()
+
+		v, err := bson.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Put(seqKey(seq), v)
+	})
+}
+
+func (b *BoltDB) FindAuditEntries(from time.Time, to time.Time, actor string) ([]AuditEntry, error) {
+	var res []AuditEntry
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(auditBucket).ForEach(func(k, v []byte) error {
+			var e AuditEntry
+			if err := bson.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			if e.Timestamp.Before(from) || e.Timestamp.After(to) {
+				return nil
+			}
+
+			if actor != "" && e.Actor != actor {
+				return nil
+			}
+
+			res = append(res, e)
+			return nil
+		})
+	})
+
+	return res, err
+}
+
+func (b *BoltDB) FindEnrollment(s string) (Enrollment, error) {
+	var e Enrollment
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		v := tx.Bucket(enrollBucket).Get([]byte(s))
+		if v == nil {
+			return ErrEnrollmentNotFound
+		}
+
+		return bson.Unmarshal(v, &e)
+	})
+
+	return e, err
+}
+
+func (b *BoltDB) SaveEnrollment(e *Enrollment, rev int64) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(enrollBucket)
+
+		var cur Enrollment
+		if v := bkt.Get([]byte(e.Subject)); v != nil {
+			if err := bson.Unmarshal(v, &cur); err != nil {
+				return err
+			}
+		} else if rev != 0 {
+			return ErrConflict
+		}
+
+		if cur.Revision != rev {
+			return ErrConflict
+		}
+
+		e.Revision = rev + 1
+
+		v, err := bson.Marshal(e)
+		if err != nil {
+			return err
+		}
+
+		return bkt.Put([]byte(e.Subject), v)
+	})
+}
+
+func (b *BoltDB) DeleteEnrollment(certId int) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(enrollBucket)
+
+		var keys [][]byte
+
+		if err := bkt.ForEach(func(k, v []byte) error {
+			var e Enrollment
+			if err := bson.Unmarshal(v, &e); err != nil {
+				return err
+			}
+
+			if e.State == EnrollOrdered && e.CertID == certId {
+				keys = append(keys, k)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		for _, k := range keys {
+			if err := bkt.Delete(k); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (b *BoltDB) SchemaVersion() (int, error) {
+	var v int
+
+	err := b.db.View(func(tx *bbolt.Tx) error {
+		if raw := tx.Bucket(metaBucket).Get(schemaKey); raw != nil {
+			v = int(binary.BigEndian.Uint64(raw))
+		}
+		return nil
+	})
+
+	return v, err
+}
+
+func (b *BoltDB) SetSchemaVersion(v int) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(metaBucket).Put(schemaKey, seqKey(uint64(v)))
+	})
+}
+
+func (b *BoltDB) MigrateSubjects(f func(doc bson.M) bool, dryRun bool) ([]string, error) {
+	var changed []string
+
+	err := b.db.Update(func(tx *bbolt.Tx) error {
+		bkt := tx.Bucket(subjBucket)
+		docs := make(map[string][]byte)
+
+		if err := bkt.ForEach(func(k, v []byte) error {
+			var doc bson.M
+			if err := bson.Unmarshal(v, &doc); err != nil {
+				return err
+			}
+
+			if !f(doc) {
+				return nil
+			}
+
+			raw, err := bson.Marshal(doc)
+			if err != nil {
+				return err
+			}
+
+			docs[string(k)] = raw
+
+			name, _ := doc["subject"].(string)
+			changed = append(changed, name)
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if dryRun {
+			return nil
+		}
+
+		// bucket must not be modified while it is being iterated
+		for k, v := range docs {
+			if err := bkt.Put([]byte(k), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return changed, err
+}
+
+// update applies f to the first live subject which matches, as long as it still has a given revision
+func (b *BoltDB) update(rev int64, match func(s *Subject) bool, f func(s *Subject)) error {
+	return b.db.Update(func(tx *bbolt.Tx) error {
+		c := tx.Bucket(subjBucket).Cursor()
+
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			s, err := decodeSubject(v)
+			if err != nil {
+				return err
+			}
+
+			if s.Deleted != nil || !match(s) {
+				continue
+			}
+
+			if s.Revision != rev {
+				return ErrConflict
+			}
+
+			f(s)
+			s.Revision++
+
+			return putSubject(tx, s)
+		}
+
+		return ErrSubjectNotFound
+	})
+}
+
+var errStop = errors.New("stop iteration")
+
+// forEach calls f with every live subject
+func (b *BoltDB) forEach(f func(s *Subject) error) error {
+	return b.scan(false, f)
+}
+
+// scan calls f with either deleted or live subjects
+func (b *BoltDB) scan(deleted bool, f func(s *Subject) error) error {
+	return b.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(subjBucket).ForEach(func(k, v []byte) error {
+			s, err := decodeSubject(v)
+			if err != nil {
+				return err
+			}
+
+			if (s.Deleted != nil) != deleted {
+				return nil
+			}
+			return f(s)
+		})
+	})
+}
+
+func putSubject(tx *bbolt.Tx, s *Subject) error {
+	b, err := bson.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket(subjBucket).Put([]byte(s.ID.Hex()), b)
+}
+
+func putCertRecord(bkt *bbolt.Bucket, r *CertRecord) error {
+	v, err := bson.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	return bkt.Put(seqKey(uint64(r.Version)), v)
+}
+
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+func decodeSubject(v []byte) (*Subject, error) {
+	if v == nil {
+		return nil, ErrSubjectNotFound
+	}
+
+	var s Subject
+	if err := bson.Unmarshal(v, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func containsAny(field []string, values []string) bool {
+	for _, f := range field {
+		for _, v := range values {
+			if f == v {
+				return true
+			}
+		}
+	}
+	return false
+}
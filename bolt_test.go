@@ -0,0 +1,302 @@
+package londo
+
+import (
+	"math/big"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage Storage
+		wantErr bool
+	}{
+		{"bolt", Storage{Backend: BoltBackend, Path: filepath.Join(t.TempDir(), "londo.db")}, false},
+		{"bolt without a path", Storage{Backend: BoltBackend}, true},
+		{"unknown", Storage{Backend: "sqlite"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewStore(&Config{Storage: tt.storage})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if s != nil {
+				s.Disconnect()
+			}
+		})
+	}
+}
+
+func TestBoltInsertSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject Subject
+		wantErr error
+	}{
+		{"new", Subject{Subject: "b.example.com", CertID: 2}, nil},
+		{"same subject", Subject{Subject: "a.example.com", CertID: 2}, ErrConflict},
+		{"same cert id", Subject{Subject: "b.example.com", CertID: 1}, ErrConflict},
+		{"deleted subject", Subject{Subject: "c.example.com", CertID: 4}, nil},
+		{"deleted cert id", Subject{Subject: "d.example.com", CertID: 3}, ErrConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestBolt(t)
+
+			for _, s := range []*Subject{
+				{Subject: "a.example.com", CertID: 1},
+				{Subject: "c.example.com", CertID: 3, Deleted: &Tombstone{At: time.Now()}},
+			} {
+				if err := db.InsertSubject(s); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := db.InsertSubject(&tt.subject); err != tt.wantErr {
+				t.Fatalf("InsertSubject() = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			s, err := db.FindSubject(tt.subject.Subject)
+			if err != nil || s.CertID != tt.subject.CertID || s.ID.IsZero() {
+				t.Errorf("FindSubject() = %+v, %v", s, err)
+			}
+		})
+	}
+}
+
+func TestBoltFindManySubjects(t *testing.T) {
+	db := newTestBolt(t)
+
+	for _, s := range []*Subject{
+		{Subject: "a.example.com", CertID: 1, Targets: []string{"10.0.0.1"}, AltNames: []string{"www.a.example.com"}},
+		{Subject: "b.example.com", CertID: 2, Targets: []string{"10.0.0.1", "10.0.0.2"}, Outdated: []string{"10.0.0.2"}},
+		{Subject: "c.example.com", CertID: 3, Targets: []string{"10.0.0.1"}, Deleted: &Tombstone{At: time.Now()}},
+	} {
+		if err := db.InsertSubject(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		filter  string
+		values  []string
+		want    int
+		wantErr bool
+	}{
+		{"targets", []string{"10.0.0.1"}, 2, false},
+		{"targets", []string{"10.0.0.2", "10.0.0.3"}, 1, false},
+		{"outdated", []string{"10.0.0.2"}, 1, false},
+		{"alt_names", []string{"www.a.example.com"}, 1, false},
+		{"subject", []string{"a.example.com", "c.example.com"}, 1, false},
+		{"serial", []string{"1"}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			res, err := db.FindManySubjects(tt.values, tt.filter)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FindManySubjects() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(res) != tt.want {
+				t.Errorf("found %d subjects, want %d", len(res), tt.want)
+			}
+		})
+	}
+}
+
+func TestBoltFindSubjectByCertID(t *testing.T) {
+	db := newTestBolt(t)
+
+	if err := db.InsertSubject(&Subject{Subject: "a.example.com", CertID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := db.FindSubjectByCertID(1); err != nil || s.Subject != "a.example.com" {
+		t.Errorf("FindSubjectByCertID(1) = %q, %v", s.Subject, err)
+	}
+
+	if _, err := db.FindSubjectByCertID(2); err != ErrSubjectNotFound {
+		t.Errorf("FindSubjectByCertID(2) = %v, want %v", err, ErrSubjectNotFound)
+	}
+}
+
+func TestBoltCertHistory(t *testing.T) {
+	db := newTestBolt(t)
+
+	for _, r := range []*CertRecord{
+		{Subject: "a.example.com", CertID: 1},
+		{Subject: "b.example.com", CertID: 2},
+		{Subject: "a.example.com", CertID: 3},
+	} {
+		if err := db.InsertCertRecord(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := db.RevokeCertRecord(1, "superseded", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// an imported record keeps its version, and later ones are numbered past it
+	for _, r := range []struct {
+		record CertRecord
+		want   bool
+	}{
+		{CertRecord{Subject: "a.example.com", Version: 2, CertID: 30}, false},
+		{CertRecord{Subject: "a.example.com", Version: 5, CertID: 5}, true},
+	} {
+		if ok, err := db.ImportCertRecord(&r.record); err != nil || ok != r.want {
+			t.Fatalf("ImportCertRecord(version %d) = %t, %v, want %t", r.record.Version, ok, err, r.want)
+		}
+	}
+
+	if err := db.InsertCertRecord(&CertRecord{Subject: "a.example.com", CertID: 6}); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := db.FindCertHistory("a.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct{ version, certId int }{{1, 1}, {2, 3}, {5, 5}, {6, 6}}
+	if len(h) != len(want) {
+		t.Fatalf("history has %d records, want %d", len(h), len(want))
+	}
+
+	for i, w := range want {
+		if h[i].Version != w.version || h[i].CertID != w.certId {
+			t.Errorf("record %d is version %d of cert id %d, want version %d of %d", i, h[i].Version, h[i].CertID, w.version, w.certId)
+		}
+	}
+
+	if h[0].RevokedAt.IsZero() || h[0].RevocationReason != "superseded" || !h[1].RevokedAt.IsZero() {
+		t.Error("only cert id 1 should be revoked")
+	}
+
+	if all, err := db.FindAllCertRecords(); err != nil || len(all) != 5 {
+		t.Errorf("FindAllCertRecords() = %d records, %v, want 5", len(all), err)
+	}
+
+	if h, err := db.FindCertHistory("c.example.com"); err != nil || len(h) != 0 {
+		t.Errorf("history of an unknown subject = %v, %v", h, err)
+	}
+}
+
+func TestBoltFindExpiringSubjects(t *testing.T) {
+	db := newTestBolt(t)
+
+	day := 24 * time.Hour
+	for _, s := range []*Subject{
+		// stored in another order than they expire
+		{Subject: "c.example.com", CertID: 3, NotAfter: time.Now().Add(60 * day)},
+		{Subject: "b.example.com", CertID: 2, NotAfter: time.Now().Add(10 * day)},
+		{Subject: "a.example.com", CertID: 1, NotAfter: time.Now().Add(day)},
+		{Subject: "d.example.com", CertID: 4, NotAfter: time.Now().Add(day), Deleted: &Tombstone{At: time.Now()}},
+
+		// a certificate has yet to be issued
+		{Subject: "e.example.com", CertID: 5},
+	} {
+		if err := db.InsertSubject(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		hours int
+		want  int
+	}{
+		{0, 1},
+		{48, 2},
+		{30 * 24, 3},
+		{90 * 24, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.hours), func(t *testing.T) {
+			res, err := db.FindExpiringSubjects(tt.hours)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(res) != tt.want {
+				t.Errorf("FindExpiringSubjects(%d) = %d subjects, want %d", tt.hours, len(res), tt.want)
+			}
+
+			for i := 1; i < len(res); i++ {
+				if res[i].NotAfter.Before(res[i-1].NotAfter) {
+					t.Errorf("%s expires before %s, but comes after it", res[i].Subject, res[i-1].Subject)
+				}
+			}
+		})
+	}
+}
+
+func TestBoltRevisions(t *testing.T) {
+	tests := []struct {
+		name   string
+		update func(db *BoltDB, s *Subject, rev int64) error
+
+		// stale is returned by an update once a subject has changed
+		stale error
+	}{
+		{"cert", func(db *BoltDB, s *Subject, rev int64) error {
+			cert, na := "certificate", time.Now()
+			return db.UpdateSubjCert(&s.CertID, rev, &cert, &na, big.NewInt(1))
+		}, ErrConflict},
+		{"unreachable", func(db *BoltDB, s *Subject, rev int64) error {
+			return db.UpdateUnreachable(&CheckCertEvent{ID: s.ID.Hex(), Revision: rev, Targets: []string{"10.0.0.1"}})
+		}, ErrConflict},
+		{"key", func(db *BoltDB, s *Subject, rev int64) error {
+			return db.UpdateSubjKey(s.ID.Hex(), rev, &EncryptedKey{KeyID: "k"})
+		}, ErrConflict},
+		{"delete", func(db *BoltDB, s *Subject, rev int64) error {
+			return db.DeleteSubject(s.ID.Hex(), s.CertID, rev, &Tombstone{At: time.Now()})
+		}, ErrSubjectNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestBolt(t)
+
+			s := &Subject{Subject: "a.example.com", CertID: 1}
+			if err := db.InsertSubject(s); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := tt.update(db, s, s.Revision+1); err != ErrConflict {
+				t.Errorf("update of a newer revision = %v, want %v", err, ErrConflict)
+			}
+
+			if err := tt.update(db, s, s.Revision); err != nil {
+				t.Fatal(err)
+			}
+
+			// the update has bumped the revision it was read with
+			if err := tt.update(db, s, s.Revision); err != tt.stale {
+				t.Errorf("update of a stale revision = %v, want %v", err, tt.stale)
+			}
+
+			found, err := db.FindSubjectByCertID(s.CertID)
+			if err != nil && err != ErrSubjectNotFound {
+				t.Fatal(err)
+			}
+
+			if err == nil && found.Revision != s.Revision+1 {
+				t.Errorf("revision = %d, want %d", found.Revision, s.Revision+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package londo
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// BundleVersion changes whenever Bundle layout does
+	BundleVersion = 1
+
+	bundleFormat = "londo-bundle"
+
+	PassphraseMethod = "scrypt"
+	PublicKeyMethod  = "rsa-oaep"
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	saltSize = 16
+)
+
+var ErrBundleKey = errors.New("either a passphrase or a key is required")
+
+// Bundle is a complete inventory of an installation. Private keys are in plain text,
+// so a bundle is only ever written to disk sealed.
+type Bundle struct {
+	Version       int
+	CreatedAt     time.Time
+	Source        string
+	SchemaVersion int
+	Subjects      []Subject
+	Certificates  []CertRecord
+}
+
+// ExportItem is one reply to DbExportCmd. Items carry either a subject or a certificate record,
+// and the last one carries a schema version of the database.
+type ExportItem struct {
+	Subject       *Subject    `json:",omitempty"`
+	Record        *CertRecord `json:",omitempty"`
+	SchemaVersion int         `json:",omitempty"`
+}
+
+func (ExportItem) EventName() string {
+	return "db.export.item"
+}
+
+// ImportEvent asks londo-dbd to load a bundle. With Replace, existing subjects which conflict
+// with imported ones are removed, otherwise imported subjects are skipped.
+type ImportEvent struct {
+	Replace       bool
+	SchemaVersion int
+	Subjects      []Subject
+	Certificates  []CertRecord
+}
+
+func (ImportEvent) EventName() string {
+	return "db.import"
+}
+
+// ImportConflict tells which fields of an imported subject are already taken
+type ImportConflict struct {
+	Subject string
+	CertID  int
+	Fields  []string
+}
+
+type ImportReport struct {
+	Imported  int
+	Replaced  int
+	Skipped   int
+	Records   int
+	Conflicts []ImportConflict
+}
+
+func (ImportReport) EventName() string {
+	return "db.import.report"
+}
+
+// sealedBundle is how a bundle is stored on disk
+type sealedBundle struct {
+	Format     string `json:"format"`
+	Version    int    `json:"version"`
+	Method     string `json:"method"`
+	Salt       []byte `json:"salt,omitempty"`
+	N          int    `json:"n,omitempty"`
+	R          int    `json:"r,omitempty"`
+	P          int    `json:"p,omitempty"`
+	WrappedKey []byte `json:"wrapped_key,omitempty"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// ad binds a header to its ciphertext, so a method can't be swapped
+func (sb *sealedBundle) ad() []byte {
+	return []byte(sb.Format + "/" + strconv.Itoa(sb.Version) + "/" + sb.Method)
+}
+
+// SealBundle encrypts a bundle with a key derived from a passphrase, or with a random key
+// wrapped by an RSA public key in PEM format.
+func SealBundle(b *Bundle, passphrase []byte, pubKey []byte) ([]byte, error) {
+	plain, err := json.Marshal(b)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := sealedBundle{Format: bundleFormat, Version: b.Version}
+	var key []byte
+
+	switch {
+	case len(passphrase) != 0:
+		sb.Method = PassphraseMethod
+		sb.N, sb.R, sb.P = scryptN, scryptR, scryptP
+
+		sb.Salt = make([]byte, saltSize)
+		if _, err := io.ReadFull(rand.Reader, sb.Salt); err != nil {
+			return nil, err
+		}
+
+		if key, err = scrypt.Key(passphrase, sb.Salt, sb.N, sb.R, sb.P, kekSize); err != nil {
+			return nil, err
+		}
+
+	case len(pubKey) != 0:
+		sb.Method = PublicKeyMethod
+
+		pub, err := parseRSAPublicKey(pubKey)
+		if err != nil {
+			return nil, err
+		}
+
+		key = make([]byte, kekSize)
+		if _, err := io.ReadFull(rand.Reader, key); err != nil {
+			return nil, err
+		}
+
+		if sb.WrappedKey, err = rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, sb.ad()); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, ErrBundleKey
+	}
+
+	if sb.Ciphertext, err = gcmSeal(key, plain, sb.ad()); err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(&sb, "", "  ")
+}
+
+// OpenBundle decrypts a bundle sealed by SealBundle
+func OpenBundle(data []byte, passphrase []byte, privKey []byte) (*Bundle, error) {
+	var sb sealedBundle
+	if err := json.Unmarshal(data, &sb); err != nil {
+		return nil, err
+	}
+
+	if sb.Format != bundleFormat {
+		return nil, errors.New("not a " + bundleFormat + " file")
+	}
+
+	if sb.Version > BundleVersion {
+		return nil, errors.New("bundle version " + strconv.Itoa(sb.Version) +
+			" is newer than supported " + strconv.Itoa(BundleVersion))
+	}
+
+	var (
+		key []byte
+		err error
+	)
+
+	switch sb.Method {
+	case PassphraseMethod:
+		if len(passphrase) == 0 {
+			return nil, errors.New("bundle is sealed with a passphrase")
+		}
+
+		if key, err = scrypt.Key(passphrase, sb.Salt, sb.N, sb.R, sb.P, kekSize); err != nil {
+			return nil, err
+		}
+
+	case PublicKeyMethod:
+		if len(privKey) == 0 {
+			return nil, errors.New("bundle is sealed with a public key")
+		}
+
+		priv, err := parseRSAPrivateKey(privKey)
+		if err != nil {
+			return nil, err
+		}
+
+		if key, err = rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, sb.WrappedKey, sb.ad()); err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, errors.New("unknown bundle method " + sb.Method)
+	}
+
+	plain, err := gcmOpen(key, sb.Ciphertext, sb.ad())
+	if err != nil {
+		return nil, errors.New("cannot decrypt bundle, wrong passphrase or key")
+	}
+
+	var b Bundle
+	if err := json.Unmarshal(plain, &b); err != nil {
+		return nil, err
+	}
+
+	return &b, nil
+}
+
+func parseRSAPublicKey(k []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(k)
+	if block == nil {
+		return nil, errors.New("failed to parse public key")
+	}
+
+	if block.Type == "RSA PUBLIC KEY" {
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	}
+
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaPub, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("public key is not an RSA key")
+	}
+
+	return rsaPub, nil
+}
+
+// parseRSAPrivateKey accepts both PKCS#1 and PKCS#8 keys, as written by different openssl versions
+func parseRSAPrivateKey(k []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(k)
+	if block == nil {
+		return nil, errors.New("failed to parse private key")
+	}
+
+	if priv, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return priv, nil
+	}
+
+	priv, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaPriv, ok := priv.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+
+	return rsaPriv, nil
+}
+
+// exportItems collects every subject, deleted ones included, with private keys in plain text,
+// and every certificate record.
+func (l *Londo) exportItems() ([]ExportItem, error) {
+	subjs, err := l.Db.FindAllSubjects()
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := l.Db.FindDeletedSubjects()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := l.Db.FindAllCertRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := l.Db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []ExportItem
+
+	for _, s := range append(subjs, deleted...) {
+		pkey, err := l.Keys.Reveal(s)
+		if err != nil {
+			return nil, errors.New(s.Subject + ": " + err.Error())
+		}
+
+		s.PrivateKey = pkey
+		s.EncryptedKey = nil
+
+		items = append(items, ExportItem{Subject: s})
+	}
+
+	for i := range records {
+		items = append(items, ExportItem{Record: &records[i]})
+	}
+
+	return append(items, ExportItem{SchemaVersion: schema}), nil
+}
+
+// importBundle loads subjects and certificate records. Private keys are sealed with an active
+// key encryption key, so a bundle can move between installations with different keys.
+func (l *Londo) importBundle(e *ImportEvent) (ImportReport, error) {
+	var r ImportReport
+
+	current, err := l.Db.SchemaVersion()
+	if err != nil {
+		return r, err
+	}
+
+	if e.SchemaVersion > current {
+		return r, &RPCError{Code: InvalidCode, Name: "schema_version", Err: errors.New("bundle schema version " +
+			strconv.Itoa(e.SchemaVersion) + " is newer than database schema version " + strconv.Itoa(current))}
+	}
+
+	for i := range e.Subjects {
+		s := &e.Subjects[i]
+
+		// a bundle of an older installation is brought up to a schema of this one
+		if err := migrateSubject(s, e.SchemaVersion, current); err != nil {
+			return r, errors.New(s.Subject + ": " + err.Error())
+		}
+
+		s.ID = primitive.NewObjectID()
+
+		if l.Keys != nil && s.PrivateKey != "" {
+			k, err := l.Keys.Seal(s.Subject, s.PrivateKey)
+			if err != nil {
+				return r, err
+			}
+
+			s.PrivateKey = ""
+			s.EncryptedKey = k
+		}
+
+		fields, err := l.Db.ImportSubject(s, e.Replace)
+		if err != nil {
+			return r, errors.New(s.Subject + ": " + err.Error())
+		}
+
+		switch {
+		case len(fields) == 0:
+			r.Imported++
+		case e.Replace:
+			r.Replaced++
+		default:
+			r.Skipped++
+		}
+
+		if len(fields) != 0 {
+			r.Conflicts = append(r.Conflicts, ImportConflict{Subject: s.Subject, CertID: s.CertID, Fields: fields})
+
+			log.WithFields(logrus.Fields{
+				logger.Subject: s.Subject,
+				logger.CertID:  s.CertID,
+				logger.Reason:  fields}).Warn("conflict")
+		}
+	}
+
+	for i := range e.Certificates {
+		ok, err := l.Db.ImportCertRecord(&e.Certificates[i])
+		if err != nil {
+			return r, err
+		}
+
+		if ok {
+			r.Records++
+		}
+	}
+
+	return r, nil
+}
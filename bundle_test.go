@@ -0,0 +1,241 @@
+package londo
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func testBundle() *Bundle {
+	return &Bundle{
+		Version:       BundleVersion,
+		CreatedAt:     time.Now().UTC().Truncate(time.Second),
+		Source:        "test",
+		SchemaVersion: LatestSchemaVersion(),
+		Subjects:      []Subject{{Subject: "a.example.com", CertID: 1, PrivateKey: "private key"}},
+		Certificates:  []CertRecord{{Subject: "a.example.com", Version: 1, CertID: 1}},
+	}
+}
+
+// rsaKeys returns a public key, and its private key, in PEM formats openssl writes
+func rsaKeys(t *testing.T, pkcs1 bool) ([]byte, []byte) {
+	t.Helper()
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pkcs1 {
+		return pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&priv.PublicKey)}),
+			pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)})
+	}
+
+	pub, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func TestBundleRoundTrip(t *testing.T) {
+	pkcs1Pub, pkcs1Priv := rsaKeys(t, true)
+	pkixPub, pkcs8Priv := rsaKeys(t, false)
+
+	tests := []struct {
+		name       string
+		passphrase []byte
+		pub, priv  []byte
+		wantMethod string
+	}{
+		{"passphrase", []byte("secret"), nil, nil, PassphraseMethod},
+		{"pkcs1", nil, pkcs1Pub, pkcs1Priv, PublicKeyMethod},
+		{"pkix and pkcs8", nil, pkixPub, pkcs8Priv, PublicKeyMethod},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := testBundle()
+
+			data, err := SealBundle(b, tt.passphrase, tt.pub)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sb sealedBundle
+			if err := json.Unmarshal(data, &sb); err != nil || sb.Method != tt.wantMethod || sb.Format != bundleFormat {
+				t.Fatalf("sealed bundle = %s %s, %v", sb.Format, sb.Method, err)
+			}
+
+			got, err := OpenBundle(data, tt.passphrase, tt.priv)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Source != b.Source || !got.CreatedAt.Equal(b.CreatedAt) || len(got.Subjects) != 1 || len(got.Certificates) != 1 ||
+				got.Subjects[0].PrivateKey != "private key" {
+				t.Errorf("opened bundle = %+v, want %+v", got, b)
+			}
+		})
+	}
+}
+
+func TestOpenBundleFails(t *testing.T) {
+	pub, priv := rsaKeys(t, false)
+
+	withPassphrase, err := SealBundle(testBundle(), []byte("secret"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	withKey, err := SealBundle(testBundle(), nil, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a header which doesn't match its ciphertext
+	var sb sealedBundle
+	if err := json.Unmarshal(withPassphrase, &sb); err != nil {
+		t.Fatal(err)
+	}
+	sb.N = scryptN / 2
+	tampered, _ := json.Marshal(&sb)
+
+	sb.N = scryptN
+	sb.Version = BundleVersion + 1
+	newer, _ := json.Marshal(&sb)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase []byte
+		priv       []byte
+	}{
+		{"wrong passphrase", withPassphrase, []byte("guess"), nil},
+		{"no passphrase", withPassphrase, nil, priv},
+		{"no key", withKey, []byte("secret"), nil},
+		{"tampered", tampered, []byte("secret"), nil},
+		{"newer", newer, []byte("secret"), nil},
+		{"not a bundle", []byte(`{"format": "tar"}`), []byte("secret"), nil},
+		{"not json", []byte("PK"), []byte("secret"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := OpenBundle(tt.data, tt.passphrase, tt.priv); err == nil {
+				t.Error("OpenBundle() succeeded")
+			}
+		})
+	}
+
+	if _, err := SealBundle(testBundle(), nil, nil); err != ErrBundleKey {
+		t.Errorf("SealBundle() without a key = %v, want %v", err, ErrBundleKey)
+	}
+}
+
+// TestExportImport moves subjects between installations with different key encryption keys
+func TestExportImport(t *testing.T) {
+	src := newTestDbd(t)
+	src.Keys = newTestKeyRing(t, newKEK(t))
+
+	k, err := src.Keys.Seal("a.example.com", "private key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, s := range []*Subject{
+		{Subject: "a.example.com", CertID: 1, EncryptedKey: k},
+		{Subject: "b.example.com", CertID: 2, PrivateKey: "plain key", Deleted: &Tombstone{At: time.Now()}},
+	} {
+		if err := src.Db.InsertSubject(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := src.Db.InsertCertRecord(&CertRecord{Subject: "a.example.com", CertID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := src.exportItems()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := ImportEvent{SchemaVersion: items[len(items)-1].SchemaVersion}
+	for _, i := range items {
+		switch {
+		case i.Subject != nil:
+			e.Subjects = append(e.Subjects, *i.Subject)
+		case i.Record != nil:
+			e.Certificates = append(e.Certificates, *i.Record)
+		}
+	}
+
+	dst := newTestDbd(t)
+	dst.Keys = newTestKeyRing(t, newKEK(t))
+
+	tests := []struct {
+		name    string
+		replace bool
+		want    ImportReport
+	}{
+		{"new", false, ImportReport{Imported: 2, Records: 1}},
+		{"again", false, ImportReport{Skipped: 2}},
+		{"replace", true, ImportReport{Replaced: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ev := e
+			ev.Replace = tt.replace
+			ev.Subjects = append([]Subject{}, e.Subjects...)
+			ev.Certificates = append([]CertRecord{}, e.Certificates...)
+
+			r, err := dst.importBundle(&ev)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if r.Imported != tt.want.Imported || r.Replaced != tt.want.Replaced || r.Skipped != tt.want.Skipped || r.Records != tt.want.Records {
+				t.Errorf("report = %+v, want %+v", r, tt.want)
+			}
+
+			if len(r.Conflicts) != tt.want.Skipped+tt.want.Replaced {
+				t.Errorf("conflicts = %+v", r.Conflicts)
+			}
+
+			s, err := dst.Db.FindSubject("a.example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if s.PrivateKey != "" || s.EncryptedKey == nil || s.EncryptedKey.KeyID != dst.Keys.ActiveID() {
+				t.Error("an imported key isn't sealed with a key of the installation")
+			}
+
+			if pkey, err := dst.Keys.Reveal(&s); err != nil || pkey != "private key" {
+				t.Errorf("imported key = %q, %v", pkey, err)
+			}
+		})
+	}
+
+	if deleted, err := dst.Db.FindDeletedSubjects(); err != nil || len(deleted) != 1 {
+		t.Errorf("deleted subjects = %d, %v, want 1", len(deleted), err)
+	}
+
+	e.SchemaVersion = LatestSchemaVersion() + 1
+	if _, err := dst.importBundle(&e); err == nil {
+		t.Error("a bundle of a newer schema was imported")
+	}
+}
@@ -0,0 +1,62 @@
+package londo
+
+import (
+	"github.com/streadway/amqp"
+)
+
+// Transports a Bus can be connected through, transport of config selects one
+const (
+	AMQPTransport = "amqp"
+	NATSTransport = "nats"
+)
+
+// Bus carries messages between londo daemons. AMQP talks to RabbitMQ, NATS to NATS JetStream, and
+// MemoryBus keeps everything within a single process. All route through direct exchanges by a
+// routing key, and deliveries are acknowledged, rejected and requeued the same way.
+type Bus interface {
+	// DeclareExchange declares a direct exchange
+	DeclareExchange(exchange string, kind string) error
+
+	// Declare declares an exchange and a durable queue bound to it with a routing key of the queue name
+	Declare(exchange string, queue string, kind string, args amqp.Table) error
+
+	// DeclareQueue declares a durable queue which isn't bound to any exchange, i.e. a delay queue
+	DeclareQueue(queue string, args amqp.Table) error
+
+	// DeclareReplyQueue declares a queue which only lives as long as its declaring daemon
+	DeclareReplyQueue(exchange string, queue string) error
+
+	// Emit publishes a message, a message which can't be routed to any queue is an error
+	Emit(exchange string, key string, msg amqp.Publishing) error
+
+	// Consume passes deliveries to a pool of workers running f, until f returns true
+	Consume(queue string, p Pool, f func(d amqp.Delivery) bool)
+
+	// Drain gets up to max messages from a queue, zero max is all of them. A message is acknowledged
+	// when f returns true, otherwise it is put back once all messages are read.
+	Drain(queue string, max int, f func(d *amqp.Delivery) bool) error
+
+	// Purge drops every message of a queue
+	Purge(queue string) (int, error)
+
+	// Count tells how many messages of a queue wait for a consumer
+	Count(queue string) (int, error)
+
+	// Ready reports whether messages can be published and consumed
+	Ready() bool
+
+	// Stop stops deliveries to every consumer, Consume returns once deliveries being handled are done.
+	// Consumers of reply queues go on until Shutdown, so calls still in progress get their replies.
+	Stop()
+
+	Shutdown()
+}
+
+func isDone(done chan struct{}) bool {
+	select {
+	case <-done:
+		return true
+	default:
+		return false
+	}
+}
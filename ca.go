@@ -0,0 +1,96 @@
+package londo
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+const (
+	SectigoCA = "sectigo"
+)
+
+// Order identifies a certificate a CA was asked for. OrderID is whatever else a CA needs to
+// renew it, if anything.
+type Order struct {
+	CertID  int
+	OrderID string
+}
+
+// IssuedCert is a certificate a CA knows of
+type IssuedCert struct {
+	CertID  int
+	Subject string
+	Serial  string
+}
+
+// CAProvider is a certificate authority certificates are ordered from. Consumers only talk to it,
+// so another CA only needs another implementation. Calls which a CA has answered with an error
+// return a CAError, IsRefused tells which failures happened before a CA could act on a call.
+type CAProvider interface {
+	Enroll(s *Subject) (Order, error)
+	Collect(certId int) (string, error)
+	Renew(certId int) (Order, error)
+	Revoke(certId int, reason string) error
+	List() ([]IssuedCert, error)
+	Stop()
+}
+
+// CAError means a CA has answered a call with an error status. A client error status means it has
+// refused a call, a server error may have come after a CA has acted on it.
+type CAError struct {
+	Status int
+	Err    error
+}
+
+func (e *CAError) Error() string {
+	return e.Err.Error()
+}
+
+// IsRefused tells whether a CA has certainly not acted on a call, either as it has refused it,
+// or as a call was never made as a CA couldn't be reached
+func IsRefused(err error) bool {
+	if err == ErrStopped {
+		return true
+	}
+
+	if u, ok := err.(*url.Error); ok {
+		err = u.Err
+	}
+
+	switch e := err.(type) {
+	case *CAError:
+		return e.Status >= 400 && e.Status < 500
+	case *net.OpError:
+		return e.Op == "dial"
+	case *net.DNSError:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewCAProvider makes a client of a CA selected by configuration file, Sectigo when nothing
+// was specified
+func NewCAProvider(c *Config, b Bus) (CAProvider, error) {
+	switch c.CA {
+	case "", SectigoCA:
+		r, err := NewRestClient(c, b)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+
+	default:
+		return nil, errors.New("unknown certificate authority " + c.CA)
+	}
+}
+
+func caError(status int, msg string) error {
+	return &CAError{Status: status, Err: errors.New(msg)}
+}
+
+func statusError(status int) error {
+	return caError(status, "unhandled http error, status code: "+strconv.Itoa(status))
+}
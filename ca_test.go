@@ -0,0 +1,71 @@
+package londo
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestIsRefused(t *testing.T) {
+	dial := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	read := &net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection reset by peer")}
+	dns := &net.DNSError{Err: "no such host", Name: "cert-manager.com"}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"stopped", ErrStopped, true},
+		{"bad request", caError(400, "bad request"), true},
+		{"unauthorized", caError(401, "unauthorized"), true},
+		{"too many requests", caError(429, "too many requests"), true},
+		{"server error", caError(500, "server error"), false},
+		{"bad gateway", statusError(502), false},
+		{"unknown status", statusError(302), false},
+		{"dial", dial, true},
+		{"dial through a request", &url.Error{Op: "Post", URL: "https://cert-manager.com", Err: dial}, true},
+		{"dns", &url.Error{Op: "Post", URL: "https://cert-manager.com", Err: &net.OpError{Op: "dial", Err: dns}}, true},
+		{"bare dns", dns, true},
+		{"connection reset", &url.Error{Op: "Post", URL: "https://cert-manager.com", Err: read}, false},
+		{"unparsable response", errors.New("invalid character"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRefused(tt.err); got != tt.want {
+				t.Errorf("IsRefused(%v) = %t, want %t", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewCAProvider(t *testing.T) {
+	tests := []struct {
+		ca      string
+		wantErr bool
+	}{
+		{"", false},
+		{SectigoCA, false},
+		{"letsencrypt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ca, func(t *testing.T) {
+			ca, err := NewCAProvider(&Config{CA: tt.ca}, newTestBus(t))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewCAProvider() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+			defer ca.Stop()
+
+			if _, ok := ca.(*RestAPI); !ok {
+				t.Errorf("NewCAProvider() = %T, want a Sectigo client", ca)
+			}
+		})
+	}
+}
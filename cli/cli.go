@@ -3,6 +3,7 @@ package cli
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"fmt"
 	"google.golang.org/grpc/credentials"
 	"io"
@@ -24,6 +25,9 @@ import (
 
 const (
 	Copyright = "(c) 2019 Alex Yermolaev, MIT License"
+
+	// BundlePassphraseEnvVar is used by export and import when no passphrase file was given
+	BundlePassphraseEnvVar = "LONDO_BUNDLE_PASSPHRASE"
 )
 
 var (
@@ -205,6 +209,7 @@ func DeleteSubject(c *cli.Context) error {
 	DoRequest(c, func(client londopb.CertServiceClient) error {
 		req := &londopb.DeleteSubjectRequest{
 			Subject: c.Args().First(),
+			Reason:  c.String("reason"),
 		}
 
 		res, err := client.DeleteSubject(context.Background(), req)
@@ -220,6 +225,31 @@ func DeleteSubject(c *cli.Context) error {
 	return nil
 }
 
+func RestoreSubject(c *cli.Context) error {
+	if !c.Args().Present() {
+		return argErr
+	}
+
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		req := &londopb.RestoreSubjectRequest{
+			Subject: c.Args().First(),
+		}
+
+		res, err := client.RestoreSubject(context.Background(), req)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("%s restored", res.GetSubject())
+
+		if res.GetRevoked() {
+			log.Warnf("certificate of %s was revoked, renew it", res.GetSubject())
+		}
+
+		return nil
+	})
+}
+
 func RenewSubject(c *cli.Context) {
 	if !c.Args().Present() {
 		return
@@ -293,6 +323,58 @@ func GetExpiringSubjects(c *cli.Context) {
 	})
 }
 
+func GetSubjectHistory(c *cli.Context) error {
+	if !c.Args().Present() {
+		return argErr
+	}
+
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		req := &londopb.GetSubjectHistoryRequest{
+			Subject: c.Args().First(),
+		}
+
+		stream, err := client.GetSubjectHistory(context.Background(), req)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			r := msg.GetRecord()
+
+			y := CertificateRecord{
+				Version:          r.GetVersion(),
+				CertID:           r.GetCertId(),
+				OrderID:          r.GetOrderId(),
+				Serial:           r.GetSerial(),
+				NotBefore:        formatUnix(r.GetNotBefore()),
+				NotAfter:         formatUnix(r.GetNotAfter()),
+				IssuedAt:         formatUnix(r.GetIssuedAt()),
+				RevokedAt:        formatUnix(r.GetRevokedAt()),
+				RevocationReason: r.GetRevocationReason(),
+				KeyFingerprint:   r.GetKeyFingerprint(),
+			}
+
+			s, err := yaml.Marshal(&y)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Println(string(s))
+		}
+
+		return nil
+	})
+}
+
 func GetSubject(c *cli.Context) {
 	arg := c.Args().First()
 
@@ -361,6 +443,508 @@ func GetSubject(c *cli.Context) {
 	})
 }
 
+func GetAuditLog(c *cli.Context) error {
+	req := &londopb.GetAuditLogRequest{
+		Actor: c.String("actor"),
+	}
+
+	for _, f := range []struct {
+		name string
+		dst  *int64
+	}{{"from", &req.From}, {"to", &req.To}} {
+		if c.String(f.name) == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, c.String(f.name))
+		if err != nil {
+			return cli.NewExitError("--"+f.name+" must be in RFC3339 format, e.g. 2019-09-01T00:00:00Z", 1)
+		}
+		*f.dst = t.Unix()
+	}
+
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		stream, err := client.GetAuditLog(context.Background(), req)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			e := msg.GetEntry()
+
+			y := AuditEntry{
+				Timestamp: formatUnix(e.GetTimestamp()),
+				Actor:     e.GetActor(),
+				SourceIP:  e.GetSourceIp(),
+				Action:    e.GetAction(),
+				Subject:   e.GetSubject(),
+				Outcome:   e.GetOutcome(),
+				Reason:    e.GetReason(),
+			}
+
+			s, err := yaml.Marshal(&y)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Println(string(s))
+		}
+
+		return nil
+	})
+}
+
+func ListSubjects(c *cli.Context) error {
+	req := &londopb.ListSubjectsRequest{
+		Name:       c.Args().First(),
+		AltName:    c.String("alt"),
+		Target:     c.String("target"),
+		Descending: c.Bool("desc"),
+		PageSize:   int32(c.Int("limit")),
+		PageToken:  c.String("page-token"),
+		Deleted:    c.Bool("deleted"),
+	}
+
+	for _, f := range []struct {
+		name string
+		dst  *londopb.Filter
+	}{{"match", &req.Match}, {"outdated", &req.Outdated}, {"unresolvable", &req.Unresolvable}} {
+		switch c.String(f.name) {
+		case "":
+		case "yes":
+			*f.dst = londopb.Filter_ONLY
+		case "no":
+			*f.dst = londopb.Filter_EXCLUDE
+		default:
+			return cli.NewExitError("--"+f.name+" must be either yes or no", 1)
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		dst  *int64
+	}{
+		{"expires-after", &req.ExpiresAfter},
+		{"expires-before", &req.ExpiresBefore},
+		{"created-after", &req.CreatedAfter},
+		{"created-before", &req.CreatedBefore},
+	} {
+		if c.String(f.name) == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, c.String(f.name))
+		if err != nil {
+			return cli.NewExitError("--"+f.name+" must be in RFC3339 format, e.g. 2019-09-01T00:00:00Z", 1)
+		}
+		*f.dst = t.Unix()
+	}
+
+	switch c.String("sort") {
+	case "", "subject":
+		req.SortBy = londopb.SortField_SUBJECT
+	case "not_after":
+		req.SortBy = londopb.SortField_NOT_AFTER
+	case "created_at":
+		req.SortBy = londopb.SortField_CREATED_AT
+	default:
+		return cli.NewExitError("--sort must be one of subject, not_after or created_at", 1)
+	}
+
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		for {
+			res, err := client.ListSubjects(context.Background(), req)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			for _, ls := range res.GetSubjects() {
+				y := ListedSubject{
+					Subject:        ls.GetSubject(),
+					Port:           ls.GetPort(),
+					CertID:         ls.GetCertId(),
+					Serial:         ls.GetSerial(),
+					NotAfter:       formatUnix(ls.GetNotAfter()),
+					CreatedAt:      formatUnix(ls.GetCreatedAt()),
+					UpdatedAt:      formatUnix(ls.GetUpdatedAt()),
+					UnresolvableAt: formatUnix(ls.GetUnresolvableAt()),
+					Match:          ls.GetMatch(),
+					AltNames:       ls.GetAltNames(),
+					Targets:        ls.GetTargets(),
+					Outdated:       ls.GetOutdated(),
+					DeletedAt:      formatUnix(ls.GetDeletedAt()),
+					DeletedReason:  ls.GetDeletedReason(),
+					DeletedBy:      ls.GetDeletedBy(),
+				}
+
+				s, err := yaml.Marshal(&y)
+				if err != nil {
+					log.Fatal(err)
+				}
+
+				fmt.Println(string(s))
+			}
+
+			if res.GetNextPageToken() == "" {
+				return nil
+			}
+
+			if !c.Bool("all") {
+				fmt.Printf("# next page: --page-token %s\n", res.GetNextPageToken())
+				return nil
+			}
+
+			req.PageToken = res.GetNextPageToken()
+		}
+	})
+}
+
+// Export writes every subject, with its private key and certificate history, to a sealed bundle
+func Export(c *cli.Context) error {
+	if !c.Args().Present() {
+		return argErr
+	}
+
+	passphrase, pubKey, err := bundleKeys(c, "public-key")
+	if err != nil {
+		return err
+	}
+
+	b := londo.Bundle{
+		Version:   londo.BundleVersion,
+		CreatedAt: time.Now(),
+		Source:    server.String,
+	}
+
+	if err := DoRequest(c, func(client londopb.CertServiceClient) error {
+		stream, err := client.ExportSubjects(context.Background(), &londopb.ExportSubjectsRequest{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			var it londo.ExportItem
+			if err := json.Unmarshal(msg.GetItem(), &it); err != nil {
+				log.Fatal(err)
+			}
+
+			switch {
+			case it.Subject != nil:
+				b.Subjects = append(b.Subjects, *it.Subject)
+			case it.Record != nil:
+				b.Certificates = append(b.Certificates, *it.Record)
+			default:
+				b.SchemaVersion = it.SchemaVersion
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	sealed, err := londo.SealBundle(&b, passphrase, pubKey)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	if err := ioutil.WriteFile(c.Args().First(), sealed, 0600); err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	log.Infof("exported %d subjects and %d certificates to %s",
+		len(b.Subjects), len(b.Certificates), c.Args().First())
+	return nil
+}
+
+// Import loads a sealed bundle, and prints subjects which conflicted with existing ones
+func Import(c *cli.Context) error {
+	if !c.Args().Present() {
+		return argErr
+	}
+
+	passphrase, privKey, err := bundleKeys(c, "private-key")
+	if err != nil {
+		return err
+	}
+
+	data, err := ioutil.ReadFile(c.Args().First())
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	b, err := londo.OpenBundle(data, passphrase, privKey)
+	if err != nil {
+		return cli.NewExitError(err, 1)
+	}
+
+	log.Infof("bundle of %d subjects from %s, created %s", len(b.Subjects), b.Source, b.CreatedAt)
+
+	var items []londo.ExportItem
+
+	for i := range b.Subjects {
+		items = append(items, londo.ExportItem{Subject: &b.Subjects[i]})
+	}
+
+	for i := range b.Certificates {
+		items = append(items, londo.ExportItem{Record: &b.Certificates[i]})
+	}
+
+	items = append(items, londo.ExportItem{SchemaVersion: b.SchemaVersion})
+
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		stream, err := client.ImportSubjects(context.Background())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		for _, it := range items {
+			item, err := json.Marshal(&it)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if err := stream.Send(&londopb.ImportSubjectsRequest{
+				Replace: c.Bool("replace"),
+				Item:    item,
+			}); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		res, err := stream.CloseAndRecv()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		y := ImportReport{
+			Imported: res.GetImported(),
+			Replaced: res.GetReplaced(),
+			Skipped:  res.GetSkipped(),
+			Records:  res.GetRecords(),
+		}
+
+		for _, cf := range res.GetConflicts() {
+			y.Conflicts = append(y.Conflicts, ImportConflict{
+				Subject: cf.GetSubject(),
+				CertID:  cf.GetCertId(),
+				Fields:  cf.GetFields(),
+			})
+		}
+
+		out, err := yaml.Marshal(&y)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(string(out))
+		return nil
+	})
+}
+
+// bundleKeys reads a passphrase from a file or environment, or an RSA key named by keyFlag
+func bundleKeys(c *cli.Context, keyFlag string) ([]byte, []byte, error) {
+	if f := c.String("passphrase-file"); f != "" {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, nil, cli.NewExitError(err, 1)
+		}
+		return []byte(strings.TrimRight(string(b), "\r\n")), nil, nil
+	}
+
+	if p := os.Getenv(BundlePassphraseEnvVar); p != "" {
+		return []byte(p), nil, nil
+	}
+
+	if f := c.String(keyFlag); f != "" {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, nil, cli.NewExitError(err, 1)
+		}
+		return nil, b, nil
+	}
+
+	return nil, nil, cli.NewExitError("specify --passphrase-file, --"+keyFlag+" or "+BundlePassphraseEnvVar, 1)
+}
+
+func MigrateSchema(c *cli.Context) error {
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		req := &londopb.MigrateSchemaRequest{DryRun: c.Bool("dry-run")}
+
+		stream, err := client.MigrateSchema(context.Background(), req)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var count int
+
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			r := msg.GetReport()
+			count++
+
+			y := MigrationReport{
+				Version:     r.GetVersion(),
+				Description: r.GetDescription(),
+				Applied:     r.GetApplied(),
+				Subjects:    r.GetSubjects(),
+			}
+
+			s, err := yaml.Marshal(&y)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Println(string(s))
+		}
+
+		if count == 0 {
+			log.Info("schema is up to date")
+		}
+
+		return nil
+	})
+}
+
+func RewrapKeys(c *cli.Context) error {
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		res, err := client.RewrapKeys(context.Background(), &londopb.RewrapKeysRequest{})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Info(res.GetStatus())
+
+		return nil
+	})
+}
+
+func ListDeadLetters(c *cli.Context) error {
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		req := &londopb.ListDeadLettersRequest{Queue: c.String("queue"), Limit: int32(c.Int("limit"))}
+
+		stream, err := client.ListDeadLetters(context.Background(), req)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var count int
+
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF {
+				break
+			}
+
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			l := msg.GetLetter()
+			count++
+
+			y := DeadLetter{
+				Queue:    l.GetQueue(),
+				Type:     l.GetType(),
+				Attempts: l.GetAttempts(),
+				Error:    l.GetError(),
+				FailedAt: formatUnix(l.GetFailedAt()),
+			}
+
+			if c.Bool("body") {
+				y.Body = string(l.GetBody())
+			}
+
+			s, err := yaml.Marshal(&y)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			fmt.Println(string(s))
+		}
+
+		if count == 0 {
+			log.Info("no dead letters")
+		}
+
+		return nil
+	})
+}
+
+func ReplayDeadLetters(c *cli.Context) error {
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		res, err := client.ReplayDeadLetters(context.Background(), &londopb.ReplayDeadLettersRequest{
+			Queue: c.String("queue"),
+			Limit: int32(c.Int("limit")),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("replayed %d dead letters", res.GetCount())
+		return nil
+	})
+}
+
+func PurgeDeadLetters(c *cli.Context) error {
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		res, err := client.PurgeDeadLetters(context.Background(), &londopb.PurgeDeadLettersRequest{
+			Queue: c.String("queue"),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("purged %d dead letters", res.GetCount())
+		return nil
+	})
+}
+
+func ResolveEnrollment(c *cli.Context) error {
+	if !c.Args().Present() {
+		return argErr
+	}
+
+	return DoRequest(c, func(client londopb.CertServiceClient) error {
+		res, err := client.ResolveEnrollment(context.Background(), &londopb.ResolveEnrollmentRequest{
+			Subject: c.Args().First(),
+			CertId:  int32(c.Int("cert-id")),
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Infof("enrollment of %s is %s, replay its dead letters", res.GetSubject(), res.GetState())
+		return nil
+	})
+}
+
 func DoRequest(c *cli.Context, f func(londopb.CertServiceClient) error) error {
 	auth := &authCreds{
 		token: token.String,
@@ -474,6 +1058,84 @@ type ExpiringSubjects struct {
 	NotAfter string `yaml:"not_after"`
 }
 
+type ListedSubject struct {
+	Subject        string   `yaml:"subject"`
+	Port           int32    `yaml:"port"`
+	CertID         int64    `yaml:"cert_id"`
+	Serial         string   `yaml:"serial,omitempty"`
+	NotAfter       string   `yaml:"not_after,omitempty"`
+	CreatedAt      string   `yaml:"created_at"`
+	UpdatedAt      string   `yaml:"updated_at,omitempty"`
+	UnresolvableAt string   `yaml:"unresolvable_at,omitempty"`
+	Match          bool     `yaml:"match"`
+	AltNames       []string `yaml:"alt_names,omitempty"`
+	Targets        []string `yaml:"targets,omitempty"`
+	Outdated       []string `yaml:"outdated,omitempty"`
+	DeletedAt      string   `yaml:"deleted_at,omitempty"`
+	DeletedReason  string   `yaml:"deleted_reason,omitempty"`
+	DeletedBy      string   `yaml:"deleted_by,omitempty"`
+}
+
+type CertificateRecord struct {
+	Version          int32  `yaml:"version"`
+	CertID           int64  `yaml:"cert_id"`
+	OrderID          string `yaml:"order_id"`
+	Serial           string `yaml:"serial"`
+	NotBefore        string `yaml:"not_before"`
+	NotAfter         string `yaml:"not_after"`
+	IssuedAt         string `yaml:"issued_at"`
+	RevokedAt        string `yaml:"revoked_at,omitempty"`
+	RevocationReason string `yaml:"revocation_reason,omitempty"`
+	KeyFingerprint   string `yaml:"key_fingerprint"`
+}
+
+type AuditEntry struct {
+	Timestamp string `yaml:"timestamp"`
+	Actor     string `yaml:"actor"`
+	SourceIP  string `yaml:"source_ip,omitempty"`
+	Action    string `yaml:"action"`
+	Subject   string `yaml:"subject,omitempty"`
+	Outcome   string `yaml:"outcome"`
+	Reason    string `yaml:"reason,omitempty"`
+}
+
+type DeadLetter struct {
+	Queue    string `yaml:"queue"`
+	Type     string `yaml:"type,omitempty"`
+	Attempts int32  `yaml:"attempts"`
+	Error    string `yaml:"error"`
+	FailedAt string `yaml:"failed_at,omitempty"`
+	Body     string `yaml:"body,omitempty"`
+}
+
+type ImportConflict struct {
+	Subject string   `yaml:"subject"`
+	CertID  int64    `yaml:"cert_id"`
+	Fields  []string `yaml:"fields"`
+}
+
+type ImportReport struct {
+	Imported  int32            `yaml:"imported"`
+	Replaced  int32            `yaml:"replaced"`
+	Skipped   int32            `yaml:"skipped"`
+	Records   int32            `yaml:"certificates"`
+	Conflicts []ImportConflict `yaml:"conflicts,omitempty"`
+}
+
+type MigrationReport struct {
+	Version     int32    `yaml:"version"`
+	Description string   `yaml:"description"`
+	Applied     bool     `yaml:"applied"`
+	Subjects    []string `yaml:"subjects"`
+}
+
+func formatUnix(t int64) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(t, 0).String()
+}
+
 func DaemonSetup(name string, usage string, action interface{}) *cli.App {
 	app := cli.NewApp()
 
@@ -58,6 +58,9 @@ var (
 			expSubjCmd,
 			renewCmd,
 			scanSubjCmd,
+			historyCmd,
+			listSubjCmd,
+			restoreSubjCmd,
 		},
 	}
 
@@ -88,8 +91,21 @@ var (
 		Name:        "delete",
 		Aliases:     []string{"d", "del"},
 		Usage:       "delete subject",
-		Description: "schedules an existing subject to be removed, and its certificate revoked",
+		Description: "schedules an existing subject to be removed, and its certificate revoked; it can be restored until purged",
 		Action:      londocli.DeleteSubject,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "reason, r",
+				Usage: "`REASON` recorded with deletion and revocation",
+			},
+		},
+	}
+
+	restoreSubjCmd = cli.Command{
+		Name:        "restore",
+		Usage:       "restore a deleted subject",
+		Description: "brings back the most recently deleted subject with a given name, together with its private key",
+		Action:      londocli.RestoreSubject,
 	}
 
 	scanSubjCmd = cli.Command{
@@ -122,6 +138,87 @@ var (
 		Flags:       []cli.Flag{daysFlag},
 	}
 
+	historyCmd = cli.Command{
+		Name:        "history",
+		Aliases:     []string{"hist"},
+		Usage:       "list every certificate issued for a subject",
+		Description: "shows serials, validity and revocation of all certificates, including those of deleted subjects",
+		Action:      londocli.GetSubjectHistory,
+	}
+
+	listSubjCmd = cli.Command{
+		Name:        "list",
+		Aliases:     []string{"ls"},
+		Usage:       "list subjects matching a filter",
+		ArgsUsage:   "[GLOB]",
+		Description: "lists subjects one page at a time, optionally limited to names matching a glob such as *.example.com",
+		Action:      londocli.ListSubjects,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "alt, a",
+				Usage: "only subjects with alternative `HOSTNAME` DNSName",
+			},
+			cli.StringFlag{
+				Name:  "target, t",
+				Usage: "only subjects deployed to target `IP`",
+			},
+			cli.StringFlag{
+				Name:  "match",
+				Usage: "`yes` or no, whether deployed certificates match the issued one",
+			},
+			cli.StringFlag{
+				Name:  "outdated",
+				Usage: "`yes` or no, whether any target still has an old certificate",
+			},
+			cli.StringFlag{
+				Name:  "unresolvable",
+				Usage: "`yes` or no, whether subject failed to resolve",
+			},
+			cli.StringFlag{
+				Name:  "expires-after",
+				Usage: "only certificates expiring at or after `TIME` (RFC3339)",
+			},
+			cli.StringFlag{
+				Name:  "expires-before",
+				Usage: "only certificates expiring before `TIME` (RFC3339)",
+			},
+			cli.StringFlag{
+				Name:  "created-after",
+				Usage: "only subjects created at or after `TIME` (RFC3339)",
+			},
+			cli.StringFlag{
+				Name:  "created-before",
+				Usage: "only subjects created before `TIME` (RFC3339)",
+			},
+			cli.StringFlag{
+				Name:  "sort",
+				Usage: "sort by `FIELD`, one of subject, not_after or created_at",
+				Value: "subject",
+			},
+			cli.BoolFlag{
+				Name:  "desc",
+				Usage: "sort in descending order",
+			},
+			cli.IntFlag{
+				Name:  "limit, l",
+				Usage: "show at most `N` subjects per page",
+				Value: 100,
+			},
+			cli.StringFlag{
+				Name:  "page-token",
+				Usage: "continue from `TOKEN` printed at the end of a previous page",
+			},
+			cli.BoolFlag{
+				Name:  "all",
+				Usage: "fetch every page",
+			},
+			cli.BoolFlag{
+				Name:  "deleted",
+				Usage: "list deleted subjects, which can be restored",
+			},
+		},
+	}
+
 	renewCmd = cli.Command{
 		Name:        "renew",
 		Aliases:     []string{"r"},
@@ -131,6 +228,174 @@ var (
 		Flags:       []cli.Flag{daysFlag},
 	}
 
+	auditCmd = cli.Command{
+		Name:        "audit",
+		Aliases:     []string{"au"},
+		Usage:       "show audit log",
+		Description: "lists who added, deleted, renewed or downloaded subjects, and issued tokens",
+		Action:      londocli.GetAuditLog,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "from, f",
+				Usage: "show entries since `TIME` (RFC3339)",
+			},
+			cli.StringFlag{
+				Name:  "to",
+				Usage: "show entries until `TIME` (RFC3339), defaults to now",
+			},
+			cli.StringFlag{
+				Name:  "actor, a",
+				Usage: "show entries of a single `ACTOR`, i.e. token subject",
+			},
+		},
+	}
+
+	dbCmd = cli.Command{
+		Name:  "db",
+		Usage: "database maintenance",
+		Subcommands: []cli.Command{
+			migrateCmd,
+		},
+	}
+
+	queueFlag = cli.StringFlag{
+		Name:  "queue, q",
+		Usage: "only dead letters of `QUEUE`, i.e. enroll, collect or revoke, all of them otherwise",
+	}
+
+	dlqCmd = cli.Command{
+		Name:        "dlq",
+		Usage:       "inspects and re-drives messages which failed all retries",
+		Description: "a message is dead-lettered once it used up attempts of its queue's retry policy",
+		Subcommands: []cli.Command{
+			dlqListCmd,
+			dlqReplayCmd,
+			dlqPurgeCmd,
+			dlqResolveCmd,
+		},
+	}
+
+	dlqListCmd = cli.Command{
+		Name:    "list",
+		Aliases: []string{"ls"},
+		Usage:   "list dead letters, leaving them in place",
+		Action:  londocli.ListDeadLetters,
+		Flags: []cli.Flag{
+			queueFlag,
+			cli.IntFlag{
+				Name:  "limit, l",
+				Usage: "show at most `N` dead letters",
+			},
+			cli.BoolFlag{
+				Name:  "body, b",
+				Usage: "show message bodies",
+			},
+		},
+	}
+
+	dlqReplayCmd = cli.Command{
+		Name:   "replay",
+		Usage:  "publish dead letters back to their queues with fresh attempts",
+		Action: londocli.ReplayDeadLetters,
+		Flags: []cli.Flag{
+			queueFlag,
+			cli.IntFlag{
+				Name:  "limit, l",
+				Usage: "replay at most `N` dead letters",
+			},
+		},
+	}
+
+	dlqPurgeCmd = cli.Command{
+		Name:   "purge",
+		Usage:  "drop dead letters",
+		Action: londocli.PurgeDeadLetters,
+		Flags:  []cli.Flag{queueFlag},
+	}
+
+	dlqResolveCmd = cli.Command{
+		Name:      "resolve",
+		Usage:     "settle an enroll request dead-lettered in doubt, once its order is checked with a CA",
+		ArgsUsage: "SUBJECT",
+		Description: "without a certificate id a replay orders the request again with its original key and CSR, " +
+			"with one a replay records that certificate and collects it",
+		Action: londocli.ResolveEnrollment,
+		Flags: []cli.Flag{
+			cli.IntFlag{
+				Name:  "cert-id, c",
+				Usage: "the request was ordered as certificate `ID`",
+			},
+		},
+	}
+
+	passphraseFlag = cli.StringFlag{
+		Name:  "passphrase-file",
+		Usage: "read bundle passphrase from `FILE`, " + londocli.BundlePassphraseEnvVar + " is used otherwise",
+	}
+
+	exportCmd = cli.Command{
+		Name:        "export",
+		Usage:       "export all subjects to an encrypted bundle",
+		ArgsUsage:   "FILE",
+		Description: "writes subjects, their private keys, targets and certificate history, sealed with a passphrase or an RSA public key",
+		Action:      londocli.Export,
+		Flags: []cli.Flag{
+			passphraseFlag,
+			cli.StringFlag{
+				Name:  "public-key",
+				Usage: "seal bundle for RSA public key `FILE` in PEM format instead of a passphrase",
+			},
+		},
+	}
+
+	importCmd = cli.Command{
+		Name:        "import",
+		Usage:       "import subjects from an encrypted bundle",
+		ArgsUsage:   "FILE",
+		Description: "subjects conflicting on name or certificate id are skipped and reported, or replace existing ones with --replace",
+		Action:      londocli.Import,
+		Flags: []cli.Flag{
+			passphraseFlag,
+			cli.StringFlag{
+				Name:  "private-key",
+				Usage: "open bundle with RSA private key `FILE` in PEM format",
+			},
+			cli.BoolFlag{
+				Name:  "replace",
+				Usage: "replace existing subjects that conflict with imported ones",
+			},
+		},
+	}
+
+	migrateCmd = cli.Command{
+		Name:        "migrate",
+		Usage:       "apply pending schema migrations",
+		Description: "migrations are applied in order; with --dry-run, subjects that would change are listed instead",
+		Action:      londocli.MigrateSchema,
+		Flags: []cli.Flag{
+			cli.BoolFlag{
+				Name:  "dry-run, n",
+				Usage: "only report which subjects would change",
+			},
+		},
+	}
+
+	keysCmd = cli.Command{
+		Name:    "keys",
+		Aliases: []string{"k"},
+		Usage:   "manages encryption of stored private keys",
+		Subcommands: []cli.Command{
+			rewrapCmd,
+		},
+	}
+
+	rewrapCmd = cli.Command{
+		Name:        "rewrap",
+		Usage:       "re-wrap all private keys with current key encryption key",
+		Description: "run after key encryption key rotation; previous key must still be listed in previous_kek_files",
+		Action:      londocli.RewrapKeys,
+	}
+
 	app *cli.App
 
 	argErr = cli.NewExitError("must specify an argument", 1)
@@ -150,7 +415,7 @@ func init() {
 	app.Copyright = londocli.GetCopyright()
 	app.Authors = []cli.Author{londocli.GetAuthors()}
 
-	app.Commands = []cli.Command{subjCmd, tokenCmd, tgtCmd}
+	app.Commands = []cli.Command{subjCmd, tokenCmd, tgtCmd, keysCmd, auditCmd, dbCmd, exportCmd, importCmd, dlqCmd}
 
 	app.Flags = []cli.Flag{
 		cli.StringFlag{
@@ -65,7 +65,8 @@ func defaultCommand(c *cli.Context) error {
 	}
 
 	return londo.Initialize(name).
-		AMQPConnection().
+		BusConnection().
+		Health().
 		Declare(
 			londo.DbReplyExchange,
 			londo.DbReplyQueue,
@@ -39,8 +39,9 @@ func defaultCommand(c *cli.Context) error {
 	}
 
 	return londo.Initialize(name).
-		AMQPConnection().
-		RestAPIClient().
+		BusConnection().
+		Health().
+		CAClient().
 		Declare(
 			londo.DbReplyExchange,
 			londo.DbReplyQueue,
@@ -49,6 +50,7 @@ func defaultCommand(c *cli.Context) error {
 			londo.CollectExchange,
 			londo.CollectQueue,
 			amqp.ExchangeDirect, nil).
+		DeclareRetries(londo.CollectQueue).
 		ConsumeCollect().
 		Run()
 }
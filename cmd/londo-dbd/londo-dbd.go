@@ -16,11 +16,22 @@ const (
 
 var (
 	app *cli.App
+
+	migrate bool
 )
 
 func init() {
 	app = londocli.DaemonSetup(name, usage, defaultCommand)
 
+	app.Flags = append([]cli.Flag{
+		cli.BoolFlag{
+			Name:        "migrate, m",
+			Usage:       "apply pending schema migrations on startup",
+			EnvVar:      "LONDO_MIGRATE",
+			Destination: &migrate,
+		},
+	}, app.Flags...)
+
 	sort.Sort(cli.FlagsByName(app.Flags))
 }
 
@@ -36,13 +47,21 @@ func defaultCommand(c *cli.Context) error {
 	}
 
 	return londo.Initialize(name).
+		KeyRing().
 		DbService().
-		AMQPConnection().
+		CheckSchema(migrate).
+		BusConnection().
+		Health().
 		Declare(
 			londo.DbReplyExchange,
 			londo.DbReplyQueue,
 			amqp.ExchangeDirect, nil).
+		Declare(
+			londo.RevokeExchange,
+			londo.RevokeQueue,
+			amqp.ExchangeDirect, nil).
 		ConsumeDbRPC().
+		PurgeDeleted().
 		Run()
 
 }
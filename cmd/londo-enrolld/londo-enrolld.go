@@ -37,8 +37,10 @@ func defaultCommand(c *cli.Context) error {
 	}
 
 	return londo.Initialize(name).
-		AMQPConnection().
-		RestAPIClient().
+		BusConnection().
+		Health().
+		KeyRing().
+		CAClient().
 		Declare(
 			londo.DbReplyExchange,
 			londo.DbReplyQueue,
@@ -51,6 +53,11 @@ func defaultCommand(c *cli.Context) error {
 			londo.CollectExchange,
 			londo.CollectQueue,
 			amqp.ExchangeDirect, nil).
+		DeclareExchange(
+			londo.GRPCServerExchange,
+			amqp.ExchangeDirect).
+		DeclareRetries(londo.EnrollQueue).
+		RPCClient().
 		ConsumeEnroll().
 		Run()
 }
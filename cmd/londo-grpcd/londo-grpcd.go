@@ -87,7 +87,9 @@ func defaultCommand(c *cli.Context) error {
 	}
 
 	return londo.Initialize(name).
-		AMQPConnection().
+		KeyRing().
+		BusConnection().
+		Health().
 		Declare(
 			londo.DbReplyExchange,
 			londo.DbReplyQueue,
@@ -99,6 +101,7 @@ func defaultCommand(c *cli.Context) error {
 		DeclareExchange(
 			londo.GRPCServerExchange,
 			amqp.ExchangeDirect).
+		DeclareDeadLetters().
 		GRPCServer().
 		Run()
 }
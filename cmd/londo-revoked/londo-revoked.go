@@ -37,12 +37,18 @@ func defaultCommand(c *cli.Context) error {
 	}
 
 	return londo.Initialize(name).
-		AMQPConnection().
-		RestAPIClient().
+		BusConnection().
+		Health().
+		CAClient().
+		Declare(
+			londo.DbReplyExchange,
+			londo.DbReplyQueue,
+			amqp.ExchangeDirect, nil).
 		Declare(
 			londo.RevokeExchange,
 			londo.RevokeQueue,
 			amqp.ExchangeDirect, nil).
+		DeclareRetries(londo.RevokeQueue).
 		ConsumeRevoke().
 		Run()
 }
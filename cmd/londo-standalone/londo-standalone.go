@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"sort"
+
+	"github.com/alexyermolaev/londo"
+	londocli "github.com/alexyermolaev/londo/cli"
+	"github.com/streadway/amqp"
+	"github.com/urfave/cli"
+)
+
+const (
+	name  = "londo-standalone"
+	usage = "runs every londo daemon in a single process, without a message broker"
+)
+
+var (
+	app *cli.App
+
+	migrate bool
+)
+
+func init() {
+	app = londocli.DaemonSetup(name, usage, defaultCommand)
+
+	hostname, _ := os.Hostname()
+
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{
+			Name:        "migrate, m",
+			Usage:       "apply pending schema migrations on startup",
+			EnvVar:      "LONDO_MIGRATE",
+			Destination: &migrate,
+		},
+		cli.IntFlag{
+			Name:        "hours",
+			Usage:       "specify number of `HOURS` between checks (minutes if debug is on)",
+			Value:       12,
+			Destination: &londo.ScanHours,
+		},
+		cli.IntFlag{
+			Name:        "old, o",
+			Usage:       "number of `HOURS` before subject is considered being too old and gets revoked",
+			EnvVar:      "LONDO_DELETE_HOURS",
+			Value:       168,
+			Destination: &londo.RevokeHours,
+		},
+		cli.StringFlag{
+			Name:        "secret, s",
+			Usage:       "path to `SECRET` file",
+			EnvVar:      "LONDO_SECRET",
+			Value:       "config/secret",
+			Destination: &londo.SFile,
+		},
+		cli.StringFlag{
+			Name:        "crt",
+			Usage:       "path to certificate `FILE`",
+			EnvVar:      "LONDO_CRED_CRT",
+			Value:       "/etc/pki/tls/certs/" + hostname + ".crt",
+			Destination: &londo.CrtFile,
+		},
+		cli.StringFlag{
+			Name:        "key",
+			Usage:       "path to key `FILE`",
+			EnvVar:      "LONDO_CRED_KEY",
+			Value:       "/etc/pki/tls/private/" + hostname + ".key",
+			Destination: &londo.Keyfile,
+		},
+	}
+
+	for _, f := range londo.DefaultFlags {
+		app.Flags = append(app.Flags, f)
+	}
+
+	sort.Sort(cli.FlagsByName(app.Flags))
+}
+
+/*
+Runs londo-dbd, londo-enrolld, londo-collectd, londo-revoked, londo-checkerd and londo-grpcd
+within one process. They talk through a MemoryBus instead of RabbitMQ or NATS, so messages
+which are still queued are lost once a process exits.
+*/
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		os.Exit(1)
+	}
+}
+
+func defaultCommand(c *cli.Context) error {
+	if c.Bool("debug") {
+		londo.Debug = true
+	}
+
+	return londo.Initialize(name).
+		KeyRing().
+		DbService().
+		CheckSchema(migrate).
+		UseBus(londo.NewMemoryBus()).
+		Health().
+		CAClient().
+		Declare(
+			londo.DbReplyExchange,
+			londo.DbReplyQueue,
+			amqp.ExchangeDirect, nil).
+		Declare(
+			londo.EnrollExchange,
+			londo.EnrollQueue,
+			amqp.ExchangeDirect, nil).
+		Declare(
+			londo.CollectExchange,
+			londo.CollectQueue,
+			amqp.ExchangeDirect, nil).
+		Declare(
+			londo.RevokeExchange,
+			londo.RevokeQueue,
+			amqp.ExchangeDirect, nil).
+		Declare(
+			londo.CheckExchange,
+			londo.CheckQueue,
+			amqp.ExchangeDirect, nil).
+		DeclareExchange(
+			londo.GRPCServerExchange,
+			amqp.ExchangeDirect).
+		DeclareRetries(londo.EnrollQueue).
+		DeclareRetries(londo.CollectQueue).
+		DeclareRetries(londo.RevokeQueue).
+		DeclareDeadLetters().
+		RPCClient().
+		ConsumeDbRPC().
+		PurgeDeleted().
+		ConsumeEnroll().
+		ConsumeCollect().
+		ConsumeRevoke().
+		ConsumeCheck().
+		PublishPeriodically(londo.ScanHours).
+		PublishGetAllSubjects().
+		GRPCServer().
+		Run()
+}
@@ -38,7 +38,7 @@ type CertParams struct {
 }
 
 type endpoints struct {
-	Revoke, Enroll, Collect string
+	Revoke, Enroll, Collect, Renew, List string
 }
 
 type Rest struct {
@@ -52,19 +52,89 @@ type rabbitmq struct {
 	Port                                   int
 }
 
+// natsServer configures a NATS connection, credentials is a .creds file. Streams are
+// replicated over as many servers of a JetStream cluster.
+type natsServer struct {
+	URL         string `yaml:"url"`
+	Credentials string `yaml:"credentials"`
+	Replicas    int    `yaml:"replicas"`
+}
+
+// DB configures a MongoDB connection either with a URI, or with hostname and port, or with hosts
+// of a replica set. Structured fields, when set, override what a URI says. Timeouts are in seconds.
 type DB struct {
+	URI                                string `yaml:"uri"`
 	Hostname, Username, Password, Name string
 	Port                               int
+	Hosts                              []string `yaml:"hosts"`
+	ReplicaSet                         string   `yaml:"replica_set"`
+	AuthSource                         string   `yaml:"auth_source"`
+	AuthMechanism                      string   `yaml:"auth_mechanism"`
+	ReadPreference                     string   `yaml:"read_preference"`
+	ConnectTimeout                     int      `yaml:"connect_timeout"`
+	ServerSelectionTimeout             int      `yaml:"server_selection_timeout"`
+	SocketTimeout                      int      `yaml:"socket_timeout"`
+	MaxPoolSize                        uint64   `yaml:"max_pool_size"`
+	MinPoolSize                        uint64   `yaml:"min_pool_size"`
+	TLS                                DBTLS    `yaml:"tls"`
+}
+
+type DBTLS struct {
+	Enabled            bool   `yaml:"enabled"`
+	CAFile             string `yaml:"ca_file"`
+	CertFile           string `yaml:"cert_file"`
+	KeyFile            string `yaml:"key_file"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+type Storage struct {
+	Backend       string `yaml:"backend"`
+	Path          string `yaml:"path"`
+	RetentionDays int    `yaml:"retention_days"`
+}
+
+// Encryption configures key encryption keys. Daemons which handle private keys refuse to start
+// without one, unless AllowPlaintext opts out of encryption.
+type Encryption struct {
+	KEKFile          string   `yaml:"kek_file"`
+	PreviousKEKFiles []string `yaml:"previous_kek_files"`
+	AllowPlaintext   bool     `yaml:"allow_plaintext"`
+}
+
+// Retry overrides a default retry policy of a queue, delays are in seconds
+type Retry struct {
+	MaxAttempts int `yaml:"max_attempts"`
+	Delay       int `yaml:"delay"`
+	MaxDelay    int `yaml:"max_delay"`
+}
+
+type Consumer struct {
+	Workers  int `yaml:"workers"`
+	Prefetch int `yaml:"prefetch"`
+}
+
+type RateLimit struct {
+	Requests int `yaml:"requests"`
+	Interval int `yaml:"interval"`
+	Burst    int `yaml:"burst"`
 }
 
 type Config struct {
+	Storage    `yaml:"storage"`
+	Encryption `yaml:"encryption"`
 	DB         `yaml:"mongodb"`
-	AMQP       rabbitmq `yaml:"amqp"`
+	Transport  string     `yaml:"transport"`
+	CA         string     `yaml:"ca"`
+	AMQP       rabbitmq   `yaml:"amqp"`
+	NATS       natsServer `yaml:"nats"`
 	Rest       `yaml:"sectigo"`
 	GRPC       `yaml:"grpc"`
 	CertParams `yaml:"cert_params"`
 	Debug      int `yaml:"debug"`
 	JWT        `yaml:"jwt"`
+	Retries    map[string]Retry     `yaml:"retries"`
+	RateLimits map[string]RateLimit `yaml:"rate_limits"`
+	Consumers  map[string]Consumer  `yaml:"consumers"`
 }
 
 func ReadConfig(file string) (*Config, error) {
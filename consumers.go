@@ -1,12 +1,10 @@
 package londo
 
 import (
-	"encoding/json"
+	"crypto/x509"
 	"math/big"
 	"net"
-	"net/http"
 	"strconv"
-	"sync"
 	"time"
 
 	"github.com/alexyermolaev/londo/logger"
@@ -15,120 +13,97 @@ import (
 )
 
 func (l *Londo) ConsumeEnroll() *Londo {
-	go l.AMQP.Consume(EnrollQueue, nil, func(d amqp.Delivery) bool {
-		s, err := UnmarshalSubjMsg(&d)
-		if err != nil {
-			err = d.Reject(false)
+	l.consume(EnrollQueue, func(d amqp.Delivery) bool {
+		var e EnrollEvent
+		if err := Decode(&d, &e); err != nil {
+			d.Reject(false)
 			log.WithFields(logrus.Fields{logger.Action: "rejected"}).Error(err)
 			return false
 		}
 
-		key, err := GeneratePrivateKey(cfg.CertParams.BitSize)
-		if err != nil {
-			err = d.Reject(false)
-			log.WithFields(logrus.Fields{logger.Action: "rejected"}).Error(err)
+		r, ok := l.claimEnroll(&d, &e)
+		if !ok {
 			return false
 		}
 
-		s.PrivateKey, err = EncodePKey(key)
-		if err != nil {
-			err = d.Reject(false)
-			log.WithFields(logrus.Fields{logger.Action: "rejected"}).Error(err)
-			return false
+		s := enrollSubject(&e, &r)
+
+		// a key and a CSR are recorded before a CA sees them, every later attempt orders the same ones
+		if s.CSR == "" {
+			if err := l.newEnrollKey(&s); err != nil {
+				l.ReleaseEnrollment(&e, r.Claim)
+				d.Reject(false)
+				log.WithFields(logrus.Fields{logger.Subject: s.Subject, logger.Action: "rejected"}).Error(err)
+				return false
+			}
+
+			// a key which may or may not have been recorded is claimed again with a retry, it isn't
+			// in doubt as long as a CA hasn't been asked
+			k, err := l.RecordEnrollKey(&e, r.Claim, &s)
+			if err != nil {
+				l.retry(&d, EnrollQueue, err)
+				return false
+			}
+
+			// another delivery of the same request has claimed it since
+			if k.Outcome != ClaimProceed {
+				d.Ack(false)
+				log.WithFields(logrus.Fields{logger.Subject: e.Subject, logger.ID: e.Key, logger.Reason: k.Outcome}).Warn(logger.Skip)
+				return false
+			}
+
+			s.CSR, s.PrivateKey, s.EncryptedKey = k.CSR, k.PrivateKey, k.EncryptedKey
 		}
 
-		csr, err := GenerateCSR(key, s.Subject, cfg)
+		// a claim is marked right before a CA is asked, a request is only in doubt from then on. A mark
+		// which failed leaves a CA unasked, so a claim is given up whether it was recorded or not.
+		a, err := l.AttemptEnrollment(&e, r.Claim)
 		if err != nil {
-			err = d.Reject(false)
-			log.WithFields(logrus.Fields{logger.Action: "rejected"}).Error(err)
+			l.ReleaseEnrollment(&e, r.Claim)
+			l.retry(&d, EnrollQueue, err)
 			return false
 		}
 
-		s.CSR, err = EncodeCSR(csr)
-		if err != nil {
-			err = d.Reject(false)
-			log.WithFields(logrus.Fields{logger.Action: "rejected"}).Error(err)
+		// another delivery of the same request has claimed it since
+		if a.Outcome != ClaimProceed {
+			d.Ack(false)
+			log.WithFields(logrus.Fields{logger.Subject: e.Subject, logger.ID: e.Key, logger.Reason: a.Outcome}).Warn(logger.Skip)
 			return false
 		}
 
 		log.WithFields(logrus.Fields{logger.Subject: s.Subject}).Info("enrolling")
 
-		// A workaround for now; we don't need to process as fast as londopb are being received.
-		// It is more important not to overwhelm a remote API, and get ourselves potentially banned
-		time.Sleep(1 * time.Minute)
+		o, err := l.CA.Enroll(&s)
 
-		res, err := l.RestClient.Enroll(&s)
-		if err != nil {
-			d.Reject(true)
-			log.WithFields(logrus.Fields{logger.Action: "requeue"}).Error(err)
+		// a call which a CA has refused, or never got, can be made again
+		if IsRefused(err) {
+			l.ReleaseEnrollment(&e, r.Claim)
+			l.retry(&d, EnrollQueue, err)
 			return false
 		}
 
-		log.Debug("response: " + string(res.Body()))
-
-		if err := l.RestClient.VerifyStatusCode(res, http.StatusOK); err != nil {
-			d.Reject(true)
-			log.WithFields(logrus.Fields{logger.Action: "requeue"}).Error(err)
-			return false
-		}
-
-		// TODO: need a better way to log remote errors
-
-		var j EnrollResponse
-
-		// A failure here will be handled by collector once periodic check is ready
-		err = json.Unmarshal(res.Body(), &j)
+		// a request may have reached a CA before it failed, so it isn't ordered again
 		if err != nil {
-			d.Reject(false)
-			log.WithFields(logrus.Fields{logger.Action: "rejected"}).Error(err)
+			log.WithFields(logrus.Fields{logger.Subject: s.Subject, logger.ID: e.Key, logger.Reason: err}).Error(logger.Enroll)
+			l.retry(&d, EnrollQueue, ErrInDoubt)
 			return false
 		}
 
-		if err := l.Publish(
-			CollectExchange, CollectQueue, "", "", CollectEvent{CertID: j.SslId}); err != nil {
-
-			log.WithFields(logrus.Fields{
-				logger.Exchange: DbReplyExchange,
-				logger.Queue:    DbReplyQueue,
-				logger.CertID:   s.CertID}).Error(err)
+		// an enrollment is only done once both follow-ups are confirmed, otherwise it is retried.
+		// A subject goes first, it records a request as ordered.
+		s.CertID = o.CertID
+		s.OrderID = o.OrderID
 
+		if err := l.publishSubject(&e, &s); err != nil {
+			l.retry(&d, EnrollQueue, err)
 			return false
 		}
 
-		log.WithFields(logrus.Fields{
-			logger.Exchange: CollectExchange,
-			logger.Queue:    CollectQueue,
-			logger.CertID:   j.SslId}).Info("published")
-
-		s.CertID = j.SslId
-		s.OrderID = j.RenewID
-
-		if err := l.Publish(DbReplyExchange, DbReplyQueue, "", DbAddSubjCmd, NewSubjectEvent{
-			Subject:    s.Subject,
-			Port:       s.Port,
-			CSR:        s.CSR,
-			PrivateKey: s.PrivateKey,
-			CertID:     s.CertID,
-			OrderID:    s.OrderID,
-			AltNames:   s.AltNames,
-			Targets:    s.Targets,
-		}); err != nil {
-
-			log.WithFields(logrus.Fields{
-				logger.Exchange: DbReplyExchange,
-				logger.Queue:    DbReplyQueue,
-				logger.Subject:  s.Subject,
-				logger.CertID:   s.CertID}).Error(err)
-
+		if err := l.publishCollect(o.CertID); err != nil {
+			l.retry(&d, EnrollQueue, err)
 			return false
 		}
 
-		log.WithFields(logrus.Fields{
-			logger.Exchange: DbReplyExchange,
-			logger.Queue:    DbReplyQueue,
-			logger.Subject:  s.Subject,
-			logger.CertID:   s.CertID}).Info("published")
-
 		d.Ack(false)
 		return false
 	})
@@ -137,10 +112,10 @@ func (l *Londo) ConsumeEnroll() *Londo {
 }
 
 func (l *Londo) ConsumeRevoke() *Londo {
-	go l.AMQP.Consume(RevokeQueue, nil, func(d amqp.Delivery) bool {
+	l.consume(RevokeQueue, func(d amqp.Delivery) bool {
 
 		var e RevokeEvent
-		if err := json.Unmarshal(d.Body, &e); err != nil {
+		if err := Decode(&d, &e); err != nil {
 			d.Reject(false)
 			log.WithFields(logrus.Fields{logger.Reason: err}).Error("rejected")
 			return false
@@ -148,21 +123,30 @@ func (l *Londo) ConsumeRevoke() *Londo {
 
 		log.WithFields(logrus.Fields{logger.CertID: e.CertID}).Info(logger.Received)
 
-		res, err := l.RestClient.Revoke(e.CertID, "automated revocation")
-		if err != nil {
-			d.Reject(true)
-			log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Requeue)
-			return false
+		if e.Reason == "" {
+			e.Reason = "automated revocation"
 		}
 
-		if err := l.RestClient.VerifyStatusCode(res, http.StatusNoContent); err != nil {
-			d.Reject(true)
-			log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Requeue)
+		if err := l.CA.Revoke(e.CertID, e.Reason); err != nil {
+			l.retry(&d, RevokeQueue, err)
 			return false
 		}
 
 		log.WithFields(logrus.Fields{logger.CertID: e.CertID}).Info(logger.Revoked)
 
+		// Certificate is already revoked, so a missing history entry isn't a reason to retry
+		if err := l.Publish(DbReplyExchange, DbReplyQueue, "", DbRevokeCertCmd, RevokedCertEvent{
+			CertID:    e.CertID,
+			Reason:    e.Reason,
+			RevokedAt: time.Now(),
+		}); err != nil {
+			log.WithFields(logrus.Fields{
+				logger.Exchange: DbReplyExchange,
+				logger.Queue:    DbReplyQueue,
+				logger.CertID:   e.CertID,
+				logger.Reason:   err}).Error(logger.Skip)
+		}
+
 		d.Ack(false)
 		return false
 	})
@@ -171,76 +155,34 @@ func (l *Londo) ConsumeRevoke() *Londo {
 }
 
 func (l *Londo) ConsumeCollect() *Londo {
-	go l.AMQP.Consume(CollectQueue, nil, func(d amqp.Delivery) bool {
-		// TODO: fix code duplication
-		s, err := UnmarshalSubjMsg(&d)
-		if err != nil {
+	l.consume(CollectQueue, func(d amqp.Delivery) bool {
+		var e CollectEvent
+		if err := Decode(&d, &e); err != nil {
 			d.Reject(false)
 			log.WithFields(logrus.Fields{logger.Action: logger.Rejected}).Error(err)
 			return false
 		}
 
-		log.WithFields(logrus.Fields{logger.CertID: s.CertID}).Info("collecting")
-
-		time.Sleep(1 * time.Minute)
+		log.WithFields(logrus.Fields{logger.CertID: e.CertID}).Info("collecting")
 
-		res, err := l.RestClient.Collect(s.CertID)
+		cert, err := l.CA.Collect(e.CertID)
 		if err != nil {
-			d.Reject(true)
-			log.WithFields(logrus.Fields{logger.Action: logger.Requeue}).Error(err)
+			l.retry(&d, CollectQueue, err)
 			return false
 		}
 
-		if err := l.RestClient.VerifyStatusCode(res, http.StatusOK); err != nil {
-			d.Reject(true)
-			log.WithFields(logrus.Fields{logger.Action: logger.Requeue}).Error(err)
-			return false
-		}
-
-		s.Certificate = string(res.Body())
-
 		if err := l.Publish(DbReplyExchange, DbReplyQueue, "", DbUpdateSubjCmd, CompleteEnrollEvent{
-			CertID:      s.CertID,
-			Certificate: s.Certificate,
+			CertID:      e.CertID,
+			Certificate: cert,
 		}); err != nil {
-			d.Reject(true)
-			log.WithFields(logrus.Fields{logger.Action: logger.Requeue}).Error(err)
+			l.retry(&d, CollectQueue, err)
 			return false
 		}
 
 		log.WithFields(logrus.Fields{
 			logger.Exchange: DbReplyExchange,
 			logger.Queue:    DbReplyQueue,
-			logger.CertID:   s.CertID}).Info("published")
-
-		d.Ack(false)
-		return false
-	})
-
-	return l
-}
-
-func (l *Londo) ConsumeGRPCReplies(queue string, ch chan Subject, done chan struct{}, wg *sync.WaitGroup) *Londo {
-
-	go l.AMQP.Consume(queue, wg, func(d amqp.Delivery) bool {
-
-		var s Subject
-		if err := json.Unmarshal(d.Body, &s); err != nil {
-			return false
-		}
-
-		if s.Subject != "" {
-			log.WithFields(logrus.Fields{logger.Queue: queue, logger.Subject: s.Subject}).Info("consume")
-		}
-		ch <- s
-
-		if d.Type == CloseChannelCmd {
-			log.WithFields(logrus.Fields{logger.Queue: queue, logger.Cmd: CloseChannelCmd}).Debug("received")
-			if done != nil {
-				done <- struct{}{}
-			}
-			return true
-		}
+			logger.CertID:   e.CertID}).Info("published")
 
 		d.Ack(false)
 		return false
@@ -250,161 +192,149 @@ func (l *Londo) ConsumeGRPCReplies(queue string, ch chan Subject, done chan stru
 }
 
 func (l *Londo) ConsumeCheck() *Londo {
-	go l.AMQP.Consume(CheckQueue, nil, func(d amqp.Delivery) bool {
+	l.consume(CheckQueue, func(d amqp.Delivery) bool {
 		var e CheckCertEvent
 
-		if err := json.Unmarshal(d.Body, &e); err != nil {
+		if err := Decode(&d, &e); err != nil {
 			d.Reject(false)
 			log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
 			return false
 		}
 
-		d.Ack(false)
-
-		go func() {
-			log.WithFields(logrus.Fields{logger.Subject: e.Subject}).Info(logger.Received)
+		log.WithFields(logrus.Fields{logger.Subject: e.Subject}).Info(logger.Received)
 
-			now := time.Now().UTC()
-			t := now.Sub(e.Unresolvable).Round(time.Hour).Hours()
+		now := time.Now().UTC()
+		t := now.Sub(e.Unresolvable).Round(time.Hour).Hours()
 
-			ips, err := net.LookupIP(e.Subject)
+		ips, err := net.LookupIP(e.Subject)
 
-			// if DNS cannot resolve the host and unresolvable time is larger than set number of hours
-			// but unresolvable time itself isn't a zero, revoke delete
-			if err != nil && t > float64(RevokeHours) && !e.Unresolvable.IsZero() {
-				revoke := RevokeEvent{
-					ID:     e.ID,
-					CertID: e.CertID,
-				}
-
-				if err := l.Publish(
-					DbReplyExchange, DbReplyQueue, "", DbDeleteSubjCmd, revoke); err != nil {
-					d.Reject(false)
+		// if DNS cannot resolve the host and unresolvable time is larger than set number of hours
+		// but unresolvable time itself isn't a zero, delete it. Its certificate is only revoked
+		// once a subject is purged, so a subject restored meanwhile keeps a usable one.
+		if err != nil && t > float64(RevokeHours) && !e.Unresolvable.IsZero() {
+			revoke := RevokeEvent{
+				ID:       e.ID,
+				CertID:   e.CertID,
+				Reason:   "unresolvable for " + strconv.Itoa(int(t)) + " hours",
+				Actor:    l.Name,
+				Revision: e.Revision,
+				OnPurge:  true,
+			}
 
-					log.WithFields(logrus.Fields{
-						logger.Exchange: DbReplyExchange,
-						logger.Queue:    DbReplyQueue,
-						logger.Reason:   err,
-					}).Error(logger.Rejected)
+			err := l.Publish(DbReplyExchange, DbReplyQueue, "", DbDeleteSubjCmd, revoke)
+			l.Audit(l.Name, "", DbDeleteSubjCmd, e.Subject, err)
 
-					return
-				}
+			if err != nil {
+				d.Reject(false)
 
 				log.WithFields(logrus.Fields{
 					logger.Exchange: DbReplyExchange,
 					logger.Queue:    DbReplyQueue,
-					logger.Cmd:      DbDeleteSubjCmd,
-					logger.Subject:  e.Subject,
-					logger.Hours:    int(t)}).Info(logger.Published)
-
-				if err := l.Publish(RevokeExchange, RevokeQueue, "", "", revoke); err != nil {
-					// It isn't that important if we can't publish to revoker somehow.
-					// So we'll just continue with the rest.
-					log.WithFields(logrus.Fields{
-						logger.Exchange: RevokeExchange,
-						logger.Queue:    RevokeQueue,
-						logger.Reason:   err,
-					}).Error(logger.Skip)
-				} else {
-					log.WithFields(logrus.Fields{
-						logger.Exchange: RevokeExchange,
-						logger.Queue:    RevokeQueue,
-						logger.Subject:  e.Subject,
-						logger.CertID:   e.CertID,
-						logger.Hours:    int(t)}).Info(logger.Published)
-				}
+					logger.Reason:   err,
+				}).Error(logger.Rejected)
 
-				return
+				return false
 			}
 
-			var curSerial big.Int
-			curSerial.SetString(e.Serial, 10)
+			log.WithFields(logrus.Fields{
+				logger.Exchange: DbReplyExchange,
+				logger.Queue:    DbReplyQueue,
+				logger.Cmd:      DbDeleteSubjCmd,
+				logger.Subject:  e.Subject,
+				logger.Hours:    int(t)}).Info(logger.Published)
 
-			e.Match = false
-			e.Targets = nil
-			e.Outdated = nil
-			port := strconv.Itoa(int(e.Port))
+			d.Ack(false)
+			return false
+		}
 
-			// if dns can't resolve but it previous could, because unresolvable time was reset back to zero
-			if len(ips) == 0 && e.Unresolvable.IsZero() {
-				e.Unresolvable = now
+		var curSerial big.Int
+		curSerial.SetString(e.Serial, 10)
 
-				log.WithFields(logrus.Fields{logger.Subject: e.Subject}).Warn("unreachable")
-			}
+		e.Match = false
+		e.Targets = nil
+		e.Outdated = nil
+		port := strconv.Itoa(int(e.Port))
 
-			// we have an array of IPs and unresolvable time is zero
-			if len(ips) != 0 {
-				e.Unresolvable = time.Time{}
-				var match int
+		// if dns can't resolve but it previous could, because unresolvable time was reset back to zero
+		if len(ips) == 0 && e.Unresolvable.IsZero() {
+			e.Unresolvable = now
 
-				for _, ip := range ips {
+			log.WithFields(logrus.Fields{logger.Subject: e.Subject}).Warn("unreachable")
+		}
 
-					i := ip.String()
+		// we have an array of IPs and unresolvable time is zero
+		if len(ips) != 0 {
+			e.Unresolvable = time.Time{}
+			var match int
 
-					serial, err := GetCertSerialNumber(i, port, e.Subject)
-					if err != nil {
+			for _, ip := range ips {
 
-						log.WithFields(logrus.Fields{
-							logger.Subject:  e.Subject,
-							logger.IP:       i,
-							logger.Port:     port,
-							logger.Reason:   err,
-							logger.Outdated: e.Subject,
-						}).Error(logger.Added)
-
-						e.Outdated = append(e.Outdated, ip.String())
-						continue
-					}
+				i := ip.String()
 
-					if serial.Cmp(&curSerial) == 0 {
-						e.Targets = append(e.Targets, i)
-						match++
+				serial, err := GetCertSerialNumber(i, port, e.Subject)
+				if err != nil {
 
-						log.WithFields(logrus.Fields{
-							logger.Subject: e.Subject,
-							logger.Target:  i}).Info(logger.Added)
+					log.WithFields(logrus.Fields{
+						logger.Subject:  e.Subject,
+						logger.IP:       i,
+						logger.Port:     port,
+						logger.Reason:   err,
+						logger.Outdated: e.Subject,
+					}).Error(logger.Added)
 
-					} else {
-						e.Outdated = append(e.Outdated, ip.String())
-
-						if Debug {
-							log.WithFields(logrus.Fields{
-								logger.Subject:  e.Subject,
-								logger.Outdated: i,
-								logger.Serial:   curSerial.String(),
-								logger.DbSerial: serial.String()}).Debug(logger.Added)
-						} else {
-							log.WithFields(logrus.Fields{
-								logger.Subject:  e.Subject,
-								logger.Outdated: i}).Info(logger.Added)
-						}
-					}
+					e.Outdated = append(e.Outdated, ip.String())
+					continue
 				}
 
-				if len(ips) == match {
-					e.Match = true
+				if serial.Cmp(&curSerial) == 0 {
+					e.Targets = append(e.Targets, i)
+					match++
+
+					log.WithFields(logrus.Fields{
+						logger.Subject: e.Subject,
+						logger.Target:  i}).Info(logger.Added)
+
+				} else {
+					e.Outdated = append(e.Outdated, ip.String())
+
+					if Debug {
+						log.WithFields(logrus.Fields{
+							logger.Subject:  e.Subject,
+							logger.Outdated: i,
+							logger.Serial:   curSerial.String(),
+							logger.DbSerial: serial.String()}).Debug(logger.Added)
+					} else {
+						log.WithFields(logrus.Fields{
+							logger.Subject:  e.Subject,
+							logger.Outdated: i}).Info(logger.Added)
+					}
 				}
 			}
 
-			if err := l.Publish(DbReplyExchange, DbReplyQueue, "", DbUpdateCertStatusCmd, &e); err != nil {
-				d.Reject(false)
-
-				log.WithFields(logrus.Fields{
-					logger.Subject:  e.Subject,
-					logger.Exchange: DbReplyExchange,
-					logger.Queue:    DbReplyQueue,
-					logger.Reason:   err,
-					logger.Cmd:      DbUpdateCertStatusCmd}).Error("rejected")
-				return
+			if len(ips) == match {
+				e.Match = true
 			}
+		}
+
+		if err := l.Publish(DbReplyExchange, DbReplyQueue, "", DbUpdateCertStatusCmd, &e); err != nil {
+			d.Reject(false)
 
 			log.WithFields(logrus.Fields{
 				logger.Subject:  e.Subject,
 				logger.Exchange: DbReplyExchange,
 				logger.Queue:    DbReplyQueue,
-				logger.Cmd:      DbUpdateCertStatusCmd}).Info("published")
-		}()
+				logger.Reason:   err,
+				logger.Cmd:      DbUpdateCertStatusCmd}).Error("rejected")
+			return false
+		}
+
+		log.WithFields(logrus.Fields{
+			logger.Subject:  e.Subject,
+			logger.Exchange: DbReplyExchange,
+			logger.Queue:    DbReplyQueue,
+			logger.Cmd:      DbUpdateCertStatusCmd}).Info("published")
 
+		d.Ack(false)
 		return false
 	})
 
@@ -413,7 +343,7 @@ func (l *Londo) ConsumeCheck() *Londo {
 
 func (l *Londo) updateSubject(d *amqp.Delivery) (int, error) {
 	var e CompleteEnrollEvent
-	if err := json.Unmarshal(d.Body, &e); err != nil {
+	if err := Decode(d, &e); err != nil {
 		return 0, err
 	}
 
@@ -422,34 +352,241 @@ func (l *Londo) updateSubject(d *amqp.Delivery) (int, error) {
 		return 0, err
 	}
 
-	return e.CertID, l.Db.UpdateSubjCert(&e.CertID, &e.Certificate, &c.NotAfter, c.SerialNumber)
+	// a newly issued certificate always wins, so a conflicting update is retried with a fresh revision
+	for i := 0; ; i++ {
+		s, err := l.Db.FindSubjectByCertID(e.CertID)
+		if err != nil {
+			return e.CertID, err
+		}
+
+		err = l.Db.UpdateSubjCert(&e.CertID, s.Revision, &e.Certificate, &c.NotAfter, c.SerialNumber)
+
+		if err == ErrConflict && i < UpdateRetries {
+			log.WithFields(logrus.Fields{logger.CertID: e.CertID, logger.Subject: s.Subject}).Warn(logger.Conflict)
+			continue
+		}
+
+		if err != nil {
+			return e.CertID, err
+		}
+
+		l.recordCertificate(&s, c)
+		return e.CertID, nil
+	}
+}
+
+// recordCertificate adds a newly collected certificate to subject's history. Certificate itself
+// is already stored at this point, so failures are only logged.
+func (l *Londo) recordCertificate(s *Subject, c *x509.Certificate) {
+	if err := l.Db.InsertCertRecord(&CertRecord{
+		Subject:        s.Subject,
+		CertID:         s.CertID,
+		OrderID:        s.OrderID,
+		Serial:         c.SerialNumber.String(),
+		NotBefore:      c.NotBefore,
+		NotAfter:       c.NotAfter,
+		IssuedAt:       time.Now(),
+		KeyFingerprint: KeyFingerprint(c),
+	}); err != nil {
+		log.WithFields(logrus.Fields{
+			logger.Subject: s.Subject, logger.CertID: s.CertID, logger.Reason: err}).Error(logger.Skip)
+	}
+}
+
+// claimEnroll tells whether an enroll request is the one to order a certificate. Requests which
+// aren't are acknowledged, retried or dead-lettered here.
+func (l *Londo) claimEnroll(d *amqp.Delivery, e *EnrollEvent) (ClaimEnrollReply, bool) {
+	r, err := l.ClaimEnrollment(e)
+	if err != nil {
+		l.retry(d, EnrollQueue, err)
+		return r, false
+	}
+
+	fields := logrus.Fields{logger.Subject: e.Subject, logger.ID: e.Key, logger.Reason: r.Outcome}
+
+	switch r.Outcome {
+	case ClaimProceed:
+		return r, true
+
+	case ClaimDuplicate:
+		d.Ack(false)
+		log.WithFields(fields).Warn(logger.Skip)
+
+	// a certificate has been ordered, a collector may still need to be told about it. A request
+	// resolved by an operator still has a key, its subject has yet to be recorded.
+	case ClaimOrdered:
+		if r.CSR != "" {
+			s := enrollSubject(e, &r)
+			if err := l.publishSubject(e, &s); err != nil {
+				l.retry(d, EnrollQueue, err)
+				return r, false
+			}
+		}
+
+		if err := l.publishCollect(r.CertID); err != nil {
+			l.retry(d, EnrollQueue, err)
+			return r, false
+		}
+
+		d.Ack(false)
+		fields[logger.CertID] = r.CertID
+		log.WithFields(fields).Warn(logger.Skip)
+
+	case ClaimInDoubt:
+		l.retry(d, EnrollQueue, ErrInDoubt)
+
+	default:
+		d.Reject(false)
+		log.WithFields(fields).Error(logger.Rejected)
+	}
+
+	return r, false
+}
+
+// enrollSubject is a subject of an enroll request, with a key and a CSR recorded for it if any
+func enrollSubject(e *EnrollEvent, r *ClaimEnrollReply) Subject {
+	return Subject{
+		Subject:      e.Subject,
+		Port:         e.Port,
+		AltNames:     e.AltNames,
+		Targets:      e.Targets,
+		CSR:          r.CSR,
+		PrivateKey:   r.PrivateKey,
+		EncryptedKey: r.EncryptedKey,
+		CertID:       r.CertID,
+	}
+}
+
+// newEnrollKey generates a private key and a CSR of a subject
+func (l *Londo) newEnrollKey(s *Subject) error {
+	key, err := GeneratePrivateKey(cfg.CertParams.BitSize)
+	if err != nil {
+		return err
+	}
+
+	s.PrivateKey, err = EncodePKey(key)
+	if err != nil {
+		return err
+	}
+
+	// a private key never leaves londo-enrolld in plain text, unless encryption is opted out of
+	if l.Keys != nil {
+		s.EncryptedKey, err = l.Keys.Seal(s.Subject, s.PrivateKey)
+		if err != nil {
+			return err
+		}
+
+		s.PrivateKey = ""
+	}
+
+	csr, err := GenerateCSR(key, s.Subject, cfg)
+	if err != nil {
+		return err
+	}
+
+	s.CSR, err = EncodeCSR(csr)
+	return err
+}
+
+// publishSubject records an ordered request's subject, and a request itself as ordered
+func (l *Londo) publishSubject(e *EnrollEvent, s *Subject) error {
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Subject:  s.Subject,
+		logger.CertID:   s.CertID}
+
+	if err := l.Publish(DbReplyExchange, DbReplyQueue, "", DbAddSubjCmd, NewSubjectEvent{
+		Subject:      s.Subject,
+		Port:         s.Port,
+		CSR:          s.CSR,
+		PrivateKey:   s.PrivateKey,
+		EncryptedKey: s.EncryptedKey,
+		CertID:       s.CertID,
+		OrderID:      s.OrderID,
+		AltNames:     s.AltNames,
+		Targets:      s.Targets,
+		EnrollKey:    e.Key,
+	}); err != nil {
+		log.WithFields(fields).Error(err)
+		return err
+	}
+
+	log.WithFields(fields).Info("published")
+	return nil
+}
+
+func (l *Londo) publishCollect(certId int) error {
+	fields := logrus.Fields{
+		logger.Exchange: CollectExchange,
+		logger.Queue:    CollectQueue,
+		logger.CertID:   certId}
+
+	if err := l.Publish(CollectExchange, CollectQueue, "", "", CollectEvent{CertID: certId}); err != nil {
+		log.WithFields(fields).Error(err)
+		return err
+	}
+
+	log.WithFields(fields).Info("published")
+	return nil
 }
 
 func (l *Londo) createNewSubject(d *amqp.Delivery) (string, error) {
 	var e NewSubjectEvent
-	if err := json.Unmarshal(d.Body, &e); err != nil {
+	if err := Decode(d, &e); err != nil {
 		return "", err
 	}
 
-	return e.Subject, l.Db.InsertSubject(&Subject{
-		Subject:    e.Subject,
-		CSR:        e.CSR,
-		Port:       e.Port,
-		PrivateKey: e.PrivateKey,
-		CertID:     e.CertID,
-		OrderID:    e.OrderID,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
-		Targets:    e.Targets,
-		AltNames:   e.AltNames,
-	})
+	s := &Subject{
+		Subject:      e.Subject,
+		CSR:          e.CSR,
+		Port:         e.Port,
+		PrivateKey:   e.PrivateKey,
+		EncryptedKey: e.EncryptedKey,
+		CertID:       e.CertID,
+		OrderID:      e.OrderID,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+		Targets:      e.Targets,
+		AltNames:     e.AltNames,
+	}
+
+	// an order is recorded before a subject, a redelivered request is then known to be ordered
+	// even if a subject itself fails to be inserted
+	if e.EnrollKey != "" {
+		err := l.updateEnrollment(e.Subject, e.EnrollKey, EnrollOrdered, e.CertID)
+		if err == ErrConflict || err == ErrEnrollmentNotFound {
+			log.WithFields(logrus.Fields{
+				logger.Subject: e.Subject, logger.ID: e.EnrollKey, logger.Reason: err}).Warn(logger.Skip)
+		} else if err != nil {
+			return e.Subject, err
+		}
+	}
+
+	// a key londo-enrolld has sealed is stored as it is
+	if l.Keys != nil && s.PrivateKey != "" {
+		k, err := l.Keys.Seal(s.Subject, s.PrivateKey)
+		if err != nil {
+			return e.Subject, err
+		}
+
+		s.PrivateKey = ""
+		s.EncryptedKey = k
+	}
+
+	return e.Subject, l.Db.InsertSubject(s)
 }
 
 func (l *Londo) deleteSubject(d *amqp.Delivery) (int, error) {
 	var e RevokeEvent
-	if err := json.Unmarshal(d.Body, &e); err != nil {
+	if err := Decode(d, &e); err != nil {
 		return 0, err
 	}
 
-	return e.CertID, l.Db.DeleteSubject(e.ID, e.CertID)
+	return e.CertID, l.Db.DeleteSubject(e.ID, e.CertID, e.Revision, &Tombstone{
+		At:     time.Now(),
+		Reason: e.Reason,
+		Actor:  e.Actor,
+		Revoke: e.OnPurge,
+	})
 }
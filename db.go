@@ -2,16 +2,21 @@ package londo
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"io/ioutil"
 	"math/big"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/streadway/amqp"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
 )
 
 type MongoDB struct {
@@ -20,34 +25,280 @@ type MongoDB struct {
 	Name    string
 }
 
+// DefaultDBTimeout limits how long londo-dbd waits for MongoDB on startup, so a misconfigured
+// connection fails instead of hanging
+const DefaultDBTimeout = 10 * time.Second
+
+const DefaultDBPort = 27017
+
 func NewDBConnection(c *Config) (*MongoDB, error) {
 	m := &MongoDB{Name: c.DB.Name}
 
 	ctx := context.Background()
 	m.context = ctx
 
-	client, err := mongo.Connect(m.context, options.Client().ApplyURI(
-		"mongodb://"+c.DB.Hostname+":"+strconv.Itoa(c.DB.Port)))
+	opts, err := mongoClientOptions(&c.DB)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := client.Ping(m.context, nil); err != nil {
-		return m, err
+	client, err := mongo.Connect(m.context, opts)
+	if err != nil {
+		return nil, errors.New("mongodb: " + err.Error())
+	}
+
+	timeout := DefaultDBTimeout
+	if opts.ServerSelectionTimeout != nil {
+		timeout = *opts.ServerSelectionTimeout
+	}
+
+	pingCtx, cancel := context.WithTimeout(m.context, timeout)
+	defer cancel()
+
+	if err := client.Ping(pingCtx, nil); err != nil {
+		client.Disconnect(m.context)
+		return nil, errors.New("mongodb: cannot reach " + c.DB.Addr() + ": " + err.Error())
 	}
 
 	m.client = client
 	return m, nil
 }
 
+// mongoClientOptions turns a config into client options, and checks them before connecting
+func mongoClientOptions(c *DB) (*options.ClientOptions, error) {
+	if c.Name == "" {
+		return nil, errors.New("mongodb: database name is required")
+	}
+
+	opts := options.Client()
+
+	switch {
+	case c.URI != "" && (c.Hostname != "" || len(c.Hosts) != 0):
+		return nil, errors.New("mongodb: either uri or hostname and hosts can be set, not both")
+
+	case c.URI != "":
+		opts.ApplyURI(c.URI)
+
+	case len(c.Hosts) != 0:
+		opts.SetHosts(c.Hosts)
+
+	case c.Hostname != "":
+		opts.SetHosts([]string{c.Addr()})
+
+	default:
+		return nil, errors.New("mongodb: either uri, hostname or hosts is required")
+	}
+
+	if err := opts.Validate(); err != nil {
+		return nil, errors.New("mongodb: invalid uri: " + err.Error())
+	}
+
+	if c.Username != "" {
+		if opts.Auth != nil && opts.Auth.Username != "" {
+			return nil, errors.New("mongodb: username is set both in uri and in config")
+		}
+
+		opts.SetAuth(options.Credential{
+			Username:      c.Username,
+			Password:      c.Password,
+			PasswordSet:   c.Password != "",
+			AuthSource:    c.AuthSource,
+			AuthMechanism: c.AuthMechanism,
+		})
+	} else if opts.Auth != nil {
+		// a password may be kept out of a URI
+		if c.Password != "" {
+			opts.Auth.Password = c.Password
+			opts.Auth.PasswordSet = true
+		}
+
+		if c.AuthSource != "" {
+			opts.Auth.AuthSource = c.AuthSource
+		}
+
+		if c.AuthMechanism != "" {
+			opts.Auth.AuthMechanism = c.AuthMechanism
+		}
+	} else if c.Password != "" || c.AuthSource != "" || c.AuthMechanism != "" {
+		return nil, errors.New("mongodb: password, auth_source and auth_mechanism need a username")
+	}
+
+	if c.ReplicaSet != "" {
+		opts.SetReplicaSet(c.ReplicaSet)
+	}
+
+	if c.ReadPreference != "" {
+		mode, err := readpref.ModeFromString(c.ReadPreference)
+		if err != nil {
+			return nil, errors.New("mongodb: " + err.Error())
+		}
+
+		rp, err := readpref.New(mode)
+		if err != nil {
+			return nil, errors.New("mongodb: " + err.Error())
+		}
+		opts.SetReadPreference(rp)
+	}
+
+	if c.ConnectTimeout < 0 || c.ServerSelectionTimeout < 0 || c.SocketTimeout < 0 {
+		return nil, errors.New("mongodb: timeouts can't be negative")
+	}
+
+	if c.ConnectTimeout != 0 {
+		opts.SetConnectTimeout(time.Duration(c.ConnectTimeout) * time.Second)
+	}
+
+	if c.ServerSelectionTimeout != 0 {
+		opts.SetServerSelectionTimeout(time.Duration(c.ServerSelectionTimeout) * time.Second)
+	}
+
+	if c.SocketTimeout != 0 {
+		opts.SetSocketTimeout(time.Duration(c.SocketTimeout) * time.Second)
+	}
+
+	if c.MaxPoolSize != 0 {
+		if c.MinPoolSize > c.MaxPoolSize {
+			return nil, errors.New("mongodb: min_pool_size is greater than max_pool_size")
+		}
+		opts.SetMaxPoolSize(c.MaxPoolSize)
+	}
+
+	if c.MinPoolSize != 0 {
+		opts.SetMinPoolSize(c.MinPoolSize)
+	}
+
+	if c.TLS.Enabled {
+		t, err := c.TLS.config()
+		if err != nil {
+			return nil, errors.New("mongodb: " + err.Error())
+		}
+		opts.SetTLSConfig(t)
+	} else if c.TLS.CAFile != "" || c.TLS.CertFile != "" || c.TLS.KeyFile != "" {
+		return nil, errors.New("mongodb: tls files are set, but tls isn't enabled")
+	}
+
+	return opts, nil
+}
+
+// config loads a CA and a client certificate. Without a CA file, system roots are used.
+func (t *DBTLS) config() (*tls.Config, error) {
+	c := &tls.Config{InsecureSkipVerify: t.InsecureSkipVerify}
+
+	if t.CAFile != "" {
+		pem, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		c.RootCAs = x509.NewCertPool()
+		if !c.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("no certificates found in " + t.CAFile)
+		}
+	}
+
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("tls cert_file and key_file have to be set together")
+	}
+
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		c.Certificates = []tls.Certificate{cert}
+	}
+
+	return c, nil
+}
+
+// Addr lists hosts a client connects to, without credentials, so it can be logged
+func (c *DB) Addr() string {
+	if c.URI != "" {
+		cs, err := connstring.Parse(c.URI)
+		if err != nil {
+			return "invalid uri"
+		}
+		return strings.Join(cs.Hosts, ",")
+	}
+
+	if len(c.Hosts) != 0 {
+		return strings.Join(c.Hosts, ",")
+	}
+
+	port := c.Port
+	if port == 0 {
+		port = DefaultDBPort
+	}
+
+	return c.Hostname + ":" + strconv.Itoa(port)
+}
+
 func (m *MongoDB) Disconnect() error {
 	return m.client.Disconnect(m.context)
 }
 
+// indexes declares every index a collection needs. Index names are generated by MongoDB
+// from keys, so creating an index which already exists is a no-op.
+var indexes = map[string][]mongo.IndexModel{
+	"subjects": {
+		// a deleted subject may share its name with a live one, i.e. after renewal
+		{Keys: bson.D{{Key: "subject", Value: 1}}, Options: options.Index().
+			SetName("subject_1_live").
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"deleted": bson.M{"$exists": false}})},
+		{Keys: bson.D{{Key: "cert_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "not_after", Value: 1}}},
+		{Keys: bson.D{{Key: "targets", Value: 1}}},
+		{Keys: bson.D{{Key: "outdated", Value: 1}}},
+		{Keys: bson.D{{Key: "match", Value: 1}}},
+		{Keys: bson.D{{Key: "unresolvable_at", Value: 1}}},
+		{Keys: bson.D{{Key: "deleted.at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	},
+	"certificates": {
+		{Keys: bson.D{{Key: "subject", Value: 1}, {Key: "version", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "cert_id", Value: 1}}},
+	},
+	"audit": {
+		{Keys: bson.D{{Key: "timestamp", Value: 1}}},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "timestamp", Value: 1}}},
+	},
+}
+
+// legacyIndexes were replaced by an index with different options, and have to be dropped first
+var legacyIndexes = map[string][]string{
+	"subjects": {"subject_1"},
+}
+
+// indexNotFound is returned by MongoDB when dropping an index which doesn't exist
+const indexNotFound = 27
+
+func (m *MongoDB) EnsureIndexes() error {
+	for name, legacy := range legacyIndexes {
+		col := m.client.Database(m.Name).Collection(name)
+
+		for _, idx := range legacy {
+			_, err := col.Indexes().DropOne(m.context, idx)
+			if ce, ok := err.(mongo.CommandError); err != nil && (!ok || ce.Code != indexNotFound) {
+				return errors.New("cannot drop index " + idx + " on " + name + ": " + err.Error())
+			}
+		}
+	}
+
+	for name, models := range indexes {
+		col := m.client.Database(m.Name).Collection(name)
+
+		if _, err := col.Indexes().CreateMany(m.context, models); err != nil {
+			return errors.New("cannot create indexes on " + name + ": " + err.Error())
+		}
+	}
+
+	return nil
+}
+
 func (m *MongoDB) FindAllSubjects() ([]*Subject, error) {
 	col := m.client.Database(m.Name).Collection("subjects")
 
-	cur, err := col.Find(m.context, m.client)
+	cur, err := col.Find(m.context, live(bson.M{}))
 	if err != nil {
 		return nil, err
 	}
@@ -70,22 +321,31 @@ func (m *MongoDB) FindAllSubjects() ([]*Subject, error) {
 	return results, nil
 }
 
+// FindExpiringSubjects returns subjects which certificates expire within given number of hours,
+// including those that were never issued one.
 func (m *MongoDB) FindExpiringSubjects(hours int) ([]*Subject, error) {
-	subjs, err := m.FindAllSubjects()
+	col := m.getSubjCollection()
+
+	deadline := time.Now().Add(time.Duration(hours) * time.Hour)
+	opts := options.Find().SetSort(bson.M{"not_after": 1})
+
+	cur, err := col.Find(m.context, live(bson.M{"not_after": bson.M{"$lt": deadline}}), opts)
 	if err != nil {
 		return nil, err
 	}
+	defer cur.Close(m.context)
 
 	var res []*Subject
 
-	for _, s := range subjs {
-		h := time.Until(s.NotAfter).Round(time.Hour).Hours()
-		if h < float64(hours) {
-			res = append(res, s)
+	for cur.Next(m.context) {
+		var s Subject
+		if err := cur.Decode(&s); err != nil {
+			return nil, err
 		}
+		res = append(res, &s)
 	}
 
-	return res, nil
+	return res, cur.Err()
 }
 
 func (m *MongoDB) InsertSubject(s *Subject) error {
@@ -93,58 +353,195 @@ func (m *MongoDB) InsertSubject(s *Subject) error {
 	s.ID = primitive.NewObjectID()
 
 	_, err := col.InsertOne(m.context, s)
+	if isDuplicateKey(err) {
+		return ErrConflict
+	}
+
 	return err
 }
 
-func (m *MongoDB) DeleteSubject(hexId string, certid int) error {
-	col := m.getSubjCollection()
-
+// DeleteSubject only marks a subject as deleted, it is removed by PurgeSubject once retention is over
+func (m *MongoDB) DeleteSubject(hexId string, certid int, rev int64, t *Tombstone) error {
 	id, err := primitive.ObjectIDFromHex(hexId)
 	if err != nil {
 		return err
 	}
 
-	filter := bson.M{"_id": id, "cert_id": certid}
+	filter := live(bson.M{"_id": id, "cert_id": certid})
+	update := bson.D{{Key: "$set", Value: bson.M{"deleted": t}}}
+
+	return m.updateSubject(filter, rev, update)
+}
+
+// ImportSubject inserts a subject unless a live subject has the same name, or any subject has
+// the same certificate id. Conflicting fields are returned, and with replace, conflicting
+// subjects are removed before the insert.
+func (m *MongoDB) ImportSubject(s *Subject, replace bool) ([]string, error) {
+	col := m.getSubjCollection()
 
-	dres, err := col.DeleteOne(m.context, filter)
+	or := []bson.M{{"cert_id": s.CertID}}
+	if s.Deleted == nil {
+		or = append(or, live(bson.M{"subject": s.Subject}))
+	}
+
+	cur, err := col.Find(m.context, bson.M{"$or": or})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer cur.Close(m.context)
+
+	var ids []primitive.ObjectID
+	var conflicts []Subject
 
-	if dres.DeletedCount == 0 {
-		return errors.New("no certificate with id " + strconv.Itoa(certid) + " found")
+	for cur.Next(m.context) {
+		var e Subject
+		if err := cur.Decode(&e); err != nil {
+			return nil, err
+		}
+		ids = append(ids, e.ID)
+		conflicts = append(conflicts, e)
 	}
-	return err
+
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	fields := conflictFields(s, conflicts)
+
+	if len(fields) != 0 && !replace {
+		return fields, nil
+	}
+
+	if len(ids) != 0 {
+		if _, err := col.DeleteMany(m.context, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+			return fields, err
+		}
+	}
+
+	_, err = col.InsertOne(m.context, s)
+	return fields, err
 }
 
-func (m *MongoDB) UpdateSubjCert(certId *int, cert *string, na *time.Time, sn *big.Int) error {
+func (m *MongoDB) FindDeletedSubjects() ([]*Subject, error) {
 	col := m.getSubjCollection()
 
-	filter := bson.M{"cert_id": certId}
+	cur, err := col.Find(m.context, bson.M{"deleted": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(m.context)
+
+	var res []*Subject
+
+	for cur.Next(m.context) {
+		var s Subject
+		if err := cur.Decode(&s); err != nil {
+			return nil, err
+		}
+		res = append(res, &s)
+	}
+
+	return res, cur.Err()
+}
+
+// RestoreSubject brings back the most recently deleted subject with a given name. Its unresolvable
+// time is cleared, so the checker doesn't delete it again right away.
+func (m *MongoDB) RestoreSubject(s string) (Subject, error) {
+	col := m.getSubjCollection()
+	var res Subject
+
+	err := col.FindOne(m.context, live(bson.M{"subject": s})).Err()
+	switch err {
+	case nil:
+		return res, ErrSubjectExists
+	case mongo.ErrNoDocuments:
+	default:
+		return res, err
+	}
+
+	filter := bson.M{"subject": s, "deleted": bson.M{"$exists": true}}
+	opts := options.FindOne().SetSort(bson.M{"deleted.at": -1})
+
+	if err := col.FindOne(m.context, filter, opts).Decode(&res); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return res, ErrSubjectNotFound
+		}
+		return res, err
+	}
+
 	update := bson.D{
-		{"$set", bson.D{
-			{"certificate", cert},
-			{"not_after", na},
-			{"serial", sn.String()},
-			{"updated_at", time.Now()},
-			{"match", false},
-		}},
+		{Key: "$unset", Value: bson.M{"deleted": "", "unresolvable_at": ""}},
+		{Key: "$set", Value: bson.M{"updated_at": time.Now()}},
+	}
+
+	// a live subject inserted in the meantime is caught by the unique index
+	if err := m.updateSubject(bson.M{"_id": res.ID}, res.Revision, update); err != nil {
+		return res, err
 	}
 
-	_, err := col.UpdateOne(m.context, filter, update)
+	res.Deleted = nil
+	res.UnresolvableAt = time.Time{}
+	res.Revision++
+	return res, nil
+}
+
+// PurgeSubject removes a deleted subject for good, as long as it is of a given revision.
+// Live subjects are never removed.
+func (m *MongoDB) PurgeSubject(hexId string, rev int64) error {
+	col := m.getSubjCollection()
+
+	id, err := primitive.ObjectIDFromHex(hexId)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	filter := bson.M{"_id": id, "deleted": bson.M{"$exists": true}}
+
+	res, err := col.DeleteOne(m.context, withRevision(filter, rev))
+	if err != nil {
+		return err
+	}
+
+	if res.DeletedCount != 0 {
+		return nil
+	}
+
+	n, err := col.CountDocuments(m.context, filter)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrSubjectNotFound
+	}
+	return ErrConflict
+}
+
+func (m *MongoDB) UpdateSubjCert(certId *int, rev int64, cert *string, na *time.Time, sn *big.Int) error {
+	filter := live(bson.M{"cert_id": certId})
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "certificate", Value: cert},
+			{Key: "not_after", Value: na},
+			{Key: "serial", Value: sn.String()},
+			{Key: "updated_at", Value: time.Now()},
+			{Key: "match", Value: false},
+		}},
+	}
+
+	return m.updateSubject(filter, rev, update)
 }
 
 func (m *MongoDB) FindSubject(s string) (Subject, error) {
 	col := m.getSubjCollection()
-	filter := bson.M{"subject": s}
+	filter := live(bson.M{"subject": s})
 	var res Subject
 
 	err := col.FindOne(m.context, filter).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return res, ErrSubjectNotFound
+	}
+
 	return res, err
 }
 
@@ -155,10 +552,11 @@ func (m *MongoDB) FindManySubjects(s []string, filter string) ([]Subject, error)
 		res []Subject
 	)
 
-	cur, err := col.Find(m.context, bson.M{filter: s}, nil)
+	cur, err := col.Find(m.context, live(bson.M{filter: bson.M{"$in": s}}))
 	if err != nil {
 		return nil, err
 	}
+	defer cur.Close(m.context)
 
 	for cur.Next(m.context) {
 		var s Subject
@@ -168,38 +566,460 @@ func (m *MongoDB) FindManySubjects(s []string, filter string) ([]Subject, error)
 		res = append(res, s)
 	}
 
-	return res, nil
+	return res, cur.Err()
 }
 
-func (m *MongoDB) UpdateUnreachable(e *CheckCertEvent) error {
+// ListSubjects returns a page of subjects and a token of the next page, which is empty on the last page
+func (m *MongoDB) ListSubjects(f *SubjectFilter) ([]Subject, string, error) {
 	col := m.getSubjCollection()
 
-	filter := bson.M{"subject": e.Subject}
+	filter, err := f.Query()
+	if err != nil {
+		return nil, "", err
+	}
+
+	opts := options.Find().SetSort(f.Sort()).SetLimit(int64(f.PageSize + 1))
+
+	cur, err := col.Find(m.context, filter, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	defer cur.Close(m.context)
+
+	var res []Subject
+
+	for cur.Next(m.context) {
+		var s Subject
+		if err := cur.Decode(&s); err != nil {
+			return nil, "", err
+		}
+		res = append(res, s)
+	}
+
+	if err := cur.Err(); err != nil {
+		return nil, "", err
+	}
+
+	res, next := f.Cut(res)
+	return res, next, nil
+}
+
+func (m *MongoDB) UpdateUnreachable(e *CheckCertEvent) error {
+	id, err := primitive.ObjectIDFromHex(e.ID)
+	if err != nil {
+		return err
+	}
+
+	filter := live(bson.M{"_id": id})
 	update := bson.D{
-		{"$set", bson.D{
-			{"unresolvable_at", e.Unresolvable},
-			{"match", e.Match},
-			{"targets", e.Targets},
-			{"outdated", e.Outdated},
-			{"updated_at", time.Now()},
+		{Key: "$set", Value: bson.D{
+			{Key: "unresolvable_at", Value: e.Unresolvable},
+			{Key: "match", Value: e.Match},
+			{Key: "targets", Value: e.Targets},
+			{Key: "outdated", Value: e.Outdated},
+			{Key: "updated_at", Value: time.Now()},
 		}},
 	}
 
-	_, err := col.UpdateOne(m.context, filter, update)
+	return m.updateSubject(filter, e.Revision, update)
+}
+
+func (m *MongoDB) UpdateSubjKey(hexId string, rev int64, k *EncryptedKey) error {
+	id, err := primitive.ObjectIDFromHex(hexId)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": id}
+	update := bson.D{
+		{Key: "$set", Value: bson.M{
+			"encrypted_key": k,
+			"updated_at":    time.Now(),
+		}},
+		{Key: "$unset", Value: bson.M{
+			"private_key": "",
+		}},
+	}
+
+	return m.updateSubject(filter, rev, update)
+}
+
+func (m *MongoDB) FindSubjectByCertID(certId int) (Subject, error) {
+	col := m.getSubjCollection()
+	filter := live(bson.M{"cert_id": certId})
+	var res Subject
+
+	err := col.FindOne(m.context, filter).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return res, ErrSubjectNotFound
+	}
+
+	return res, err
+}
+
+// InsertCertRecord takes a version after the latest one of a subject. Records inserted concurrently
+// may take the same version, the unique index turns one of them away, and it takes the next one.
+func (m *MongoDB) InsertCertRecord(r *CertRecord) error {
+	col := m.getCertCollection()
+
+	var err error
+
+	for i := 0; i <= UpdateRetries; i++ {
+		var last CertRecord
+
+		opts := options.FindOne().SetSort(bson.M{"version": -1})
+
+		err = col.FindOne(m.context, bson.M{"subject": r.Subject}, opts).Decode(&last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		r.ID = primitive.NewObjectID()
+		r.Version = last.Version + 1
+
+		_, err = col.InsertOne(m.context, r)
+		if !isDuplicateKey(err) {
+			return err
+		}
+	}
+
+	return err
+}
+
+func (m *MongoDB) FindCertHistory(s string) ([]CertRecord, error) {
+	var (
+		col = m.getCertCollection()
+		res []CertRecord
+	)
+
+	opts := options.Find().SetSort(bson.M{"version": 1})
+
+	cur, err := col.Find(m.context, bson.M{"subject": s}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(m.context)
+
+	for cur.Next(m.context) {
+		var r CertRecord
+		if err := cur.Decode(&r); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+
+	return res, cur.Err()
+}
+
+func (m *MongoDB) FindAllCertRecords() ([]CertRecord, error) {
+	var (
+		col = m.getCertCollection()
+		res []CertRecord
+	)
+
+	opts := options.Find().SetSort(bson.D{{Key: "subject", Value: 1}, {Key: "version", Value: 1}})
+
+	cur, err := col.Find(m.context, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(m.context)
+
+	for cur.Next(m.context) {
+		var r CertRecord
+		if err := cur.Decode(&r); err != nil {
+			return nil, err
+		}
+		res = append(res, r)
+	}
+
+	return res, cur.Err()
+}
+
+// ImportCertRecord keeps a version of an imported record, and skips it if that version exists
+func (m *MongoDB) ImportCertRecord(r *CertRecord) (bool, error) {
+	col := m.getCertCollection()
+
+	n, err := col.CountDocuments(m.context, bson.M{"subject": r.Subject, "version": r.Version})
+	if err != nil || n != 0 {
+		return false, err
+	}
+
+	r.ID = primitive.NewObjectID()
+
+	_, err = col.InsertOne(m.context, r)
+	return err == nil, err
+}
+
+func (m *MongoDB) RevokeCertRecord(certId int, reason string, at time.Time) error {
+	col := m.getCertCollection()
+
+	filter := bson.M{"cert_id": certId}
+	update := bson.M{
+		"$set": bson.M{
+			"revoked_at":        at,
+			"revocation_reason": reason,
+		},
+	}
+
+	_, err := col.UpdateMany(m.context, filter, update)
+	return err
+}
+
+func (m *MongoDB) InsertAuditEntry(e *AuditEntry) error {
+	col := m.getAuditCollection()
+	e.ID = primitive.NewObjectID()
+
+	_, err := col.InsertOne(m.context, e)
+	return err
+}
+
+func (m *MongoDB) FindAuditEntries(from time.Time, to time.Time, actor string) ([]AuditEntry, error) {
+	var (
+		col = m.getAuditCollection()
+		res []AuditEntry
+	)
+
+	filter := bson.M{"timestamp": bson.M{"$gte": from, "$lte": to}}
+	if actor != "" {
+		filter["actor"] = actor
+	}
+
+	opts := options.Find().SetSort(bson.M{"timestamp": 1})
+
+	cur, err := col.Find(m.context, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(m.context)
+
+	for cur.Next(m.context) {
+		var e AuditEntry
+		if err := cur.Decode(&e); err != nil {
+			return nil, err
+		}
+		res = append(res, e)
+	}
+
+	return res, cur.Err()
+}
+
+func (m *MongoDB) FindEnrollment(s string) (Enrollment, error) {
+	col := m.getEnrollCollection()
+
+	var e Enrollment
+
+	err := col.FindOne(m.context, bson.M{"_id": s}).Decode(&e)
+	if err == mongo.ErrNoDocuments {
+		return e, ErrEnrollmentNotFound
+	}
+
+	return e, err
+}
+
+func (m *MongoDB) SaveEnrollment(e *Enrollment, rev int64) error {
+	col := m.getEnrollCollection()
+
+	saved := *e
+	saved.Revision = rev + 1
+
+	// a duplicate key means another request has saved a new enrollment first
+	if rev == 0 {
+		if _, err := col.InsertOne(m.context, &saved); err != nil {
+			if isDuplicateKey(err) {
+				return ErrConflict
+			}
+			return err
+		}
+
+		e.Revision = saved.Revision
+		return nil
+	}
+
+	res, err := col.ReplaceOne(m.context, bson.M{"_id": e.Subject, "revision": rev}, &saved)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrConflict
+	}
+
+	e.Revision = saved.Revision
+	return nil
+}
 
+func (m *MongoDB) DeleteEnrollment(certId int) error {
+	col := m.getEnrollCollection()
+
+	_, err := col.DeleteMany(m.context, bson.M{"state": EnrollOrdered, "cert_id": certId})
+	return err
+}
+
+func (m *MongoDB) SchemaVersion() (int, error) {
+	col := m.getMetaCollection()
+
+	var res struct {
+		Version int `bson:"version"`
+	}
+
+	err := col.FindOne(m.context, bson.M{"_id": "schema"}).Decode(&res)
+	if err == mongo.ErrNoDocuments {
+		return 0, nil
+	}
+
+	return res.Version, err
+}
+
+func (m *MongoDB) SetSchemaVersion(v int) error {
+	col := m.getMetaCollection()
+
+	update := bson.M{
+		"$set": bson.M{
+			"version":    v,
+			"updated_at": time.Now(),
+		},
+	}
+
+	_, err := col.UpdateOne(m.context, bson.M{"_id": "schema"}, update, options.Update().SetUpsert(true))
 	return err
 }
 
+func (m *MongoDB) MigrateSubjects(f func(doc bson.M) bool, dryRun bool) ([]string, error) {
+	col := m.getSubjCollection()
+
+	cur, err := col.Find(m.context, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(m.context)
+
+	var changed []string
+
+	for cur.Next(m.context) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return changed, err
+		}
+
+		// a nil revision matches subjects written before revisions were introduced
+		filter := bson.M{"_id": doc["_id"], "revision": doc["revision"]}
+
+		if !f(doc) {
+			continue
+		}
+
+		name, _ := doc["subject"].(string)
+
+		if !dryRun {
+			res, err := col.ReplaceOne(m.context, filter, doc)
+			if err != nil {
+				return changed, err
+			}
+
+			if res.MatchedCount == 0 {
+				return changed, errors.New(name + ": " + ErrConflict.Error())
+			}
+		}
+
+		changed = append(changed, name)
+	}
+
+	return changed, cur.Err()
+}
+
+// updateSubject applies an update only if a subject still has a revision it was read with,
+// and bumps the revision. When nothing matches, it tells a missing subject from a modified one.
+func (m *MongoDB) updateSubject(filter bson.M, rev int64, update bson.D) error {
+	col := m.getSubjCollection()
+
+	update = append(update, bson.E{Key: "$inc", Value: bson.M{"revision": 1}})
+
+	res, err := col.UpdateOne(m.context, withRevision(filter, rev), update)
+	if err != nil {
+		return err
+	}
+
+	if res.MatchedCount != 0 {
+		return nil
+	}
+
+	n, err := col.CountDocuments(m.context, filter)
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrSubjectNotFound
+	}
+	return ErrConflict
+}
+
+// withRevision copies a filter, and narrows it down to a revision
+func withRevision(filter bson.M, rev int64) bson.M {
+	cond := bson.M{}
+	for k, v := range filter {
+		cond[k] = v
+	}
+
+	// subjects written before revisions were introduced have none, which counts as zero
+	if rev == 0 {
+		cond["$or"] = []bson.M{{"revision": 0}, {"revision": bson.M{"$exists": false}}}
+	} else {
+		cond["revision"] = rev
+	}
+
+	return cond
+}
+
+func isDuplicateKey(err error) bool {
+	we, ok := err.(mongo.WriteException)
+	if !ok {
+		return false
+	}
+
+	for _, e := range we.WriteErrors {
+		if e.Code == 11000 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// live limits a filter to subjects which weren't deleted
+func live(filter bson.M) bson.M {
+	filter["deleted"] = bson.M{"$exists": false}
+	return filter
+}
+
 func (m *MongoDB) getSubjCollection() *mongo.Collection {
 	return m.client.Database(m.Name).Collection("subjects")
 }
 
+func (m *MongoDB) getCertCollection() *mongo.Collection {
+	return m.client.Database(m.Name).Collection("certificates")
+}
+
+func (m *MongoDB) getAuditCollection() *mongo.Collection {
+	return m.client.Database(m.Name).Collection("audit")
+}
+
+func (m *MongoDB) getEnrollCollection() *mongo.Collection {
+	return m.client.Database(m.Name).Collection("enrollments")
+}
+
+func (m *MongoDB) getMetaCollection() *mongo.Collection {
+	return m.client.Database(m.Name).Collection("metadata")
+}
+
 type Subject struct {
 	ID             primitive.ObjectID `bson:"_id"`
 	Subject        string             `bson:"subject"`
 	Port           int32              `bson:"port"`
 	CSR            string             `bson:"csr"`
-	PrivateKey     string             `bson:"private_key"`
+	PrivateKey     string             `bson:"private_key,omitempty"`
+	EncryptedKey   *EncryptedKey      `bson:"encrypted_key,omitempty"`
 	Certificate    string             `bson:"certificate,omitempty"`
 	Serial         string             `bson:"serial"`
 	CertID         int                `bson:"cert_id"`
@@ -212,8 +1032,32 @@ type Subject struct {
 	AltNames       []string           `bson:"alt_names,omitempty"`
 	Match          bool               `bson:"match"`
 	Outdated       []string           `bson:"outdated,omitempty"`
+	Deleted        *Tombstone         `bson:"deleted,omitempty"`
+
+	// Revision is bumped by every update, which is only applied to a revision it was read with
+	Revision int64 `bson:"revision"`
+
+	// History is only filled in replies to DbGetSubjectHistoryCmd
+	History []CertRecord `bson:"-"`
+}
+
+func (Subject) EventName() string {
+	return "subject"
 }
 
-func (Subject) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+// CertRecord is one issued certificate of a subject. Records outlive their subjects,
+// so it is possible to tell which certificate was served, and when it was revoked.
+type CertRecord struct {
+	ID               primitive.ObjectID `bson:"_id"`
+	Subject          string             `bson:"subject"`
+	Version          int                `bson:"version"`
+	CertID           int                `bson:"cert_id"`
+	OrderID          string             `bson:"order_id"`
+	Serial           string             `bson:"serial"`
+	NotBefore        time.Time          `bson:"not_before"`
+	NotAfter         time.Time          `bson:"not_after"`
+	IssuedAt         time.Time          `bson:"issued_at"`
+	RevokedAt        time.Time          `bson:"revoked_at,omitempty"`
+	RevocationReason string             `bson:"revocation_reason,omitempty"`
+	KeyFingerprint   string             `bson:"key_fingerprint"`
 }
@@ -1,8 +1,9 @@
 package londo
 
 import (
-	"encoding/json"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/alexyermolaev/londo/logger"
 	"github.com/sirupsen/logrus"
@@ -10,7 +11,7 @@ import (
 )
 
 func (l *Londo) ConsumeDbRPC() *Londo {
-	go l.AMQP.Consume(DbReplyQueue, nil, func(d amqp.Delivery) bool {
+	l.consume(DbReplyQueue, func(d amqp.Delivery) bool {
 
 		switch d.Type {
 		case DbUpdateCertStatusCmd:
@@ -40,6 +41,51 @@ func (l *Londo) ConsumeDbRPC() *Londo {
 		case DbGetAllSubjectsCmd:
 			return l.dbGetAllSubjects(d)
 
+		case DbRewrapKeysCmd:
+			return l.dbRewrapKeys(d)
+
+		case DbGetSubjectHistoryCmd:
+			return l.dbGetSubjectHistory(d)
+
+		case DbRevokeCertCmd:
+			return l.dbRevokeCert(d)
+
+		case DbAuditCmd:
+			return l.dbAudit(d)
+
+		case DbGetAuditLogCmd:
+			return l.dbGetAuditLog(d)
+
+		case DbMigrateCmd:
+			return l.dbMigrate(d)
+
+		case DbListSubjectsCmd:
+			return l.dbListSubjects(d)
+
+		case DbRestoreSubjCmd:
+			return l.dbRestoreSubject(d)
+
+		case DbExportCmd:
+			return l.dbExport(d)
+
+		case DbImportCmd:
+			return l.dbImport(d)
+
+		case DbClaimEnrollCmd:
+			return l.dbClaimEnrollment(d)
+
+		case DbReleaseEnrollCmd:
+			return l.dbReleaseEnrollment(d)
+
+		case DbEnrollKeyCmd:
+			return l.dbEnrollKey(d)
+
+		case DbEnrollAttemptCmd:
+			return l.dbAttemptEnrollment(d)
+
+		case DbResolveEnrollCmd:
+			return l.dbResolveEnrollment(d)
+
 		default:
 			d.Reject(false)
 			log.WithFields(logrus.Fields{logger.Cmd: d.Type}).Error("unknown")
@@ -54,9 +100,7 @@ func (l *Londo) ConsumeDbRPC() *Londo {
 func (l *Londo) dbGetAllSubjects(d amqp.Delivery) bool {
 	subjs, err := l.Db.FindAllSubjects()
 	if err != nil {
-		d.Reject(false)
-		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
-		return false
+		return l.reject(&d, err)
 	}
 
 	d.Ack(false)
@@ -75,6 +119,7 @@ func (l *Londo) dbGetAllSubjects(d amqp.Delivery) bool {
 			Targets:      s.Targets,
 			Outdated:     s.Outdated,
 			Unresolvable: s.UnresolvableAt,
+			Revision:     s.Revision,
 		}); err != nil {
 			log.WithFields(logrus.Fields{
 				logger.Exchange: CheckExchange,
@@ -101,6 +146,21 @@ func (l *Londo) dbGetAllSubjects(d amqp.Delivery) bool {
 
 func (l *Londo) dbUpdateSubject(d amqp.Delivery) bool {
 	certId, err := l.updateSubject(&d)
+
+	// subject was deleted since its certificate was ordered
+	if err == ErrSubjectNotFound {
+		d.Ack(false)
+		log.WithFields(logrus.Fields{
+			logger.CertID: certId, logger.Cmd: DbUpdateSubjCmd, logger.Reason: err}).Warn(logger.Skip)
+		return false
+	}
+
+	if err == ErrConflict {
+		d.Reject(true)
+		log.WithFields(logrus.Fields{logger.CertID: certId, logger.Reason: err}).Error(logger.Requeue)
+		return false
+	}
+
 	if err != nil {
 		d.Reject(false)
 		log.WithFields(logrus.Fields{logger.Action: logger.Rejected}).Error(err)
@@ -114,6 +174,18 @@ func (l *Londo) dbUpdateSubject(d amqp.Delivery) bool {
 
 func (l *Londo) dbAddSubject(d amqp.Delivery) bool {
 	subj, err := l.createNewSubject(&d)
+	if IsMalformed(err) {
+		return l.reject(&d, err)
+	}
+
+	// a subject was added already, i.e. by a redelivered request, so there is nothing to retry
+	if err == ErrConflict {
+		d.Ack(false)
+		log.WithFields(logrus.Fields{
+			logger.Subject: subj, logger.Cmd: DbAddSubjCmd, logger.Reason: err}).Error(logger.Skip)
+		return false
+	}
+
 	if err != nil {
 		d.Reject(true)
 		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Requeue)
@@ -127,12 +199,30 @@ func (l *Londo) dbAddSubject(d amqp.Delivery) bool {
 
 func (l *Londo) dbDeleteSubject(d amqp.Delivery) bool {
 	certId, err := l.deleteSubject(&d)
+
+	// subject was renewed, restored or already deleted since deletion was asked for
+	if err == ErrConflict || err == ErrSubjectNotFound {
+		d.Ack(false)
+		log.WithFields(logrus.Fields{
+			logger.CertID: certId, logger.Cmd: DbDeleteSubjCmd, logger.Reason: err}).Warn(logger.Skip)
+		return false
+	}
+
+	if IsMalformed(err) {
+		return l.reject(&d, err)
+	}
+
 	if err != nil {
 		d.Reject(true)
 		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Requeue)
 		return false
 	}
 
+	// a subject enrolled again is a new request, rather than a duplicate of the deleted one
+	if err := l.Db.DeleteEnrollment(certId); err != nil {
+		log.WithFields(logrus.Fields{logger.CertID: certId, logger.Reason: err}).Error(logger.Skip)
+	}
+
 	log.WithFields(logrus.Fields{logger.CertID: certId, logger.Cmd: DbDeleteSubjCmd}).Info(logger.Success)
 	d.Ack(false)
 	return false
@@ -140,29 +230,28 @@ func (l *Londo) dbDeleteSubject(d amqp.Delivery) bool {
 
 func (l *Londo) dbGetSubjects(d amqp.Delivery) bool {
 	var e GetSubjectEvent
-	if err := json.Unmarshal(d.Body, &e); err != nil {
-		// TODO: need to reply back to sender with an error
-		d.Reject(false)
-		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
-		return false
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
 	}
 
 	subj, err := l.Db.FindSubject(e.Subject)
-	if err := l.Publish(
-		GRPCServerExchange, d.ReplyTo, d.ReplyTo, CloseChannelCmd, &subj); err != nil {
-		return false
+	if err == ErrSubjectNotFound {
+		return l.fail(&d, rpcError(err, SubjectResource, e.Subject))
 	}
 
 	if err != nil {
-		// FIXME: ????
-		log.Error(errors.New("subject " + e.Subject + " not found"))
-	} else {
-		log.WithFields(logrus.Fields{
-			logger.Queue:   d.ReplyTo,
-			logger.Subject: subj.Subject,
-			logger.Cmd:     DbGetSubjectCmd}).Info(logger.Published)
+		return l.reject(&d, rpcError(err, SubjectResource, e.Subject))
+	}
+
+	if err := l.Reply(&d, CloseChannelCmd, &subj); err != nil {
+		return l.reject(&d, err)
 	}
 
+	log.WithFields(logrus.Fields{
+		logger.Queue:   d.ReplyTo,
+		logger.Subject: subj.Subject,
+		logger.Cmd:     DbGetSubjectCmd}).Info(logger.Published)
+
 	d.Ack(false)
 	return false
 }
@@ -173,10 +262,8 @@ func (l *Londo) dbSubjectByTarget(d amqp.Delivery, outdated bool) bool {
 		filter = "targets"
 	)
 
-	if err := json.Unmarshal(d.Body, &e); err != nil {
-		d.Reject(false)
-		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
-		return false
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
 	}
 
 	log.WithFields(logrus.Fields{
@@ -188,9 +275,7 @@ func (l *Londo) dbSubjectByTarget(d amqp.Delivery, outdated bool) bool {
 
 	subjs, err := l.Db.FindManySubjects(e.Target, filter)
 	if err != nil {
-		d.Reject(false)
-		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
-		return false
+		return l.reject(&d, err)
 	}
 
 	length := len(subjs) - 1
@@ -198,11 +283,8 @@ func (l *Londo) dbSubjectByTarget(d amqp.Delivery, outdated bool) bool {
 	if length == -1 {
 		var s Subject
 
-		if err := l.Publish(
-			GRPCServerExchange, d.ReplyTo, "", CloseChannelCmd, &s); err != nil {
-			d.Reject(false)
-			log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
-			return false
+		if err := l.Reply(&d, CloseChannelCmd, &s); err != nil {
+			return l.reject(&d, err)
 		}
 
 		log.WithFields(logrus.Fields{
@@ -218,11 +300,8 @@ func (l *Londo) dbSubjectByTarget(d amqp.Delivery, outdated bool) bool {
 			cmd = CloseChannelCmd
 		}
 
-		if err := l.Publish(
-			GRPCServerExchange, d.ReplyTo, d.ReplyTo, cmd, &subjs[i]); err != nil {
-			d.Reject(false)
-			log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
-			return false
+		if err := l.Reply(&d, cmd, &subjs[i]); err != nil {
+			return l.reject(&d, err)
 		}
 
 		log.WithFields(logrus.Fields{
@@ -237,8 +316,8 @@ func (l *Londo) dbSubjectByTarget(d amqp.Delivery, outdated bool) bool {
 
 func (l *Londo) dbExpiringSubjects(d amqp.Delivery) bool {
 	var e GetExpiringSubjEvent
-	if err := json.Unmarshal(d.Body, &e); err != nil {
-		return false
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
 	}
 
 	log.WithFields(logrus.Fields{
@@ -246,9 +325,7 @@ func (l *Londo) dbExpiringSubjects(d amqp.Delivery) bool {
 
 	exp, err := l.Db.FindExpiringSubjects(24 * int(e.Days))
 	if err != nil {
-		d.Reject(false)
-		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
-		return false
+		return l.reject(&d, err)
 	}
 
 	length := len(exp) - 1
@@ -257,17 +334,15 @@ func (l *Londo) dbExpiringSubjects(d amqp.Delivery) bool {
 	if length == -1 {
 		var s Subject
 
-		if err := l.Publish(
-			GRPCServerExchange, d.ReplyTo, d.ReplyTo, CloseChannelCmd, &s); err != nil {
-			d.Reject(false)
-			log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
-			return false
+		if err := l.Reply(&d, CloseChannelCmd, &s); err != nil {
+			return l.reject(&d, err)
 		}
 
 		log.WithFields(logrus.Fields{
 			logger.Queue: d.ReplyTo,
 			logger.Cmd:   DbGetExpiringSubjectsCmd}).Error("none")
 
+		d.Ack(false)
 		return false
 	}
 
@@ -277,11 +352,8 @@ func (l *Londo) dbExpiringSubjects(d amqp.Delivery) bool {
 			cmd = CloseChannelCmd
 		}
 
-		if err := l.Publish(
-			GRPCServerExchange, d.ReplyTo, d.ReplyTo, cmd, exp[i]); err != nil {
-			d.Reject(false)
-			log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
-			return false
+		if err := l.Reply(&d, cmd, exp[i]); err != nil {
+			return l.reject(&d, err)
 		}
 
 		log.WithFields(logrus.Fields{
@@ -296,19 +368,417 @@ func (l *Londo) dbExpiringSubjects(d amqp.Delivery) bool {
 
 func (l *Londo) dbStatusUpdate(d amqp.Delivery) bool {
 	var e CheckCertEvent
-	if err := json.Unmarshal(d.Body, &e); err != nil {
-		return false
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
 	}
 
 	log.WithFields(logrus.Fields{
 		logger.Subject: e.Subject, logger.Cmd: DbUpdateCertStatusCmd}).Info(logger.Consumed)
 
-	if err := l.Db.UpdateUnreachable(&e); err != nil {
+	err := l.Db.UpdateUnreachable(&e)
+
+	// a check result is stale once a subject has changed, the next check run will see the change
+	if err == ErrConflict || err == ErrSubjectNotFound {
+		d.Ack(false)
+		log.WithFields(logrus.Fields{
+			logger.Subject: e.Subject, logger.Cmd: DbUpdateCertStatusCmd, logger.Reason: err}).Warn(logger.Skip)
+		return false
+	}
+
+	if err != nil {
+		return l.reject(&d, err)
+	}
+
+	d.Ack(false)
+	return false
+}
+
+// dbRewrapKeys wraps data keys of every subject with an active key encryption key. Subjects
+// stored before encryption was enabled get their private keys sealed.
+func (l *Londo) dbRewrapKeys(d amqp.Delivery) bool {
+	if l.Keys == nil {
 		d.Reject(false)
-		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Rejected)
+		log.WithFields(logrus.Fields{logger.Reason: ErrNoKEK, logger.Cmd: DbRewrapKeysCmd}).Error(logger.Rejected)
 		return false
 	}
 
+	subjs, err := l.Db.FindAllSubjects()
+	if err != nil {
+		return l.reject(&d, err)
+	}
+
+	// deleted subjects can still be restored, so their keys must stay readable
+	deleted, err := l.Db.FindDeletedSubjects()
+	if err != nil {
+		return l.reject(&d, err)
+	}
+
+	subjs = append(subjs, deleted...)
+
 	d.Ack(false)
+
+	var count, failed int
+
+	for _, s := range subjs {
+		var changed bool
+
+		if s.EncryptedKey == nil {
+			s.EncryptedKey, err = l.Keys.Seal(s.Subject, s.PrivateKey)
+			changed = err == nil
+		} else {
+			changed, err = l.Keys.Rewrap(s.EncryptedKey)
+		}
+
+		if err == nil && changed {
+			// a conflicting subject keeps its old key, which is still readable, until the next rewrap
+			err = l.Db.UpdateSubjKey(s.ID.Hex(), s.Revision, s.EncryptedKey)
+		}
+
+		if err != nil {
+			failed++
+			log.WithFields(logrus.Fields{
+				logger.Subject: s.Subject,
+				logger.Cmd:     DbRewrapKeysCmd,
+				logger.Reason:  err}).Error(logger.Skip)
+			continue
+		}
+
+		if changed {
+			count++
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Cmd:    DbRewrapKeysCmd,
+		logger.KeyID:  l.Keys.ActiveID(),
+		logger.Count:  count,
+		logger.Failed: failed}).Info(logger.Success)
+
+	return false
+}
+
+// dbGetSubjectHistory replies with a single subject carrying all its certificate records.
+// Subject is looked up by history only, so records of deleted subjects are returned too.
+func (l *Londo) dbGetSubjectHistory(d amqp.Delivery) bool {
+	var e GetSubjectEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	h, err := l.Db.FindCertHistory(e.Subject)
+	if err != nil {
+		return l.reject(&d, rpcError(err, SubjectResource, e.Subject))
+	}
+
+	if len(h) == 0 {
+		return l.fail(&d, rpcError(ErrSubjectNotFound, SubjectResource, e.Subject))
+	}
+
+	s := Subject{Subject: e.Subject, History: h}
+
+	if err := l.Reply(&d, CloseChannelCmd, &s); err != nil {
+		return l.reject(&d, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Queue:   d.ReplyTo,
+		logger.Subject: e.Subject,
+		logger.Count:   len(h),
+		logger.Cmd:     DbGetSubjectHistoryCmd}).Info(logger.Published)
+
+	d.Ack(false)
+	return false
+}
+
+func (l *Londo) dbRevokeCert(d amqp.Delivery) bool {
+	var e RevokedCertEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	if err := l.Db.RevokeCertRecord(e.CertID, e.Reason, e.RevokedAt); err != nil {
+		d.Reject(true)
+		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Requeue)
+		return false
+	}
+
+	log.WithFields(logrus.Fields{logger.CertID: e.CertID, logger.Cmd: DbRevokeCertCmd}).Info(logger.Success)
+	d.Ack(false)
+	return false
+}
+
+func (l *Londo) dbAudit(d amqp.Delivery) bool {
+	var e AuditEntry
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	if err := l.Db.InsertAuditEntry(&e); err != nil {
+		d.Reject(true)
+		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Requeue)
+		return false
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Actor:   e.Actor,
+		logger.Action:  e.Action,
+		logger.Subject: e.Subject,
+		logger.Cmd:     DbAuditCmd}).Debug(logger.Success)
+
+	d.Ack(false)
+	return false
+}
+
+func (l *Londo) dbGetAuditLog(d amqp.Delivery) bool {
+	var e GetAuditLogEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	if e.To.IsZero() {
+		e.To = time.Now()
+	}
+
+	entries, err := l.Db.FindAuditEntries(e.From, e.To, e.Actor)
+	if err != nil {
+		return l.reject(&d, err)
+	}
+
+	length := len(entries) - 1
+	var cmd string
+
+	if length == -1 {
+		if err := l.Reply(&d, CloseChannelCmd, EmptyEvent{}); err != nil {
+			return l.reject(&d, err)
+		}
+
+		d.Ack(false)
+		return false
+	}
+
+	for i := 0; i <= length; i++ {
+
+		if i == length {
+			cmd = CloseChannelCmd
+		}
+
+		if err := l.Reply(&d, cmd, entries[i]); err != nil {
+			return l.reject(&d, err)
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Queue: d.ReplyTo,
+		logger.Count: len(entries),
+		logger.Cmd:   DbGetAuditLogCmd}).Info(logger.Published)
+
+	d.Ack(false)
+	return false
+}
+
+// dbMigrate replies with a report per pending migration
+func (l *Londo) dbMigrate(d amqp.Delivery) bool {
+	var e MigrateEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	reports, err := l.Migrate(e.DryRun)
+	if err != nil {
+		// reports of migrations applied before a failure are still sent back
+		log.WithFields(logrus.Fields{logger.Cmd: DbMigrateCmd, logger.Reason: err}).Error()
+	}
+
+	length := len(reports) - 1
+	var cmd string
+
+	if length == -1 {
+		if err := l.Reply(&d, CloseChannelCmd, EmptyEvent{}); err != nil {
+			return l.reject(&d, err)
+		}
+
+		d.Ack(false)
+		return false
+	}
+
+	for i := 0; i <= length; i++ {
+
+		if i == length {
+			cmd = CloseChannelCmd
+		}
+
+		if err := l.Reply(&d, cmd, reports[i]); err != nil {
+			return l.reject(&d, err)
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Queue:  d.ReplyTo,
+		logger.Count:  len(reports),
+		logger.DryRun: e.DryRun,
+		logger.Cmd:    DbMigrateCmd}).Info(logger.Published)
+
+	d.Ack(false)
+	return false
+}
+
+// dbListSubjects replies with a single page of subjects. Private keys never leave londo-dbd
+// through a listing, and a filter that can't be applied is reported back instead of a page.
+func (l *Londo) dbListSubjects(d amqp.Delivery) bool {
+	var f SubjectFilter
+	if err := Decode(&d, &f); err != nil {
+		return l.reject(&d, err)
+	}
+
+	if err := f.Validate(); err != nil {
+		return l.fail(&d, &RPCError{Code: InvalidCode, Name: "filter", Err: err})
+	}
+
+	var (
+		r   ListSubjectsReply
+		err error
+	)
+
+	r.Subjects, r.NextPageToken, err = l.Db.ListSubjects(&f)
+	if err != nil {
+		return l.reject(&d, rpcError(err, "", ""))
+	}
+
+	for i := range r.Subjects {
+		r.Subjects[i].PrivateKey = ""
+		r.Subjects[i].EncryptedKey = nil
+	}
+
+	if err := l.Reply(&d, CloseChannelCmd, &r); err != nil {
+		return l.reject(&d, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Queue: d.ReplyTo,
+		logger.Count: len(r.Subjects),
+		logger.Cmd:   DbListSubjectsCmd}).Info(logger.Published)
+
+	d.Ack(false)
+	return false
+}
+
+func (l *Londo) dbRestoreSubject(d amqp.Delivery) bool {
+	var e GetSubjectEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	r, err := l.restoreSubject(e.Subject)
+	if err == ErrSubjectNotFound || err == ErrSubjectExists {
+		return l.fail(&d, rpcError(err, SubjectResource, e.Subject))
+	}
+
+	if err != nil {
+		return l.reject(&d, rpcError(err, SubjectResource, e.Subject))
+	}
+
+	if err := l.Reply(&d, CloseChannelCmd, &r); err != nil {
+		return l.reject(&d, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Queue:   d.ReplyTo,
+		logger.Subject: e.Subject,
+		logger.Cmd:     DbRestoreSubjCmd}).Info(logger.Published)
+
+	d.Ack(false)
+	return false
+}
+
+// dbExport replies with every subject and certificate record, and a schema version last
+func (l *Londo) dbExport(d amqp.Delivery) bool {
+	items, err := l.exportItems()
+	if err != nil {
+		return l.reject(&d, err)
+	}
+
+	length := len(items) - 1
+	var cmd string
+
+	for i := 0; i <= length; i++ {
+
+		if i == length {
+			cmd = CloseChannelCmd
+		}
+
+		if err := l.Reply(&d, cmd, items[i]); err != nil {
+			return l.reject(&d, err)
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Queue: d.ReplyTo,
+		logger.Count: len(items),
+		logger.Cmd:   DbExportCmd}).Info(logger.Published)
+
+	d.Ack(false)
+	return false
+}
+
+func (l *Londo) dbImport(d amqp.Delivery) bool {
+	var e ImportEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	// subjects imported before a failure stay, so a failure tells how far an import went. A request
+	// carries private keys, so it is never dead-lettered.
+	r, err := l.importBundle(&e)
+	if _, ok := err.(*RPCError); ok {
+		return l.fail(&d, rpcError(err, "", ""))
+	}
+
+	if err != nil {
+		return l.fail(&d, &RPCError{Code: AbortedCode, Err: errors.New(err.Error() + ", after " +
+			strconv.Itoa(r.Imported+r.Replaced+r.Skipped) + " subjects and " + strconv.Itoa(r.Records) + " records")})
+	}
+
+	if err := l.Reply(&d, CloseChannelCmd, &r); err != nil {
+		return l.reject(&d, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Queue:   d.ReplyTo,
+		logger.Count:   r.Imported + r.Replaced,
+		logger.Skipped: r.Skipped,
+		logger.Cmd:     DbImportCmd}).Info(logger.Published)
+
+	d.Ack(false)
+	return false
+}
+
+// reject drops a request, and tells londo-grpcd about it when it waits for replies
+func (l *Londo) reject(d *amqp.Delivery, err error) bool {
+	if d.CorrelationId != "" {
+		if err := l.ReplyError(d, err); err != nil {
+			log.WithFields(logrus.Fields{logger.Queue: d.ReplyTo, logger.Reason: err}).Error(logger.Skip)
+		}
+	}
+
+	d.Reject(false)
+	log.WithFields(logrus.Fields{logger.Cmd: d.Type, logger.Reason: err}).Error(logger.Rejected)
+	return false
+}
+
+// fail tells londo-grpcd that a request can't be served, i.e. it asks for a subject which doesn't
+// exist. A request itself is fine, so it is acknowledged rather than dead-lettered.
+func (l *Londo) fail(d *amqp.Delivery, err *RPCError) bool {
+	if err := l.ReplyError(d, err); err != nil {
+		return l.reject(d, err)
+	}
+
+	d.Ack(false)
+
+	log.WithFields(logrus.Fields{
+		logger.Queue:  d.ReplyTo,
+		logger.Cmd:    d.Type,
+		logger.Code:   err.Code,
+		logger.Reason: err}).Warn(logger.Published)
+
 	return false
 }
@@ -0,0 +1,124 @@
+package londo
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+// request queues a request of londo-grpcd, a nil event sends a body which can't be decoded
+func request(t *testing.T, l *Londo, cmd string, e Event) amqp.Delivery {
+	t.Helper()
+
+	msg := amqp.Publishing{Body: []byte("{")}
+	if e != nil {
+		var err error
+		if msg, err = seal(e, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg.Type = cmd
+	msg.ReplyTo = testReplyQueue
+	msg.CorrelationId = "1"
+
+	if err := l.Bus.Emit(DbReplyExchange, DbReplyQueue, msg); err != nil {
+		t.Fatal(err)
+	}
+
+	return get(t, l.Bus.(*MemoryBus), DbReplyQueue)
+}
+
+// lastReply drains replies of a request, and returns a type of the last one, and a code
+// of an error reply
+func lastReply(t *testing.T, b *MemoryBus) (string, string) {
+	t.Helper()
+
+	var (
+		cmd = "none"
+		e   ErrorReply
+	)
+
+	if err := b.Drain(testReplyQueue, 0, func(d *amqp.Delivery) bool {
+		cmd = d.Type
+		if cmd == ErrorReplyCmd {
+			if err := Decode(d, &e); err != nil {
+				t.Error(err)
+			}
+		}
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd, e.Code
+}
+
+func TestDbHandlersSettle(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler func(l *Londo, d amqp.Delivery) bool
+		cmd     string
+		event   Event
+		reply   string
+		code    string
+	}{
+		{"expiring none", (*Londo).dbExpiringSubjects, DbGetExpiringSubjectsCmd, GetExpiringSubjEvent{Days: 30}, CloseChannelCmd, ""},
+		{"expiring malformed", (*Londo).dbExpiringSubjects, DbGetExpiringSubjectsCmd, nil, ErrorReplyCmd, InvalidCode},
+		{"status malformed", (*Londo).dbStatusUpdate, DbUpdateCertStatusCmd, nil, ErrorReplyCmd, InvalidCode},
+		{"get missing", (*Londo).dbGetSubjects, DbGetSubjectCmd, GetSubjectEvent{Subject: "a.example.com"}, ErrorReplyCmd, NotFoundCode},
+		{"get malformed", (*Londo).dbGetSubjects, DbGetSubjectCmd, nil, ErrorReplyCmd, InvalidCode},
+		{"history missing", (*Londo).dbGetSubjectHistory, DbGetSubjectHistoryCmd, GetSubjectEvent{Subject: "a.example.com"}, ErrorReplyCmd, NotFoundCode},
+		{"audit none", (*Londo).dbGetAuditLog, DbGetAuditLogCmd, GetAuditLogEvent{}, CloseChannelCmd, ""},
+		{"export", (*Londo).dbExport, DbExportCmd, EmptyEvent{}, CloseChannelCmd, ""},
+		{"target none", func(l *Londo, d amqp.Delivery) bool {
+			return l.dbSubjectByTarget(d, false)
+		}, DbGetSubjectByTargetCmd, GetSubjectByTargetEvent{Target: []string{"10.0.0.1"}}, CloseChannelCmd, ""},
+		{"restore malformed", (*Londo).dbRestoreSubject, DbRestoreSubjCmd, nil, ErrorReplyCmd, InvalidCode},
+		{"restore missing", (*Londo).dbRestoreSubject, DbRestoreSubjCmd, GetSubjectEvent{Subject: "a.example.com"}, ErrorReplyCmd, NotFoundCode},
+		{"list", (*Londo).dbListSubjects, DbListSubjectsCmd, SubjectFilter{}, CloseChannelCmd, ""},
+		{"list invalid", (*Londo).dbListSubjects, DbListSubjectsCmd, SubjectFilter{SortBy: "serial"}, ErrorReplyCmd, InvalidCode},
+		{"import newer", (*Londo).dbImport, DbImportCmd, ImportEvent{SchemaVersion: LatestSchemaVersion() + 1}, ErrorReplyCmd, InvalidCode},
+		{"import", (*Londo).dbImport, DbImportCmd, ImportEvent{}, CloseChannelCmd, ""},
+		{"claim malformed", (*Londo).dbClaimEnrollment, DbClaimEnrollCmd, nil, ErrorReplyCmd, InvalidCode},
+		{"enroll key malformed", (*Londo).dbEnrollKey, DbEnrollKeyCmd, nil, ErrorReplyCmd, InvalidCode},
+		{"enroll key missing", (*Londo).dbEnrollKey, DbEnrollKeyCmd, EnrollKeyEvent{Subject: "a.example.com", Key: "k1"}, CloseChannelCmd, ""},
+		{"attempt malformed", (*Londo).dbAttemptEnrollment, DbEnrollAttemptCmd, nil, ErrorReplyCmd, InvalidCode},
+		{"attempt missing", (*Londo).dbAttemptEnrollment, DbEnrollAttemptCmd, EnrollAttemptEvent{Subject: "a.example.com", Key: "k1"}, CloseChannelCmd, ""},
+		{"resolve malformed", (*Londo).dbResolveEnrollment, DbResolveEnrollCmd, nil, ErrorReplyCmd, InvalidCode},
+		{"resolve missing", (*Londo).dbResolveEnrollment, DbResolveEnrollCmd, ResolveEnrollEvent{Subject: "a.example.com"}, ErrorReplyCmd, NotFoundCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestDbd(t)
+			b := l.Bus.(*MemoryBus)
+
+			if tt.handler(l, request(t, l, tt.cmd, tt.event)) {
+				t.Error("handler asked a consumer to stop")
+			}
+
+			q, err := b.queue(DbReplyQueue)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			b.mu.Lock()
+			unacked := len(q.unacked)
+			b.mu.Unlock()
+
+			if unacked != 0 {
+				t.Errorf("%d deliveries left unacknowledged", unacked)
+			}
+
+			if n := count(t, b, DbReplyQueue); n != 0 {
+				t.Errorf("%d deliveries requeued", n)
+			}
+
+			reply, code := lastReply(t, b)
+			if reply != tt.reply || code != tt.code {
+				t.Errorf("last reply = %q %q, want %q %q", reply, code, tt.reply, tt.code)
+			}
+		})
+	}
+}
@@ -0,0 +1,580 @@
+package londo
+
+import (
+	"errors"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// States of an enrollment record
+const (
+	EnrollPending  = "pending"
+	EnrollReleased = "released"
+	EnrollOrdered  = "ordered"
+)
+
+// Outcomes of a claim, they tell londo-enrolld what to do with an enroll request
+const (
+	// a request is the one to order a certificate
+	ClaimProceed = "proceed"
+	// another request of a subject is being ordered, or has been ordered already
+	ClaimDuplicate = "duplicate"
+	// a request has been ordered already, only its follow-ups may be missing
+	ClaimOrdered = "ordered"
+	// a request has asked a CA for a certificate before, and may or may not have been ordered
+	ClaimInDoubt = "in_doubt"
+)
+
+// EnrollClaimTTL is how long a pending claim holds off other requests of a subject. A pending
+// claim of a request which has been dead-lettered in doubt is only given up after it, too, unless
+// an operator resolves it first.
+const EnrollClaimTTL = 24 * time.Hour
+
+// ErrInDoubt means a certificate may have been ordered already, so an order isn't repeated
+var ErrInDoubt = errors.New("enroll request may have been ordered already")
+
+// Enrollment records the latest enroll request of a subject by its idempotency key, it is claimed
+// before a CA is asked for a certificate, so a request is ordered at most once. A key and a CSR of
+// a request are kept with it until its subject is recorded, so every attempt orders the same CSR.
+// A claim is marked as attempted right before a CA is asked, only then a request is in doubt.
+type Enrollment struct {
+	Subject      string        `bson:"_id"`
+	Key          string        `bson:"key"`
+	State        string        `bson:"state"`
+	Claim        string        `bson:"claim,omitempty"`
+	Attempted    bool          `bson:"attempted,omitempty"`
+	CertID       int           `bson:"cert_id,omitempty"`
+	CSR          string        `bson:"csr,omitempty"`
+	PrivateKey   string        `bson:"private_key,omitempty"`
+	EncryptedKey *EncryptedKey `bson:"encrypted_key,omitempty"`
+	ClaimedAt    time.Time     `bson:"claimed_at"`
+	Revision     int64         `bson:"revision"`
+}
+
+// material tells whether a request has had its key and CSR recorded
+func (e *Enrollment) material() bool {
+	return e.CSR != ""
+}
+
+func (e *Enrollment) forget() {
+	e.CSR = ""
+	e.PrivateKey = ""
+	e.EncryptedKey = nil
+}
+
+type ClaimEnrollEvent struct {
+	Subject  string
+	Key      string
+	Replaces int
+}
+
+func (ClaimEnrollEvent) EventName() string {
+	return "enroll.claim"
+}
+
+// ClaimEnrollReply carries a key and a CSR recorded by an earlier attempt of a request, they are
+// empty if a request has yet to have them generated
+type ClaimEnrollReply struct {
+	Outcome      string
+	Claim        string
+	CertID       int
+	CSR          string
+	PrivateKey   string
+	EncryptedKey *EncryptedKey
+}
+
+func (ClaimEnrollReply) EventName() string {
+	return "enroll.claim.reply"
+}
+
+// EnrollKeyEvent records a key and a CSR of a claimed request before a CA is asked for
+// a certificate. The first ones recorded are kept, a reply tells whether they are these.
+type EnrollKeyEvent struct {
+	Subject      string
+	Key          string
+	Claim        string
+	CSR          string
+	PrivateKey   string
+	EncryptedKey *EncryptedKey
+}
+
+func (EnrollKeyEvent) EventName() string {
+	return "enroll.key"
+}
+
+// EnrollAttemptEvent marks a claim as attempted right before a CA is asked for a certificate.
+// Only the first attempt of a claim proceeds, a reply tells whether it is this one.
+type EnrollAttemptEvent struct {
+	Subject string
+	Key     string
+	Claim   string
+}
+
+func (EnrollAttemptEvent) EventName() string {
+	return "enroll.attempt"
+}
+
+// ResolveEnrollEvent settles a request dead-lettered in doubt once an operator has checked a CA.
+// Without a certificate id a request is released, with one it is recorded as ordered.
+type ResolveEnrollEvent struct {
+	Subject string
+	CertID  int
+}
+
+func (ResolveEnrollEvent) EventName() string {
+	return "enroll.resolve"
+}
+
+type ResolveEnrollReply struct {
+	Subject string
+	State   string
+}
+
+func (ResolveEnrollReply) EventName() string {
+	return "enroll.resolve.reply"
+}
+
+// ReleaseEnrollEvent gives a claim up, once a CA has certainly not ordered a certificate
+type ReleaseEnrollEvent struct {
+	Subject string
+	Key     string
+	Claim   string
+}
+
+func (ReleaseEnrollEvent) EventName() string {
+	return "enroll.release"
+}
+
+// claim decides what happens to a request given the latest one of a subject, nil if there is none.
+// A request which proceeds takes a record over.
+func (c *ClaimEnrollEvent) claim(e *Enrollment, now time.Time) string {
+	if e == nil {
+		return ClaimProceed
+	}
+
+	stale := now.Sub(e.ClaimedAt) > EnrollClaimTTL
+
+	if e.Key == c.Key {
+		switch {
+		case e.State == EnrollOrdered:
+			return ClaimOrdered
+		// a request which has yet to ask a CA for anything goes on with its key and CSR, if any
+		case e.State == EnrollPending && !stale && e.Attempted:
+			return ClaimInDoubt
+		default:
+			return ClaimProceed
+		}
+	}
+
+	switch {
+	case e.State == EnrollOrdered && (c.Replaces == 0 || c.Replaces != e.CertID):
+		return ClaimDuplicate
+	case e.State == EnrollPending && !stale:
+		return ClaimDuplicate
+	default:
+		return ClaimProceed
+	}
+}
+
+// claimEnrollment records a request as pending, unless another one stands in its way
+func (l *Londo) claimEnrollment(c *ClaimEnrollEvent) (ClaimEnrollReply, error) {
+	var err error
+
+	for i := 0; i < UpdateRetries; i++ {
+		var (
+			found Enrollment
+			e     *Enrollment
+			rev   int64
+		)
+
+		found, err = l.Db.FindEnrollment(c.Subject)
+		switch {
+		case err == nil:
+			e, rev = &found, found.Revision
+		case err != ErrEnrollmentNotFound:
+			return ClaimEnrollReply{}, err
+		}
+
+		outcome := c.claim(e, time.Now())
+		if outcome != ClaimProceed {
+			return claimReply(outcome, &found), nil
+		}
+
+		claimed := &Enrollment{
+			Subject:   c.Subject,
+			Key:       c.Key,
+			State:     EnrollPending,
+			Claim:     newID(),
+			ClaimedAt: time.Now(),
+		}
+
+		// a later delivery of a request which never asked a CA orders a key and a CSR of the first one
+		if e != nil && e.Key == c.Key {
+			claimed.CSR = e.CSR
+			claimed.PrivateKey = e.PrivateKey
+			claimed.EncryptedKey = e.EncryptedKey
+		}
+
+		err = l.Db.SaveEnrollment(claimed, rev)
+
+		if err == nil {
+			return claimReply(ClaimProceed, claimed), nil
+		}
+
+		if err != ErrConflict {
+			return ClaimEnrollReply{}, err
+		}
+	}
+
+	return ClaimEnrollReply{}, err
+}
+
+func claimReply(outcome string, e *Enrollment) ClaimEnrollReply {
+	return ClaimEnrollReply{
+		Outcome:      outcome,
+		Claim:        e.Claim,
+		CertID:       e.CertID,
+		CSR:          e.CSR,
+		PrivateKey:   e.PrivateKey,
+		EncryptedKey: e.EncryptedKey,
+	}
+}
+
+// updateEnrollment changes a state of a request's record, records of other requests are left alone.
+// A key of an ordered request is forgotten, since a subject event carries it on.
+func (l *Londo) updateEnrollment(subject string, key string, state string, certId int) error {
+	return l.changeEnrollment(subject, key, func(e *Enrollment) bool {
+		if e.State == state && e.CertID == certId && (state != EnrollOrdered || !e.material()) {
+			return false
+		}
+
+		e.State = state
+		e.CertID = certId
+
+		if state == EnrollOrdered {
+			e.forget()
+		}
+
+		return true
+	})
+}
+
+// changeEnrollment applies f to a request's record, and saves it if f tells it has changed
+func (l *Londo) changeEnrollment(subject string, key string, f func(e *Enrollment) bool) error {
+	var err error
+
+	for i := 0; i < UpdateRetries; i++ {
+		var e Enrollment
+
+		e, err = l.Db.FindEnrollment(subject)
+		if err != nil {
+			return err
+		}
+
+		if e.Key != key {
+			return ErrConflict
+		}
+
+		if !f(&e) {
+			return nil
+		}
+
+		if err = l.Db.SaveEnrollment(&e, e.Revision); err != ErrConflict {
+			return err
+		}
+	}
+
+	return err
+}
+
+// recordEnrollKey keeps a key and a CSR of a pending claim. Material recorded first stays, and
+// a delivery whose claim has been taken over by another one learns it is a duplicate.
+func (l *Londo) recordEnrollKey(k *EnrollKeyEvent) (ClaimEnrollReply, error) {
+	var r ClaimEnrollReply
+
+	// a key is only ever stored sealed where londo-dbd has a key ring
+	if l.Keys != nil && k.PrivateKey != "" {
+		sealed, err := l.Keys.Seal(k.Subject, k.PrivateKey)
+		if err != nil {
+			return r, err
+		}
+
+		k.PrivateKey = ""
+		k.EncryptedKey = sealed
+	}
+
+	err := l.changeEnrollment(k.Subject, k.Key, func(e *Enrollment) bool {
+		if e.State != EnrollPending || e.Claim != k.Claim || e.material() {
+			r = claimReply(ClaimDuplicate, e)
+			return false
+		}
+
+		e.CSR = k.CSR
+		e.PrivateKey = k.PrivateKey
+		e.EncryptedKey = k.EncryptedKey
+
+		r = claimReply(ClaimProceed, e)
+		return true
+	})
+
+	// a claim has been taken over by another request
+	if err == ErrConflict || err == ErrEnrollmentNotFound {
+		return ClaimEnrollReply{Outcome: ClaimDuplicate}, nil
+	}
+
+	return r, err
+}
+
+// releaseEnrollment gives a pending claim up, a claim which another delivery has taken over is left alone
+func (l *Londo) releaseEnrollment(r *ReleaseEnrollEvent) error {
+	return l.changeEnrollment(r.Subject, r.Key, func(e *Enrollment) bool {
+		if e.State != EnrollPending || e.Claim != r.Claim {
+			return false
+		}
+
+		e.State = EnrollReleased
+		e.CertID = 0
+
+		return true
+	})
+}
+
+// attemptEnrollment marks a claim as attempted. A claim which has been taken over by another
+// delivery, or attempted already, isn't asked for again.
+func (l *Londo) attemptEnrollment(a *EnrollAttemptEvent) (ClaimEnrollReply, error) {
+	var r ClaimEnrollReply
+
+	err := l.changeEnrollment(a.Subject, a.Key, func(e *Enrollment) bool {
+		if e.State != EnrollPending || e.Claim != a.Claim || e.Attempted {
+			r = claimReply(ClaimDuplicate, e)
+			return false
+		}
+
+		e.Attempted = true
+
+		r = claimReply(ClaimProceed, e)
+		return true
+	})
+
+	if err == ErrConflict || err == ErrEnrollmentNotFound {
+		return ClaimEnrollReply{Outcome: ClaimDuplicate}, nil
+	}
+
+	return r, err
+}
+
+// resolveEnrollment settles a pending request. A released one is ordered again with its key and
+// CSR, an ordered one only has its subject recorded and its certificate collected.
+func (l *Londo) resolveEnrollment(r *ResolveEnrollEvent) (ResolveEnrollReply, error) {
+	var err error
+
+	for i := 0; i < UpdateRetries; i++ {
+		var e Enrollment
+
+		e, err = l.Db.FindEnrollment(r.Subject)
+		if err != nil {
+			return ResolveEnrollReply{}, err
+		}
+
+		if e.State != EnrollPending {
+			return ResolveEnrollReply{}, &RPCError{
+				Code:     ConflictCode,
+				Resource: EnrollmentResource,
+				Name:     r.Subject,
+				Err:      errors.New("enrollment is " + e.State + ", only a pending one can be resolved"),
+			}
+		}
+
+		e.State = EnrollReleased
+		if r.CertID > 0 {
+			e.State = EnrollOrdered
+		}
+		e.CertID = r.CertID
+
+		if err = l.Db.SaveEnrollment(&e, e.Revision); err == nil {
+			return ResolveEnrollReply{Subject: e.Subject, State: e.State}, nil
+		}
+
+		if err != ErrConflict {
+			return ResolveEnrollReply{}, err
+		}
+	}
+
+	return ResolveEnrollReply{}, err
+}
+
+func (l *Londo) dbClaimEnrollment(d amqp.Delivery) bool {
+	var e ClaimEnrollEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	r, err := l.claimEnrollment(&e)
+	if err != nil {
+		return l.reject(&d, rpcError(err, SubjectResource, e.Subject))
+	}
+
+	if err := l.Reply(&d, CloseChannelCmd, r); err != nil {
+		return l.reject(&d, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Subject: e.Subject, logger.ID: e.Key, logger.Cmd: DbClaimEnrollCmd, logger.Reason: r.Outcome}).Info(logger.Success)
+
+	d.Ack(false)
+	return false
+}
+
+func (l *Londo) dbReleaseEnrollment(d amqp.Delivery) bool {
+	var e ReleaseEnrollEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	err := l.releaseEnrollment(&e)
+
+	// another request has claimed a subject since
+	if err == ErrConflict || err == ErrEnrollmentNotFound {
+		d.Ack(false)
+		log.WithFields(logrus.Fields{
+			logger.Subject: e.Subject, logger.ID: e.Key, logger.Cmd: DbReleaseEnrollCmd, logger.Reason: err}).Warn(logger.Skip)
+		return false
+	}
+
+	if err != nil {
+		d.Reject(true)
+		log.WithFields(logrus.Fields{logger.Reason: err}).Error(logger.Requeue)
+		return false
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Subject: e.Subject, logger.ID: e.Key, logger.Cmd: DbReleaseEnrollCmd}).Info(logger.Success)
+
+	d.Ack(false)
+	return false
+}
+
+func (l *Londo) dbEnrollKey(d amqp.Delivery) bool {
+	var e EnrollKeyEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	r, err := l.recordEnrollKey(&e)
+	if err != nil {
+		return l.reject(&d, rpcError(err, EnrollmentResource, e.Subject))
+	}
+
+	if err := l.Reply(&d, CloseChannelCmd, r); err != nil {
+		return l.reject(&d, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Subject: e.Subject, logger.ID: e.Key, logger.Cmd: DbEnrollKeyCmd, logger.Reason: r.Outcome}).Info(logger.Success)
+
+	d.Ack(false)
+	return false
+}
+
+func (l *Londo) dbAttemptEnrollment(d amqp.Delivery) bool {
+	var e EnrollAttemptEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	r, err := l.attemptEnrollment(&e)
+	if err != nil {
+		return l.reject(&d, rpcError(err, EnrollmentResource, e.Subject))
+	}
+
+	if err := l.Reply(&d, CloseChannelCmd, r); err != nil {
+		return l.reject(&d, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Subject: e.Subject, logger.ID: e.Key, logger.Cmd: DbEnrollAttemptCmd, logger.Reason: r.Outcome}).Info(logger.Success)
+
+	d.Ack(false)
+	return false
+}
+
+func (l *Londo) dbResolveEnrollment(d amqp.Delivery) bool {
+	var e ResolveEnrollEvent
+	if err := Decode(&d, &e); err != nil {
+		return l.reject(&d, err)
+	}
+
+	r, err := l.resolveEnrollment(&e)
+	if _, ok := err.(*RPCError); ok || err == ErrEnrollmentNotFound {
+		return l.fail(&d, rpcError(err, EnrollmentResource, e.Subject))
+	}
+
+	if err != nil {
+		return l.reject(&d, rpcError(err, EnrollmentResource, e.Subject))
+	}
+
+	if err := l.Reply(&d, CloseChannelCmd, r); err != nil {
+		return l.reject(&d, err)
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Subject: e.Subject, logger.CertID: e.CertID, logger.Cmd: DbResolveEnrollCmd, logger.Reason: r.State}).Info(logger.Success)
+
+	d.Ack(false)
+	return false
+}
+
+// ClaimEnrollment asks londo-dbd whether an enroll request is the one to order a certificate
+func (l *Londo) ClaimEnrollment(e *EnrollEvent) (ClaimEnrollReply, error) {
+	var r ClaimEnrollReply
+
+	err := l.call(DbClaimEnrollCmd, ClaimEnrollEvent{Subject: e.Subject, Key: e.Key, Replaces: e.Replaces}, &r)
+	return r, err
+}
+
+// RecordEnrollKey asks londo-dbd to keep a key and a CSR of a claimed enroll request
+func (l *Londo) RecordEnrollKey(e *EnrollEvent, claim string, s *Subject) (ClaimEnrollReply, error) {
+	var r ClaimEnrollReply
+
+	err := l.call(DbEnrollKeyCmd, EnrollKeyEvent{
+		Subject:      e.Subject,
+		Key:          e.Key,
+		Claim:        claim,
+		CSR:          s.CSR,
+		PrivateKey:   s.PrivateKey,
+		EncryptedKey: s.EncryptedKey,
+	}, &r)
+	return r, err
+}
+
+// AttemptEnrollment asks londo-dbd to mark a claim as attempted, right before a CA is asked
+func (l *Londo) AttemptEnrollment(e *EnrollEvent, claim string) (ClaimEnrollReply, error) {
+	var r ClaimEnrollReply
+
+	err := l.call(DbEnrollAttemptCmd, EnrollAttemptEvent{Subject: e.Subject, Key: e.Key, Claim: claim}, &r)
+	return r, err
+}
+
+// ReleaseEnrollment lets an enroll request be ordered again on its next attempt
+func (l *Londo) ReleaseEnrollment(e *EnrollEvent, claim string) {
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Subject:  e.Subject,
+		logger.ID:       e.Key}
+
+	if err := l.Publish(DbReplyExchange, DbReplyQueue, "", DbReleaseEnrollCmd, ReleaseEnrollEvent{
+		Subject: e.Subject,
+		Key:     e.Key,
+		Claim:   claim,
+	}); err != nil {
+		fields[logger.Reason] = err
+		log.WithFields(fields).Error(logger.Skip)
+		return
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+}
@@ -0,0 +1,206 @@
+package londo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClaim(t *testing.T) {
+	var (
+		now   = time.Now()
+		fresh = now.Add(-time.Hour)
+		stale = now.Add(-EnrollClaimTTL - time.Hour)
+	)
+
+	tests := []struct {
+		name string
+		c    ClaimEnrollEvent
+		e    *Enrollment
+		want string
+	}{
+		{"first request", ClaimEnrollEvent{Key: "k1"}, nil, ClaimProceed},
+
+		{"same, ordered", ClaimEnrollEvent{Key: "k1"},
+			&Enrollment{Key: "k1", State: EnrollOrdered, CertID: 1, ClaimedAt: fresh}, ClaimOrdered},
+		{"same, attempted", ClaimEnrollEvent{Key: "k1"},
+			&Enrollment{Key: "k1", State: EnrollPending, CSR: "csr", Attempted: true, ClaimedAt: fresh}, ClaimInDoubt},
+		{"same, pending with a CSR", ClaimEnrollEvent{Key: "k1"},
+			&Enrollment{Key: "k1", State: EnrollPending, CSR: "csr", ClaimedAt: fresh}, ClaimProceed},
+		{"same, pending without a CSR", ClaimEnrollEvent{Key: "k1"},
+			&Enrollment{Key: "k1", State: EnrollPending, ClaimedAt: fresh}, ClaimProceed},
+		{"same, stale attempted", ClaimEnrollEvent{Key: "k1"},
+			&Enrollment{Key: "k1", State: EnrollPending, CSR: "csr", Attempted: true, ClaimedAt: stale}, ClaimProceed},
+		{"same, released", ClaimEnrollEvent{Key: "k1"},
+			&Enrollment{Key: "k1", State: EnrollReleased, CSR: "csr", ClaimedAt: fresh}, ClaimProceed},
+
+		{"other, ordered", ClaimEnrollEvent{Key: "k2"},
+			&Enrollment{Key: "k1", State: EnrollOrdered, CertID: 1, ClaimedAt: fresh}, ClaimDuplicate},
+		{"other, replaces ordered", ClaimEnrollEvent{Key: "k2", Replaces: 1},
+			&Enrollment{Key: "k1", State: EnrollOrdered, CertID: 1, ClaimedAt: fresh}, ClaimProceed},
+		{"other, replaces another certificate", ClaimEnrollEvent{Key: "k2", Replaces: 2},
+			&Enrollment{Key: "k1", State: EnrollOrdered, CertID: 1, ClaimedAt: fresh}, ClaimDuplicate},
+		{"other, pending", ClaimEnrollEvent{Key: "k2"},
+			&Enrollment{Key: "k1", State: EnrollPending, ClaimedAt: fresh}, ClaimDuplicate},
+		{"other, attempted", ClaimEnrollEvent{Key: "k2"},
+			&Enrollment{Key: "k1", State: EnrollPending, Attempted: true, ClaimedAt: fresh}, ClaimDuplicate},
+		{"other, stale pending", ClaimEnrollEvent{Key: "k2"},
+			&Enrollment{Key: "k1", State: EnrollPending, CSR: "csr", ClaimedAt: stale}, ClaimProceed},
+		{"other, released", ClaimEnrollEvent{Key: "k2"},
+			&Enrollment{Key: "k1", State: EnrollReleased, ClaimedAt: fresh}, ClaimProceed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.claim(tt.e, now); got != tt.want {
+				t.Errorf("claim() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnrollKeyIsKept(t *testing.T) {
+	l := newTestDbd(t)
+
+	c := &ClaimEnrollEvent{Subject: "a.example.com", Key: "k1"}
+	claimed, err := l.claimEnrollment(c)
+	if err != nil || claimed.Outcome != ClaimProceed || claimed.CSR != "" || claimed.Claim == "" {
+		t.Fatalf("claim = %+v, %v, want to proceed without a CSR", claimed, err)
+	}
+
+	first := &EnrollKeyEvent{Subject: c.Subject, Key: c.Key, Claim: claimed.Claim, CSR: "csr1", PrivateKey: "key1"}
+	if r, err := l.recordEnrollKey(first); err != nil || r.Outcome != ClaimProceed || r.CSR != "csr1" {
+		t.Fatalf("record = %+v, %v, want csr1 recorded", r, err)
+	}
+
+	// a concurrent delivery of the same claim loses
+	second := &EnrollKeyEvent{Subject: c.Subject, Key: c.Key, Claim: claimed.Claim, CSR: "csr2", PrivateKey: "key2"}
+	if r, err := l.recordEnrollKey(second); err != nil || r.Outcome != ClaimDuplicate {
+		t.Fatalf("second record = %+v, %v, want a duplicate", r, err)
+	}
+
+	// a delivery whose reply was lost claims again, and goes on with csr1
+	again, err := l.claimEnrollment(c)
+	if err != nil || again.Outcome != ClaimProceed || again.CSR != "csr1" || again.PrivateKey != "key1" {
+		t.Fatalf("claim with a recorded CSR = %+v, %v, want csr1 and key1", again, err)
+	}
+
+	// a delivery whose claim was taken over neither records a key, nor asks a CA
+	if r, err := l.recordEnrollKey(first); err != nil || r.Outcome != ClaimDuplicate {
+		t.Fatalf("record of a claim taken over = %+v, %v, want a duplicate", r, err)
+	}
+
+	if r, err := l.attemptEnrollment(&EnrollAttemptEvent{Subject: c.Subject, Key: c.Key, Claim: claimed.Claim}); err != nil || r.Outcome != ClaimDuplicate {
+		t.Fatalf("attempt of a claim taken over = %+v, %v, want a duplicate", r, err)
+	}
+
+	if r, err := l.attemptEnrollment(&EnrollAttemptEvent{Subject: c.Subject, Key: c.Key, Claim: again.Claim}); err != nil || r.Outcome != ClaimProceed {
+		t.Fatalf("attempt = %+v, %v, want to proceed", r, err)
+	}
+
+	if r, err := l.claimEnrollment(c); err != nil || r.Outcome != ClaimInDoubt {
+		t.Fatalf("claim of an attempted request = %+v, %v, want in doubt", r, err)
+	}
+
+	// a released request is ordered again with its first key and CSR
+	if err := l.releaseEnrollment(&ReleaseEnrollEvent{Subject: c.Subject, Key: c.Key, Claim: again.Claim}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := l.claimEnrollment(c)
+	if err != nil || r.Outcome != ClaimProceed || r.CSR != "csr1" || r.PrivateKey != "key1" {
+		t.Fatalf("claim after a release = %+v, %v, want csr1 and key1", r, err)
+	}
+
+	// another request starts over
+	if err := l.releaseEnrollment(&ReleaseEnrollEvent{Subject: c.Subject, Key: c.Key, Claim: r.Claim}); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err = l.claimEnrollment(&ClaimEnrollEvent{Subject: c.Subject, Key: "k2"})
+	if err != nil || r.Outcome != ClaimProceed || r.CSR != "" {
+		t.Fatalf("claim of another request = %+v, %v, want to proceed without a CSR", r, err)
+	}
+
+	if r, err := l.recordEnrollKey(first); err != nil || r.Outcome != ClaimDuplicate {
+		t.Errorf("record of a replaced request = %+v, %v, want a duplicate", r, err)
+	}
+}
+
+func TestReleaseEnrollment(t *testing.T) {
+	tests := []struct {
+		name  string
+		state string
+		claim string
+		want  string
+	}{
+		{"pending", EnrollPending, "c1", EnrollReleased},
+		{"taken over", EnrollPending, "c2", EnrollPending},
+		{"ordered", EnrollOrdered, "c1", EnrollOrdered},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestDbd(t)
+
+			if err := l.Db.SaveEnrollment(&Enrollment{
+				Subject: "a.example.com", Key: "k1", State: tt.state, Claim: "c1", ClaimedAt: time.Now()}, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := l.releaseEnrollment(&ReleaseEnrollEvent{Subject: "a.example.com", Key: "k1", Claim: tt.claim}); err != nil {
+				t.Fatal(err)
+			}
+
+			if e, err := l.Db.FindEnrollment("a.example.com"); err != nil || e.State != tt.want {
+				t.Errorf("enrollment = %+v, %v, want %s", e, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveEnrollment(t *testing.T) {
+	tests := []struct {
+		name     string
+		state    string
+		certId   int
+		want     string
+		wantCode string
+	}{
+		{"release", EnrollPending, 0, EnrollReleased, ""},
+		{"order", EnrollPending, 7, EnrollOrdered, ""},
+		{"released", EnrollReleased, 0, "", ConflictCode},
+		{"ordered", EnrollOrdered, 7, "", ConflictCode},
+		{"missing", "", 0, "", NotFoundCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestDbd(t)
+
+			if tt.state != "" {
+				if err := l.Db.SaveEnrollment(&Enrollment{
+					Subject: "a.example.com", Key: "k1", State: tt.state, CSR: "csr", ClaimedAt: time.Now()}, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r, err := l.resolveEnrollment(&ResolveEnrollEvent{Subject: "a.example.com", CertID: tt.certId})
+			if tt.wantCode != "" {
+				if e := rpcError(err, EnrollmentResource, ""); e.Code != tt.wantCode {
+					t.Errorf("resolve = %v, want %s", err, tt.wantCode)
+				}
+				return
+			}
+
+			if err != nil || r.State != tt.want {
+				t.Fatalf("resolve = %+v, %v, want %s", r, err, tt.want)
+			}
+
+			e, err := l.Db.FindEnrollment("a.example.com")
+			if err != nil || e.State != tt.want || e.CertID != tt.certId || e.CSR != "csr" {
+				t.Errorf("enrollment = %+v, %v, want %s as %d keeping its CSR", e, err, tt.want, tt.certId)
+			}
+		})
+	}
+}
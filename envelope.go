@@ -0,0 +1,232 @@
+package londo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Headers every message carries besides its payload. A message id, a timestamp and a producer
+// are kept in message properties.
+const (
+	EventHeader   = "x-londo-event"
+	VersionHeader = "x-londo-version"
+
+	// LegacyVersion is assumed for messages published before events were versioned
+	LegacyVersion = 1
+)
+
+var (
+	ErrUnknownEvent    = errors.New("unknown event")
+	ErrUnknownVersion  = errors.New("unknown event version")
+	ErrUnexpectedEvent = errors.New("unexpected event")
+)
+
+// Envelope describes a message apart from its payload
+type Envelope struct {
+	Event    string
+	Version  int
+	ID       string
+	Time     time.Time
+	Producer string
+}
+
+// MalformedError tells that a message can't be decoded, so there is no point in retrying it
+type MalformedError struct {
+	Err error
+}
+
+func (e *MalformedError) Error() string {
+	return "malformed message: " + e.Err.Error()
+}
+
+func malformed(err error) error {
+	return &MalformedError{Err: err}
+}
+
+type eventType struct {
+	version int
+	typ     reflect.Type
+}
+
+var registry = make(map[string]eventType)
+
+func init() {
+	RegisterEvent(EmptyEvent{}, 1)
+	RegisterEvent(ErrorReply{}, 2)
+	RegisterEvent(Subject{}, 1)
+
+	RegisterEvent(EnrollEvent{}, 2)
+	RegisterEvent(CollectEvent{}, 1)
+	RegisterEvent(CompleteEnrollEvent{}, 1)
+	RegisterEvent(NewSubjectEvent{}, 3)
+	RegisterEvent(RevokeEvent{}, 2)
+	RegisterEvent(RevokedCertEvent{}, 1)
+	RegisterEvent(CheckCertEvent{}, 1)
+
+	RegisterEvent(GetSubjectEvent{}, 1)
+	RegisterEvent(GetSubjectByTargetEvent{}, 1)
+	RegisterEvent(GetExpiringSubjEvent{}, 1)
+	RegisterEvent(ExpiringSubjectEvent{}, 1)
+	RegisterEvent(SubjectFilter{}, 1)
+	RegisterEvent(ListSubjectsReply{}, 2)
+	RegisterEvent(RestoreSubjectReply{}, 2)
+
+	RegisterEvent(ClaimEnrollEvent{}, 1)
+	RegisterEvent(ClaimEnrollReply{}, 3)
+	RegisterEvent(ReleaseEnrollEvent{}, 2)
+	RegisterEvent(EnrollKeyEvent{}, 2)
+	RegisterEvent(EnrollAttemptEvent{}, 1)
+	RegisterEvent(ResolveEnrollEvent{}, 1)
+	RegisterEvent(ResolveEnrollReply{}, 1)
+
+	RegisterEvent(AuditEntry{}, 1)
+	RegisterEvent(GetAuditLogEvent{}, 1)
+	RegisterEvent(MigrateEvent{}, 1)
+	RegisterEvent(MigrationReport{}, 1)
+	RegisterEvent(ExportItem{}, 1)
+	RegisterEvent(ImportEvent{}, 1)
+	RegisterEvent(ImportReport{}, 2)
+}
+
+// RegisterEvent maps an event name to its Go type and a schema version it is published with.
+// A change to an event's fields needs a new version, consumers reject versions they don't know.
+func RegisterEvent(e Event, version int) {
+	name := e.EventName()
+
+	if _, ok := registry[name]; ok {
+		panic("event " + name + " is already registered")
+	}
+
+	registry[name] = eventType{version: version, typ: reflect.TypeOf(e)}
+}
+
+// lookup finds a registered event by its Go type, a pointer to an event is the event itself
+func lookup(e Event) (string, eventType, error) {
+	t := reflect.TypeOf(e)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	name := e.EventName()
+
+	et, ok := registry[name]
+	if !ok || et.typ != t {
+		return name, et, errors.New(ErrUnknownEvent.Error() + ": " + t.String())
+	}
+
+	return name, et, nil
+}
+
+// NewEvent returns a pointer to a zero event registered under a name
+func NewEvent(name string) (Event, error) {
+	et, ok := registry[name]
+	if !ok {
+		return nil, errors.New(ErrUnknownEvent.Error() + ": " + name)
+	}
+
+	return reflect.New(et.typ).Interface().(Event), nil
+}
+
+// Open reads an envelope of a delivery. A message without one is a legacy message, it carries
+// no event name and is of LegacyVersion.
+func Open(d *amqp.Delivery) (Envelope, error) {
+	env := Envelope{
+		Version:  LegacyVersion,
+		ID:       d.MessageId,
+		Time:     d.Timestamp,
+		Producer: d.AppId,
+	}
+
+	if v, ok := d.Headers[EventHeader]; ok {
+		name, ok := v.(string)
+		if !ok {
+			return env, errors.New("invalid " + EventHeader + " header")
+		}
+		env.Event = name
+	}
+
+	switch v := d.Headers[VersionHeader].(type) {
+	case nil:
+	case int32:
+		env.Version = int(v)
+	case int64:
+		env.Version = int(v)
+	case int:
+		env.Version = v
+	default:
+		return env, errors.New("invalid " + VersionHeader + " header")
+	}
+
+	return env, nil
+}
+
+// Decode decodes a payload into a pointer to an event. A message has to carry an event of the
+// same type and of a known version, and a payload can't have fields an event doesn't know.
+// Failures are always a MalformedError.
+func Decode(d *amqp.Delivery, v Event) error {
+	env, err := Open(d)
+	if err != nil {
+		return malformed(err)
+	}
+
+	name, et, err := lookup(v)
+	if err != nil {
+		return malformed(err)
+	}
+
+	if env.Event != "" && env.Event != name {
+		return malformed(errors.New(ErrUnexpectedEvent.Error() + ": " + env.Event + ", expected " + name))
+	}
+
+	if env.Version != et.version {
+		return malformed(errors.New(
+			ErrUnknownVersion.Error() + ": " + name + " v" + strconv.Itoa(env.Version)))
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(d.Body))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return malformed(err)
+	}
+
+	return nil
+}
+
+// IsMalformed tells whether an error is a MalformedError
+func IsMalformed(err error) bool {
+	_, ok := err.(*MalformedError)
+	return ok
+}
+
+// seal wraps an event into a message, it is given a new id and is stamped with a producer
+func seal(e Event, producer string) (amqp.Publishing, error) {
+	name, et, err := lookup(e)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		return amqp.Publishing{}, err
+	}
+
+	return amqp.Publishing{
+		Headers: amqp.Table{
+			EventHeader:   name,
+			VersionHeader: int32(et.version),
+		},
+		ContentType:  ContentType,
+		DeliveryMode: amqp.Persistent,
+		MessageId:    newID(),
+		Timestamp:    time.Now().UTC(),
+		AppId:        producer,
+		Body:         body,
+	}, nil
+}
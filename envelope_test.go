@@ -0,0 +1,128 @@
+package londo
+
+import (
+	"testing"
+
+	"github.com/streadway/amqp"
+)
+
+// unregisteredEvent is never registered, so it can't be published or decoded
+type unregisteredEvent struct{}
+
+func (unregisteredEvent) EventName() string {
+	return "unregistered"
+}
+
+func sealed(t *testing.T, e Event) amqp.Delivery {
+	t.Helper()
+
+	msg, err := seal(e, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return amqp.Delivery{
+		Headers:      msg.Headers,
+		ContentType:  msg.ContentType,
+		DeliveryMode: msg.DeliveryMode,
+		MessageId:    msg.MessageId,
+		Timestamp:    msg.Timestamp,
+		AppId:        msg.AppId,
+		Body:         msg.Body,
+	}
+}
+
+func TestDecode(t *testing.T) {
+	collect := sealed(t, CollectEvent{CertID: 1})
+
+	withHeaders := func(h amqp.Table) amqp.Delivery {
+		d := collect
+		d.Headers = amqp.Table{}
+		for k, v := range collect.Headers {
+			d.Headers[k] = v
+		}
+		for k, v := range h {
+			d.Headers[k] = v
+		}
+		return d
+	}
+
+	tests := []struct {
+		name    string
+		d       amqp.Delivery
+		v       Event
+		wantErr bool
+	}{
+		{"sealed", collect, &CollectEvent{}, false},
+		{"int64 version", withHeaders(amqp.Table{VersionHeader: int64(1)}), &CollectEvent{}, false},
+		{"legacy", amqp.Delivery{Body: []byte(`{"CertID": 1}`)}, &CollectEvent{}, false},
+		{"legacy of a newer event", amqp.Delivery{Body: []byte(`{"Subject": "a"}`)}, &EnrollEvent{}, true},
+		{"another event", collect, &RevokeEvent{}, true},
+		{"newer version", withHeaders(amqp.Table{VersionHeader: int32(2)}), &CollectEvent{}, true},
+		{"invalid version", withHeaders(amqp.Table{VersionHeader: "1"}), &CollectEvent{}, true},
+		{"invalid event", withHeaders(amqp.Table{EventHeader: 1}), &CollectEvent{}, true},
+		{"unknown field", amqp.Delivery{Body: []byte(`{"CertID": 1, "Serial": "1"}`)}, &CollectEvent{}, true},
+		{"not json", amqp.Delivery{Body: []byte("1,")}, &CollectEvent{}, true},
+		{"unregistered", collect, &unregisteredEvent{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Decode(&tt.d, tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil && !IsMalformed(err) {
+				t.Errorf("Decode() error = %v, want a malformed message", err)
+			}
+
+			if c, ok := tt.v.(*CollectEvent); ok && err == nil && c.CertID != 1 {
+				t.Errorf("Decode() = %+v", c)
+			}
+		})
+	}
+}
+
+func TestSeal(t *testing.T) {
+	d := sealed(t, &EnrollEvent{Subject: "a.example.com"})
+
+	env, err := Open(&d)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if env.Event != "enroll" || env.Version != 2 || env.ID == "" || env.Time.IsZero() || env.Producer != "test" {
+		t.Errorf("envelope = %+v", env)
+	}
+
+	if d.DeliveryMode != amqp.Persistent || d.ContentType != ContentType {
+		t.Errorf("delivery mode = %d, content type = %q", d.DeliveryMode, d.ContentType)
+	}
+
+	if _, err := seal(unregisteredEvent{}, "test"); err == nil {
+		t.Error("an unregistered event was sealed")
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	e, err := NewEvent("collect")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := e.(*CollectEvent); !ok {
+		t.Errorf("NewEvent() = %T, want *CollectEvent", e)
+	}
+
+	if _, err := NewEvent("unregistered"); err == nil {
+		t.Error("NewEvent() of an unregistered event succeeded")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("an event was registered twice")
+		}
+	}()
+	RegisterEvent(CollectEvent{}, 2)
+}
@@ -2,32 +2,52 @@ package londo
 
 import (
 	"time"
-
-	"github.com/streadway/amqp"
 )
 
+// Event is a payload of a message, its name and schema version are registered with RegisterEvent
 type Event interface {
-	GetMessage() amqp.Publishing
+	EventName() string
 }
 
+// RevokeEvent asks for a subject to be deleted, and its certificate revoked. With OnPurge, the
+// certificate is only revoked once a deleted subject is purged.
 type RevokeEvent struct {
-	ID     string
-	CertID int
+	ID       string
+	CertID   int
+	Reason   string
+	Actor    string
+	Revision int64
+	OnPurge  bool
 }
 
-func (RevokeEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+func (RevokeEvent) EventName() string {
+	return "revoke"
 }
 
+// EnrollEvent asks for a certificate to be ordered. Key identifies a request, so its redeliveries
+// and duplicates are only ordered once, and Replaces is a certificate a renewal orders instead of.
 type EnrollEvent struct {
 	Subject  string
 	Port     int32
 	AltNames []string
 	Targets  []string
+	Key      string
+	Replaces int
+}
+
+func (EnrollEvent) EventName() string {
+	return "enroll"
+}
+
+// RevokedCertEvent is published once remote CA confirms revocation
+type RevokedCertEvent struct {
+	CertID    int
+	Reason    string
+	RevokedAt time.Time
 }
 
-func (EnrollEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{ContentType: ContentType}
+func (RevokedCertEvent) EventName() string {
+	return "cert.revoked"
 }
 
 // FIXME: not being used?
@@ -40,57 +60,59 @@ type CompleteEnrollEvent struct {
 	Certificate string
 }
 
-func (CompleteEnrollEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+func (CompleteEnrollEvent) EventName() string {
+	return "enroll.complete"
 }
 
 type GetSubjectEvent struct {
 	Subject string
 }
 
-func (GetSubjectEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+func (GetSubjectEvent) EventName() string {
+	return "subject.get"
 }
 
 type GetSubjectByTargetEvent struct {
 	Target []string
 }
 
-func (GetSubjectByTargetEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+func (GetSubjectByTargetEvent) EventName() string {
+	return "subject.get.target"
 }
 
+// NewSubjectEvent carries a private key sealed by londo-enrolld, it is only in plain text
+// where encryption is opted out of
 type NewSubjectEvent struct {
-	Subject    string
-	Port       int32
-	CSR        string
-	PrivateKey string
-	CertID     int
-	OrderID    string
-	AltNames   []string
-	Targets    []string
+	Subject      string
+	Port         int32
+	CSR          string
+	PrivateKey   string
+	EncryptedKey *EncryptedKey
+	CertID       int
+	OrderID      string
+	AltNames     []string
+	Targets      []string
+	EnrollKey    string
 }
 
-func (NewSubjectEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+func (NewSubjectEvent) EventName() string {
+	return "subject.new"
 }
 
 type CollectEvent struct {
 	CertID int
 }
 
-func (CollectEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+func (CollectEvent) EventName() string {
+	return "collect"
 }
 
 type GetExpiringSubjEvent struct {
 	Days int32
 }
 
-func (GetExpiringSubjEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{
-		Type: DbGetExpiringSubjectsCmd,
-	}
+func (GetExpiringSubjEvent) EventName() string {
+	return "subject.get.expiring"
 }
 
 type ExpiringSubjectEvent struct {
@@ -98,8 +120,8 @@ type ExpiringSubjectEvent struct {
 	NotAfter time.Time
 }
 
-func (ExpiringSubjectEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+func (ExpiringSubjectEvent) EventName() string {
+	return "subject.expiring"
 }
 
 type CheckCertEvent struct {
@@ -113,14 +135,15 @@ type CheckCertEvent struct {
 	Outdated []string
 	// TODO: it may not be possible to deserialize it and from JSON
 	Unresolvable time.Time
+	Revision     int64
 }
 
-func (CheckCertEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+func (CheckCertEvent) EventName() string {
+	return "cert.check"
 }
 
 type EmptyEvent struct{}
 
-func (EmptyEvent) GetMessage() amqp.Publishing {
-	return amqp.Publishing{}
+func (EmptyEvent) EventName() string {
+	return "empty"
 }
@@ -2,14 +2,21 @@ package londo
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"sync"
+	"io"
+	"time"
 
 	"github.com/alexyermolaev/londo/jwt"
 	"github.com/alexyermolaev/londo/logger"
 	"github.com/alexyermolaev/londo/londopb"
+	"github.com/golang/protobuf/proto"
 	grpcauth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
 	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -26,9 +33,15 @@ var (
 
 type GRPCServer struct {
 	Londo *Londo
+	rpc   *rpcClient
+	srv   *grpc.Server
 }
 
-func (g *GRPCServer) GetToken(ctx context.Context, req *londopb.GetTokenRequest) (*londopb.GetTokenResponse, error) {
+func (g *GRPCServer) GetToken(
+	ctx context.Context, req *londopb.GetTokenRequest) (res *londopb.GetTokenResponse, err error) {
+
+	defer func() { g.audit(ctx, "GetToken", "", err) }()
+
 	ip, _, err := ParseIPAddr(ctx)
 	if err != nil {
 		log.WithFields(logrus.Fields{logger.IP: logger.Unknown}).Error(err)
@@ -51,15 +64,18 @@ func (g *GRPCServer) GetToken(ctx context.Context, req *londopb.GetTokenRequest)
 }
 
 func (g *GRPCServer) RenewSubjects(
-	req *londopb.RenewSubjectRequest, stream londopb.CertService_RenewSubjectsServer) error {
+	req *londopb.RenewSubjectRequest, stream londopb.CertService_RenewSubjectsServer) (err error) {
 
 	s := req.GetSubject()
 
+	defer func() { g.audit(stream.Context(), "RenewSubjects", s, err) }()
+
 	sr, err := g.setupRequest(stream.Context())
 	if err != nil {
 		log.Error(err)
 		return internalError()
 	}
+	defer sr.close()
 
 	if s != "" {
 		fields := logrus.Fields{
@@ -69,11 +85,7 @@ func (g *GRPCServer) RenewSubjects(
 			logger.IP:       sr.ip,
 			logger.Subject:  s}
 
-		if err := g.Londo.Publish(
-			DbReplyExchange,
-			DbReplyQueue,
-			sr.addr,
-			DbGetSubjectCmd,
+		if err := g.request(sr, DbGetSubjectCmd,
 			GetSubjectEvent{Subject: s},
 		); err != nil {
 			log.WithFields(fields).Error(err)
@@ -82,19 +94,23 @@ func (g *GRPCServer) RenewSubjects(
 
 		log.WithFields(fields).Info(logger.Get)
 
-		rs := <-sr.replyChannel
+		rs, err := sr.subject()
+		if err != nil {
+			log.WithFields(fields).Error(err)
+			return rpcStatus(sr, err)
+		}
 
 		if rs.Subject == "" {
 			log.WithFields(fields).Error(notFound)
 			return notFoundError()
 		}
 
-		<-sr.doneChannel
-		sr.wg.Wait()
-
 		revEvent := RevokeEvent{
-			ID:     rs.ID.Hex(),
-			CertID: rs.CertID,
+			ID:       rs.ID.Hex(),
+			CertID:   rs.CertID,
+			Reason:   "renewed",
+			Actor:    ActorFromContext(stream.Context()),
+			Revision: rs.Revision,
 		}
 
 		fields = logrus.Fields{
@@ -121,6 +137,8 @@ func (g *GRPCServer) RenewSubjects(
 			Port:     rs.Port,
 			AltNames: rs.AltNames,
 			Targets:  rs.Targets,
+			Key:      sr.id,
+			Replaces: rs.CertID,
 		}); err != nil {
 			log.WithFields(fields).Error(err)
 			return internalError()
@@ -158,6 +176,7 @@ func (g *GRPCServer) GetExpiringSubject(
 	if err != nil {
 		return internalError()
 	}
+	defer sr.close()
 
 	fields := logrus.Fields{
 		logger.Exchange: DbReplyExchange,
@@ -167,11 +186,7 @@ func (g *GRPCServer) GetExpiringSubject(
 		logger.Cmd:      DbGetExpiringSubjectsCmd,
 	}
 
-	if err := g.Londo.Publish(
-		DbReplyExchange,
-		DbReplyQueue,
-		sr.addr,
-		DbGetExpiringSubjectsCmd,
+	if err := g.request(sr, DbGetExpiringSubjectsCmd,
 		GetExpiringSubjEvent{Days: d},
 	); err != nil {
 		log.WithFields(fields).Error(err)
@@ -190,23 +205,163 @@ func (g *GRPCServer) GetExpiringSubject(
 	})
 }
 
+func (g *GRPCServer) GetSubjectHistory(
+	req *londopb.GetSubjectHistoryRequest, stream londopb.CertService_GetSubjectHistoryServer) error {
+
+	s := req.GetSubject()
+
+	sr, err := g.setupRequest(stream.Context())
+	if err != nil {
+		return internalError()
+	}
+	defer sr.close()
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Reply:    sr.addr,
+		logger.IP:       sr.ip,
+		logger.Subject:  s,
+		logger.Cmd:      DbGetSubjectHistoryCmd,
+	}
+
+	if err := g.request(sr, DbGetSubjectHistoryCmd,
+		GetSubjectEvent{Subject: s},
+	); err != nil {
+		log.WithFields(fields).Error(err)
+		return internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+
+	return g.getManyReplies(sr, func(rs Subject) error {
+		for _, r := range rs.History {
+			if err := stream.Send(&londopb.GetSubjectHistoryResponse{
+				Record: &londopb.CertificateRecord{
+					Version:          int32(r.Version),
+					CertId:           int64(r.CertID),
+					OrderId:          r.OrderID,
+					Serial:           r.Serial,
+					NotBefore:        unixTime(r.NotBefore),
+					NotAfter:         unixTime(r.NotAfter),
+					IssuedAt:         unixTime(r.IssuedAt),
+					RevokedAt:        unixTime(r.RevokedAt),
+					RevocationReason: r.RevocationReason,
+					KeyFingerprint:   r.KeyFingerprint,
+				},
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
 func (g *GRPCServer) DeleteSubject(
-	ctx context.Context, req *londopb.DeleteSubjectRequest) (*londopb.DeleteSubjectResponse, error) {
+	ctx context.Context, req *londopb.DeleteSubjectRequest) (res *londopb.DeleteSubjectResponse, err error) {
 	s := req.GetSubject()
 
-	ip, _, err := ParseIPAddr(ctx)
+	defer func() { g.audit(ctx, "DeleteSubject", s, err) }()
+
+	sr, err := g.setupRequest(ctx)
 	if err != nil {
-		return nil, err
+		log.Error(err)
+		return nil, internalError()
+	}
+	defer sr.close()
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Cmd:      DbGetSubjectCmd,
+		logger.IP:       sr.ip,
+		logger.Subject:  s}
+
+	if err := g.request(sr, DbGetSubjectCmd, GetSubjectEvent{Subject: s}); err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, internalError()
+	}
+
+	rs, err := sr.subject()
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, rpcStatus(sr, err)
 	}
 
-	log.WithFields(logrus.Fields{logger.IP: ip, logger.Subject: s}).Info(logger.Revoked)
-	return nil, err
+	if rs.Subject == "" {
+		log.WithFields(fields).Error(notFound)
+		return nil, notFoundError()
+	}
+
+	revEvent := RevokeEvent{
+		ID:       rs.ID.Hex(),
+		CertID:   rs.CertID,
+		Reason:   req.GetReason(),
+		Actor:    ActorFromContext(ctx),
+		Revision: rs.Revision,
+		OnPurge:  true,
+	}
+
+	if revEvent.Reason == "" {
+		revEvent.Reason = "deleted by " + revEvent.Actor
+	}
+
+	// subject is only marked as deleted, so it can be restored until it is purged. Its certificate
+	// is revoked by a purge, a subject restored before then keeps a usable one.
+	fields[logger.Cmd] = DbDeleteSubjCmd
+
+	if err = g.Londo.Publish(DbReplyExchange, DbReplyQueue, "", DbDeleteSubjCmd, revEvent); err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+	return &londopb.DeleteSubjectResponse{Subject: s}, nil
+}
+
+func (g *GRPCServer) RestoreSubject(
+	ctx context.Context, req *londopb.RestoreSubjectRequest) (res *londopb.RestoreSubjectResponse, err error) {
+	s := req.GetSubject()
+
+	defer func() { g.audit(ctx, "RestoreSubject", s, err) }()
+
+	sr, err := g.setupRequest(ctx)
+	if err != nil {
+		log.Error(err)
+		return nil, internalError()
+	}
+	defer sr.close()
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Cmd:      DbRestoreSubjCmd,
+		logger.IP:       sr.ip,
+		logger.Subject:  s}
+
+	if err := g.request(sr, DbRestoreSubjCmd, GetSubjectEvent{Subject: s}); err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, internalError()
+	}
+
+	var r RestoreSubjectReply
+	err = sr.reply(&r)
+
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, rpcStatus(sr, err)
+	}
+
+	log.WithFields(fields).Info(logger.Success)
+	return &londopb.RestoreSubjectResponse{Subject: s, Revoked: r.Revoked}, nil
 }
 
 func (g *GRPCServer) AddNewSubject(
-	ctx context.Context, req *londopb.AddNewSubjectRequest) (*londopb.AddNewSubjectResponse, error) {
+	ctx context.Context, req *londopb.AddNewSubjectRequest) (res *londopb.AddNewSubjectResponse, err error) {
 
 	s := req.GetSubject().Subject
+
+	defer func() { g.audit(ctx, "AddNewSubject", s, err) }()
 	subj := Subject{
 		Subject:  s,
 		Port:     req.GetSubject().Port,
@@ -219,6 +374,7 @@ func (g *GRPCServer) AddNewSubject(
 		log.Error(err)
 		return nil, internalError()
 	}
+	defer sr.close()
 
 	log.WithFields(logrus.Fields{logger.IP: sr.ip, logger.Subject: s, logger.Queue: sr.addr}).Info(logger.Get)
 
@@ -229,14 +385,18 @@ func (g *GRPCServer) AddNewSubject(
 		logger.Cmd:      DbGetSubjectCmd,
 	}
 
-	if err := g.Londo.Publish(
-		DbReplyExchange, DbReplyQueue, sr.addr, DbGetSubjectCmd, GetSubjectEvent{Subject: s}); err != nil {
+	if err := g.request(sr, DbGetSubjectCmd, GetSubjectEvent{Subject: s}); err != nil {
 
 		log.WithFields(fields).Error(err)
 		return nil, internalError()
 	}
 
-	rs := <-sr.replyChannel
+	// a subject which isn't found is the one to enroll
+	rs, err := sr.subject()
+	if err != nil && !IsNotFound(err) {
+		log.WithFields(fields).Error(err)
+		return nil, rpcStatus(sr, err)
+	}
 
 	if rs.Subject != "" {
 
@@ -248,14 +408,12 @@ func (g *GRPCServer) AddNewSubject(
 		return nil, alreadyExistsError()
 	}
 
-	<-sr.doneChannel
-	sr.wg.Wait()
-
 	if err = g.Londo.Publish(EnrollExchange, EnrollQueue, "", "", EnrollEvent{
 		Subject:  subj.Subject,
 		Port:     subj.Port,
 		AltNames: subj.AltNames,
 		Targets:  subj.Targets,
+		Key:      sr.id,
 	}); err != nil {
 		return nil, err
 	}
@@ -265,38 +423,48 @@ func (g *GRPCServer) AddNewSubject(
 }
 
 func (g *GRPCServer) GetSubject(
-	ctx context.Context, req *londopb.GetSubjectRequest) (*londopb.GetSubjectResponse, error) {
+	ctx context.Context, req *londopb.GetSubjectRequest) (res *londopb.GetSubjectResponse, err error) {
 
 	s := req.GetSubject()
 
+	// private key disclosure
+	defer func() { g.audit(ctx, "GetSubject", s, err) }()
+
 	sr, err := g.setupRequest(ctx)
 	if err != nil {
 		return nil, err
 	}
+	defer sr.close()
 
 	log.WithFields(logrus.Fields{logger.IP: sr.ip, logger.Subject: s, logger.Queue: sr.addr}).Info(logger.Get)
 
-	if err := g.Londo.Publish(
-		DbReplyExchange, DbReplyQueue, sr.addr, DbGetSubjectCmd, GetSubjectEvent{Subject: s}); err != nil {
+	if err := g.request(sr, DbGetSubjectCmd, GetSubjectEvent{Subject: s}); err != nil {
 		return nil, err
 	}
 
-	rs := <-sr.replyChannel
+	rs, err := sr.subject()
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.IP: sr.ip}).Error(err)
+		return nil, rpcStatus(sr, err)
+	}
 
 	if rs.Subject == "" {
 		log.WithFields(logrus.Fields{logger.IP: sr.ip, logger.Code: codes.NotFound}).Error(notFound)
 		return nil, notFoundError()
 	}
 
-	<-sr.doneChannel
-	sr.wg.Wait()
+	pkey, err := g.Londo.Keys.Reveal(&rs)
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.IP: sr.ip, logger.Subject: rs.Subject}).Error(err)
+		return nil, internalError()
+	}
 
 	log.Infof("%s: resp %s", sr.ip, rs.Subject)
 	return &londopb.GetSubjectResponse{
 		Subject: &londopb.Subject{
 			Subject:     rs.Subject,
 			Certificate: rs.Certificate,
-			PrivateKey:  rs.PrivateKey,
+			PrivateKey:  pkey,
 			AltNames:    rs.AltNames,
 			Targets:     rs.Targets,
 		},
@@ -304,12 +472,15 @@ func (g *GRPCServer) GetSubject(
 }
 
 func (g *GRPCServer) GetSubjectForTarget(
-	req *londopb.ForTargetRequest, stream londopb.CertService_GetSubjectForTargetServer) error {
+	req *londopb.ForTargetRequest, stream londopb.CertService_GetSubjectForTargetServer) (err error) {
+
+	defer func() { g.auditFailure(stream.Context(), "GetSubjectForTarget", err) }()
 
 	sr, err := g.setupRequest(stream.Context())
 	if err != nil {
 		return err
 	}
+	defer sr.close()
 
 	var targets []string
 	targets = append(targets, sr.ip)
@@ -327,11 +498,7 @@ func (g *GRPCServer) GetSubjectForTarget(
 		logger.Cmd:      cmd,
 	}
 
-	if err := g.Londo.Publish(
-		DbReplyExchange,
-		DbReplyQueue,
-		sr.addr,
-		cmd,
+	if err := g.request(sr, cmd,
 		GetSubjectByTargetEvent{Target: targets},
 	); err != nil {
 		log.WithFields(fields).Error(err)
@@ -341,20 +508,31 @@ func (g *GRPCServer) GetSubjectForTarget(
 	log.WithFields(fields).Info(logger.Published)
 
 	return g.getManyReplies(sr, func(rs Subject) error {
-		return stream.Send(&londopb.GetSubjectResponse{
+		pkey, err := g.Londo.Keys.Reveal(&rs)
+		if err != nil {
+			log.WithFields(logrus.Fields{logger.IP: sr.ip, logger.Subject: rs.Subject}).Error(err)
+			return internalError()
+		}
+
+		err = stream.Send(&londopb.GetSubjectResponse{
 			Subject: &londopb.Subject{
 				Subject:     rs.Subject,
 				Certificate: rs.Certificate,
-				PrivateKey:  rs.PrivateKey,
+				PrivateKey:  pkey,
 				AltNames:    rs.AltNames,
 				Targets:     rs.Targets,
 			},
 		})
+
+		g.audit(stream.Context(), "GetSubjectForTarget", rs.Subject, err)
+		return err
 	})
 }
 
 func (g *GRPCServer) GetSubjectsByTarget(
-	req *londopb.TargetRequest, stream londopb.CertService_GetSubjectsByTargetServer) error {
+	req *londopb.TargetRequest, stream londopb.CertService_GetSubjectsByTargetServer) (err error) {
+
+	defer func() { g.auditFailure(stream.Context(), "GetSubjectsByTarget", err) }()
 
 	targets := req.GetTarget()
 
@@ -362,6 +540,7 @@ func (g *GRPCServer) GetSubjectsByTarget(
 	if err != nil {
 		return err
 	}
+	defer sr.close()
 
 	fields := logrus.Fields{
 		logger.Exchange: DbReplyExchange,
@@ -371,11 +550,7 @@ func (g *GRPCServer) GetSubjectsByTarget(
 		logger.Cmd:      DbGetSubjectByTargetCmd,
 	}
 
-	if err := g.Londo.Publish(
-		DbReplyExchange,
-		DbReplyQueue,
-		sr.addr,
-		DbGetSubjectByTargetCmd,
+	if err := g.request(sr, DbGetSubjectByTargetCmd,
 		GetSubjectByTargetEvent{Target: targets},
 	); err != nil {
 		log.WithFields(fields).Error(err)
@@ -385,18 +560,540 @@ func (g *GRPCServer) GetSubjectsByTarget(
 	log.WithFields(fields).Info(logger.Published)
 
 	return g.getManyReplies(sr, func(rs Subject) error {
-		return stream.Send(&londopb.GetSubjectResponse{
+		pkey, err := g.Londo.Keys.Reveal(&rs)
+		if err != nil {
+			log.WithFields(logrus.Fields{logger.IP: sr.ip, logger.Subject: rs.Subject}).Error(err)
+			return internalError()
+		}
+
+		err = stream.Send(&londopb.GetSubjectResponse{
 			Subject: &londopb.Subject{
 				Subject:     rs.Subject,
 				Certificate: rs.Certificate,
-				PrivateKey:  rs.PrivateKey,
+				PrivateKey:  pkey,
 				AltNames:    rs.AltNames,
 				Targets:     rs.Targets,
 			},
 		})
+
+		g.audit(stream.Context(), "GetSubjectsByTarget", rs.Subject, err)
+		return err
+	})
+}
+
+func (g *GRPCServer) ListSubjects(
+	ctx context.Context, req *londopb.ListSubjectsRequest) (*londopb.ListSubjectsResponse, error) {
+
+	f := SubjectFilter{
+		Name:          req.GetName(),
+		AltName:       req.GetAltName(),
+		Target:        req.GetTarget(),
+		Match:         filterState(req.GetMatch()),
+		Outdated:      filterState(req.GetOutdated()),
+		Unresolvable:  filterState(req.GetUnresolvable()),
+		Deleted:       req.GetDeleted(),
+		ExpiresAfter:  fromUnix(req.GetExpiresAfter()),
+		ExpiresBefore: fromUnix(req.GetExpiresBefore()),
+		CreatedAfter:  fromUnix(req.GetCreatedAfter()),
+		CreatedBefore: fromUnix(req.GetCreatedBefore()),
+		Descending:    req.GetDescending(),
+		PageSize:      int(req.GetPageSize()),
+		PageToken:     req.GetPageToken(),
+	}
+
+	switch req.GetSortBy() {
+	case londopb.SortField_NOT_AFTER:
+		f.SortBy = SortByNotAfter
+	case londopb.SortField_CREATED_AT:
+		f.SortBy = SortByCreatedAt
+	default:
+		f.SortBy = SortBySubject
+	}
+
+	if err := f.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sr, err := g.setupRequest(ctx)
+	if err != nil {
+		return nil, internalError()
+	}
+	defer sr.close()
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Reply:    sr.addr,
+		logger.IP:       sr.ip,
+		logger.Cmd:      DbListSubjectsCmd,
+	}
+
+	if err := g.request(sr, DbListSubjectsCmd, f); err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+
+	var r ListSubjectsReply
+	err = sr.reply(&r)
+
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, rpcStatus(sr, err)
+	}
+
+	res := &londopb.ListSubjectsResponse{NextPageToken: r.NextPageToken}
+
+	for _, s := range r.Subjects {
+		ls := &londopb.ListedSubject{
+			Subject:        s.Subject,
+			Serial:         s.Serial,
+			Port:           s.Port,
+			CertId:         int64(s.CertID),
+			NotAfter:       unixTime(s.NotAfter),
+			CreatedAt:      unixTime(s.CreatedAt),
+			UpdatedAt:      unixTime(s.UpdatedAt),
+			UnresolvableAt: unixTime(s.UnresolvableAt),
+			Match:          s.Match,
+			AltNames:       s.AltNames,
+			Targets:        s.Targets,
+			Outdated:       s.Outdated,
+		}
+
+		if s.Deleted != nil {
+			ls.DeletedAt = unixTime(s.Deleted.At)
+			ls.DeletedReason = s.Deleted.Reason
+			ls.DeletedBy = s.Deleted.Actor
+		}
+
+		res.Subjects = append(res.Subjects, ls)
+	}
+
+	log.WithFields(fields).Infof("%d subjects", len(res.Subjects))
+	return res, nil
+}
+
+// ExportSubjects streams items of a bundle as londo-dbd sends them. Private keys are in plain text,
+// it is up to a client to seal a bundle.
+func (g *GRPCServer) ExportSubjects(
+	req *londopb.ExportSubjectsRequest, stream londopb.CertService_ExportSubjectsServer) (err error) {
+
+	// private key disclosure of every subject
+	defer func() { g.audit(stream.Context(), "ExportSubjects", "", err) }()
+
+	sr, err := g.setupRequest(stream.Context())
+	if err != nil {
+		return internalError()
+	}
+	defer sr.close()
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Reply:    sr.addr,
+		logger.IP:       sr.ip,
+		logger.Cmd:      DbExportCmd,
+	}
+
+	if err := g.request(sr, DbExportCmd, EmptyEvent{}); err != nil {
+		log.WithFields(fields).Error(err)
+		return internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+
+	return g.getReplies(sr, func(d *amqp.Delivery) error {
+		var it ExportItem
+		if err := Decode(d, &it); err != nil {
+			log.WithFields(fields).Error(err)
+			return internalError()
+		}
+
+		return stream.Send(&londopb.ExportSubjectsResponse{Item: d.Body})
+	})
+}
+
+func (g *GRPCServer) ImportSubjects(stream londopb.CertService_ImportSubjectsServer) (err error) {
+	defer func() { g.audit(stream.Context(), "ImportSubjects", "", err) }()
+
+	var (
+		e     ImportEvent
+		first = true
+	)
+
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if first {
+			e.Replace = req.GetReplace()
+			first = false
+		}
+
+		var it ExportItem
+		if err := json.Unmarshal(req.GetItem(), &it); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+
+		switch {
+		case it.Subject != nil:
+			e.Subjects = append(e.Subjects, *it.Subject)
+		case it.Record != nil:
+			e.Certificates = append(e.Certificates, *it.Record)
+		default:
+			e.SchemaVersion = it.SchemaVersion
+		}
+	}
+
+	sr, err := g.setupRequest(stream.Context())
+	if err != nil {
+		return internalError()
+	}
+	defer sr.close()
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Reply:    sr.addr,
+		logger.IP:       sr.ip,
+		logger.Count:    len(e.Subjects),
+		logger.Cmd:      DbImportCmd,
+	}
+
+	if err := g.request(sr, DbImportCmd, e); err != nil {
+		log.WithFields(fields).Error(err)
+		return internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+
+	var r ImportReport
+	err = sr.reply(&r)
+
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		return rpcStatus(sr, err)
+	}
+
+	res := &londopb.ImportSubjectsResponse{
+		Imported: int32(r.Imported),
+		Replaced: int32(r.Replaced),
+		Skipped:  int32(r.Skipped),
+		Records:  int32(r.Records),
+	}
+
+	for _, c := range r.Conflicts {
+		res.Conflicts = append(res.Conflicts, &londopb.ImportConflict{
+			Subject: c.Subject,
+			CertId:  int64(c.CertID),
+			Fields:  c.Fields,
+		})
+	}
+
+	log.WithFields(fields).Info(logger.Success)
+	return stream.SendAndClose(res)
+}
+
+func (g *GRPCServer) RewrapKeys(
+	ctx context.Context, req *londopb.RewrapKeysRequest) (*londopb.RewrapKeysResponse, error) {
+
+	ip, _, err := ParseIPAddr(ctx)
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.IP: logger.Unknown}).Error(err)
+		return nil, internalError()
+	}
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.IP:       ip,
+		logger.Cmd:      DbRewrapKeysCmd,
+	}
+
+	if err := g.Londo.Publish(DbReplyExchange, DbReplyQueue, "", DbRewrapKeysCmd, EmptyEvent{}); err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+	return &londopb.RewrapKeysResponse{Status: "key rewrap scheduled"}, nil
+}
+
+func (g *GRPCServer) ListDeadLetters(
+	req *londopb.ListDeadLettersRequest, stream londopb.CertService_ListDeadLettersServer) error {
+
+	ip, _, err := ParseIPAddr(stream.Context())
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.IP: logger.Unknown}).Error(err)
+		return internalError()
+	}
+
+	fields := logrus.Fields{logger.IP: ip, logger.Queue: req.GetQueue()}
+
+	if _, err := deadLetterQueues(req.GetQueue()); err != nil {
+		log.WithFields(fields).Error(err)
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	letters, err := g.Londo.DeadLetters(req.GetQueue(), int(req.GetLimit()))
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		return internalError()
+	}
+
+	for _, dl := range letters {
+		if err := stream.Send(&londopb.ListDeadLettersResponse{
+			Letter: &londopb.DeadLetter{
+				Queue:    dl.Queue,
+				Type:     dl.Type,
+				Attempts: int32(dl.Attempts),
+				Error:    dl.Error,
+				FailedAt: unixTime(dl.FailedAt),
+				Body:     dl.Body,
+			},
+		}); err != nil {
+			log.WithFields(fields).Error(err)
+			return internalError()
+		}
+	}
+
+	fields[logger.Count] = len(letters)
+	log.WithFields(fields).Info(logger.Success)
+	return nil
+}
+
+func (g *GRPCServer) ReplayDeadLetters(
+	ctx context.Context, req *londopb.ReplayDeadLettersRequest) (res *londopb.ReplayDeadLettersResponse, err error) {
+
+	defer func() { g.audit(ctx, "ReplayDeadLetters", req.GetQueue(), err) }()
+
+	ip, _, err := ParseIPAddr(ctx)
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.IP: logger.Unknown}).Error(err)
+		return nil, internalError()
+	}
+
+	fields := logrus.Fields{logger.IP: ip, logger.Queue: req.GetQueue()}
+
+	if _, err := deadLetterQueues(req.GetQueue()); err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	n, err := g.Londo.ReplayDeadLetters(req.GetQueue(), int(req.GetLimit()))
+	fields[logger.Count] = n
+
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Success)
+	return &londopb.ReplayDeadLettersResponse{Count: int32(n)}, nil
+}
+
+func (g *GRPCServer) PurgeDeadLetters(
+	ctx context.Context, req *londopb.PurgeDeadLettersRequest) (res *londopb.PurgeDeadLettersResponse, err error) {
+
+	defer func() { g.audit(ctx, "PurgeDeadLetters", req.GetQueue(), err) }()
+
+	ip, _, err := ParseIPAddr(ctx)
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.IP: logger.Unknown}).Error(err)
+		return nil, internalError()
+	}
+
+	fields := logrus.Fields{logger.IP: ip, logger.Queue: req.GetQueue()}
+
+	if _, err := deadLetterQueues(req.GetQueue()); err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	n, err := g.Londo.PurgeDeadLetters(req.GetQueue())
+	fields[logger.Count] = n
+
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Success)
+	return &londopb.PurgeDeadLettersResponse{Count: int32(n)}, nil
+}
+
+// ResolveEnrollment settles an enroll request dead-lettered in doubt, so a replay of it can go ahead
+func (g *GRPCServer) ResolveEnrollment(
+	ctx context.Context, req *londopb.ResolveEnrollmentRequest) (res *londopb.ResolveEnrollmentResponse, err error) {
+	s := req.GetSubject()
+
+	defer func() { g.audit(ctx, "ResolveEnrollment", s, err) }()
+
+	if req.GetCertId() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "certificate id can't be negative")
+	}
+
+	sr, err := g.setupRequest(ctx)
+	if err != nil {
+		log.Error(err)
+		return nil, internalError()
+	}
+	defer sr.close()
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Cmd:      DbResolveEnrollCmd,
+		logger.IP:       sr.ip,
+		logger.Subject:  s,
+		logger.CertID:   req.GetCertId()}
+
+	if err := g.request(sr, DbResolveEnrollCmd, ResolveEnrollEvent{Subject: s, CertID: int(req.GetCertId())}); err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, internalError()
+	}
+
+	var r ResolveEnrollReply
+	err = sr.reply(&r)
+
+	if err != nil {
+		log.WithFields(fields).Error(err)
+		return nil, rpcStatus(sr, err)
+	}
+
+	log.WithFields(fields).Info(logger.Success)
+	return &londopb.ResolveEnrollmentResponse{Subject: r.Subject, State: r.State}, nil
+}
+
+func (g *GRPCServer) GetAuditLog(
+	req *londopb.GetAuditLogRequest, stream londopb.CertService_GetAuditLogServer) error {
+
+	sr, err := g.setupRequest(stream.Context())
+	if err != nil {
+		return internalError()
+	}
+	defer sr.close()
+
+	e := GetAuditLogEvent{Actor: req.GetActor()}
+
+	if req.GetFrom() != 0 {
+		e.From = time.Unix(req.GetFrom(), 0)
+	}
+
+	if req.GetTo() != 0 {
+		e.To = time.Unix(req.GetTo(), 0)
+	}
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Reply:    sr.addr,
+		logger.IP:       sr.ip,
+		logger.Actor:    e.Actor,
+		logger.Cmd:      DbGetAuditLogCmd,
+	}
+
+	if err := g.request(sr, DbGetAuditLogCmd, e); err != nil {
+		log.WithFields(fields).Error(err)
+		return internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+
+	return g.getReplies(sr, func(d *amqp.Delivery) error {
+		var a AuditEntry
+		if err := Decode(d, &a); err != nil {
+			log.WithFields(fields).Error(err)
+			return internalError()
+		}
+
+		return stream.Send(&londopb.GetAuditLogResponse{
+			Entry: &londopb.AuditEntry{
+				Timestamp: a.Timestamp.Unix(),
+				Actor:     a.Actor,
+				SourceIp:  a.SourceIP,
+				Action:    a.Action,
+				Subject:   a.Subject,
+				Outcome:   a.Outcome,
+				Reason:    a.Reason,
+			},
+		})
 	})
 }
 
+func (g *GRPCServer) MigrateSchema(
+	req *londopb.MigrateSchemaRequest, stream londopb.CertService_MigrateSchemaServer) (err error) {
+
+	if !req.GetDryRun() {
+		defer func() { g.audit(stream.Context(), "MigrateSchema", "", err) }()
+	}
+
+	sr, err := g.setupRequest(stream.Context())
+	if err != nil {
+		return internalError()
+	}
+	defer sr.close()
+
+	fields := logrus.Fields{
+		logger.Exchange: DbReplyExchange,
+		logger.Queue:    DbReplyQueue,
+		logger.Reply:    sr.addr,
+		logger.IP:       sr.ip,
+		logger.DryRun:   req.GetDryRun(),
+		logger.Cmd:      DbMigrateCmd,
+	}
+
+	if err := g.request(sr, DbMigrateCmd, MigrateEvent{DryRun: req.GetDryRun()}); err != nil {
+		log.WithFields(fields).Error(err)
+		return internalError()
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+
+	return g.getReplies(sr, func(d *amqp.Delivery) error {
+		var r MigrationReport
+		if err := Decode(d, &r); err != nil {
+			log.WithFields(fields).Error(err)
+			return internalError()
+		}
+
+		return stream.Send(&londopb.MigrateSchemaResponse{
+			Report: &londopb.MigrationReport{
+				Version:     int32(r.Version),
+				Description: r.Description,
+				Subjects:    r.Subjects,
+				Applied:     r.Applied,
+			},
+		})
+	})
+}
+
+// audit records an outcome of a call on behalf of an authenticated caller
+func (g *GRPCServer) audit(ctx context.Context, action string, subject string, err error) {
+	ip, _, _ := ParseIPAddr(ctx)
+
+	if err != nil {
+		st := status.Convert(err)
+		err = errors.New(st.Code().String() + ": " + st.Message())
+	}
+
+	g.Londo.Audit(ActorFromContext(ctx), ip, action, subject, err)
+}
+
+// auditFailure records calls that failed before any subject could be served
+func (g *GRPCServer) auditFailure(ctx context.Context, action string, err error) {
+	if err != nil {
+		g.audit(ctx, action, "", err)
+	}
+}
+
 func AuthIntercept(ctx context.Context) (context.Context, error) {
 	ip, _, err := ParseIPAddr(ctx)
 	if err != nil {
@@ -408,7 +1105,7 @@ func AuthIntercept(ctx context.Context) (context.Context, error) {
 
 	// For now we'll trust that if it's on localhost, it's ok to do whatever
 	if ip == "[" {
-		return ctx, nil
+		return WithActor(ctx, localActor), nil
 	}
 
 	token, err := grpcauth.AuthFromMD(ctx, "bearer")
@@ -429,62 +1126,38 @@ func AuthIntercept(ctx context.Context) (context.Context, error) {
 	}
 
 	log.WithFields(fields).Info(logger.Ok)
-	return ctx, nil
-}
-
-type requestSetup struct {
-	replyChannel chan Subject
-	doneChannel  chan struct{}
-	wg           sync.WaitGroup
-	ip           string
-	addr         string
+	return WithActor(ctx, sub), nil
 }
 
-func (g *GRPCServer) setupRequest(ctx context.Context) (*requestSetup, error) {
-	ip, addr, err := ParseIPAddr(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	rs := &requestSetup{
-		replyChannel: make(chan Subject),
-		doneChannel:  make(chan struct{}),
-		ip:           ip,
-		addr:         addr,
+// unixTime keeps zero time as zero instead of a negative timestamp
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
 	}
+	return t.Unix()
+}
 
-	if err := g.Londo.DeclareBindQueue(GRPCServerExchange, rs.addr); err != nil {
-		return nil, internalError()
+// filterState turns a tri-state filter into a condition, nil means any
+func filterState(f londopb.Filter) *bool {
+	var b bool
+
+	switch f {
+	case londopb.Filter_ONLY:
+		b = true
+	case londopb.Filter_EXCLUDE:
+		b = false
+	default:
+		return nil
 	}
 
-	rs.wg.Add(1)
-
-	g.Londo.ConsumeGRPCReplies(addr, rs.replyChannel, rs.doneChannel, &rs.wg)
-
-	return rs, nil
+	return &b
 }
 
-func (g *GRPCServer) getManyReplies(sr *requestSetup, f func(rs Subject) error) error {
-	for {
-		select {
-		case rs := <-sr.replyChannel:
-			if rs.Subject == "" {
-				log.WithFields(logrus.Fields{logger.IP: sr.ip}).Error(notFound)
-
-				<-sr.doneChannel
-				sr.wg.Wait()
-				return notFoundError()
-			}
-
-			if err := f(rs); err != nil {
-				return err
-			}
-
-		case _ = <-sr.doneChannel:
-			sr.wg.Wait()
-			return nil
-		}
+func fromUnix(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
 	}
+	return time.Unix(sec, 0)
 }
 
 func internalError() error {
@@ -506,3 +1179,54 @@ func authFailedError() error {
 func invalidArgError() error {
 	return status.Errorf(codes.InvalidArgument, fmt.Sprintf(noToken))
 }
+
+// rpcStatus maps a failed request to londo-dbd to a gRPC status. Details tell which resource a
+// failure is about, and an id of a request. Internal failures only say as much.
+func rpcStatus(sr *requestSetup, err error) error {
+	var (
+		st      *status.Status
+		details []proto.Message
+	)
+
+	e, ok := err.(*RPCError)
+
+	switch {
+	case err == ErrReplyTimeout, err == context.DeadlineExceeded:
+		st = status.New(codes.DeadlineExceeded, err.Error())
+	case err == context.Canceled:
+		st = status.New(codes.Canceled, err.Error())
+	case err == ErrReplyOverflow:
+		st = status.New(codes.ResourceExhausted, err.Error())
+	case !ok:
+		st = status.New(codes.Internal, intError)
+	case e.Code == NotFoundCode:
+		st = status.New(codes.NotFound, e.Error())
+	case e.Code == ExistsCode:
+		st = status.New(codes.AlreadyExists, e.Error())
+	case e.Code == ConflictCode, e.Code == AbortedCode:
+		st = status.New(codes.Aborted, e.Error())
+	case e.Code == InvalidCode:
+		st = status.New(codes.InvalidArgument, e.Error())
+		details = append(details, &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{Field: e.Name, Description: e.Error()}},
+		})
+	default:
+		st = status.New(codes.Internal, intError)
+	}
+
+	if ok && e.Resource != "" && st.Code() != codes.Internal {
+		details = append(details, &errdetails.ResourceInfo{
+			ResourceType: e.Resource,
+			ResourceName: e.Name,
+			Description:  e.Error(),
+		})
+	}
+
+	details = append(details, &errdetails.RequestInfo{RequestId: sr.id})
+
+	if d, err := st.WithDetails(details...); err == nil {
+		st = d
+	}
+
+	return st.Err()
+}
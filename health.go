@@ -0,0 +1,55 @@
+package londo
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/sirupsen/logrus"
+)
+
+// Health serves /healthz, which answers as long as a daemon runs, and /readyz, which fails
+// while a bus isn't ready, i.e. there is no AMQP connection, and once a daemon is stopping.
+// Nothing is served unless a health port is set.
+func (l *Londo) Health() *Londo {
+	if HealthPort == 0 {
+		return l
+	}
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(logger.Ok))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if l.Stopping() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("stopping"))
+			return
+		}
+
+		if l.Bus == nil || !l.Bus.Ready() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(ErrNotConnected.Error()))
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(logger.Ready))
+	})
+
+	lis, err := net.Listen("tcp", ":"+strconv.Itoa(HealthPort))
+	Fail(err)
+
+	go func() {
+		log.WithFields(logrus.Fields{logger.Service: "health", logger.Port: HealthPort}).Info(logger.Ready)
+		if err := http.Serve(lis, mux); err != nil {
+			Fail(err)
+		}
+	}()
+
+	return l
+}
@@ -0,0 +1,48 @@
+package londo
+
+import (
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	l := newTestDbd(t)
+
+	port := HealthPort
+	HealthPort = freePort(t)
+	t.Cleanup(func() { HealthPort = port })
+
+	l.Health()
+	url := "http://127.0.0.1:" + strconv.Itoa(HealthPort)
+
+	tests := []struct {
+		name   string
+		setup  func()
+		path   string
+		status int
+	}{
+		{"live", func() {}, "/healthz", http.StatusOK},
+		{"ready", func() {}, "/readyz", http.StatusOK},
+		{"disconnected", func() { l.Bus.Shutdown() }, "/readyz", http.StatusServiceUnavailable},
+		{"stopping", func() { atomic.StoreInt32(&l.stopping, 1) }, "/readyz", http.StatusServiceUnavailable},
+		{"live while stopping", func() {}, "/healthz", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.setup()
+
+			resp, err := http.Get(url + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.status {
+				t.Errorf("GET %s = %d, want %d", tt.path, resp.StatusCode, tt.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package londo
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// Fixtures shared by tests of every daemon, stores and buses are in memory or in a temporary directory
+
+const testReplyQueue = "test-replies"
+
+// withConfig replaces a global config for a single test
+func withConfig(t *testing.T, c *Config) {
+	t.Helper()
+
+	prev := cfg
+	cfg = c
+	t.Cleanup(func() { cfg = prev })
+}
+
+func declarePipeline(t *testing.T, b Bus) {
+	t.Helper()
+
+	for _, q := range []struct{ exchange, queue string }{
+		{DbReplyExchange, DbReplyQueue},
+		{EnrollExchange, EnrollQueue},
+		{CollectExchange, CollectQueue},
+	} {
+		if err := b.Declare(q.exchange, q.queue, amqp.ExchangeDirect, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := b.DeclareExchange(GRPCServerExchange, amqp.ExchangeDirect); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// stopDaemon stops consumers of a daemon, and waits for them
+func stopDaemon(l *Londo) {
+	l.Bus.Stop()
+	l.consumers.Wait()
+}
+
+func waitFor(t *testing.T, what string, f func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(20 * time.Second)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func newTestBus(t *testing.T, queues ...string) *MemoryBus {
+	t.Helper()
+
+	b := NewMemoryBus()
+	for _, q := range queues {
+		if err := b.Declare("test", q, amqp.ExchangeDirect, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return b
+}
+
+func emit(t *testing.T, b *MemoryBus, key string, body string) {
+	t.Helper()
+
+	if err := b.Emit("test", key, amqp.Publishing{Body: []byte(body)}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// consumeAsync runs a consumer until a bus is stopped, deliveries are handed to f and then to a channel
+func consumeAsync(b *MemoryBus, queue string, f func(d amqp.Delivery)) (<-chan amqp.Delivery, <-chan struct{}) {
+	var (
+		got  = make(chan amqp.Delivery, 16)
+		done = make(chan struct{})
+	)
+
+	go func() {
+		defer close(done)
+
+		b.Consume(queue, Single, func(d amqp.Delivery) bool {
+			f(d)
+			got <- d
+			return false
+		})
+	}()
+
+	return got, done
+}
+
+func next(t *testing.T, got <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+
+	select {
+	case d := <-got:
+		return d
+	case <-time.After(2 * time.Second):
+		t.Fatal("no delivery")
+		return amqp.Delivery{}
+	}
+}
+
+// get takes a single delivery off a queue, leaving it unacknowledged
+func get(t *testing.T, b *MemoryBus, queue string) amqp.Delivery {
+	t.Helper()
+
+	q, err := b.queue(queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b.mu.Lock()
+	d, ok := q.pop(nil)
+	b.mu.Unlock()
+
+	if !ok {
+		t.Fatal("no delivery")
+	}
+
+	return d
+}
+
+func count(t *testing.T, b *MemoryBus, queue string) int {
+	t.Helper()
+
+	n, err := b.Count(queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return n
+}
+
+func newTestBolt(t *testing.T) *BoltDB {
+	t.Helper()
+
+	db, err := NewBoltDB(&Config{Storage: Storage{Backend: BoltBackend, Path: filepath.Join(t.TempDir(), "londo.db")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Disconnect() })
+
+	return db
+}
+
+// newTestDbd is londo-dbd on a MemoryBus with an empty Bolt store
+func newTestDbd(t *testing.T) *Londo {
+	t.Helper()
+
+	db := newTestBolt(t)
+
+	b := NewMemoryBus()
+	if err := b.Declare(DbReplyExchange, DbReplyQueue, amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.DeclareExchange(GRPCServerExchange, amqp.ExchangeDirect); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.DeclareReplyQueue(GRPCServerExchange, testReplyQueue); err != nil {
+		t.Fatal(err)
+	}
+
+	return &Londo{Name: "test", Db: db, Bus: b}
+}
+
+// newTestRetries returns a daemon with an enroll queue, its delay queues and its dead letter queue.
+// Delays are long enough for messages to stay in delay queues while a test runs.
+func newTestRetries(t *testing.T) (*Londo, *MemoryBus) {
+	t.Helper()
+
+	withConfig(t, &Config{Retries: map[string]Retry{
+		EnrollQueue: {MaxAttempts: 3, Delay: 60, MaxDelay: 120},
+	}})
+
+	b := NewMemoryBus()
+	t.Cleanup(b.Shutdown)
+
+	if err := b.Declare(EnrollExchange, EnrollQueue, amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	l := &Londo{Name: "test", Bus: b}
+	l.DeclareRetries(EnrollQueue).DeclareDeadLetters()
+
+	return l, b
+}
+
+// newTestRateLimiter returns a limiter of a budget with burst tokens, which rest for an hour after a call
+func newTestRateLimiter(t *testing.T, b *MemoryBus, burst int) (*RateLimiter, chan struct{}) {
+	t.Helper()
+
+	withConfig(t, &Config{RateLimits: map[string]RateLimit{
+		EnrollQueue: {Requests: burst, Interval: 3600, Burst: burst},
+	}})
+
+	done := make(chan struct{})
+
+	r, err := NewRateLimiter(b, EnrollQueue, done)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return r, done
+}
+
+// newTestRest is a client of a fake Sectigo, with budgets which don't hold a test up
+func newTestRest(t *testing.T, h http.HandlerFunc) *RestAPI {
+	t.Helper()
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+
+	c := &Config{RateLimits: make(map[string]RateLimit)}
+	c.Rest.Url = srv.URL
+	c.Rest.Username = "user"
+	c.Rest.Password = "secret"
+	c.Rest.CustomerURI = "acme"
+	c.Rest.Endpoints.Enroll = "/ssl/v1/enroll"
+	c.Rest.Endpoints.Renew = "/ssl/v1/renewById"
+	c.Rest.Endpoints.Collect = "/ssl/v1/collect"
+	c.Rest.Endpoints.Revoke = "/ssl/v1/revoke"
+	c.Rest.Endpoints.List = "/ssl/v1"
+	c.CertParams.FormatType = "x509CO"
+
+	for budget := range RateLimits {
+		c.RateLimits[budget] = RateLimit{Requests: 100, Interval: 1, Burst: 100}
+	}
+	withConfig(t, c)
+
+	r, err := NewRestClient(c, NewMemoryBus())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(r.Stop)
+
+	return r
+}
+
+func newKEK(t *testing.T) string {
+	t.Helper()
+
+	kek := make([]byte, kekSize)
+	if _, err := rand.Read(kek); err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(kek)
+}
+
+// writeKEK writes a key encryption key like `openssl rand -base64 32` would
+func writeKEK(t *testing.T, kek string, perm os.FileMode) string {
+	t.Helper()
+
+	f := filepath.Join(t.TempDir(), "kek")
+	if err := os.WriteFile(f, []byte(kek+"\n"), perm); err != nil {
+		t.Fatal(err)
+	}
+
+	// a umask may have taken permissions away
+	if err := os.Chmod(f, perm); err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+func newTestKeyRing(t *testing.T, kek string, previous ...string) *KeyRing {
+	t.Helper()
+
+	c := &Config{Encryption: Encryption{KEKFile: writeKEK(t, kek, 0600)}}
+	for _, p := range previous {
+		c.Encryption.PreviousKEKFiles = append(c.Encryption.PreviousKEKFiles, writeKEK(t, p, 0600))
+	}
+
+	t.Setenv(KEKEnvVar, "")
+
+	k, err := LoadKeyRing(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return k
+}
+
+// freePort finds a port nothing listens on
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+
+	return lis.Addr().(*net.TCPAddr).Port
+}
@@ -0,0 +1,246 @@
+package londo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const (
+	// KEKEnvVar takes precedence over kek_file when set
+	KEKEnvVar = "LONDO_KEK"
+
+	kekSize = 32
+)
+
+var (
+	ErrNoKEK = errors.New("private key is encrypted, but no key encryption key is configured")
+
+	ErrKEKRequired = errors.New("no key encryption key is configured, set " + KEKEnvVar +
+		" or kek_file, or allow_plaintext to store private keys in plain text")
+)
+
+// EncryptedKey is a private key sealed with its own data key. The data key is wrapped
+// with a key encryption key, which is identified by KeyID.
+type EncryptedKey struct {
+	KeyID      string `bson:"key_id"`
+	WrappedKey []byte `bson:"wrapped_key"`
+	Ciphertext []byte `bson:"ciphertext"`
+}
+
+// KeyRing holds an active key encryption key used to seal new records and any previous
+// keys that are still needed to open records sealed before a rotation.
+type KeyRing struct {
+	active string
+	keys   map[string][]byte
+}
+
+// LoadKeyRing reads key encryption keys from configuration. It returns nil if encryption
+// isn't configured.
+func LoadKeyRing(c *Config) (*KeyRing, error) {
+	var (
+		kek []byte
+		err error
+	)
+
+	if v := os.Getenv(KEKEnvVar); v != "" {
+		kek, err = decodeKEK(v)
+	} else if c.Encryption.KEKFile != "" {
+		kek, err = readKEK(c.Encryption.KEKFile)
+	} else {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	k := &KeyRing{keys: make(map[string][]byte)}
+	k.active = k.add(kek)
+
+	for _, f := range c.Encryption.PreviousKEKFiles {
+		prev, err := readKEK(f)
+		if err != nil {
+			return nil, err
+		}
+		k.add(prev)
+	}
+
+	return k, nil
+}
+
+func (k *KeyRing) add(kek []byte) string {
+	sum := sha256.Sum256(kek)
+	id := hex.EncodeToString(sum[:8])
+
+	k.keys[id] = kek
+	return id
+}
+
+// ActiveID returns an id of the key encryption key new records are sealed with.
+func (k *KeyRing) ActiveID() string {
+	return k.active
+}
+
+// Seal encrypts a private key with a fresh data key. Subject is bound to a ciphertext,
+// so a sealed key cannot be moved to another record.
+func (k *KeyRing) Seal(subject string, pkey string) (*EncryptedKey, error) {
+	dek := make([]byte, kekSize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+
+	ct, err := gcmSeal(dek, []byte(pkey), []byte(subject))
+	if err != nil {
+		return nil, err
+	}
+
+	wrapped, err := gcmSeal(k.keys[k.active], dek, []byte(k.active))
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedKey{
+		KeyID:      k.active,
+		WrappedKey: wrapped,
+		Ciphertext: ct,
+	}, nil
+}
+
+// Open decrypts a private key sealed for a given subject.
+func (k *KeyRing) Open(subject string, e *EncryptedKey) (string, error) {
+	dek, err := k.unwrap(e)
+	if err != nil {
+		return "", err
+	}
+
+	pkey, err := gcmOpen(dek, e.Ciphertext, []byte(subject))
+	if err != nil {
+		return "", err
+	}
+
+	return string(pkey), nil
+}
+
+// Rewrap wraps a data key with the active key encryption key. Ciphertext is left as is.
+// It reports whether a record has changed.
+func (k *KeyRing) Rewrap(e *EncryptedKey) (bool, error) {
+	if e.KeyID == k.active {
+		return false, nil
+	}
+
+	dek, err := k.unwrap(e)
+	if err != nil {
+		return false, err
+	}
+
+	wrapped, err := gcmSeal(k.keys[k.active], dek, []byte(k.active))
+	if err != nil {
+		return false, err
+	}
+
+	e.KeyID = k.active
+	e.WrappedKey = wrapped
+
+	return true, nil
+}
+
+// Reveal returns a plain text private key of a subject. Records stored before encryption
+// was enabled are returned as they are.
+func (k *KeyRing) Reveal(s *Subject) (string, error) {
+	if s.EncryptedKey == nil {
+		return s.PrivateKey, nil
+	}
+
+	if k == nil {
+		return "", ErrNoKEK
+	}
+
+	return k.Open(s.Subject, s.EncryptedKey)
+}
+
+func (k *KeyRing) unwrap(e *EncryptedKey) ([]byte, error) {
+	kek, ok := k.keys[e.KeyID]
+	if !ok {
+		return nil, errors.New("unknown key encryption key " + e.KeyID)
+	}
+
+	return gcmOpen(kek, e.WrappedKey, []byte(e.KeyID))
+}
+
+func gcmSeal(key []byte, plain []byte, ad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plain, ad), nil
+}
+
+func gcmOpen(key []byte, sealed []byte, ad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], ad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(b)
+}
+
+func readKEK(file string) ([]byte, error) {
+	fi, err := os.Lstat(file)
+	if err != nil {
+		return nil, err
+	}
+
+	if fi.Mode().Perm()&0077 != 0 {
+		return nil, errors.New("perm " + file + ": should not be accessible by group or others")
+	}
+
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeKEK(string(b))
+}
+
+// decodeKEK expects base64 encoded 256 bit key, i.e. output of `openssl rand -base64 32`
+func decodeKEK(s string) ([]byte, error) {
+	kek, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(kek) != kekSize {
+		return nil, errors.New("key encryption key must be 32 bytes long")
+	}
+
+	return kek, nil
+}
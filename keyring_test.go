@@ -0,0 +1,154 @@
+package londo
+
+import (
+	"encoding/base64"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKeyRing(t *testing.T) {
+	kek := newKEK(t)
+
+	tests := []struct {
+		name    string
+		env     string
+		file    func(t *testing.T) string
+		wantNil bool
+		wantErr bool
+	}{
+		{"none", "", nil, true, false},
+		{"environment", kek, nil, false, false},
+		{"file", "", func(t *testing.T) string { return writeKEK(t, kek, 0600) }, false, false},
+		{"readable by others", "", func(t *testing.T) string { return writeKEK(t, kek, 0644) }, true, true},
+		{"short", base64.StdEncoding.EncodeToString([]byte("short")), nil, true, true},
+		{"not base64", "!", nil, true, true},
+		{"missing file", "", func(t *testing.T) string { return filepath.Join(t.TempDir(), "kek") }, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(KEKEnvVar, tt.env)
+
+			c := &Config{}
+			if tt.file != nil {
+				c.Encryption.KEKFile = tt.file(t)
+			}
+
+			k, err := LoadKeyRing(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadKeyRing() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if (k == nil) != tt.wantNil {
+				t.Errorf("LoadKeyRing() = %v, want nil %t", k, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestKeyRingSealOpen(t *testing.T) {
+	k := newTestKeyRing(t, newKEK(t))
+
+	e, err := k.Seal("a.example.com", "private key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if e.KeyID != k.ActiveID() {
+		t.Errorf("sealed with %s, want %s", e.KeyID, k.ActiveID())
+	}
+
+	tampered := *e
+	tampered.Ciphertext = append([]byte{}, e.Ciphertext...)
+	tampered.Ciphertext[len(tampered.Ciphertext)-1] ^= 1
+
+	tests := []struct {
+		name    string
+		subject string
+		key     *EncryptedKey
+		wantErr bool
+	}{
+		{"same subject", "a.example.com", e, false},
+		{"another subject", "b.example.com", e, true},
+		{"tampered", "a.example.com", &tampered, true},
+		{"unknown key", "a.example.com", &EncryptedKey{KeyID: "x", WrappedKey: e.WrappedKey, Ciphertext: e.Ciphertext}, true},
+		{"short", "a.example.com", &EncryptedKey{KeyID: e.KeyID, WrappedKey: []byte("x"), Ciphertext: e.Ciphertext}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkey, err := k.Open(tt.subject, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Open() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && pkey != "private key" {
+				t.Errorf("Open() = %q, want %q", pkey, "private key")
+			}
+		})
+	}
+}
+
+func TestKeyRingRewrap(t *testing.T) {
+	old, cur := newKEK(t), newKEK(t)
+
+	before := newTestKeyRing(t, old)
+	after := newTestKeyRing(t, cur, old)
+
+	e, err := before.Seal("a.example.com", "private key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct := string(e.Ciphertext)
+
+	if changed, err := after.Rewrap(e); err != nil || !changed {
+		t.Fatalf("Rewrap() = %t, %v, want a changed record", changed, err)
+	}
+
+	if e.KeyID != after.ActiveID() || string(e.Ciphertext) != ct {
+		t.Error("a data key wasn't wrapped with an active key, or a ciphertext has changed")
+	}
+
+	if pkey, err := after.Open("a.example.com", e); err != nil || pkey != "private key" {
+		t.Errorf("Open() after Rewrap() = %q, %v", pkey, err)
+	}
+
+	if changed, err := after.Rewrap(e); err != nil || changed {
+		t.Errorf("second Rewrap() = %t, %v, want an unchanged record", changed, err)
+	}
+
+	// a retired key can't open records it has sealed
+	if _, err := newTestKeyRing(t, cur).Rewrap(&EncryptedKey{KeyID: before.ActiveID()}); err == nil {
+		t.Error("Rewrap() without a previous key succeeded")
+	}
+}
+
+func TestKeyRingReveal(t *testing.T) {
+	k := newTestKeyRing(t, newKEK(t))
+
+	e, err := k.Seal("a.example.com", "private key")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ring    *KeyRing
+		subject Subject
+		want    string
+		wantErr error
+	}{
+		{"plain text", nil, Subject{Subject: "a.example.com", PrivateKey: "plain"}, "plain", nil},
+		{"sealed", k, Subject{Subject: "a.example.com", EncryptedKey: e}, "private key", nil},
+		{"sealed without a ring", nil, Subject{Subject: "a.example.com", EncryptedKey: e}, "", ErrNoKEK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.ring.Reveal(&tt.subject)
+			if err != tt.wantErr || got != tt.want {
+				t.Errorf("Reveal() = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
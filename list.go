@@ -0,0 +1,377 @@
+package londo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	SortBySubject   = "subject"
+	SortByNotAfter  = "not_after"
+	SortByCreatedAt = "created_at"
+
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// SubjectFilter selects a page of subjects. Nil booleans and zero times aren't applied.
+// Results are always ordered by a sort field and then by id, so pages stay stable.
+type SubjectFilter struct {
+	Name          string // glob, i.e. *.example.com
+	AltName       string
+	Target        string
+	Match         *bool
+	Outdated      *bool
+	Unresolvable  *bool
+	Deleted       bool // only deleted subjects instead of live ones
+	ExpiresAfter  time.Time
+	ExpiresBefore time.Time
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	SortBy        string
+	Descending    bool
+	PageSize      int
+	PageToken     string
+}
+
+func (SubjectFilter) EventName() string {
+	return "subject.filter"
+}
+
+// ListSubjectsReply carries a single page back to londo-grpcd
+type ListSubjectsReply struct {
+	Subjects      []Subject
+	NextPageToken string
+}
+
+func (ListSubjectsReply) EventName() string {
+	return "subject.list"
+}
+
+// pageToken points at the last subject of a previous page
+type pageToken struct {
+	Subject string    `json:"s,omitempty"`
+	Time    time.Time `json:"t,omitempty"`
+	ID      string    `json:"id"`
+}
+
+// Validate checks a filter and fills in defaults
+func (f *SubjectFilter) Validate() error {
+	switch f.SortBy {
+	case "":
+		f.SortBy = SortBySubject
+	case SortBySubject, SortByNotAfter, SortByCreatedAt:
+	default:
+		return errors.New("cannot sort by " + f.SortBy)
+	}
+
+	if f.PageSize <= 0 {
+		f.PageSize = DefaultPageSize
+	}
+
+	if f.PageSize > MaxPageSize {
+		f.PageSize = MaxPageSize
+	}
+
+	if _, err := f.nameRegexp(); err != nil {
+		return err
+	}
+
+	if _, err := f.token(); err != nil {
+		return errors.New("invalid page token")
+	}
+
+	return nil
+}
+
+// nameRegexp translates a name glob into an anchored regular expression
+func (f *SubjectFilter) nameRegexp() (string, error) {
+	if f.Name == "" {
+		return "", nil
+	}
+
+	var b strings.Builder
+	b.WriteString("^")
+
+	for _, r := range f.Name {
+		switch r {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	b.WriteString("$")
+
+	_, err := regexp.Compile(b.String())
+	return b.String(), err
+}
+
+func (f *SubjectFilter) token() (*pageToken, error) {
+	if f.PageToken == "" {
+		return nil, nil
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(f.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var t pageToken
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, err
+	}
+
+	if _, err := primitive.ObjectIDFromHex(t.ID); err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+func (f *SubjectFilter) nextToken(s *Subject) string {
+	t := pageToken{ID: s.ID.Hex()}
+
+	switch f.SortBy {
+	case SortBySubject:
+		t.Subject = s.Subject
+	case SortByNotAfter:
+		t.Time = s.NotAfter
+	case SortByCreatedAt:
+		t.Time = s.CreatedAt
+	}
+
+	b, _ := json.Marshal(&t)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Query builds a MongoDB filter. Both conditions on unresolvable_at and a page token
+// need $or, so everything is combined with $and.
+func (f *SubjectFilter) Query() (bson.M, error) {
+	and := []bson.M{{"deleted": bson.M{"$exists": f.Deleted}}}
+
+	if re, err := f.nameRegexp(); err != nil {
+		return nil, err
+	} else if re != "" {
+		and = append(and, bson.M{"subject": primitive.Regex{Pattern: re}})
+	}
+
+	if f.AltName != "" {
+		and = append(and, bson.M{"alt_names": f.AltName})
+	}
+
+	if f.Target != "" {
+		and = append(and, bson.M{"targets": f.Target})
+	}
+
+	if f.Match != nil {
+		and = append(and, bson.M{"match": *f.Match})
+	}
+
+	if f.Outdated != nil {
+		and = append(and, bson.M{"outdated.0": bson.M{"$exists": *f.Outdated}})
+	}
+
+	if f.Unresolvable != nil {
+		if *f.Unresolvable {
+			and = append(and, bson.M{"unresolvable_at": bson.M{"$gt": time.Time{}}})
+		} else {
+			and = append(and, bson.M{"$or": []bson.M{
+				{"unresolvable_at": bson.M{"$exists": false}},
+				{"unresolvable_at": bson.M{"$lte": time.Time{}}},
+			}})
+		}
+	}
+
+	if r := timeRange(f.ExpiresAfter, f.ExpiresBefore); r != nil {
+		and = append(and, bson.M{"not_after": r})
+	}
+
+	if r := timeRange(f.CreatedAfter, f.CreatedBefore); r != nil {
+		and = append(and, bson.M{"created_at": r})
+	}
+
+	t, err := f.token()
+	if err != nil {
+		return nil, err
+	}
+
+	if t != nil {
+		id, _ := primitive.ObjectIDFromHex(t.ID)
+
+		op := "$gt"
+		if f.Descending {
+			op = "$lt"
+		}
+
+		var v interface{} = t.Time
+		if f.SortBy == SortBySubject {
+			v = t.Subject
+		}
+
+		and = append(and, bson.M{"$or": []bson.M{
+			{f.SortBy: bson.M{op: v}},
+			{f.SortBy: v, "_id": bson.M{op: id}},
+		}})
+	}
+
+	return bson.M{"$and": and}, nil
+}
+
+// Sort returns MongoDB sort order matching Less
+func (f *SubjectFilter) Sort() bson.D {
+	dir := 1
+	if f.Descending {
+		dir = -1
+	}
+
+	return bson.D{{Key: f.SortBy, Value: dir}, {Key: "_id", Value: dir}}
+}
+
+// Matches applies a filter to a subject in memory. It is used by stores which can't query.
+func (f *SubjectFilter) Matches(s *Subject) bool {
+	if f.Deleted != (s.Deleted != nil) {
+		return false
+	}
+
+	if re, _ := f.nameRegexp(); re != "" {
+		if ok, _ := regexp.MatchString(re, s.Subject); !ok {
+			return false
+		}
+	}
+
+	if f.AltName != "" && !containsAny(s.AltNames, []string{f.AltName}) {
+		return false
+	}
+
+	if f.Target != "" && !containsAny(s.Targets, []string{f.Target}) {
+		return false
+	}
+
+	if f.Match != nil && *f.Match != s.Match {
+		return false
+	}
+
+	if f.Outdated != nil && *f.Outdated != (len(s.Outdated) != 0) {
+		return false
+	}
+
+	if f.Unresolvable != nil && *f.Unresolvable != !s.UnresolvableAt.IsZero() {
+		return false
+	}
+
+	if !inRange(s.NotAfter, f.ExpiresAfter, f.ExpiresBefore) {
+		return false
+	}
+
+	if !inRange(s.CreatedAt, f.CreatedAfter, f.CreatedBefore) {
+		return false
+	}
+
+	return true
+}
+
+// Less orders subjects by a sort field and then by id
+func (f *SubjectFilter) Less(a *Subject, b *Subject) bool {
+	var c int
+
+	switch f.SortBy {
+	case SortBySubject:
+		c = strings.Compare(a.Subject, b.Subject)
+	case SortByNotAfter:
+		c = compareTime(a.NotAfter, b.NotAfter)
+	case SortByCreatedAt:
+		c = compareTime(a.CreatedAt, b.CreatedAt)
+	}
+
+	if c == 0 {
+		c = strings.Compare(a.ID.Hex(), b.ID.Hex())
+	}
+
+	if f.Descending {
+		return c > 0
+	}
+	return c < 0
+}
+
+// Page sorts subjects which already matched a filter and cuts a page after a page token
+func (f *SubjectFilter) Page(subjs []Subject) ([]Subject, string) {
+	sort.SliceStable(subjs, func(i, j int) bool {
+		return f.Less(&subjs[i], &subjs[j])
+	})
+
+	if t, _ := f.token(); t != nil {
+		id, _ := primitive.ObjectIDFromHex(t.ID)
+		last := Subject{ID: id, Subject: t.Subject, NotAfter: t.Time, CreatedAt: t.Time}
+
+		i := sort.Search(len(subjs), func(i int) bool {
+			return f.Less(&last, &subjs[i])
+		})
+		subjs = subjs[i:]
+	}
+
+	return f.Cut(subjs)
+}
+
+// Cut limits a sorted result to a page size. A store should fetch one subject more than
+// a page size, so it is known whether there is a next page.
+func (f *SubjectFilter) Cut(subjs []Subject) ([]Subject, string) {
+	if len(subjs) <= f.PageSize {
+		return subjs, ""
+	}
+
+	subjs = subjs[:f.PageSize]
+	return subjs, f.nextToken(&subjs[len(subjs)-1])
+}
+
+func timeRange(after time.Time, before time.Time) bson.M {
+	if after.IsZero() && before.IsZero() {
+		return nil
+	}
+
+	r := bson.M{}
+
+	if !after.IsZero() {
+		r["$gte"] = after
+	}
+
+	if !before.IsZero() {
+		r["$lt"] = before
+	}
+
+	return r
+}
+
+func inRange(t time.Time, after time.Time, before time.Time) bool {
+	if !after.IsZero() && t.Before(after) {
+		return false
+	}
+
+	if !before.IsZero() && !t.Before(before) {
+		return false
+	}
+
+	return true
+}
+
+func compareTime(a time.Time, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	default:
+		return 0
+	}
+}
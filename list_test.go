@@ -0,0 +1,161 @@
+package londo
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSubjectFilterValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		f            SubjectFilter
+		wantErr      bool
+		wantSortBy   string
+		wantPageSize int
+	}{
+		{"defaults", SubjectFilter{}, false, SortBySubject, DefaultPageSize},
+		{"sort by expiry", SubjectFilter{SortBy: SortByNotAfter, PageSize: 10}, false, SortByNotAfter, 10},
+		{"too large page", SubjectFilter{PageSize: MaxPageSize + 1}, false, SortBySubject, MaxPageSize},
+		{"unknown sort", SubjectFilter{SortBy: "serial"}, true, "", 0},
+		{"page token", SubjectFilter{PageToken: "%"}, true, "", 0},
+		{"page token without an id", SubjectFilter{PageToken: "e30"}, true, "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.f.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if tt.f.SortBy != tt.wantSortBy || tt.f.PageSize != tt.wantPageSize {
+				t.Errorf("Validate() = %s, %d, want %s, %d", tt.f.SortBy, tt.f.PageSize, tt.wantSortBy, tt.wantPageSize)
+			}
+		})
+	}
+}
+
+func TestSubjectFilterMatches(t *testing.T) {
+	var (
+		yes = true
+		no  = false
+		now = time.Now()
+	)
+
+	s := &Subject{
+		Subject:   "www.example.com",
+		AltNames:  []string{"example.com"},
+		Targets:   []string{"10.0.0.1"},
+		Match:     true,
+		NotAfter:  now.Add(24 * time.Hour),
+		CreatedAt: now.Add(-24 * time.Hour),
+	}
+
+	tests := []struct {
+		name string
+		f    SubjectFilter
+		want bool
+	}{
+		{"everything", SubjectFilter{}, true},
+		{"glob", SubjectFilter{Name: "*.example.com"}, true},
+		{"single character", SubjectFilter{Name: "ww?.example.com"}, true},
+		{"glob is anchored", SubjectFilter{Name: "example.com"}, false},
+		{"dot is literal", SubjectFilter{Name: "www.example.co?x"}, false},
+		{"alt name", SubjectFilter{AltName: "example.com"}, true},
+		{"other alt name", SubjectFilter{AltName: "example.org"}, false},
+		{"target", SubjectFilter{Target: "10.0.0.1"}, true},
+		{"other target", SubjectFilter{Target: "10.0.0.2"}, false},
+		{"matching", SubjectFilter{Match: &yes}, true},
+		{"not matching", SubjectFilter{Match: &no}, false},
+		{"outdated", SubjectFilter{Outdated: &yes}, false},
+		{"up to date", SubjectFilter{Outdated: &no}, true},
+		{"unresolvable", SubjectFilter{Unresolvable: &yes}, false},
+		{"expires within", SubjectFilter{ExpiresAfter: now, ExpiresBefore: now.Add(48 * time.Hour)}, true},
+		{"expires later", SubjectFilter{ExpiresBefore: now}, false},
+		{"created before", SubjectFilter{CreatedBefore: now}, true},
+		{"created after", SubjectFilter{CreatedAfter: now}, false},
+		{"deleted", SubjectFilter{Deleted: true}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.f.Matches(s); got != tt.want {
+				t.Errorf("Matches() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestListSubjectsPages pages through subjects of a store, every subject comes once and in order
+func TestListSubjectsPages(t *testing.T) {
+	db := newTestBolt(t)
+
+	base := time.Now()
+	for i, name := range []string{"e", "c", "a", "d", "b"} {
+		// two subjects share an expiry, so they are ordered by an id, i.e. as they were inserted
+		day := i
+		if i == 4 {
+			day = 3
+		}
+
+		if err := db.InsertSubject(&Subject{
+			Subject:   name + ".example.com",
+			CertID:    i + 1,
+			NotAfter:  base.Add(time.Duration(day) * 24 * time.Hour),
+			CreatedAt: base.Add(-time.Duration(i) * time.Hour),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		sortBy     string
+		descending bool
+		want       []string
+	}{
+		{SortBySubject, false, []string{"a", "b", "c", "d", "e"}},
+		{SortBySubject, true, []string{"e", "d", "c", "b", "a"}},
+		{SortByNotAfter, false, []string{"e", "c", "a", "d", "b"}},
+		{SortByCreatedAt, false, []string{"b", "d", "a", "c", "e"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sortBy+" "+strconv.FormatBool(tt.descending), func(t *testing.T) {
+			f := &SubjectFilter{SortBy: tt.sortBy, Descending: tt.descending, PageSize: 2}
+			if err := f.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			var (
+				got   []string
+				pages int
+			)
+
+			for {
+				page, next, err := db.ListSubjects(f)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				for _, s := range page {
+					got = append(got, s.Subject[:1])
+				}
+
+				if pages++; next == "" || pages > 5 {
+					break
+				}
+				f.PageToken = next
+			}
+
+			if !reflect.DeepEqual(got, tt.want) || pages != 3 {
+				t.Errorf("listed %v in %d pages, want %v in 3", got, pages, tt.want)
+			}
+		})
+	}
+}
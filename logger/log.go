@@ -25,20 +25,43 @@ const (
 	DbSerial = "db_serial"
 	Service  = "service"
 	Reply    = "reply"
+	Path     = "path"
+	KeyID    = "key_id"
+	Failed   = "failed"
+	Actor    = "actor"
+	Version  = "version"
+	DryRun   = "dry_run"
+	Skipped  = "skipped"
+	Delay    = "delay"
+	Attempt  = "attempt"
+	ID       = "id"
+	Budget   = "budget"
+	Interval = "interval"
+	Burst    = "burst"
+	Workers  = "workers"
+	Prefetch = "prefetch"
+	Timeout  = "timeout"
+	Duration = "duration"
 
-	Requeue   = "requeue"
-	Rejected  = "rejected"
-	Ack       = "acknowledged"
-	Published = "published"
-	Received  = "received"
-	Success   = "success"
-	Skip      = "skipping"
-	Get       = "get"
-	Consumed  = "consumed"
-	Revoked   = "revoked"
-	Unknown   = "unknown"
-	Enroll    = "enroll"
-	Ok        = "ok"
-	Added     = "added"
-	Ready     = "ready"
+	Requeue      = "requeue"
+	Rejected     = "rejected"
+	Ack          = "acknowledged"
+	Published    = "published"
+	Received     = "received"
+	Success      = "success"
+	Skip         = "skipping"
+	Get          = "get"
+	Consumed     = "consumed"
+	Revoked      = "revoked"
+	Unknown      = "unknown"
+	Enroll       = "enroll"
+	Ok           = "ok"
+	Added        = "added"
+	Ready        = "ready"
+	Conflict     = "conflict"
+	Retry        = "retrying"
+	Lost         = "lost"
+	DeadLettered = "dead-lettered"
+	Throttled    = "throttled"
+	Abandoned    = "abandoned"
 )
@@ -6,6 +6,8 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/alexyermolaev/londo/jwt"
 	"github.com/alexyermolaev/londo/logger"
@@ -49,9 +51,29 @@ const (
 	DbGetUpdatedSubjectByTargetCmd = "subj.get.update"
 	DbGetExpiringSubjectsCmd       = "subj.get.expiring"
 	DbUpdateCertStatusCmd          = "subj.update.status"
-
-	// Tell consumer to close channel
+	DbRewrapKeysCmd                = "subj.keys.rewrap"
+	DbGetSubjectHistoryCmd         = "subj.get.history"
+	DbRevokeCertCmd                = "subj.cert.revoke"
+	DbAuditCmd                     = "audit.add"
+	DbGetAuditLogCmd               = "audit.get"
+	DbMigrateCmd                   = "db.migrate"
+	DbListSubjectsCmd              = "subj.list"
+	DbRestoreSubjCmd               = "subj.restore"
+	DbExportCmd                    = "db.export"
+	DbImportCmd                    = "db.import"
+	DbClaimEnrollCmd               = "enroll.claim"
+	DbReleaseEnrollCmd             = "enroll.release"
+	DbEnrollKeyCmd                 = "enroll.key"
+	DbEnrollAttemptCmd             = "enroll.attempt"
+	DbResolveEnrollCmd             = "enroll.resolve"
+
+	// Marks the last reply to a request, it may carry data itself
 	CloseChannelCmd = "stop"
+	// Replaces replies to a request which has failed
+	ErrorReplyCmd = "error"
+
+	// UpdateRetries is how many times a conflicting update is retried before it is requeued
+	UpdateRetries = 3
 
 	ContentType = "application/json"
 
@@ -62,6 +84,7 @@ var (
 	Debug       bool
 	ScanHours   int
 	RevokeHours int
+	HealthPort  int
 	cfgFile     string
 
 	cfg *Config
@@ -86,6 +109,19 @@ var (
 			Destination: &cfgFile,
 			Value:       "config/config.yml",
 		},
+		cli.DurationFlag{
+			Name:        "shutdown-timeout",
+			Usage:       "how long a stopping daemon waits for work in progress",
+			EnvVar:      "LONDO_SHUTDOWN_TIMEOUT",
+			Value:       ShutdownTimeout,
+			Destination: &ShutdownTimeout,
+		},
+		cli.IntFlag{
+			Name:        "health-port",
+			Usage:       "serve /healthz and /readyz on `PORT`, 0 disables",
+			EnvVar:      "LONDO_HEALTH_PORT",
+			Destination: &HealthPort,
+		},
 	}
 )
 
@@ -98,82 +134,90 @@ func init() {
 }
 
 type Londo struct {
-	Name       string
-	Db         *MongoDB
-	AMQP       *AMQP
-	GRPC       *GRPCServer
-	RestClient *RestAPI
+	Name string
+	Db   Store
+	Bus  Bus
+	GRPC *GRPCServer
+	CA   CAProvider
+	Keys *KeyRing
+
+	rpc       *rpcClient
+	consumers sync.WaitGroup
+	inflight  inflight
+	stopping  int32
 }
 
 func (l *Londo) AMQPConnection() *Londo {
-	l.AMQP, err = NewMQConnection(cfg, l.Db)
+	l.Bus, err = NewMQConnection(cfg, l.Db)
 	Fail(err)
 
 	log.WithFields(logrus.Fields{logger.Service: "amqp", logger.IP: cfg.AMQP.Hostname, logger.Port: cfg.AMQP.Port}).Info("connected")
 	return l
 }
 
-func (l *Londo) Declare(exchange string, queue string, kind string, args amqp.Table) *Londo {
-	ch, err := l.AMQP.connection.Channel()
-	defer ch.Close()
-	Fail(err)
+// BusConnection connects through a transport config selects, RabbitMQ unless it says otherwise
+func (l *Londo) BusConnection() *Londo {
+	if cfg.Transport != NATSTransport {
+		return l.AMQPConnection()
+	}
 
-	log.WithFields(logrus.Fields{logger.Exchange: exchange}).Info("declaring")
-	err = ch.ExchangeDeclare(
-		exchange, kind, true, false, false, false, nil)
+	l.Bus, err = NewNATSConnection(cfg)
 	Fail(err)
 
-	log.WithFields(logrus.Fields{logger.Queue: queue}).Info("declaring")
-	q, err := ch.QueueDeclare(
-		queue, false, false, false, false, args)
-	Fail(err)
+	log.WithFields(logrus.Fields{logger.Service: "nats", logger.IP: cfg.NATS.URL}).Info("connected")
+	return l
+}
 
-	log.WithFields(logrus.Fields{logger.Queue: q.Name}).Info("binding")
-	err = ch.QueueBind(queue, queue, exchange, false, nil)
-	Fail(err)
+// UseBus replaces BusConnection with a given bus, i.e. a MemoryBus shared by every role of a single process
+func (l *Londo) UseBus(b Bus) *Londo {
+	l.Bus = b
+	return l
+}
 
+func (l *Londo) Declare(exchange string, queue string, kind string, args amqp.Table) *Londo {
+	Fail(l.Bus.Declare(exchange, queue, kind, args))
 	return l
 }
 
-// TODO: refactor
 func (l *Londo) DeclareExchange(exchange string, kind string) *Londo {
-	ch, err := l.AMQP.connection.Channel()
-	defer ch.Close()
-	Fail(err)
-
-	log.WithFields(logrus.Fields{logger.Exchange: exchange}).Info("declaring")
-	err = ch.ExchangeDeclare(
-		exchange, kind, true, false, false, false, nil)
-	Fail(err)
-
+	Fail(l.Bus.DeclareExchange(exchange, kind))
 	return l
 }
 
-// TODO: refactor
-func (l *Londo) DeclareBindQueue(exchange string, queue string) error {
-	ch, err := l.AMQP.connection.Channel()
-	defer ch.Close()
-	Fail(err)
+func (l *Londo) DbService() *Londo {
+	var err error
 
-	log.WithFields(logrus.Fields{logger.Queue: queue}).Info("declaring")
-	q, err := ch.QueueDeclare(queue, false, true, false, false, nil)
-	if err != nil {
-		return err
+	if cfg.Storage.Backend == BoltBackend {
+		log.WithFields(logrus.Fields{logger.Service: BoltBackend, logger.Path: cfg.Storage.Path}).Info("db connection")
+	} else {
+		log.WithFields(logrus.Fields{logger.IP: cfg.DB.Addr(), logger.Service: MongoBackend}).Info("db connection")
 	}
 
-	log.WithFields(logrus.Fields{logger.Queue: q.Name}).Info("binding")
-	err = ch.QueueBind(queue, queue, exchange, false, nil)
+	l.Db, err = NewStore(cfg)
+	Fail(err)
 
-	return err
+	Fail(l.Db.EnsureIndexes())
+	log.WithFields(logrus.Fields{logger.Service: "db"}).Info("indexes ensured")
+
+	return l
 }
 
-func (l *Londo) DbService() *Londo {
+func (l *Londo) KeyRing() *Londo {
 	var err error
 
-	log.WithFields(logrus.Fields{logger.IP: cfg.DB.Hostname, logger.Port: cfg.DB.Port}).Info("db connection")
-	l.Db, err = NewDBConnection(cfg)
+	l.Keys, err = LoadKeyRing(cfg)
 	Fail(err)
 
+	if l.Keys == nil && !cfg.Encryption.AllowPlaintext {
+		Fail(ErrKEKRequired)
+	}
+
+	if l.Keys == nil {
+		log.WithFields(logrus.Fields{logger.Service: "encryption"}).Warn("no key encryption key, private keys are stored in plain text")
+		return l
+	}
+
+	log.WithFields(logrus.Fields{logger.Service: "encryption", logger.KeyID: l.Keys.ActiveID()}).Info("loaded")
 	return l
 }
 
@@ -219,10 +263,18 @@ func (l *Londo) GRPCServer() *Londo {
 		grpc.Creds(creds),
 	}
 
+	if l.rpc == nil {
+		l.RPCClient()
+	}
+
 	srv := grpc.NewServer(opts...)
-	londopb.RegisterCertServiceServer(srv, &GRPCServer{
+
+	l.GRPC = &GRPCServer{
 		Londo: l,
-	})
+		rpc:   l.rpc,
+		srv:   srv,
+	}
+	londopb.RegisterCertServiceServer(srv, l.GRPC)
 
 	reflection.Register(srv)
 
@@ -238,17 +290,36 @@ func (l *Londo) GRPCServer() *Londo {
 
 func (l *Londo) Run() error {
 	s := make(chan os.Signal, 1)
-	signal.Notify(s, os.Interrupt)
+	signal.Notify(s, os.Interrupt, syscall.SIGTERM)
+
+	sig := <-s
+	log.WithFields(logrus.Fields{logger.Reason: sig}).Info("received")
+
+	code := 0
+	if n := l.stop(); n != 0 {
+		log.WithFields(logrus.Fields{logger.Count: n}).Error(logger.Abandoned)
+		code = 1
+	}
 
-	<-s
 	log.Info("Goodbye, Captain Sheridan!")
-	l.shutdown(0)
+	l.shutdown(code)
 
 	return nil
 }
 
-func (l *Londo) RestAPIClient() *Londo {
-	l.RestClient = NewRestClient(cfg)
+// RPCClient lets a daemon wait for replies of londo-dbd, they come through GRPCServerExchange
+func (l *Londo) RPCClient() *Londo {
+	l.rpc, err = newRPCClient(l.Bus)
+	Fail(err)
+
+	return l
+}
+
+// CAClient needs a bus, CA calls of every replica share rate limits through it
+func (l *Londo) CAClient() *Londo {
+	l.CA, err = NewCAProvider(cfg, l.Bus)
+	Fail(err)
+
 	return l
 }
 
@@ -8,6 +8,8 @@ import (
 	fmt "fmt"
 	proto "github.com/golang/protobuf/proto"
 	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
 	math "math"
 )
 
@@ -22,6 +24,63 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+// List subjects
+type Filter int32
+
+const (
+	Filter_ANY     Filter = 0
+	Filter_ONLY    Filter = 1
+	Filter_EXCLUDE Filter = 2
+)
+
+var Filter_name = map[int32]string{
+	0: "ANY",
+	1: "ONLY",
+	2: "EXCLUDE",
+}
+
+var Filter_value = map[string]int32{
+	"ANY":     0,
+	"ONLY":    1,
+	"EXCLUDE": 2,
+}
+
+func (x Filter) String() string {
+	return proto.EnumName(Filter_name, int32(x))
+}
+
+func (Filter) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{0}
+}
+
+type SortField int32
+
+const (
+	SortField_SUBJECT    SortField = 0
+	SortField_NOT_AFTER  SortField = 1
+	SortField_CREATED_AT SortField = 2
+)
+
+var SortField_name = map[int32]string{
+	0: "SUBJECT",
+	1: "NOT_AFTER",
+	2: "CREATED_AT",
+}
+
+var SortField_value = map[string]int32{
+	"SUBJECT":    0,
+	"NOT_AFTER":  1,
+	"CREATED_AT": 2,
+}
+
+func (x SortField) String() string {
+	return proto.EnumName(SortField_name, int32(x))
+}
+
+func (SortField) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{1}
+}
+
 type Subject struct {
 	Subject              string   `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
 	Certificate          string   `protobuf:"bytes,2,opt,name=certificate,proto3" json:"certificate,omitempty"`
@@ -394,6 +453,7 @@ func (m *AddNewSubjectResponse) GetSubject() string {
 // Delete Subject
 type DeleteSubjectRequest struct {
 	Subject              string   `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	Reason               string   `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -431,6 +491,13 @@ func (m *DeleteSubjectRequest) GetSubject() string {
 	return ""
 }
 
+func (m *DeleteSubjectRequest) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
 type DeleteSubjectResponse struct {
 	Subject              string   `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -470,6 +537,94 @@ func (m *DeleteSubjectResponse) GetSubject() string {
 	return ""
 }
 
+// Restore Subject
+type RestoreSubjectRequest struct {
+	Subject              string   `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RestoreSubjectRequest) Reset()         { *m = RestoreSubjectRequest{} }
+func (m *RestoreSubjectRequest) String() string { return proto.CompactTextString(m) }
+func (*RestoreSubjectRequest) ProtoMessage()    {}
+func (*RestoreSubjectRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{10}
+}
+
+func (m *RestoreSubjectRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RestoreSubjectRequest.Unmarshal(m, b)
+}
+func (m *RestoreSubjectRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RestoreSubjectRequest.Marshal(b, m, deterministic)
+}
+func (m *RestoreSubjectRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RestoreSubjectRequest.Merge(m, src)
+}
+func (m *RestoreSubjectRequest) XXX_Size() int {
+	return xxx_messageInfo_RestoreSubjectRequest.Size(m)
+}
+func (m *RestoreSubjectRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RestoreSubjectRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RestoreSubjectRequest proto.InternalMessageInfo
+
+func (m *RestoreSubjectRequest) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+type RestoreSubjectResponse struct {
+	Subject string `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	// certificate was revoked while subject was deleted, so it has to be renewed
+	Revoked              bool     `protobuf:"varint,2,opt,name=revoked,proto3" json:"revoked,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RestoreSubjectResponse) Reset()         { *m = RestoreSubjectResponse{} }
+func (m *RestoreSubjectResponse) String() string { return proto.CompactTextString(m) }
+func (*RestoreSubjectResponse) ProtoMessage()    {}
+func (*RestoreSubjectResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{11}
+}
+
+func (m *RestoreSubjectResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RestoreSubjectResponse.Unmarshal(m, b)
+}
+func (m *RestoreSubjectResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RestoreSubjectResponse.Marshal(b, m, deterministic)
+}
+func (m *RestoreSubjectResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RestoreSubjectResponse.Merge(m, src)
+}
+func (m *RestoreSubjectResponse) XXX_Size() int {
+	return xxx_messageInfo_RestoreSubjectResponse.Size(m)
+}
+func (m *RestoreSubjectResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RestoreSubjectResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RestoreSubjectResponse proto.InternalMessageInfo
+
+func (m *RestoreSubjectResponse) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+func (m *RestoreSubjectResponse) GetRevoked() bool {
+	if m != nil {
+		return m.Revoked
+	}
+	return false
+}
+
 // Get expiring subjects
 type ExpiringSubject struct {
 	Subject              string   `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
@@ -483,7 +638,7 @@ func (m *ExpiringSubject) Reset()         { *m = ExpiringSubject{} }
 func (m *ExpiringSubject) String() string { return proto.CompactTextString(m) }
 func (*ExpiringSubject) ProtoMessage()    {}
 func (*ExpiringSubject) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f3d42104e625ed99, []int{10}
+	return fileDescriptor_f3d42104e625ed99, []int{12}
 }
 
 func (m *ExpiringSubject) XXX_Unmarshal(b []byte) error {
@@ -529,7 +684,7 @@ func (m *GetExpiringSubjectsRequest) Reset()         { *m = GetExpiringSubjectsR
 func (m *GetExpiringSubjectsRequest) String() string { return proto.CompactTextString(m) }
 func (*GetExpiringSubjectsRequest) ProtoMessage()    {}
 func (*GetExpiringSubjectsRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f3d42104e625ed99, []int{11}
+	return fileDescriptor_f3d42104e625ed99, []int{13}
 }
 
 func (m *GetExpiringSubjectsRequest) XXX_Unmarshal(b []byte) error {
@@ -568,7 +723,7 @@ func (m *GetExpiringSubjectsResponse) Reset()         { *m = GetExpiringSubjects
 func (m *GetExpiringSubjectsResponse) String() string { return proto.CompactTextString(m) }
 func (*GetExpiringSubjectsResponse) ProtoMessage()    {}
 func (*GetExpiringSubjectsResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f3d42104e625ed99, []int{12}
+	return fileDescriptor_f3d42104e625ed99, []int{14}
 }
 
 func (m *GetExpiringSubjectsResponse) XXX_Unmarshal(b []byte) error {
@@ -608,7 +763,7 @@ func (m *RenewSubject) Reset()         { *m = RenewSubject{} }
 func (m *RenewSubject) String() string { return proto.CompactTextString(m) }
 func (*RenewSubject) ProtoMessage()    {}
 func (*RenewSubject) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f3d42104e625ed99, []int{13}
+	return fileDescriptor_f3d42104e625ed99, []int{15}
 }
 
 func (m *RenewSubject) XXX_Unmarshal(b []byte) error {
@@ -648,7 +803,7 @@ func (m *RenewSubjectRequest) Reset()         { *m = RenewSubjectRequest{} }
 func (m *RenewSubjectRequest) String() string { return proto.CompactTextString(m) }
 func (*RenewSubjectRequest) ProtoMessage()    {}
 func (*RenewSubjectRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f3d42104e625ed99, []int{14}
+	return fileDescriptor_f3d42104e625ed99, []int{16}
 }
 
 func (m *RenewSubjectRequest) XXX_Unmarshal(b []byte) error {
@@ -694,7 +849,7 @@ func (m *RenewResponse) Reset()         { *m = RenewResponse{} }
 func (m *RenewResponse) String() string { return proto.CompactTextString(m) }
 func (*RenewResponse) ProtoMessage()    {}
 func (*RenewResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f3d42104e625ed99, []int{15}
+	return fileDescriptor_f3d42104e625ed99, []int{17}
 }
 
 func (m *RenewResponse) XXX_Unmarshal(b []byte) error {
@@ -722,182 +877,1917 @@ func (m *RenewResponse) GetSubject() *RenewSubject {
 	return nil
 }
 
-// New Token
-type JWTToken struct {
-	Token                string   `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+type ListedSubject struct {
+	Subject              string   `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	Port                 int32    `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	CertId               int64    `protobuf:"varint,3,opt,name=cert_id,json=certId,proto3" json:"cert_id,omitempty"`
+	Serial               string   `protobuf:"bytes,4,opt,name=serial,proto3" json:"serial,omitempty"`
+	NotAfter             int64    `protobuf:"varint,5,opt,name=not_after,json=notAfter,proto3" json:"not_after,omitempty"`
+	CreatedAt            int64    `protobuf:"varint,6,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	UpdatedAt            int64    `protobuf:"varint,7,opt,name=updated_at,json=updatedAt,proto3" json:"updated_at,omitempty"`
+	UnresolvableAt       int64    `protobuf:"varint,8,opt,name=unresolvable_at,json=unresolvableAt,proto3" json:"unresolvable_at,omitempty"`
+	Match                bool     `protobuf:"varint,9,opt,name=match,proto3" json:"match,omitempty"`
+	AltNames             []string `protobuf:"bytes,10,rep,name=alt_names,json=altNames,proto3" json:"alt_names,omitempty"`
+	Targets              []string `protobuf:"bytes,11,rep,name=targets,proto3" json:"targets,omitempty"`
+	Outdated             []string `protobuf:"bytes,12,rep,name=outdated,proto3" json:"outdated,omitempty"`
+	DeletedAt            int64    `protobuf:"varint,13,opt,name=deleted_at,json=deletedAt,proto3" json:"deleted_at,omitempty"`
+	DeletedReason        string   `protobuf:"bytes,14,opt,name=deleted_reason,json=deletedReason,proto3" json:"deleted_reason,omitempty"`
+	DeletedBy            string   `protobuf:"bytes,15,opt,name=deleted_by,json=deletedBy,proto3" json:"deleted_by,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *JWTToken) Reset()         { *m = JWTToken{} }
-func (m *JWTToken) String() string { return proto.CompactTextString(m) }
-func (*JWTToken) ProtoMessage()    {}
-func (*JWTToken) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f3d42104e625ed99, []int{16}
+func (m *ListedSubject) Reset()         { *m = ListedSubject{} }
+func (m *ListedSubject) String() string { return proto.CompactTextString(m) }
+func (*ListedSubject) ProtoMessage()    {}
+func (*ListedSubject) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{18}
 }
 
-func (m *JWTToken) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_JWTToken.Unmarshal(m, b)
+func (m *ListedSubject) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListedSubject.Unmarshal(m, b)
 }
-func (m *JWTToken) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_JWTToken.Marshal(b, m, deterministic)
+func (m *ListedSubject) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListedSubject.Marshal(b, m, deterministic)
 }
-func (m *JWTToken) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_JWTToken.Merge(m, src)
+func (m *ListedSubject) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListedSubject.Merge(m, src)
 }
-func (m *JWTToken) XXX_Size() int {
-	return xxx_messageInfo_JWTToken.Size(m)
+func (m *ListedSubject) XXX_Size() int {
+	return xxx_messageInfo_ListedSubject.Size(m)
 }
-func (m *JWTToken) XXX_DiscardUnknown() {
-	xxx_messageInfo_JWTToken.DiscardUnknown(m)
+func (m *ListedSubject) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListedSubject.DiscardUnknown(m)
 }
 
-var xxx_messageInfo_JWTToken proto.InternalMessageInfo
+var xxx_messageInfo_ListedSubject proto.InternalMessageInfo
 
-func (m *JWTToken) GetToken() string {
+func (m *ListedSubject) GetSubject() string {
 	if m != nil {
-		return m.Token
+		return m.Subject
 	}
 	return ""
 }
 
-type GetTokenRequest struct {
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+func (m *ListedSubject) GetPort() int32 {
+	if m != nil {
+		return m.Port
+	}
+	return 0
 }
 
-func (m *GetTokenRequest) Reset()         { *m = GetTokenRequest{} }
-func (m *GetTokenRequest) String() string { return proto.CompactTextString(m) }
-func (*GetTokenRequest) ProtoMessage()    {}
-func (*GetTokenRequest) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f3d42104e625ed99, []int{17}
+func (m *ListedSubject) GetCertId() int64 {
+	if m != nil {
+		return m.CertId
+	}
+	return 0
 }
 
-func (m *GetTokenRequest) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_GetTokenRequest.Unmarshal(m, b)
+func (m *ListedSubject) GetSerial() string {
+	if m != nil {
+		return m.Serial
+	}
+	return ""
 }
-func (m *GetTokenRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_GetTokenRequest.Marshal(b, m, deterministic)
+
+func (m *ListedSubject) GetNotAfter() int64 {
+	if m != nil {
+		return m.NotAfter
+	}
+	return 0
 }
-func (m *GetTokenRequest) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_GetTokenRequest.Merge(m, src)
+
+func (m *ListedSubject) GetCreatedAt() int64 {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return 0
 }
-func (m *GetTokenRequest) XXX_Size() int {
-	return xxx_messageInfo_GetTokenRequest.Size(m)
+
+func (m *ListedSubject) GetUpdatedAt() int64 {
+	if m != nil {
+		return m.UpdatedAt
+	}
+	return 0
 }
-func (m *GetTokenRequest) XXX_DiscardUnknown() {
-	xxx_messageInfo_GetTokenRequest.DiscardUnknown(m)
+
+func (m *ListedSubject) GetUnresolvableAt() int64 {
+	if m != nil {
+		return m.UnresolvableAt
+	}
+	return 0
 }
 
-var xxx_messageInfo_GetTokenRequest proto.InternalMessageInfo
+func (m *ListedSubject) GetMatch() bool {
+	if m != nil {
+		return m.Match
+	}
+	return false
+}
 
-type GetTokenResponse struct {
-	Token                *JWTToken `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
-	XXX_unrecognized     []byte    `json:"-"`
-	XXX_sizecache        int32     `json:"-"`
+func (m *ListedSubject) GetAltNames() []string {
+	if m != nil {
+		return m.AltNames
+	}
+	return nil
 }
 
-func (m *GetTokenResponse) Reset()         { *m = GetTokenResponse{} }
-func (m *GetTokenResponse) String() string { return proto.CompactTextString(m) }
-func (*GetTokenResponse) ProtoMessage()    {}
-func (*GetTokenResponse) Descriptor() ([]byte, []int) {
-	return fileDescriptor_f3d42104e625ed99, []int{18}
+func (m *ListedSubject) GetTargets() []string {
+	if m != nil {
+		return m.Targets
+	}
+	return nil
 }
 
-func (m *GetTokenResponse) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_GetTokenResponse.Unmarshal(m, b)
+func (m *ListedSubject) GetOutdated() []string {
+	if m != nil {
+		return m.Outdated
+	}
+	return nil
 }
-func (m *GetTokenResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_GetTokenResponse.Marshal(b, m, deterministic)
+
+func (m *ListedSubject) GetDeletedAt() int64 {
+	if m != nil {
+		return m.DeletedAt
+	}
+	return 0
 }
-func (m *GetTokenResponse) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_GetTokenResponse.Merge(m, src)
+
+func (m *ListedSubject) GetDeletedReason() string {
+	if m != nil {
+		return m.DeletedReason
+	}
+	return ""
 }
-func (m *GetTokenResponse) XXX_Size() int {
-	return xxx_messageInfo_GetTokenResponse.Size(m)
+
+func (m *ListedSubject) GetDeletedBy() string {
+	if m != nil {
+		return m.DeletedBy
+	}
+	return ""
 }
-func (m *GetTokenResponse) XXX_DiscardUnknown() {
-	xxx_messageInfo_GetTokenResponse.DiscardUnknown(m)
+
+type ListSubjectsRequest struct {
+	// glob, i.e. *.example.com
+	Name          string    `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	AltName       string    `protobuf:"bytes,2,opt,name=alt_name,json=altName,proto3" json:"alt_name,omitempty"`
+	Target        string    `protobuf:"bytes,3,opt,name=target,proto3" json:"target,omitempty"`
+	Match         Filter    `protobuf:"varint,4,opt,name=match,proto3,enum=londoapi.v1.Filter" json:"match,omitempty"`
+	Outdated      Filter    `protobuf:"varint,5,opt,name=outdated,proto3,enum=londoapi.v1.Filter" json:"outdated,omitempty"`
+	Unresolvable  Filter    `protobuf:"varint,6,opt,name=unresolvable,proto3,enum=londoapi.v1.Filter" json:"unresolvable,omitempty"`
+	ExpiresAfter  int64     `protobuf:"varint,7,opt,name=expires_after,json=expiresAfter,proto3" json:"expires_after,omitempty"`
+	ExpiresBefore int64     `protobuf:"varint,8,opt,name=expires_before,json=expiresBefore,proto3" json:"expires_before,omitempty"`
+	CreatedAfter  int64     `protobuf:"varint,9,opt,name=created_after,json=createdAfter,proto3" json:"created_after,omitempty"`
+	CreatedBefore int64     `protobuf:"varint,10,opt,name=created_before,json=createdBefore,proto3" json:"created_before,omitempty"`
+	SortBy        SortField `protobuf:"varint,11,opt,name=sort_by,json=sortBy,proto3,enum=londoapi.v1.SortField" json:"sort_by,omitempty"`
+	Descending    bool      `protobuf:"varint,12,opt,name=descending,proto3" json:"descending,omitempty"`
+	PageSize      int32     `protobuf:"varint,13,opt,name=page_size,json=pageSize,proto3" json:"page_size,omitempty"`
+	PageToken     string    `protobuf:"bytes,14,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	// deleted subjects instead of live ones
+	Deleted              bool     `protobuf:"varint,15,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-var xxx_messageInfo_GetTokenResponse proto.InternalMessageInfo
+func (m *ListSubjectsRequest) Reset()         { *m = ListSubjectsRequest{} }
+func (m *ListSubjectsRequest) String() string { return proto.CompactTextString(m) }
+func (*ListSubjectsRequest) ProtoMessage()    {}
+func (*ListSubjectsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{19}
+}
 
-func (m *GetTokenResponse) GetToken() *JWTToken {
+func (m *ListSubjectsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListSubjectsRequest.Unmarshal(m, b)
+}
+func (m *ListSubjectsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListSubjectsRequest.Marshal(b, m, deterministic)
+}
+func (m *ListSubjectsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListSubjectsRequest.Merge(m, src)
+}
+func (m *ListSubjectsRequest) XXX_Size() int {
+	return xxx_messageInfo_ListSubjectsRequest.Size(m)
+}
+func (m *ListSubjectsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListSubjectsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListSubjectsRequest proto.InternalMessageInfo
+
+func (m *ListSubjectsRequest) GetName() string {
 	if m != nil {
-		return m.Token
+		return m.Name
 	}
-	return nil
+	return ""
 }
 
-func init() {
-	proto.RegisterType((*Subject)(nil), "londoapi.v1.Subject")
-	proto.RegisterType((*GetSubjectRequest)(nil), "londoapi.v1.GetSubjectRequest")
-	proto.RegisterType((*TargetRequest)(nil), "londoapi.v1.TargetRequest")
-	proto.RegisterType((*ForTargetRequest)(nil), "londoapi.v1.ForTargetRequest")
-	proto.RegisterType((*GetSubjectResponse)(nil), "londoapi.v1.GetSubjectResponse")
-	proto.RegisterType((*NewSubject)(nil), "londoapi.v1.NewSubject")
-	proto.RegisterType((*AddNewSubjectRequest)(nil), "londoapi.v1.AddNewSubjectRequest")
-	proto.RegisterType((*AddNewSubjectResponse)(nil), "londoapi.v1.AddNewSubjectResponse")
-	proto.RegisterType((*DeleteSubjectRequest)(nil), "londoapi.v1.DeleteSubjectRequest")
-	proto.RegisterType((*DeleteSubjectResponse)(nil), "londoapi.v1.DeleteSubjectResponse")
-	proto.RegisterType((*ExpiringSubject)(nil), "londoapi.v1.ExpiringSubject")
-	proto.RegisterType((*GetExpiringSubjectsRequest)(nil), "londoapi.v1.GetExpiringSubjectsRequest")
-	proto.RegisterType((*GetExpiringSubjectsResponse)(nil), "londoapi.v1.GetExpiringSubjectsResponse")
-	proto.RegisterType((*RenewSubject)(nil), "londoapi.v1.RenewSubject")
-	proto.RegisterType((*RenewSubjectRequest)(nil), "londoapi.v1.RenewSubjectRequest")
-	proto.RegisterType((*RenewResponse)(nil), "londoapi.v1.RenewResponse")
-	proto.RegisterType((*JWTToken)(nil), "londoapi.v1.JWTToken")
-	proto.RegisterType((*GetTokenRequest)(nil), "londoapi.v1.GetTokenRequest")
-	proto.RegisterType((*GetTokenResponse)(nil), "londoapi.v1.GetTokenResponse")
+func (m *ListSubjectsRequest) GetAltName() string {
+	if m != nil {
+		return m.AltName
+	}
+	return ""
 }
 
-func init() { proto.RegisterFile("londopb/londo.proto", fileDescriptor_f3d42104e625ed99) }
+func (m *ListSubjectsRequest) GetTarget() string {
+	if m != nil {
+		return m.Target
+	}
+	return ""
+}
 
-var fileDescriptor_f3d42104e625ed99 = []byte{
-	// 639 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x55, 0xd1, 0x6e, 0xda, 0x4a,
-	0x10, 0x15, 0x01, 0x02, 0x8c, 0x2f, 0x4a, 0xb2, 0x81, 0x5b, 0xc7, 0x49, 0x1a, 0xea, 0x97, 0xa0,
-	0x56, 0xa5, 0x40, 0xa4, 0xbe, 0x56, 0x4d, 0x68, 0x50, 0x5b, 0x35, 0x95, 0x1c, 0x9a, 0x48, 0x7d,
-	0x41, 0x06, 0x4f, 0x23, 0x37, 0xd4, 0x76, 0xec, 0x85, 0xc2, 0xc7, 0xf4, 0x5f, 0xfa, 0x69, 0x95,
-	0x97, 0xb5, 0xf1, 0x2e, 0x38, 0xce, 0x13, 0x3b, 0xbb, 0x33, 0x67, 0xce, 0x1c, 0xcf, 0x0c, 0xb0,
-	0x3f, 0x71, 0x1d, 0xcb, 0xf5, 0x46, 0x6f, 0xd8, 0x6f, 0xcb, 0xf3, 0x5d, 0xea, 0x12, 0x85, 0x19,
-	0xa6, 0x67, 0xb7, 0x66, 0x1d, 0xfd, 0x4f, 0x0e, 0x4a, 0xd7, 0xd3, 0xd1, 0x4f, 0x1c, 0x53, 0xa2,
-	0x42, 0x29, 0x58, 0x1e, 0xd5, 0x5c, 0x23, 0xd7, 0xac, 0x18, 0x91, 0x49, 0x1a, 0xa0, 0x8c, 0xd1,
-	0xa7, 0xf6, 0x0f, 0x7b, 0x6c, 0x52, 0x54, 0xb7, 0xd8, 0x6b, 0xf2, 0x8a, 0x9c, 0x80, 0xe2, 0xf9,
-	0xf6, 0xcc, 0xa4, 0x38, 0xbc, 0xc7, 0x85, 0x9a, 0x67, 0x1e, 0xc0, 0xaf, 0x3e, 0xe3, 0x82, 0x1c,
-	0x42, 0xc5, 0x9c, 0xd0, 0xa1, 0x63, 0xfe, 0xc2, 0x40, 0x2d, 0x34, 0xf2, 0xcd, 0x8a, 0x51, 0x36,
-	0x27, 0xf4, 0x2a, 0xb4, 0xc3, 0xcc, 0xd4, 0xf4, 0xef, 0x90, 0x06, 0x6a, 0x91, 0x3d, 0x45, 0xa6,
-	0xfe, 0x1a, 0xf6, 0xfa, 0x48, 0x39, 0x43, 0x03, 0x1f, 0xa6, 0x18, 0x3c, 0x42, 0x54, 0x3f, 0x85,
-	0xea, 0x80, 0x45, 0x46, 0xae, 0xff, 0xc3, 0xf6, 0x12, 0x4a, 0xcd, 0x31, 0x60, 0x6e, 0xe9, 0x2f,
-	0x61, 0xf7, 0xd2, 0xf5, 0xd7, 0x7c, 0xa7, 0x9e, 0x15, 0x16, 0x18, 0xa2, 0x96, 0x0d, 0x6e, 0xe9,
-	0x3d, 0x20, 0x49, 0x0e, 0x81, 0xe7, 0x3a, 0x01, 0x92, 0x96, 0x48, 0x42, 0xe9, 0xd6, 0x5a, 0x09,
-	0x61, 0x5b, 0x91, 0x7b, 0x4c, 0xed, 0x01, 0xe0, 0x0a, 0x7f, 0x67, 0x6b, 0x4d, 0xa0, 0xe0, 0xb9,
-	0x3e, 0x65, 0x22, 0x17, 0x0d, 0x76, 0x16, 0xc5, 0xcb, 0xa7, 0x8b, 0x57, 0x10, 0xc5, 0xfb, 0x08,
-	0xb5, 0xf7, 0x96, 0xb5, 0xca, 0x1a, 0x15, 0xda, 0x91, 0xa9, 0x3f, 0x13, 0xa8, 0x27, 0x02, 0x62,
-	0xf6, 0x1d, 0xa8, 0x4b, 0x50, 0x5c, 0x86, 0xf4, 0x6f, 0xd1, 0x86, 0x5a, 0x0f, 0x27, 0x48, 0xf1,
-	0xc9, 0x5f, 0xaf, 0x03, 0x75, 0x29, 0x22, 0x33, 0xc9, 0x25, 0xec, 0x7c, 0x98, 0x7b, 0xb6, 0x6f,
-	0x3b, 0x77, 0xd9, 0xd2, 0x1e, 0x40, 0x19, 0xe7, 0xde, 0xd0, 0x8a, 0x7a, 0x38, 0x6f, 0x94, 0x70,
-	0xee, 0xf5, 0xc2, 0x6f, 0xdc, 0x06, 0xad, 0x8f, 0x54, 0x82, 0x0a, 0x22, 0xca, 0x04, 0x0a, 0x96,
-	0xb9, 0x08, 0x18, 0x5e, 0xd1, 0x60, 0x67, 0xfd, 0x1b, 0x1c, 0x6e, 0x8c, 0xe0, 0x94, 0xdf, 0xca,
-	0x1a, 0x1f, 0x09, 0x1a, 0x4b, 0x71, 0xab, 0x82, 0x9a, 0xf0, 0x9f, 0x81, 0xce, 0xc6, 0x46, 0xd9,
-	0x12, 0x4b, 0xbf, 0x80, 0xfd, 0xa4, 0x67, 0xa6, 0xbc, 0x71, 0x15, 0x5b, 0x89, 0x2a, 0x7a, 0x50,
-	0x65, 0x20, 0x31, 0xef, 0x33, 0x99, 0xf7, 0x81, 0xc0, 0x5b, 0xc8, 0x18, 0x53, 0x69, 0x40, 0xf9,
-	0xd3, 0xed, 0x60, 0xe0, 0xde, 0xa3, 0x43, 0x6a, 0x50, 0xa4, 0xe1, 0x81, 0x67, 0x5f, 0x1a, 0xfa,
-	0x1e, 0xec, 0xf4, 0x91, 0x32, 0x0f, 0x4e, 0x54, 0x7f, 0x07, 0xbb, 0xab, 0x2b, 0x9e, 0xfd, 0x55,
-	0x32, 0x58, 0xe9, 0xd6, 0x85, 0xdc, 0x51, 0x0a, 0x8e, 0xd9, 0xfd, 0x5b, 0x04, 0xe5, 0x02, 0x7d,
-	0x7a, 0x8d, 0xfe, 0xcc, 0x1e, 0x23, 0xf9, 0x02, 0xb0, 0x9a, 0x53, 0xf2, 0x5c, 0x88, 0x5d, 0x5b,
-	0x22, 0xda, 0x49, 0xea, 0x3b, 0xe7, 0x32, 0x80, 0xfd, 0xd5, 0x6d, 0x70, 0xbe, 0x58, 0x2e, 0x0b,
-	0xa2, 0x09, 0x71, 0xc2, 0x06, 0xc9, 0xc4, 0x6c, 0xe7, 0xc8, 0x6d, 0x12, 0x35, 0x5e, 0x41, 0xe4,
-	0x58, 0x88, 0x94, 0x57, 0xd3, 0x53, 0x80, 0x6f, 0xa0, 0x2a, 0x4c, 0x28, 0x79, 0x21, 0xc4, 0x6c,
-	0x5a, 0x04, 0x9a, 0xfe, 0x98, 0x0b, 0x97, 0xe1, 0x06, 0xaa, 0xc2, 0x50, 0x4a, 0xb8, 0x9b, 0x46,
-	0x5c, 0xc2, 0xdd, 0x3c, 0xd3, 0x36, 0xdb, 0xaa, 0xf2, 0xf0, 0x9e, 0xca, 0x85, 0xa6, 0x8c, 0xa4,
-	0xd6, 0xcc, 0x76, 0x8c, 0xa5, 0xf9, 0xca, 0x9b, 0x3c, 0x7a, 0x22, 0x8d, 0xf4, 0x9e, 0xe6, 0xf0,
-	0xda, 0xba, 0x47, 0x02, 0xb0, 0x0f, 0xe5, 0xa8, 0x75, 0xc9, 0x91, 0x4c, 0x24, 0xd9, 0xe4, 0xda,
-	0x71, 0xca, 0xeb, 0x12, 0xea, 0xbc, 0xf2, 0xbd, 0xc4, 0xff, 0xa2, 0x47, 0xdb, 0xec, 0xdf, 0xf9,
-	0xec, 0x5f, 0x00, 0x00, 0x00, 0xff, 0xff, 0x4f, 0x34, 0x04, 0x89, 0xb4, 0x07, 0x00, 0x00,
+func (m *ListSubjectsRequest) GetMatch() Filter {
+	if m != nil {
+		return m.Match
+	}
+	return Filter_ANY
+}
+
+func (m *ListSubjectsRequest) GetOutdated() Filter {
+	if m != nil {
+		return m.Outdated
+	}
+	return Filter_ANY
+}
+
+func (m *ListSubjectsRequest) GetUnresolvable() Filter {
+	if m != nil {
+		return m.Unresolvable
+	}
+	return Filter_ANY
+}
+
+func (m *ListSubjectsRequest) GetExpiresAfter() int64 {
+	if m != nil {
+		return m.ExpiresAfter
+	}
+	return 0
+}
+
+func (m *ListSubjectsRequest) GetExpiresBefore() int64 {
+	if m != nil {
+		return m.ExpiresBefore
+	}
+	return 0
+}
+
+func (m *ListSubjectsRequest) GetCreatedAfter() int64 {
+	if m != nil {
+		return m.CreatedAfter
+	}
+	return 0
+}
+
+func (m *ListSubjectsRequest) GetCreatedBefore() int64 {
+	if m != nil {
+		return m.CreatedBefore
+	}
+	return 0
+}
+
+func (m *ListSubjectsRequest) GetSortBy() SortField {
+	if m != nil {
+		return m.SortBy
+	}
+	return SortField_SUBJECT
+}
+
+func (m *ListSubjectsRequest) GetDescending() bool {
+	if m != nil {
+		return m.Descending
+	}
+	return false
+}
+
+func (m *ListSubjectsRequest) GetPageSize() int32 {
+	if m != nil {
+		return m.PageSize
+	}
+	return 0
+}
+
+func (m *ListSubjectsRequest) GetPageToken() string {
+	if m != nil {
+		return m.PageToken
+	}
+	return ""
+}
+
+func (m *ListSubjectsRequest) GetDeleted() bool {
+	if m != nil {
+		return m.Deleted
+	}
+	return false
+}
+
+type ListSubjectsResponse struct {
+	Subjects []*ListedSubject `protobuf:"bytes,1,rep,name=subjects,proto3" json:"subjects,omitempty"`
+	// empty on the last page
+	NextPageToken        string   `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListSubjectsResponse) Reset()         { *m = ListSubjectsResponse{} }
+func (m *ListSubjectsResponse) String() string { return proto.CompactTextString(m) }
+func (*ListSubjectsResponse) ProtoMessage()    {}
+func (*ListSubjectsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{20}
+}
+
+func (m *ListSubjectsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListSubjectsResponse.Unmarshal(m, b)
+}
+func (m *ListSubjectsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListSubjectsResponse.Marshal(b, m, deterministic)
+}
+func (m *ListSubjectsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListSubjectsResponse.Merge(m, src)
+}
+func (m *ListSubjectsResponse) XXX_Size() int {
+	return xxx_messageInfo_ListSubjectsResponse.Size(m)
+}
+func (m *ListSubjectsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListSubjectsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListSubjectsResponse proto.InternalMessageInfo
+
+func (m *ListSubjectsResponse) GetSubjects() []*ListedSubject {
+	if m != nil {
+		return m.Subjects
+	}
+	return nil
+}
+
+func (m *ListSubjectsResponse) GetNextPageToken() string {
+	if m != nil {
+		return m.NextPageToken
+	}
+	return ""
+}
+
+// Certificate history
+type CertificateRecord struct {
+	Version              int32    `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	CertId               int64    `protobuf:"varint,2,opt,name=cert_id,json=certId,proto3" json:"cert_id,omitempty"`
+	OrderId              string   `protobuf:"bytes,3,opt,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	Serial               string   `protobuf:"bytes,4,opt,name=serial,proto3" json:"serial,omitempty"`
+	NotBefore            int64    `protobuf:"varint,5,opt,name=not_before,json=notBefore,proto3" json:"not_before,omitempty"`
+	NotAfter             int64    `protobuf:"varint,6,opt,name=not_after,json=notAfter,proto3" json:"not_after,omitempty"`
+	IssuedAt             int64    `protobuf:"varint,7,opt,name=issued_at,json=issuedAt,proto3" json:"issued_at,omitempty"`
+	RevokedAt            int64    `protobuf:"varint,8,opt,name=revoked_at,json=revokedAt,proto3" json:"revoked_at,omitempty"`
+	RevocationReason     string   `protobuf:"bytes,9,opt,name=revocation_reason,json=revocationReason,proto3" json:"revocation_reason,omitempty"`
+	KeyFingerprint       string   `protobuf:"bytes,10,opt,name=key_fingerprint,json=keyFingerprint,proto3" json:"key_fingerprint,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *CertificateRecord) Reset()         { *m = CertificateRecord{} }
+func (m *CertificateRecord) String() string { return proto.CompactTextString(m) }
+func (*CertificateRecord) ProtoMessage()    {}
+func (*CertificateRecord) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{21}
+}
+
+func (m *CertificateRecord) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_CertificateRecord.Unmarshal(m, b)
+}
+func (m *CertificateRecord) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_CertificateRecord.Marshal(b, m, deterministic)
+}
+func (m *CertificateRecord) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_CertificateRecord.Merge(m, src)
+}
+func (m *CertificateRecord) XXX_Size() int {
+	return xxx_messageInfo_CertificateRecord.Size(m)
+}
+func (m *CertificateRecord) XXX_DiscardUnknown() {
+	xxx_messageInfo_CertificateRecord.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_CertificateRecord proto.InternalMessageInfo
+
+func (m *CertificateRecord) GetVersion() int32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *CertificateRecord) GetCertId() int64 {
+	if m != nil {
+		return m.CertId
+	}
+	return 0
+}
+
+func (m *CertificateRecord) GetOrderId() string {
+	if m != nil {
+		return m.OrderId
+	}
+	return ""
+}
+
+func (m *CertificateRecord) GetSerial() string {
+	if m != nil {
+		return m.Serial
+	}
+	return ""
+}
+
+func (m *CertificateRecord) GetNotBefore() int64 {
+	if m != nil {
+		return m.NotBefore
+	}
+	return 0
+}
+
+func (m *CertificateRecord) GetNotAfter() int64 {
+	if m != nil {
+		return m.NotAfter
+	}
+	return 0
+}
+
+func (m *CertificateRecord) GetIssuedAt() int64 {
+	if m != nil {
+		return m.IssuedAt
+	}
+	return 0
+}
+
+func (m *CertificateRecord) GetRevokedAt() int64 {
+	if m != nil {
+		return m.RevokedAt
+	}
+	return 0
+}
+
+func (m *CertificateRecord) GetRevocationReason() string {
+	if m != nil {
+		return m.RevocationReason
+	}
+	return ""
+}
+
+func (m *CertificateRecord) GetKeyFingerprint() string {
+	if m != nil {
+		return m.KeyFingerprint
+	}
+	return ""
+}
+
+type GetSubjectHistoryRequest struct {
+	Subject              string   `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetSubjectHistoryRequest) Reset()         { *m = GetSubjectHistoryRequest{} }
+func (m *GetSubjectHistoryRequest) String() string { return proto.CompactTextString(m) }
+func (*GetSubjectHistoryRequest) ProtoMessage()    {}
+func (*GetSubjectHistoryRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{22}
+}
+
+func (m *GetSubjectHistoryRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetSubjectHistoryRequest.Unmarshal(m, b)
+}
+func (m *GetSubjectHistoryRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetSubjectHistoryRequest.Marshal(b, m, deterministic)
+}
+func (m *GetSubjectHistoryRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetSubjectHistoryRequest.Merge(m, src)
+}
+func (m *GetSubjectHistoryRequest) XXX_Size() int {
+	return xxx_messageInfo_GetSubjectHistoryRequest.Size(m)
+}
+func (m *GetSubjectHistoryRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetSubjectHistoryRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetSubjectHistoryRequest proto.InternalMessageInfo
+
+func (m *GetSubjectHistoryRequest) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+type GetSubjectHistoryResponse struct {
+	Record               *CertificateRecord `protobuf:"bytes,1,opt,name=record,proto3" json:"record,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *GetSubjectHistoryResponse) Reset()         { *m = GetSubjectHistoryResponse{} }
+func (m *GetSubjectHistoryResponse) String() string { return proto.CompactTextString(m) }
+func (*GetSubjectHistoryResponse) ProtoMessage()    {}
+func (*GetSubjectHistoryResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{23}
+}
+
+func (m *GetSubjectHistoryResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetSubjectHistoryResponse.Unmarshal(m, b)
+}
+func (m *GetSubjectHistoryResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetSubjectHistoryResponse.Marshal(b, m, deterministic)
+}
+func (m *GetSubjectHistoryResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetSubjectHistoryResponse.Merge(m, src)
+}
+func (m *GetSubjectHistoryResponse) XXX_Size() int {
+	return xxx_messageInfo_GetSubjectHistoryResponse.Size(m)
+}
+func (m *GetSubjectHistoryResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetSubjectHistoryResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetSubjectHistoryResponse proto.InternalMessageInfo
+
+func (m *GetSubjectHistoryResponse) GetRecord() *CertificateRecord {
+	if m != nil {
+		return m.Record
+	}
+	return nil
+}
+
+// Audit log
+type AuditEntry struct {
+	Timestamp            int64    `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Actor                string   `protobuf:"bytes,2,opt,name=actor,proto3" json:"actor,omitempty"`
+	SourceIp             string   `protobuf:"bytes,3,opt,name=source_ip,json=sourceIp,proto3" json:"source_ip,omitempty"`
+	Action               string   `protobuf:"bytes,4,opt,name=action,proto3" json:"action,omitempty"`
+	Subject              string   `protobuf:"bytes,5,opt,name=subject,proto3" json:"subject,omitempty"`
+	Outcome              string   `protobuf:"bytes,6,opt,name=outcome,proto3" json:"outcome,omitempty"`
+	Reason               string   `protobuf:"bytes,7,opt,name=reason,proto3" json:"reason,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *AuditEntry) Reset()         { *m = AuditEntry{} }
+func (m *AuditEntry) String() string { return proto.CompactTextString(m) }
+func (*AuditEntry) ProtoMessage()    {}
+func (*AuditEntry) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{24}
+}
+
+func (m *AuditEntry) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_AuditEntry.Unmarshal(m, b)
+}
+func (m *AuditEntry) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_AuditEntry.Marshal(b, m, deterministic)
+}
+func (m *AuditEntry) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_AuditEntry.Merge(m, src)
+}
+func (m *AuditEntry) XXX_Size() int {
+	return xxx_messageInfo_AuditEntry.Size(m)
+}
+func (m *AuditEntry) XXX_DiscardUnknown() {
+	xxx_messageInfo_AuditEntry.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_AuditEntry proto.InternalMessageInfo
+
+func (m *AuditEntry) GetTimestamp() int64 {
+	if m != nil {
+		return m.Timestamp
+	}
+	return 0
+}
+
+func (m *AuditEntry) GetActor() string {
+	if m != nil {
+		return m.Actor
+	}
+	return ""
+}
+
+func (m *AuditEntry) GetSourceIp() string {
+	if m != nil {
+		return m.SourceIp
+	}
+	return ""
+}
+
+func (m *AuditEntry) GetAction() string {
+	if m != nil {
+		return m.Action
+	}
+	return ""
+}
+
+func (m *AuditEntry) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+func (m *AuditEntry) GetOutcome() string {
+	if m != nil {
+		return m.Outcome
+	}
+	return ""
+}
+
+func (m *AuditEntry) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+type GetAuditLogRequest struct {
+	From                 int64    `protobuf:"varint,1,opt,name=from,proto3" json:"from,omitempty"`
+	To                   int64    `protobuf:"varint,2,opt,name=to,proto3" json:"to,omitempty"`
+	Actor                string   `protobuf:"bytes,3,opt,name=actor,proto3" json:"actor,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetAuditLogRequest) Reset()         { *m = GetAuditLogRequest{} }
+func (m *GetAuditLogRequest) String() string { return proto.CompactTextString(m) }
+func (*GetAuditLogRequest) ProtoMessage()    {}
+func (*GetAuditLogRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{25}
+}
+
+func (m *GetAuditLogRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetAuditLogRequest.Unmarshal(m, b)
+}
+func (m *GetAuditLogRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetAuditLogRequest.Marshal(b, m, deterministic)
+}
+func (m *GetAuditLogRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetAuditLogRequest.Merge(m, src)
+}
+func (m *GetAuditLogRequest) XXX_Size() int {
+	return xxx_messageInfo_GetAuditLogRequest.Size(m)
+}
+func (m *GetAuditLogRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetAuditLogRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetAuditLogRequest proto.InternalMessageInfo
+
+func (m *GetAuditLogRequest) GetFrom() int64 {
+	if m != nil {
+		return m.From
+	}
+	return 0
+}
+
+func (m *GetAuditLogRequest) GetTo() int64 {
+	if m != nil {
+		return m.To
+	}
+	return 0
+}
+
+func (m *GetAuditLogRequest) GetActor() string {
+	if m != nil {
+		return m.Actor
+	}
+	return ""
+}
+
+type GetAuditLogResponse struct {
+	Entry                *AuditEntry `protobuf:"bytes,1,opt,name=entry,proto3" json:"entry,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *GetAuditLogResponse) Reset()         { *m = GetAuditLogResponse{} }
+func (m *GetAuditLogResponse) String() string { return proto.CompactTextString(m) }
+func (*GetAuditLogResponse) ProtoMessage()    {}
+func (*GetAuditLogResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{26}
+}
+
+func (m *GetAuditLogResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetAuditLogResponse.Unmarshal(m, b)
+}
+func (m *GetAuditLogResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetAuditLogResponse.Marshal(b, m, deterministic)
+}
+func (m *GetAuditLogResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetAuditLogResponse.Merge(m, src)
+}
+func (m *GetAuditLogResponse) XXX_Size() int {
+	return xxx_messageInfo_GetAuditLogResponse.Size(m)
+}
+func (m *GetAuditLogResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetAuditLogResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetAuditLogResponse proto.InternalMessageInfo
+
+func (m *GetAuditLogResponse) GetEntry() *AuditEntry {
+	if m != nil {
+		return m.Entry
+	}
+	return nil
+}
+
+// Schema migrations
+type MigrationReport struct {
+	Version              int32    `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	Description          string   `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	Subjects             []string `protobuf:"bytes,3,rep,name=subjects,proto3" json:"subjects,omitempty"`
+	Applied              bool     `protobuf:"varint,4,opt,name=applied,proto3" json:"applied,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MigrationReport) Reset()         { *m = MigrationReport{} }
+func (m *MigrationReport) String() string { return proto.CompactTextString(m) }
+func (*MigrationReport) ProtoMessage()    {}
+func (*MigrationReport) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{27}
+}
+
+func (m *MigrationReport) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MigrationReport.Unmarshal(m, b)
+}
+func (m *MigrationReport) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MigrationReport.Marshal(b, m, deterministic)
+}
+func (m *MigrationReport) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MigrationReport.Merge(m, src)
+}
+func (m *MigrationReport) XXX_Size() int {
+	return xxx_messageInfo_MigrationReport.Size(m)
+}
+func (m *MigrationReport) XXX_DiscardUnknown() {
+	xxx_messageInfo_MigrationReport.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MigrationReport proto.InternalMessageInfo
+
+func (m *MigrationReport) GetVersion() int32 {
+	if m != nil {
+		return m.Version
+	}
+	return 0
+}
+
+func (m *MigrationReport) GetDescription() string {
+	if m != nil {
+		return m.Description
+	}
+	return ""
+}
+
+func (m *MigrationReport) GetSubjects() []string {
+	if m != nil {
+		return m.Subjects
+	}
+	return nil
+}
+
+func (m *MigrationReport) GetApplied() bool {
+	if m != nil {
+		return m.Applied
+	}
+	return false
+}
+
+type MigrateSchemaRequest struct {
+	DryRun               bool     `protobuf:"varint,1,opt,name=dry_run,json=dryRun,proto3" json:"dry_run,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *MigrateSchemaRequest) Reset()         { *m = MigrateSchemaRequest{} }
+func (m *MigrateSchemaRequest) String() string { return proto.CompactTextString(m) }
+func (*MigrateSchemaRequest) ProtoMessage()    {}
+func (*MigrateSchemaRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{28}
+}
+
+func (m *MigrateSchemaRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MigrateSchemaRequest.Unmarshal(m, b)
+}
+func (m *MigrateSchemaRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MigrateSchemaRequest.Marshal(b, m, deterministic)
+}
+func (m *MigrateSchemaRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MigrateSchemaRequest.Merge(m, src)
+}
+func (m *MigrateSchemaRequest) XXX_Size() int {
+	return xxx_messageInfo_MigrateSchemaRequest.Size(m)
+}
+func (m *MigrateSchemaRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_MigrateSchemaRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MigrateSchemaRequest proto.InternalMessageInfo
+
+func (m *MigrateSchemaRequest) GetDryRun() bool {
+	if m != nil {
+		return m.DryRun
+	}
+	return false
+}
+
+type MigrateSchemaResponse struct {
+	Report               *MigrationReport `protobuf:"bytes,1,opt,name=report,proto3" json:"report,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}         `json:"-"`
+	XXX_unrecognized     []byte           `json:"-"`
+	XXX_sizecache        int32            `json:"-"`
+}
+
+func (m *MigrateSchemaResponse) Reset()         { *m = MigrateSchemaResponse{} }
+func (m *MigrateSchemaResponse) String() string { return proto.CompactTextString(m) }
+func (*MigrateSchemaResponse) ProtoMessage()    {}
+func (*MigrateSchemaResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{29}
+}
+
+func (m *MigrateSchemaResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_MigrateSchemaResponse.Unmarshal(m, b)
+}
+func (m *MigrateSchemaResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_MigrateSchemaResponse.Marshal(b, m, deterministic)
+}
+func (m *MigrateSchemaResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_MigrateSchemaResponse.Merge(m, src)
+}
+func (m *MigrateSchemaResponse) XXX_Size() int {
+	return xxx_messageInfo_MigrateSchemaResponse.Size(m)
+}
+func (m *MigrateSchemaResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_MigrateSchemaResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_MigrateSchemaResponse proto.InternalMessageInfo
+
+func (m *MigrateSchemaResponse) GetReport() *MigrationReport {
+	if m != nil {
+		return m.Report
+	}
+	return nil
+}
+
+// Export and import. Items are JSON encoded, their layout follows bundle version.
+type ExportSubjectsRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExportSubjectsRequest) Reset()         { *m = ExportSubjectsRequest{} }
+func (m *ExportSubjectsRequest) String() string { return proto.CompactTextString(m) }
+func (*ExportSubjectsRequest) ProtoMessage()    {}
+func (*ExportSubjectsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{30}
+}
+
+func (m *ExportSubjectsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportSubjectsRequest.Unmarshal(m, b)
+}
+func (m *ExportSubjectsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportSubjectsRequest.Marshal(b, m, deterministic)
+}
+func (m *ExportSubjectsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportSubjectsRequest.Merge(m, src)
+}
+func (m *ExportSubjectsRequest) XXX_Size() int {
+	return xxx_messageInfo_ExportSubjectsRequest.Size(m)
+}
+func (m *ExportSubjectsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportSubjectsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportSubjectsRequest proto.InternalMessageInfo
+
+type ExportSubjectsResponse struct {
+	Item                 []byte   `protobuf:"bytes,1,opt,name=item,proto3" json:"item,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExportSubjectsResponse) Reset()         { *m = ExportSubjectsResponse{} }
+func (m *ExportSubjectsResponse) String() string { return proto.CompactTextString(m) }
+func (*ExportSubjectsResponse) ProtoMessage()    {}
+func (*ExportSubjectsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{31}
+}
+
+func (m *ExportSubjectsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportSubjectsResponse.Unmarshal(m, b)
+}
+func (m *ExportSubjectsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportSubjectsResponse.Marshal(b, m, deterministic)
+}
+func (m *ExportSubjectsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportSubjectsResponse.Merge(m, src)
+}
+func (m *ExportSubjectsResponse) XXX_Size() int {
+	return xxx_messageInfo_ExportSubjectsResponse.Size(m)
+}
+func (m *ExportSubjectsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportSubjectsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportSubjectsResponse proto.InternalMessageInfo
+
+func (m *ExportSubjectsResponse) GetItem() []byte {
+	if m != nil {
+		return m.Item
+	}
+	return nil
+}
+
+type ImportSubjectsRequest struct {
+	// only read from the first message
+	Replace              bool     `protobuf:"varint,1,opt,name=replace,proto3" json:"replace,omitempty"`
+	Item                 []byte   `protobuf:"bytes,2,opt,name=item,proto3" json:"item,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ImportSubjectsRequest) Reset()         { *m = ImportSubjectsRequest{} }
+func (m *ImportSubjectsRequest) String() string { return proto.CompactTextString(m) }
+func (*ImportSubjectsRequest) ProtoMessage()    {}
+func (*ImportSubjectsRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{32}
+}
+
+func (m *ImportSubjectsRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ImportSubjectsRequest.Unmarshal(m, b)
+}
+func (m *ImportSubjectsRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ImportSubjectsRequest.Marshal(b, m, deterministic)
+}
+func (m *ImportSubjectsRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ImportSubjectsRequest.Merge(m, src)
+}
+func (m *ImportSubjectsRequest) XXX_Size() int {
+	return xxx_messageInfo_ImportSubjectsRequest.Size(m)
+}
+func (m *ImportSubjectsRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ImportSubjectsRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ImportSubjectsRequest proto.InternalMessageInfo
+
+func (m *ImportSubjectsRequest) GetReplace() bool {
+	if m != nil {
+		return m.Replace
+	}
+	return false
+}
+
+func (m *ImportSubjectsRequest) GetItem() []byte {
+	if m != nil {
+		return m.Item
+	}
+	return nil
+}
+
+type ImportConflict struct {
+	Subject              string   `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	CertId               int64    `protobuf:"varint,2,opt,name=cert_id,json=certId,proto3" json:"cert_id,omitempty"`
+	Fields               []string `protobuf:"bytes,3,rep,name=fields,proto3" json:"fields,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ImportConflict) Reset()         { *m = ImportConflict{} }
+func (m *ImportConflict) String() string { return proto.CompactTextString(m) }
+func (*ImportConflict) ProtoMessage()    {}
+func (*ImportConflict) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{33}
+}
+
+func (m *ImportConflict) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ImportConflict.Unmarshal(m, b)
+}
+func (m *ImportConflict) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ImportConflict.Marshal(b, m, deterministic)
+}
+func (m *ImportConflict) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ImportConflict.Merge(m, src)
+}
+func (m *ImportConflict) XXX_Size() int {
+	return xxx_messageInfo_ImportConflict.Size(m)
+}
+func (m *ImportConflict) XXX_DiscardUnknown() {
+	xxx_messageInfo_ImportConflict.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ImportConflict proto.InternalMessageInfo
+
+func (m *ImportConflict) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+func (m *ImportConflict) GetCertId() int64 {
+	if m != nil {
+		return m.CertId
+	}
+	return 0
+}
+
+func (m *ImportConflict) GetFields() []string {
+	if m != nil {
+		return m.Fields
+	}
+	return nil
+}
+
+type ImportSubjectsResponse struct {
+	Imported             int32             `protobuf:"varint,1,opt,name=imported,proto3" json:"imported,omitempty"`
+	Replaced             int32             `protobuf:"varint,2,opt,name=replaced,proto3" json:"replaced,omitempty"`
+	Skipped              int32             `protobuf:"varint,3,opt,name=skipped,proto3" json:"skipped,omitempty"`
+	Records              int32             `protobuf:"varint,4,opt,name=records,proto3" json:"records,omitempty"`
+	Conflicts            []*ImportConflict `protobuf:"bytes,5,rep,name=conflicts,proto3" json:"conflicts,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
+}
+
+func (m *ImportSubjectsResponse) Reset()         { *m = ImportSubjectsResponse{} }
+func (m *ImportSubjectsResponse) String() string { return proto.CompactTextString(m) }
+func (*ImportSubjectsResponse) ProtoMessage()    {}
+func (*ImportSubjectsResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{34}
+}
+
+func (m *ImportSubjectsResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ImportSubjectsResponse.Unmarshal(m, b)
+}
+func (m *ImportSubjectsResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ImportSubjectsResponse.Marshal(b, m, deterministic)
+}
+func (m *ImportSubjectsResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ImportSubjectsResponse.Merge(m, src)
+}
+func (m *ImportSubjectsResponse) XXX_Size() int {
+	return xxx_messageInfo_ImportSubjectsResponse.Size(m)
+}
+func (m *ImportSubjectsResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ImportSubjectsResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ImportSubjectsResponse proto.InternalMessageInfo
+
+func (m *ImportSubjectsResponse) GetImported() int32 {
+	if m != nil {
+		return m.Imported
+	}
+	return 0
+}
+
+func (m *ImportSubjectsResponse) GetReplaced() int32 {
+	if m != nil {
+		return m.Replaced
+	}
+	return 0
+}
+
+func (m *ImportSubjectsResponse) GetSkipped() int32 {
+	if m != nil {
+		return m.Skipped
+	}
+	return 0
+}
+
+func (m *ImportSubjectsResponse) GetRecords() int32 {
+	if m != nil {
+		return m.Records
+	}
+	return 0
+}
+
+func (m *ImportSubjectsResponse) GetConflicts() []*ImportConflict {
+	if m != nil {
+		return m.Conflicts
+	}
+	return nil
+}
+
+// Dead letters. An empty queue means every queue with a retry policy, zero limit means no limit.
+type DeadLetter struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Type                 string   `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	Attempts             int32    `protobuf:"varint,3,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Error                string   `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	FailedAt             int64    `protobuf:"varint,5,opt,name=failed_at,json=failedAt,proto3" json:"failed_at,omitempty"`
+	Body                 []byte   `protobuf:"bytes,6,opt,name=body,proto3" json:"body,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *DeadLetter) Reset()         { *m = DeadLetter{} }
+func (m *DeadLetter) String() string { return proto.CompactTextString(m) }
+func (*DeadLetter) ProtoMessage()    {}
+func (*DeadLetter) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{35}
+}
+
+func (m *DeadLetter) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_DeadLetter.Unmarshal(m, b)
+}
+func (m *DeadLetter) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_DeadLetter.Marshal(b, m, deterministic)
+}
+func (m *DeadLetter) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_DeadLetter.Merge(m, src)
+}
+func (m *DeadLetter) XXX_Size() int {
+	return xxx_messageInfo_DeadLetter.Size(m)
+}
+func (m *DeadLetter) XXX_DiscardUnknown() {
+	xxx_messageInfo_DeadLetter.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_DeadLetter proto.InternalMessageInfo
+
+func (m *DeadLetter) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetType() string {
+	if m != nil {
+		return m.Type
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetAttempts() int32 {
+	if m != nil {
+		return m.Attempts
+	}
+	return 0
+}
+
+func (m *DeadLetter) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *DeadLetter) GetFailedAt() int64 {
+	if m != nil {
+		return m.FailedAt
+	}
+	return 0
+}
+
+func (m *DeadLetter) GetBody() []byte {
+	if m != nil {
+		return m.Body
+	}
+	return nil
+}
+
+type ListDeadLettersRequest struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Limit                int32    `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ListDeadLettersRequest) Reset()         { *m = ListDeadLettersRequest{} }
+func (m *ListDeadLettersRequest) String() string { return proto.CompactTextString(m) }
+func (*ListDeadLettersRequest) ProtoMessage()    {}
+func (*ListDeadLettersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{36}
+}
+
+func (m *ListDeadLettersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListDeadLettersRequest.Unmarshal(m, b)
+}
+func (m *ListDeadLettersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListDeadLettersRequest.Marshal(b, m, deterministic)
+}
+func (m *ListDeadLettersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListDeadLettersRequest.Merge(m, src)
+}
+func (m *ListDeadLettersRequest) XXX_Size() int {
+	return xxx_messageInfo_ListDeadLettersRequest.Size(m)
+}
+func (m *ListDeadLettersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListDeadLettersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListDeadLettersRequest proto.InternalMessageInfo
+
+func (m *ListDeadLettersRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *ListDeadLettersRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+type ListDeadLettersResponse struct {
+	Letter               *DeadLetter `protobuf:"bytes,1,opt,name=letter,proto3" json:"letter,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *ListDeadLettersResponse) Reset()         { *m = ListDeadLettersResponse{} }
+func (m *ListDeadLettersResponse) String() string { return proto.CompactTextString(m) }
+func (*ListDeadLettersResponse) ProtoMessage()    {}
+func (*ListDeadLettersResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{37}
+}
+
+func (m *ListDeadLettersResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ListDeadLettersResponse.Unmarshal(m, b)
+}
+func (m *ListDeadLettersResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ListDeadLettersResponse.Marshal(b, m, deterministic)
+}
+func (m *ListDeadLettersResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ListDeadLettersResponse.Merge(m, src)
+}
+func (m *ListDeadLettersResponse) XXX_Size() int {
+	return xxx_messageInfo_ListDeadLettersResponse.Size(m)
+}
+func (m *ListDeadLettersResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ListDeadLettersResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ListDeadLettersResponse proto.InternalMessageInfo
+
+func (m *ListDeadLettersResponse) GetLetter() *DeadLetter {
+	if m != nil {
+		return m.Letter
+	}
+	return nil
+}
+
+type ReplayDeadLettersRequest struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	Limit                int32    `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReplayDeadLettersRequest) Reset()         { *m = ReplayDeadLettersRequest{} }
+func (m *ReplayDeadLettersRequest) String() string { return proto.CompactTextString(m) }
+func (*ReplayDeadLettersRequest) ProtoMessage()    {}
+func (*ReplayDeadLettersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{38}
+}
+
+func (m *ReplayDeadLettersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReplayDeadLettersRequest.Unmarshal(m, b)
+}
+func (m *ReplayDeadLettersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReplayDeadLettersRequest.Marshal(b, m, deterministic)
+}
+func (m *ReplayDeadLettersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReplayDeadLettersRequest.Merge(m, src)
+}
+func (m *ReplayDeadLettersRequest) XXX_Size() int {
+	return xxx_messageInfo_ReplayDeadLettersRequest.Size(m)
+}
+func (m *ReplayDeadLettersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReplayDeadLettersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReplayDeadLettersRequest proto.InternalMessageInfo
+
+func (m *ReplayDeadLettersRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+func (m *ReplayDeadLettersRequest) GetLimit() int32 {
+	if m != nil {
+		return m.Limit
+	}
+	return 0
+}
+
+type ReplayDeadLettersResponse struct {
+	Count                int32    `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ReplayDeadLettersResponse) Reset()         { *m = ReplayDeadLettersResponse{} }
+func (m *ReplayDeadLettersResponse) String() string { return proto.CompactTextString(m) }
+func (*ReplayDeadLettersResponse) ProtoMessage()    {}
+func (*ReplayDeadLettersResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{39}
+}
+
+func (m *ReplayDeadLettersResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ReplayDeadLettersResponse.Unmarshal(m, b)
+}
+func (m *ReplayDeadLettersResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ReplayDeadLettersResponse.Marshal(b, m, deterministic)
+}
+func (m *ReplayDeadLettersResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ReplayDeadLettersResponse.Merge(m, src)
+}
+func (m *ReplayDeadLettersResponse) XXX_Size() int {
+	return xxx_messageInfo_ReplayDeadLettersResponse.Size(m)
+}
+func (m *ReplayDeadLettersResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ReplayDeadLettersResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ReplayDeadLettersResponse proto.InternalMessageInfo
+
+func (m *ReplayDeadLettersResponse) GetCount() int32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+type PurgeDeadLettersRequest struct {
+	Queue                string   `protobuf:"bytes,1,opt,name=queue,proto3" json:"queue,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PurgeDeadLettersRequest) Reset()         { *m = PurgeDeadLettersRequest{} }
+func (m *PurgeDeadLettersRequest) String() string { return proto.CompactTextString(m) }
+func (*PurgeDeadLettersRequest) ProtoMessage()    {}
+func (*PurgeDeadLettersRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{40}
+}
+
+func (m *PurgeDeadLettersRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PurgeDeadLettersRequest.Unmarshal(m, b)
+}
+func (m *PurgeDeadLettersRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PurgeDeadLettersRequest.Marshal(b, m, deterministic)
+}
+func (m *PurgeDeadLettersRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PurgeDeadLettersRequest.Merge(m, src)
+}
+func (m *PurgeDeadLettersRequest) XXX_Size() int {
+	return xxx_messageInfo_PurgeDeadLettersRequest.Size(m)
+}
+func (m *PurgeDeadLettersRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_PurgeDeadLettersRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PurgeDeadLettersRequest proto.InternalMessageInfo
+
+func (m *PurgeDeadLettersRequest) GetQueue() string {
+	if m != nil {
+		return m.Queue
+	}
+	return ""
+}
+
+type PurgeDeadLettersResponse struct {
+	Count                int32    `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *PurgeDeadLettersResponse) Reset()         { *m = PurgeDeadLettersResponse{} }
+func (m *PurgeDeadLettersResponse) String() string { return proto.CompactTextString(m) }
+func (*PurgeDeadLettersResponse) ProtoMessage()    {}
+func (*PurgeDeadLettersResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{41}
+}
+
+func (m *PurgeDeadLettersResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_PurgeDeadLettersResponse.Unmarshal(m, b)
+}
+func (m *PurgeDeadLettersResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_PurgeDeadLettersResponse.Marshal(b, m, deterministic)
+}
+func (m *PurgeDeadLettersResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_PurgeDeadLettersResponse.Merge(m, src)
+}
+func (m *PurgeDeadLettersResponse) XXX_Size() int {
+	return xxx_messageInfo_PurgeDeadLettersResponse.Size(m)
+}
+func (m *PurgeDeadLettersResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_PurgeDeadLettersResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_PurgeDeadLettersResponse proto.InternalMessageInfo
+
+func (m *PurgeDeadLettersResponse) GetCount() int32 {
+	if m != nil {
+		return m.Count
+	}
+	return 0
+}
+
+// Settles an enroll request dead-lettered in doubt, once its order is checked with a CA
+type ResolveEnrollmentRequest struct {
+	Subject string `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	// certificate ordered by the request, none if it wasn't ordered
+	CertId               int32    `protobuf:"varint,2,opt,name=cert_id,json=certId,proto3" json:"cert_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResolveEnrollmentRequest) Reset()         { *m = ResolveEnrollmentRequest{} }
+func (m *ResolveEnrollmentRequest) String() string { return proto.CompactTextString(m) }
+func (*ResolveEnrollmentRequest) ProtoMessage()    {}
+func (*ResolveEnrollmentRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{42}
+}
+
+func (m *ResolveEnrollmentRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResolveEnrollmentRequest.Unmarshal(m, b)
+}
+func (m *ResolveEnrollmentRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResolveEnrollmentRequest.Marshal(b, m, deterministic)
+}
+func (m *ResolveEnrollmentRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResolveEnrollmentRequest.Merge(m, src)
+}
+func (m *ResolveEnrollmentRequest) XXX_Size() int {
+	return xxx_messageInfo_ResolveEnrollmentRequest.Size(m)
+}
+func (m *ResolveEnrollmentRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResolveEnrollmentRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResolveEnrollmentRequest proto.InternalMessageInfo
+
+func (m *ResolveEnrollmentRequest) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+func (m *ResolveEnrollmentRequest) GetCertId() int32 {
+	if m != nil {
+		return m.CertId
+	}
+	return 0
+}
+
+type ResolveEnrollmentResponse struct {
+	Subject              string   `protobuf:"bytes,1,opt,name=subject,proto3" json:"subject,omitempty"`
+	State                string   `protobuf:"bytes,2,opt,name=state,proto3" json:"state,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ResolveEnrollmentResponse) Reset()         { *m = ResolveEnrollmentResponse{} }
+func (m *ResolveEnrollmentResponse) String() string { return proto.CompactTextString(m) }
+func (*ResolveEnrollmentResponse) ProtoMessage()    {}
+func (*ResolveEnrollmentResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{43}
+}
+
+func (m *ResolveEnrollmentResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ResolveEnrollmentResponse.Unmarshal(m, b)
+}
+func (m *ResolveEnrollmentResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ResolveEnrollmentResponse.Marshal(b, m, deterministic)
+}
+func (m *ResolveEnrollmentResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ResolveEnrollmentResponse.Merge(m, src)
+}
+func (m *ResolveEnrollmentResponse) XXX_Size() int {
+	return xxx_messageInfo_ResolveEnrollmentResponse.Size(m)
+}
+func (m *ResolveEnrollmentResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_ResolveEnrollmentResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ResolveEnrollmentResponse proto.InternalMessageInfo
+
+func (m *ResolveEnrollmentResponse) GetSubject() string {
+	if m != nil {
+		return m.Subject
+	}
+	return ""
+}
+
+func (m *ResolveEnrollmentResponse) GetState() string {
+	if m != nil {
+		return m.State
+	}
+	return ""
+}
+
+// New Token
+type JWTToken struct {
+	Token                string   `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *JWTToken) Reset()         { *m = JWTToken{} }
+func (m *JWTToken) String() string { return proto.CompactTextString(m) }
+func (*JWTToken) ProtoMessage()    {}
+func (*JWTToken) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{44}
+}
+
+func (m *JWTToken) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_JWTToken.Unmarshal(m, b)
+}
+func (m *JWTToken) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_JWTToken.Marshal(b, m, deterministic)
+}
+func (m *JWTToken) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_JWTToken.Merge(m, src)
+}
+func (m *JWTToken) XXX_Size() int {
+	return xxx_messageInfo_JWTToken.Size(m)
+}
+func (m *JWTToken) XXX_DiscardUnknown() {
+	xxx_messageInfo_JWTToken.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_JWTToken proto.InternalMessageInfo
+
+func (m *JWTToken) GetToken() string {
+	if m != nil {
+		return m.Token
+	}
+	return ""
+}
+
+type GetTokenRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *GetTokenRequest) Reset()         { *m = GetTokenRequest{} }
+func (m *GetTokenRequest) String() string { return proto.CompactTextString(m) }
+func (*GetTokenRequest) ProtoMessage()    {}
+func (*GetTokenRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{45}
+}
+
+func (m *GetTokenRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTokenRequest.Unmarshal(m, b)
+}
+func (m *GetTokenRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTokenRequest.Marshal(b, m, deterministic)
+}
+func (m *GetTokenRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTokenRequest.Merge(m, src)
+}
+func (m *GetTokenRequest) XXX_Size() int {
+	return xxx_messageInfo_GetTokenRequest.Size(m)
+}
+func (m *GetTokenRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTokenRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTokenRequest proto.InternalMessageInfo
+
+type GetTokenResponse struct {
+	Token                *JWTToken `protobuf:"bytes,1,opt,name=token,proto3" json:"token,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}  `json:"-"`
+	XXX_unrecognized     []byte    `json:"-"`
+	XXX_sizecache        int32     `json:"-"`
+}
+
+func (m *GetTokenResponse) Reset()         { *m = GetTokenResponse{} }
+func (m *GetTokenResponse) String() string { return proto.CompactTextString(m) }
+func (*GetTokenResponse) ProtoMessage()    {}
+func (*GetTokenResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{46}
+}
+
+func (m *GetTokenResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_GetTokenResponse.Unmarshal(m, b)
+}
+func (m *GetTokenResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_GetTokenResponse.Marshal(b, m, deterministic)
+}
+func (m *GetTokenResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_GetTokenResponse.Merge(m, src)
+}
+func (m *GetTokenResponse) XXX_Size() int {
+	return xxx_messageInfo_GetTokenResponse.Size(m)
+}
+func (m *GetTokenResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_GetTokenResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_GetTokenResponse proto.InternalMessageInfo
+
+func (m *GetTokenResponse) GetToken() *JWTToken {
+	if m != nil {
+		return m.Token
+	}
+	return nil
+}
+
+// Key rotation
+type RewrapKeysRequest struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RewrapKeysRequest) Reset()         { *m = RewrapKeysRequest{} }
+func (m *RewrapKeysRequest) String() string { return proto.CompactTextString(m) }
+func (*RewrapKeysRequest) ProtoMessage()    {}
+func (*RewrapKeysRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{47}
+}
+
+func (m *RewrapKeysRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RewrapKeysRequest.Unmarshal(m, b)
+}
+func (m *RewrapKeysRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RewrapKeysRequest.Marshal(b, m, deterministic)
+}
+func (m *RewrapKeysRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RewrapKeysRequest.Merge(m, src)
+}
+func (m *RewrapKeysRequest) XXX_Size() int {
+	return xxx_messageInfo_RewrapKeysRequest.Size(m)
+}
+func (m *RewrapKeysRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RewrapKeysRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RewrapKeysRequest proto.InternalMessageInfo
+
+type RewrapKeysResponse struct {
+	Status               string   `protobuf:"bytes,1,opt,name=status,proto3" json:"status,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RewrapKeysResponse) Reset()         { *m = RewrapKeysResponse{} }
+func (m *RewrapKeysResponse) String() string { return proto.CompactTextString(m) }
+func (*RewrapKeysResponse) ProtoMessage()    {}
+func (*RewrapKeysResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_f3d42104e625ed99, []int{48}
+}
+
+func (m *RewrapKeysResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RewrapKeysResponse.Unmarshal(m, b)
+}
+func (m *RewrapKeysResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RewrapKeysResponse.Marshal(b, m, deterministic)
+}
+func (m *RewrapKeysResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RewrapKeysResponse.Merge(m, src)
+}
+func (m *RewrapKeysResponse) XXX_Size() int {
+	return xxx_messageInfo_RewrapKeysResponse.Size(m)
+}
+func (m *RewrapKeysResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RewrapKeysResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RewrapKeysResponse proto.InternalMessageInfo
+
+func (m *RewrapKeysResponse) GetStatus() string {
+	if m != nil {
+		return m.Status
+	}
+	return ""
+}
+
+func init() {
+	proto.RegisterEnum("londoapi.v1.Filter", Filter_name, Filter_value)
+	proto.RegisterEnum("londoapi.v1.SortField", SortField_name, SortField_value)
+	proto.RegisterType((*Subject)(nil), "londoapi.v1.Subject")
+	proto.RegisterType((*GetSubjectRequest)(nil), "londoapi.v1.GetSubjectRequest")
+	proto.RegisterType((*TargetRequest)(nil), "londoapi.v1.TargetRequest")
+	proto.RegisterType((*ForTargetRequest)(nil), "londoapi.v1.ForTargetRequest")
+	proto.RegisterType((*GetSubjectResponse)(nil), "londoapi.v1.GetSubjectResponse")
+	proto.RegisterType((*NewSubject)(nil), "londoapi.v1.NewSubject")
+	proto.RegisterType((*AddNewSubjectRequest)(nil), "londoapi.v1.AddNewSubjectRequest")
+	proto.RegisterType((*AddNewSubjectResponse)(nil), "londoapi.v1.AddNewSubjectResponse")
+	proto.RegisterType((*DeleteSubjectRequest)(nil), "londoapi.v1.DeleteSubjectRequest")
+	proto.RegisterType((*DeleteSubjectResponse)(nil), "londoapi.v1.DeleteSubjectResponse")
+	proto.RegisterType((*RestoreSubjectRequest)(nil), "londoapi.v1.RestoreSubjectRequest")
+	proto.RegisterType((*RestoreSubjectResponse)(nil), "londoapi.v1.RestoreSubjectResponse")
+	proto.RegisterType((*ExpiringSubject)(nil), "londoapi.v1.ExpiringSubject")
+	proto.RegisterType((*GetExpiringSubjectsRequest)(nil), "londoapi.v1.GetExpiringSubjectsRequest")
+	proto.RegisterType((*GetExpiringSubjectsResponse)(nil), "londoapi.v1.GetExpiringSubjectsResponse")
+	proto.RegisterType((*RenewSubject)(nil), "londoapi.v1.RenewSubject")
+	proto.RegisterType((*RenewSubjectRequest)(nil), "londoapi.v1.RenewSubjectRequest")
+	proto.RegisterType((*RenewResponse)(nil), "londoapi.v1.RenewResponse")
+	proto.RegisterType((*ListedSubject)(nil), "londoapi.v1.ListedSubject")
+	proto.RegisterType((*ListSubjectsRequest)(nil), "londoapi.v1.ListSubjectsRequest")
+	proto.RegisterType((*ListSubjectsResponse)(nil), "londoapi.v1.ListSubjectsResponse")
+	proto.RegisterType((*CertificateRecord)(nil), "londoapi.v1.CertificateRecord")
+	proto.RegisterType((*GetSubjectHistoryRequest)(nil), "londoapi.v1.GetSubjectHistoryRequest")
+	proto.RegisterType((*GetSubjectHistoryResponse)(nil), "londoapi.v1.GetSubjectHistoryResponse")
+	proto.RegisterType((*AuditEntry)(nil), "londoapi.v1.AuditEntry")
+	proto.RegisterType((*GetAuditLogRequest)(nil), "londoapi.v1.GetAuditLogRequest")
+	proto.RegisterType((*GetAuditLogResponse)(nil), "londoapi.v1.GetAuditLogResponse")
+	proto.RegisterType((*MigrationReport)(nil), "londoapi.v1.MigrationReport")
+	proto.RegisterType((*MigrateSchemaRequest)(nil), "londoapi.v1.MigrateSchemaRequest")
+	proto.RegisterType((*MigrateSchemaResponse)(nil), "londoapi.v1.MigrateSchemaResponse")
+	proto.RegisterType((*ExportSubjectsRequest)(nil), "londoapi.v1.ExportSubjectsRequest")
+	proto.RegisterType((*ExportSubjectsResponse)(nil), "londoapi.v1.ExportSubjectsResponse")
+	proto.RegisterType((*ImportSubjectsRequest)(nil), "londoapi.v1.ImportSubjectsRequest")
+	proto.RegisterType((*ImportConflict)(nil), "londoapi.v1.ImportConflict")
+	proto.RegisterType((*ImportSubjectsResponse)(nil), "londoapi.v1.ImportSubjectsResponse")
+	proto.RegisterType((*DeadLetter)(nil), "londoapi.v1.DeadLetter")
+	proto.RegisterType((*ListDeadLettersRequest)(nil), "londoapi.v1.ListDeadLettersRequest")
+	proto.RegisterType((*ListDeadLettersResponse)(nil), "londoapi.v1.ListDeadLettersResponse")
+	proto.RegisterType((*ReplayDeadLettersRequest)(nil), "londoapi.v1.ReplayDeadLettersRequest")
+	proto.RegisterType((*ReplayDeadLettersResponse)(nil), "londoapi.v1.ReplayDeadLettersResponse")
+	proto.RegisterType((*PurgeDeadLettersRequest)(nil), "londoapi.v1.PurgeDeadLettersRequest")
+	proto.RegisterType((*PurgeDeadLettersResponse)(nil), "londoapi.v1.PurgeDeadLettersResponse")
+	proto.RegisterType((*ResolveEnrollmentRequest)(nil), "londoapi.v1.ResolveEnrollmentRequest")
+	proto.RegisterType((*ResolveEnrollmentResponse)(nil), "londoapi.v1.ResolveEnrollmentResponse")
+	proto.RegisterType((*JWTToken)(nil), "londoapi.v1.JWTToken")
+	proto.RegisterType((*GetTokenRequest)(nil), "londoapi.v1.GetTokenRequest")
+	proto.RegisterType((*GetTokenResponse)(nil), "londoapi.v1.GetTokenResponse")
+	proto.RegisterType((*RewrapKeysRequest)(nil), "londoapi.v1.RewrapKeysRequest")
+	proto.RegisterType((*RewrapKeysResponse)(nil), "londoapi.v1.RewrapKeysResponse")
+}
+
+func init() { proto.RegisterFile("londopb/londo.proto", fileDescriptor_f3d42104e625ed99) }
+
+var fileDescriptor_f3d42104e625ed99 = []byte{
+	// 2149 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x59, 0xdd, 0x72, 0xdb, 0xc6,
+	0x15, 0x0e, 0x29, 0xf1, 0xef, 0x50, 0xa4, 0xa8, 0x15, 0x25, 0x41, 0xb0, 0x1d, 0x2b, 0x70, 0x6d,
+	0xab, 0x4e, 0x63, 0x59, 0x4a, 0xa6, 0x99, 0x5e, 0x75, 0x28, 0x89, 0x72, 0x64, 0xcb, 0x72, 0x66,
+	0x45, 0x27, 0x71, 0x33, 0x53, 0x0e, 0x44, 0xac, 0x14, 0x54, 0x24, 0x00, 0x2f, 0x96, 0x8a, 0x98,
+	0xdb, 0xbe, 0x43, 0x67, 0x7a, 0xd1, 0x77, 0xe8, 0x1b, 0xb4, 0xbd, 0xea, 0x6b, 0x75, 0xf6, 0x0f,
+	0x7f, 0x04, 0x49, 0xb7, 0xbd, 0x22, 0xce, 0xd9, 0xb3, 0x67, 0xcf, 0xdf, 0x9e, 0xfd, 0x76, 0x09,
+	0xeb, 0x43, 0xdf, 0x73, 0xfc, 0xe0, 0x72, 0x4f, 0xfc, 0x3e, 0x0f, 0xa8, 0xcf, 0x7c, 0x54, 0x17,
+	0x84, 0x1d, 0xb8, 0xcf, 0x6f, 0xf7, 0xad, 0xbf, 0x15, 0xa0, 0x72, 0x31, 0xbe, 0xfc, 0x13, 0x19,
+	0x30, 0x64, 0x40, 0x25, 0x94, 0x9f, 0x46, 0x61, 0xa7, 0xb0, 0x5b, 0xc3, 0x9a, 0x44, 0x3b, 0x50,
+	0x1f, 0x10, 0xca, 0xdc, 0x2b, 0x77, 0x60, 0x33, 0x62, 0x14, 0xc5, 0x68, 0x92, 0x85, 0x1e, 0x42,
+	0x3d, 0xa0, 0xee, 0xad, 0xcd, 0x48, 0xff, 0x86, 0x4c, 0x8c, 0x25, 0x21, 0x01, 0x8a, 0xf5, 0x9a,
+	0x4c, 0xd0, 0x3d, 0xa8, 0xd9, 0x43, 0xd6, 0xf7, 0xec, 0x11, 0x09, 0x8d, 0xe5, 0x9d, 0xa5, 0xdd,
+	0x1a, 0xae, 0xda, 0x43, 0x76, 0xce, 0x69, 0xbe, 0x32, 0xb3, 0xe9, 0x35, 0x61, 0xa1, 0x51, 0x12,
+	0x43, 0x9a, 0xb4, 0xbe, 0x80, 0xb5, 0x97, 0x84, 0x29, 0x0b, 0x31, 0xf9, 0x30, 0x26, 0xe1, 0x1c,
+	0x43, 0xad, 0xa7, 0xd0, 0xe8, 0x89, 0x99, 0x5a, 0x74, 0x13, 0xca, 0x52, 0x95, 0x51, 0x10, 0x8a,
+	0x15, 0x65, 0x3d, 0x83, 0xd6, 0x89, 0x4f, 0xa7, 0x64, 0xc7, 0x81, 0xc3, 0x1d, 0xe4, 0x5a, 0xab,
+	0x58, 0x51, 0xd6, 0x31, 0xa0, 0xa4, 0x0d, 0x61, 0xe0, 0x7b, 0x21, 0x41, 0xcf, 0xd3, 0x46, 0xd4,
+	0x0f, 0xda, 0xcf, 0x13, 0x81, 0x7d, 0xae, 0xc5, 0x23, 0xd3, 0x3e, 0x00, 0x9c, 0x93, 0x9f, 0x17,
+	0xc7, 0x1a, 0xc1, 0x72, 0xe0, 0x53, 0x26, 0x82, 0x5c, 0xc2, 0xe2, 0x3b, 0x1d, 0xbc, 0xa5, 0xd9,
+	0xc1, 0x5b, 0x4e, 0x07, 0xef, 0x14, 0xda, 0x1d, 0xc7, 0x89, 0x57, 0xd5, 0x8e, 0xee, 0x67, 0x4d,
+	0xdf, 0x4a, 0x99, 0x9e, 0x98, 0x10, 0x59, 0xbf, 0x0f, 0x1b, 0x19, 0x55, 0x2a, 0x0c, 0xb3, 0x73,
+	0xf1, 0x0d, 0xb4, 0x8f, 0xc9, 0x90, 0x30, 0xf2, 0xb1, 0xd9, 0xe3, 0x09, 0xa0, 0xc4, 0x0e, 0x7d,
+	0x4f, 0x55, 0x98, 0xa2, 0xf8, 0xe2, 0x19, 0x4d, 0x0b, 0x17, 0xdf, 0x87, 0x0d, 0x4c, 0x42, 0xe6,
+	0xd3, 0x8f, 0x5e, 0xdd, 0x3a, 0x83, 0xcd, 0xec, 0x94, 0x45, 0xcb, 0xf0, 0x11, 0x4a, 0x6e, 0xfd,
+	0x1b, 0xe2, 0x08, 0x93, 0xab, 0x58, 0x93, 0xd6, 0x09, 0xac, 0x76, 0xef, 0x02, 0x97, 0xba, 0xde,
+	0xf5, 0xe2, 0x9c, 0x6f, 0x43, 0x95, 0xdc, 0x05, 0x7d, 0x47, 0x6f, 0xae, 0x25, 0x5c, 0x21, 0x77,
+	0xc1, 0x31, 0x2f, 0xbe, 0x17, 0x60, 0xbe, 0x24, 0x2c, 0xa3, 0x2a, 0xd4, 0xde, 0x20, 0x58, 0x76,
+	0xec, 0x49, 0x28, 0xf4, 0x95, 0xb0, 0xf8, 0xb6, 0xde, 0xc1, 0xbd, 0xdc, 0x19, 0xca, 0x99, 0xdf,
+	0x66, 0x93, 0x7f, 0x3f, 0x95, 0xfc, 0xcc, 0xbc, 0x38, 0x3c, 0xbb, 0xb0, 0x82, 0x89, 0x97, 0x5b,
+	0xc1, 0xc5, 0x74, 0x20, 0x8f, 0x60, 0x3d, 0x29, 0xb9, 0x38, 0xef, 0xda, 0x8b, 0x62, 0xc2, 0x8b,
+	0x63, 0x68, 0x08, 0x25, 0x91, 0xdd, 0x5f, 0x66, 0xed, 0xde, 0x4e, 0xd9, 0x9d, 0x5a, 0x31, 0x32,
+	0xe5, 0x9f, 0x4b, 0xd0, 0x38, 0x73, 0x43, 0x46, 0x9c, 0xff, 0x6d, 0xe3, 0x6d, 0x41, 0x85, 0x77,
+	0xb9, 0xbe, 0xeb, 0x88, 0x96, 0xb6, 0x84, 0xcb, 0x9c, 0x3c, 0x75, 0x78, 0xa9, 0x86, 0x84, 0xba,
+	0xf6, 0xd0, 0x58, 0x96, 0xa5, 0x2a, 0x29, 0xbe, 0x53, 0x3d, 0x9f, 0xf5, 0xed, 0x2b, 0x46, 0xa8,
+	0x51, 0x12, 0x53, 0xaa, 0x9e, 0xcf, 0x3a, 0x9c, 0x46, 0x0f, 0x00, 0x06, 0x94, 0xd8, 0x8c, 0x38,
+	0x7d, 0x9b, 0x19, 0x65, 0x31, 0x5a, 0x53, 0x9c, 0x0e, 0xe3, 0xc3, 0xb2, 0xe3, 0x88, 0xe1, 0x8a,
+	0x1c, 0x56, 0x9c, 0x0e, 0x43, 0x4f, 0x61, 0x75, 0xec, 0x51, 0x12, 0xfa, 0xc3, 0x5b, 0xfb, 0x72,
+	0x48, 0xb8, 0x4c, 0x55, 0xc8, 0x34, 0x93, 0xec, 0x0e, 0x43, 0x6d, 0x28, 0x8d, 0x6c, 0x36, 0xf8,
+	0xc9, 0xa8, 0x89, 0x92, 0x94, 0x44, 0xba, 0x87, 0xc0, 0xec, 0x1e, 0x52, 0x4f, 0xf5, 0x10, 0x64,
+	0x42, 0xd5, 0x1f, 0x33, 0x61, 0x83, 0xb1, 0x22, 0x67, 0x69, 0x9a, 0x1b, 0xec, 0x88, 0x7d, 0x29,
+	0x0c, 0x6e, 0x48, 0x83, 0x15, 0xa7, 0xc3, 0xd0, 0x63, 0x68, 0xea, 0x61, 0xb5, 0xad, 0x9b, 0x22,
+	0x56, 0x0d, 0xc5, 0xc5, 0x82, 0x99, 0xd4, 0x72, 0x39, 0x31, 0x56, 0x85, 0x88, 0xd6, 0x72, 0x38,
+	0xb1, 0xfe, 0xbe, 0x0c, 0xeb, 0x3c, 0x85, 0x39, 0xa5, 0xcf, 0x7d, 0x51, 0x59, 0x14, 0xdf, 0x7c,
+	0x1f, 0x69, 0x1f, 0x75, 0x51, 0x2a, 0x17, 0x13, 0x07, 0x81, 0x3c, 0x9b, 0x14, 0x85, 0x7e, 0xad,
+	0x83, 0xc5, 0xf3, 0xd8, 0x3c, 0x58, 0x4f, 0x15, 0xd5, 0x89, 0x3b, 0x64, 0x84, 0xea, 0x08, 0xee,
+	0x25, 0x42, 0x51, 0x9a, 0x2d, 0x1d, 0xc7, 0xe7, 0x6b, 0x58, 0x49, 0xa6, 0xc6, 0x28, 0xcf, 0x9e,
+	0x94, 0x12, 0x44, 0x8f, 0xa0, 0x41, 0xf8, 0x3e, 0x24, 0xa1, 0xaa, 0x24, 0x59, 0x0c, 0x2b, 0x8a,
+	0x29, 0xab, 0xe9, 0x31, 0x34, 0xb5, 0xd0, 0x25, 0xb9, 0xf2, 0x29, 0x51, 0xe5, 0xa0, 0xa7, 0x1e,
+	0x0a, 0x26, 0xd7, 0x15, 0x15, 0x9d, 0xd0, 0x55, 0x93, 0xba, 0x74, 0xdd, 0x69, 0x5d, 0x5a, 0x48,
+	0xe9, 0x02, 0xa9, 0x4b, 0x71, 0x95, 0xae, 0x3d, 0xa8, 0x84, 0x3e, 0x65, 0x3c, 0x4f, 0x75, 0xe1,
+	0xcb, 0x66, 0xfa, 0xcc, 0xf3, 0x29, 0x3b, 0x71, 0xc9, 0xd0, 0xc1, 0x65, 0x2e, 0x76, 0x38, 0x41,
+	0x9f, 0xf2, 0xdc, 0x86, 0x03, 0xe2, 0x39, 0xae, 0x77, 0x6d, 0xac, 0x88, 0x7a, 0x4c, 0x70, 0x78,
+	0x51, 0x06, 0xf6, 0x35, 0xe9, 0x87, 0xee, 0x2f, 0x44, 0x14, 0x50, 0x09, 0x57, 0x39, 0xe3, 0xc2,
+	0xfd, 0x85, 0xf0, 0xc2, 0x10, 0x83, 0xcc, 0xbf, 0x21, 0xba, 0x76, 0x84, 0x78, 0x8f, 0x33, 0x78,
+	0xcd, 0xaa, 0x2a, 0x11, 0x45, 0x53, 0xc5, 0x9a, 0xb4, 0x6e, 0xa1, 0x9d, 0xae, 0x98, 0xa8, 0xf5,
+	0x55, 0xd5, 0x66, 0x0f, 0x05, 0x1c, 0xa8, 0x1f, 0x98, 0x29, 0xfb, 0x53, 0x9d, 0x02, 0x47, 0xb2,
+	0xe8, 0x09, 0xac, 0x7a, 0xe4, 0x8e, 0xf5, 0x13, 0xd6, 0xc8, 0xea, 0x6a, 0x70, 0xf6, 0xb7, 0xda,
+	0x22, 0xeb, 0xdf, 0x45, 0x58, 0x3b, 0x8a, 0x41, 0x11, 0x26, 0x03, 0x9f, 0x3a, 0xdc, 0xce, 0x5b,
+	0x42, 0x43, 0xd7, 0xf7, 0x54, 0x9b, 0xd6, 0x64, 0xb2, 0xbb, 0x14, 0x53, 0xdd, 0x65, 0x1b, 0xaa,
+	0x3e, 0x75, 0x08, 0xd5, 0x7d, 0xa7, 0x86, 0x2b, 0x82, 0x9e, 0xd3, 0x78, 0x1e, 0x00, 0xf0, 0xc6,
+	0xa3, 0xb2, 0x27, 0x3b, 0x0f, 0x6f, 0x45, 0x2a, 0x73, 0xa9, 0xbe, 0x54, 0xce, 0xf4, 0xa5, 0x7b,
+	0x50, 0x73, 0xc3, 0x70, 0x9c, 0xec, 0x3b, 0x55, 0xc9, 0x90, 0x5d, 0x49, 0x9d, 0x69, 0x71, 0xc7,
+	0xa9, 0x29, 0x4e, 0x87, 0xa1, 0xcf, 0x61, 0x8d, 0x13, 0x03, 0x9b, 0xb9, 0xbe, 0xa7, 0xf7, 0x79,
+	0x4d, 0x98, 0xd6, 0x8a, 0x07, 0xd4, 0x56, 0x7f, 0x0a, 0xab, 0x37, 0x64, 0xd2, 0xbf, 0x72, 0xbd,
+	0x6b, 0x42, 0x03, 0xea, 0x7a, 0x4c, 0xd4, 0x59, 0x0d, 0x37, 0x6f, 0xc8, 0xe4, 0x24, 0xe6, 0x5a,
+	0x5f, 0x81, 0x11, 0x43, 0xae, 0x6f, 0x5c, 0x7e, 0x2a, 0x4f, 0x16, 0x9f, 0xe0, 0x17, 0xb0, 0x9d,
+	0x33, 0x2b, 0x4a, 0x7e, 0x99, 0x8a, 0x84, 0xa8, 0xe3, 0xe3, 0xd3, 0x54, 0xea, 0xa7, 0xd2, 0x86,
+	0x95, 0xb4, 0xf5, 0xaf, 0x02, 0x40, 0x67, 0xec, 0xb8, 0xac, 0xeb, 0x31, 0x3a, 0x41, 0xf7, 0xa1,
+	0xc6, 0xdc, 0x11, 0x09, 0x99, 0x3d, 0x0a, 0x84, 0xa6, 0x25, 0x1c, 0x33, 0x78, 0xeb, 0xb5, 0x07,
+	0xcc, 0xa7, 0xaa, 0x3e, 0x24, 0xc1, 0xe3, 0x1b, 0xfa, 0x63, 0x3a, 0x20, 0x7d, 0x37, 0x50, 0xf9,
+	0xac, 0x4a, 0xc6, 0x69, 0xc0, 0x13, 0x6a, 0x0f, 0x78, 0x8c, 0x74, 0x42, 0x25, 0x95, 0x74, 0xb3,
+	0x34, 0x05, 0x3a, 0xfc, 0x31, 0x1b, 0xf8, 0x23, 0xd9, 0x51, 0x6a, 0x58, 0x93, 0x09, 0x00, 0x55,
+	0x49, 0x01, 0xa8, 0x73, 0x81, 0x60, 0x85, 0x17, 0x67, 0xfe, 0x75, 0xa2, 0x83, 0x5e, 0x51, 0x7f,
+	0xa4, 0xbc, 0x10, 0xdf, 0xa8, 0x09, 0x45, 0xe6, 0xab, 0x6a, 0x2c, 0x32, 0x3f, 0x76, 0x68, 0x29,
+	0xe1, 0x90, 0x75, 0x0c, 0xeb, 0x29, 0x7d, 0x2a, 0xc4, 0x5f, 0x40, 0x89, 0xf0, 0x20, 0xe5, 0xa2,
+	0xca, 0x38, 0x86, 0x58, 0x4a, 0x59, 0x7f, 0x2e, 0xc0, 0xea, 0x1b, 0xf7, 0x9a, 0xaa, 0x0a, 0x11,
+	0x07, 0xee, 0xec, 0xcd, 0xb2, 0x03, 0x75, 0xde, 0x38, 0xa8, 0x1b, 0x88, 0x60, 0xa9, 0x3b, 0x48,
+	0x82, 0xc5, 0x8f, 0xaa, 0x68, 0x7b, 0x2b, 0x90, 0xac, 0x69, 0xae, 0xd7, 0x0e, 0x82, 0xa1, 0x4b,
+	0x1c, 0x11, 0xe6, 0x2a, 0xd6, 0xa4, 0xb5, 0x07, 0x6d, 0x69, 0x04, 0xb9, 0x18, 0xfc, 0x44, 0x46,
+	0xb6, 0x8e, 0xce, 0x16, 0x54, 0x1c, 0x3a, 0xe9, 0xd3, 0xb1, 0xa7, 0xaf, 0x03, 0x0e, 0x9d, 0xe0,
+	0xb1, 0x67, 0xbd, 0x81, 0x8d, 0xcc, 0x04, 0xe5, 0xfe, 0x57, 0x3c, 0xfa, 0x02, 0x42, 0xe4, 0x01,
+	0xab, 0x8c, 0xa7, 0x58, 0xc9, 0x5a, 0x5b, 0xb0, 0xd1, 0xbd, 0xe3, 0x5f, 0x99, 0x03, 0xce, 0xfa,
+	0x0d, 0x6c, 0x66, 0x07, 0xd4, 0x42, 0x08, 0x96, 0x5d, 0x46, 0x64, 0xe2, 0x56, 0xb0, 0xf8, 0xb6,
+	0xba, 0xb0, 0x71, 0x3a, 0xca, 0x51, 0x23, 0x21, 0x6a, 0x30, 0xb4, 0x07, 0xfa, 0x5a, 0xa3, 0xc9,
+	0x48, 0x4d, 0x31, 0xa1, 0xe6, 0x47, 0x68, 0x4a, 0x35, 0x47, 0xbe, 0x77, 0x35, 0x74, 0xe7, 0x02,
+	0xa6, 0x99, 0xed, 0x6b, 0x13, 0xca, 0x57, 0xfc, 0x18, 0xd0, 0x69, 0x50, 0x94, 0xf5, 0x8f, 0x02,
+	0x6c, 0x9e, 0x8e, 0x72, 0x5d, 0x32, 0xa1, 0xea, 0x8a, 0x11, 0xe2, 0xa8, 0xc4, 0x47, 0x34, 0x1f,
+	0x53, 0x26, 0x3b, 0x0a, 0x9c, 0x45, 0xb4, 0xb0, 0xee, 0xc6, 0x0d, 0x02, 0x22, 0x1b, 0x65, 0x09,
+	0x6b, 0x52, 0xfa, 0xcd, 0x77, 0x70, 0x28, 0x32, 0x5e, 0xc2, 0x9a, 0x44, 0xbf, 0x83, 0xda, 0x40,
+	0x79, 0x27, 0xef, 0x9b, 0xf5, 0x83, 0x7b, 0xa9, 0x54, 0xa5, 0x23, 0x80, 0x63, 0x69, 0xeb, 0xaf,
+	0x05, 0x80, 0x63, 0x62, 0x3b, 0x67, 0x84, 0xf1, 0xc6, 0xd9, 0x86, 0xd2, 0x87, 0x31, 0x19, 0x6b,
+	0x10, 0x22, 0x09, 0x1e, 0x57, 0x36, 0x09, 0x34, 0x02, 0x11, 0xdf, 0xdc, 0x07, 0x9b, 0x31, 0x32,
+	0x0a, 0x44, 0x6d, 0x0a, 0x1f, 0x34, 0xcd, 0xb5, 0x10, 0x4a, 0x7d, 0xaa, 0x1a, 0x80, 0x24, 0x78,
+	0xd3, 0xb8, 0xb2, 0xdd, 0xa1, 0x6c, 0xbb, 0x0a, 0x49, 0x4a, 0x46, 0x47, 0x6c, 0xdd, 0x4b, 0xdf,
+	0x99, 0x88, 0xfd, 0xbf, 0x82, 0xc5, 0xb7, 0x75, 0x0c, 0x9b, 0xfc, 0x00, 0x8b, 0xcd, 0x8b, 0x4a,
+	0x20, 0xdf, 0xcc, 0x36, 0x94, 0x86, 0xee, 0xc8, 0xd5, 0x80, 0x57, 0x12, 0xd6, 0x2b, 0xd8, 0x9a,
+	0xd2, 0xa2, 0x72, 0xb4, 0x07, 0xe5, 0xa1, 0x60, 0xe5, 0xee, 0xef, 0x78, 0x06, 0x56, 0x62, 0xd6,
+	0x09, 0x18, 0x98, 0x27, 0x6a, 0xf2, 0x7f, 0xda, 0xb4, 0x0f, 0xdb, 0x39, 0x7a, 0x94, 0x55, 0x6d,
+	0x28, 0x0d, 0xfc, 0xb1, 0xc7, 0x54, 0xd9, 0x48, 0xc2, 0xda, 0x83, 0xad, 0x6f, 0xc7, 0xf4, 0x9a,
+	0x7c, 0xec, 0xca, 0xd6, 0x0b, 0x30, 0xa6, 0x27, 0xcc, 0x5d, 0xe2, 0x0d, 0xf7, 0x8e, 0x43, 0x36,
+	0xd2, 0xf5, 0xa8, 0x3f, 0x1c, 0x8e, 0x88, 0xf7, 0x11, 0x77, 0x9d, 0xcc, 0xa6, 0x29, 0xe9, 0x4d,
+	0x63, 0xbd, 0x86, 0xed, 0x1c, 0x75, 0x0b, 0x6f, 0xa0, 0x6d, 0x28, 0x85, 0x2c, 0x7e, 0x94, 0x91,
+	0x84, 0xb5, 0x03, 0xd5, 0x57, 0xdf, 0xf7, 0x24, 0x4e, 0x6a, 0x43, 0x49, 0x62, 0x16, 0xe5, 0xaf,
+	0x20, 0xac, 0x35, 0x58, 0x7d, 0x49, 0x98, 0x90, 0xd0, 0x0d, 0xe7, 0xf7, 0xd0, 0x8a, 0x59, 0x6a,
+	0xe1, 0xcf, 0x93, 0x93, 0xeb, 0x07, 0x1b, 0xa9, 0x94, 0xeb, 0x25, 0xb4, 0xce, 0x75, 0x58, 0xc3,
+	0xe4, 0x67, 0x6a, 0x07, 0xaf, 0xc9, 0x24, 0xd1, 0xc6, 0x50, 0x92, 0xa9, 0xf4, 0x72, 0x18, 0xc3,
+	0x6c, 0x36, 0x0e, 0x95, 0x55, 0x8a, 0x7a, 0xb6, 0x0b, 0x65, 0x89, 0x88, 0x51, 0x05, 0x96, 0x3a,
+	0xe7, 0xef, 0x5b, 0x9f, 0xa0, 0x2a, 0x2c, 0xbf, 0x3d, 0x3f, 0x7b, 0xdf, 0x2a, 0xa0, 0x3a, 0x54,
+	0xba, 0x3f, 0x1c, 0x9d, 0xbd, 0x3b, 0xee, 0xb6, 0x8a, 0xcf, 0xbe, 0x86, 0x5a, 0x84, 0x37, 0xf9,
+	0xc8, 0xc5, 0xbb, 0xc3, 0x57, 0xdd, 0xa3, 0x5e, 0xeb, 0x13, 0xd4, 0x80, 0xda, 0xf9, 0xdb, 0x5e,
+	0xbf, 0x73, 0xd2, 0xeb, 0xe2, 0x56, 0x01, 0x35, 0x01, 0x8e, 0x70, 0xb7, 0xd3, 0xeb, 0x1e, 0xf7,
+	0x3b, 0xbd, 0x56, 0xf1, 0xe0, 0x2f, 0x4d, 0xa8, 0xf3, 0xe3, 0xfe, 0x82, 0xd0, 0x5b, 0x77, 0x40,
+	0xd0, 0x1b, 0x80, 0x18, 0x35, 0xa0, 0x34, 0x2c, 0x98, 0x7a, 0x7b, 0x32, 0x1f, 0xce, 0x1c, 0x57,
+	0x9e, 0xf5, 0x60, 0x3d, 0xe6, 0x86, 0x87, 0x13, 0xf9, 0xc6, 0x84, 0xd2, 0x48, 0x33, 0xf5, 0xf0,
+	0xb4, 0x50, 0xe7, 0x8b, 0x02, 0xfa, 0x3e, 0xa9, 0x35, 0x7a, 0xb9, 0x42, 0x0f, 0xd2, 0x77, 0x09,
+	0x9f, 0xfe, 0xd7, 0x8a, 0xbf, 0x83, 0x46, 0xea, 0x61, 0x07, 0x7d, 0x96, 0x3e, 0xb5, 0x73, 0xde,
+	0x8f, 0x4c, 0x6b, 0x9e, 0x88, 0x0a, 0xc3, 0x77, 0xd0, 0x48, 0xbd, 0xd9, 0x64, 0xf4, 0xe6, 0xbd,
+	0x0c, 0x99, 0xd6, 0x3c, 0x11, 0xa5, 0xf7, 0x3d, 0x34, 0xd3, 0xaf, 0x34, 0xc8, 0xca, 0xbc, 0x03,
+	0xe4, 0xbc, 0xfa, 0x98, 0x8f, 0xe6, 0xca, 0x28, 0xd5, 0xae, 0x40, 0x49, 0xd9, 0x57, 0x9b, 0xa7,
+	0xd9, 0x18, 0xce, 0x78, 0x8b, 0x31, 0x77, 0x17, 0x0b, 0x46, 0x51, 0x7f, 0xab, 0x5e, 0x37, 0xf4,
+	0x10, 0xda, 0x99, 0xfd, 0x98, 0xa1, 0xd4, 0x9b, 0xd3, 0x12, 0x09, 0x85, 0x17, 0xb0, 0x92, 0xbc,
+	0xf2, 0x64, 0xf4, 0xe5, 0xdc, 0x9f, 0xcd, 0xcf, 0xe6, 0x48, 0xa8, 0x80, 0x38, 0xb0, 0x36, 0x85,
+	0xa7, 0xd1, 0xe3, 0x19, 0x35, 0x95, 0x46, 0xe9, 0xe6, 0x93, 0x45, 0x62, 0x91, 0xe9, 0x2f, 0xa1,
+	0xaa, 0xdb, 0x0e, 0xba, 0x9f, 0x9d, 0x95, 0x6c, 0x50, 0xe6, 0x83, 0x19, 0xa3, 0xca, 0x5c, 0x0c,
+	0xf5, 0x04, 0x2a, 0x45, 0x53, 0xc5, 0x9f, 0xc1, 0xbf, 0xe6, 0xce, 0x6c, 0x81, 0xc8, 0xb8, 0x1f,
+	0xa0, 0x91, 0x02, 0x7b, 0x99, 0x32, 0xce, 0x43, 0x8e, 0xa6, 0x35, 0x4f, 0x24, 0xd2, 0xfc, 0x23,
+	0x34, 0xd3, 0xf0, 0x2e, 0x53, 0xc8, 0xb9, 0xa0, 0xd0, 0x7c, 0x34, 0x57, 0x26, 0xa9, 0xfc, 0x74,
+	0x34, 0x47, 0xf9, 0xe9, 0x68, 0xb1, 0xf2, 0x7c, 0xa4, 0xb6, 0x5b, 0xe0, 0x0d, 0x33, 0xee, 0xe8,
+	0x99, 0x86, 0x39, 0xd5, 0xff, 0xcd, 0x87, 0x33, 0xc7, 0x55, 0xda, 0xfe, 0x08, 0xab, 0x19, 0xc4,
+	0x81, 0x1e, 0x4d, 0xd5, 0xe6, 0xf4, 0x39, 0x6e, 0xfe, 0x6a, 0xbe, 0x50, 0x14, 0x8b, 0x4b, 0x58,
+	0x9b, 0x42, 0x0f, 0x99, 0x2a, 0x9e, 0x85, 0x52, 0xcc, 0x27, 0x8b, 0xc4, 0x94, 0x0f, 0x7d, 0x68,
+	0x65, 0xd1, 0x03, 0x4a, 0xdb, 0x37, 0x03, 0x8d, 0x98, 0x8f, 0x17, 0x48, 0xa9, 0x05, 0x84, 0x13,
+	0x19, 0x74, 0x30, 0xe5, 0x44, 0x3e, 0x18, 0x31, 0x9f, 0x2c, 0x12, 0x93, 0x6b, 0x1c, 0xd6, 0xfe,
+	0x50, 0x51, 0xff, 0x17, 0x5d, 0x96, 0xc5, 0x5f, 0x45, 0x5f, 0xfe, 0x67, 0x00, 0x11, 0x3f, 0xb5,
+	0x85, 0x41, 0x1a, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -918,9 +2808,29 @@ type CertServiceClient interface {
 	GetSubjectForTarget(ctx context.Context, in *ForTargetRequest, opts ...grpc.CallOption) (CertService_GetSubjectForTargetClient, error)
 	AddNewSubject(ctx context.Context, in *AddNewSubjectRequest, opts ...grpc.CallOption) (*AddNewSubjectResponse, error)
 	DeleteSubject(ctx context.Context, in *DeleteSubjectRequest, opts ...grpc.CallOption) (*DeleteSubjectResponse, error)
+	// Brings back a deleted subject until its retention is over
+	RestoreSubject(ctx context.Context, in *RestoreSubjectRequest, opts ...grpc.CallOption) (*RestoreSubjectResponse, error)
 	GetExpiringSubject(ctx context.Context, in *GetExpiringSubjectsRequest, opts ...grpc.CallOption) (CertService_GetExpiringSubjectClient, error)
 	RenewSubjects(ctx context.Context, in *RenewSubjectRequest, opts ...grpc.CallOption) (CertService_RenewSubjectsClient, error)
+	// A page of subjects matching a filter, pass next_page_token back to get the next one
+	ListSubjects(ctx context.Context, in *ListSubjectsRequest, opts ...grpc.CallOption) (*ListSubjectsResponse, error)
+	// Every certificate ever issued for a subject, oldest first
+	GetSubjectHistory(ctx context.Context, in *GetSubjectHistoryRequest, opts ...grpc.CallOption) (CertService_GetSubjectHistoryClient, error)
 	GetToken(ctx context.Context, in *GetTokenRequest, opts ...grpc.CallOption) (*GetTokenResponse, error)
+	// Audit entries within a time range, optionally limited to one actor
+	GetAuditLog(ctx context.Context, in *GetAuditLogRequest, opts ...grpc.CallOption) (CertService_GetAuditLogClient, error)
+	// Applies pending database migrations, or reports what they would change on a dry run
+	MigrateSchema(ctx context.Context, in *MigrateSchemaRequest, opts ...grpc.CallOption) (CertService_MigrateSchemaClient, error)
+	// Every subject with its private key in plain text, and every certificate record
+	ExportSubjects(ctx context.Context, in *ExportSubjectsRequest, opts ...grpc.CallOption) (CertService_ExportSubjectsClient, error)
+	ImportSubjects(ctx context.Context, opts ...grpc.CallOption) (CertService_ImportSubjectsClient, error)
+	// Re-wraps private keys of all subjects with current key encryption key
+	RewrapKeys(ctx context.Context, in *RewrapKeysRequest, opts ...grpc.CallOption) (*RewrapKeysResponse, error)
+	// Messages which failed every attempt of their queue's retry policy
+	ListDeadLetters(ctx context.Context, in *ListDeadLettersRequest, opts ...grpc.CallOption) (CertService_ListDeadLettersClient, error)
+	ReplayDeadLetters(ctx context.Context, in *ReplayDeadLettersRequest, opts ...grpc.CallOption) (*ReplayDeadLettersResponse, error)
+	PurgeDeadLetters(ctx context.Context, in *PurgeDeadLettersRequest, opts ...grpc.CallOption) (*PurgeDeadLettersResponse, error)
+	ResolveEnrollment(ctx context.Context, in *ResolveEnrollmentRequest, opts ...grpc.CallOption) (*ResolveEnrollmentResponse, error)
 }
 
 type certServiceClient struct {
@@ -1022,6 +2932,15 @@ func (c *certServiceClient) DeleteSubject(ctx context.Context, in *DeleteSubject
 	return out, nil
 }
 
+func (c *certServiceClient) RestoreSubject(ctx context.Context, in *RestoreSubjectRequest, opts ...grpc.CallOption) (*RestoreSubjectResponse, error) {
+	out := new(RestoreSubjectResponse)
+	err := c.cc.Invoke(ctx, "/londoapi.v1.CertService/RestoreSubject", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *certServiceClient) GetExpiringSubject(ctx context.Context, in *GetExpiringSubjectsRequest, opts ...grpc.CallOption) (CertService_GetExpiringSubjectClient, error) {
 	stream, err := c.cc.NewStream(ctx, &_CertService_serviceDesc.Streams[2], "/londoapi.v1.CertService/GetExpiringSubject", opts...)
 	if err != nil {
@@ -1037,29 +2956,250 @@ func (c *certServiceClient) GetExpiringSubject(ctx context.Context, in *GetExpir
 	return x, nil
 }
 
-type CertService_GetExpiringSubjectClient interface {
-	Recv() (*GetExpiringSubjectsResponse, error)
+type CertService_GetExpiringSubjectClient interface {
+	Recv() (*GetExpiringSubjectsResponse, error)
+	grpc.ClientStream
+}
+
+type certServiceGetExpiringSubjectClient struct {
+	grpc.ClientStream
+}
+
+func (x *certServiceGetExpiringSubjectClient) Recv() (*GetExpiringSubjectsResponse, error) {
+	m := new(GetExpiringSubjectsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *certServiceClient) RenewSubjects(ctx context.Context, in *RenewSubjectRequest, opts ...grpc.CallOption) (CertService_RenewSubjectsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_CertService_serviceDesc.Streams[3], "/londoapi.v1.CertService/RenewSubjects", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certServiceRenewSubjectsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CertService_RenewSubjectsClient interface {
+	Recv() (*RenewResponse, error)
+	grpc.ClientStream
+}
+
+type certServiceRenewSubjectsClient struct {
+	grpc.ClientStream
+}
+
+func (x *certServiceRenewSubjectsClient) Recv() (*RenewResponse, error) {
+	m := new(RenewResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *certServiceClient) ListSubjects(ctx context.Context, in *ListSubjectsRequest, opts ...grpc.CallOption) (*ListSubjectsResponse, error) {
+	out := new(ListSubjectsResponse)
+	err := c.cc.Invoke(ctx, "/londoapi.v1.CertService/ListSubjects", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certServiceClient) GetSubjectHistory(ctx context.Context, in *GetSubjectHistoryRequest, opts ...grpc.CallOption) (CertService_GetSubjectHistoryClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_CertService_serviceDesc.Streams[4], "/londoapi.v1.CertService/GetSubjectHistory", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certServiceGetSubjectHistoryClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CertService_GetSubjectHistoryClient interface {
+	Recv() (*GetSubjectHistoryResponse, error)
+	grpc.ClientStream
+}
+
+type certServiceGetSubjectHistoryClient struct {
+	grpc.ClientStream
+}
+
+func (x *certServiceGetSubjectHistoryClient) Recv() (*GetSubjectHistoryResponse, error) {
+	m := new(GetSubjectHistoryResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *certServiceClient) GetToken(ctx context.Context, in *GetTokenRequest, opts ...grpc.CallOption) (*GetTokenResponse, error) {
+	out := new(GetTokenResponse)
+	err := c.cc.Invoke(ctx, "/londoapi.v1.CertService/GetToken", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certServiceClient) GetAuditLog(ctx context.Context, in *GetAuditLogRequest, opts ...grpc.CallOption) (CertService_GetAuditLogClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_CertService_serviceDesc.Streams[5], "/londoapi.v1.CertService/GetAuditLog", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certServiceGetAuditLogClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CertService_GetAuditLogClient interface {
+	Recv() (*GetAuditLogResponse, error)
+	grpc.ClientStream
+}
+
+type certServiceGetAuditLogClient struct {
+	grpc.ClientStream
+}
+
+func (x *certServiceGetAuditLogClient) Recv() (*GetAuditLogResponse, error) {
+	m := new(GetAuditLogResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *certServiceClient) MigrateSchema(ctx context.Context, in *MigrateSchemaRequest, opts ...grpc.CallOption) (CertService_MigrateSchemaClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_CertService_serviceDesc.Streams[6], "/londoapi.v1.CertService/MigrateSchema", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certServiceMigrateSchemaClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CertService_MigrateSchemaClient interface {
+	Recv() (*MigrateSchemaResponse, error)
+	grpc.ClientStream
+}
+
+type certServiceMigrateSchemaClient struct {
+	grpc.ClientStream
+}
+
+func (x *certServiceMigrateSchemaClient) Recv() (*MigrateSchemaResponse, error) {
+	m := new(MigrateSchemaResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *certServiceClient) ExportSubjects(ctx context.Context, in *ExportSubjectsRequest, opts ...grpc.CallOption) (CertService_ExportSubjectsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_CertService_serviceDesc.Streams[7], "/londoapi.v1.CertService/ExportSubjects", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certServiceExportSubjectsClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type CertService_ExportSubjectsClient interface {
+	Recv() (*ExportSubjectsResponse, error)
+	grpc.ClientStream
+}
+
+type certServiceExportSubjectsClient struct {
+	grpc.ClientStream
+}
+
+func (x *certServiceExportSubjectsClient) Recv() (*ExportSubjectsResponse, error) {
+	m := new(ExportSubjectsResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *certServiceClient) ImportSubjects(ctx context.Context, opts ...grpc.CallOption) (CertService_ImportSubjectsClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_CertService_serviceDesc.Streams[8], "/londoapi.v1.CertService/ImportSubjects", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certServiceImportSubjectsClient{stream}
+	return x, nil
+}
+
+type CertService_ImportSubjectsClient interface {
+	Send(*ImportSubjectsRequest) error
+	CloseAndRecv() (*ImportSubjectsResponse, error)
 	grpc.ClientStream
 }
 
-type certServiceGetExpiringSubjectClient struct {
+type certServiceImportSubjectsClient struct {
 	grpc.ClientStream
 }
 
-func (x *certServiceGetExpiringSubjectClient) Recv() (*GetExpiringSubjectsResponse, error) {
-	m := new(GetExpiringSubjectsResponse)
+func (x *certServiceImportSubjectsClient) Send(m *ImportSubjectsRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *certServiceImportSubjectsClient) CloseAndRecv() (*ImportSubjectsResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(ImportSubjectsResponse)
 	if err := x.ClientStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
 	return m, nil
 }
 
-func (c *certServiceClient) RenewSubjects(ctx context.Context, in *RenewSubjectRequest, opts ...grpc.CallOption) (CertService_RenewSubjectsClient, error) {
-	stream, err := c.cc.NewStream(ctx, &_CertService_serviceDesc.Streams[3], "/londoapi.v1.CertService/RenewSubjects", opts...)
+func (c *certServiceClient) RewrapKeys(ctx context.Context, in *RewrapKeysRequest, opts ...grpc.CallOption) (*RewrapKeysResponse, error) {
+	out := new(RewrapKeysResponse)
+	err := c.cc.Invoke(ctx, "/londoapi.v1.CertService/RewrapKeys", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &certServiceRenewSubjectsClient{stream}
+	return out, nil
+}
+
+func (c *certServiceClient) ListDeadLetters(ctx context.Context, in *ListDeadLettersRequest, opts ...grpc.CallOption) (CertService_ListDeadLettersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_CertService_serviceDesc.Streams[9], "/londoapi.v1.CertService/ListDeadLetters", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &certServiceListDeadLettersClient{stream}
 	if err := x.ClientStream.SendMsg(in); err != nil {
 		return nil, err
 	}
@@ -1069,26 +3209,44 @@ func (c *certServiceClient) RenewSubjects(ctx context.Context, in *RenewSubjectR
 	return x, nil
 }
 
-type CertService_RenewSubjectsClient interface {
-	Recv() (*RenewResponse, error)
+type CertService_ListDeadLettersClient interface {
+	Recv() (*ListDeadLettersResponse, error)
 	grpc.ClientStream
 }
 
-type certServiceRenewSubjectsClient struct {
+type certServiceListDeadLettersClient struct {
 	grpc.ClientStream
 }
 
-func (x *certServiceRenewSubjectsClient) Recv() (*RenewResponse, error) {
-	m := new(RenewResponse)
+func (x *certServiceListDeadLettersClient) Recv() (*ListDeadLettersResponse, error) {
+	m := new(ListDeadLettersResponse)
 	if err := x.ClientStream.RecvMsg(m); err != nil {
 		return nil, err
 	}
 	return m, nil
 }
 
-func (c *certServiceClient) GetToken(ctx context.Context, in *GetTokenRequest, opts ...grpc.CallOption) (*GetTokenResponse, error) {
-	out := new(GetTokenResponse)
-	err := c.cc.Invoke(ctx, "/londoapi.v1.CertService/GetToken", in, out, opts...)
+func (c *certServiceClient) ReplayDeadLetters(ctx context.Context, in *ReplayDeadLettersRequest, opts ...grpc.CallOption) (*ReplayDeadLettersResponse, error) {
+	out := new(ReplayDeadLettersResponse)
+	err := c.cc.Invoke(ctx, "/londoapi.v1.CertService/ReplayDeadLetters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certServiceClient) PurgeDeadLetters(ctx context.Context, in *PurgeDeadLettersRequest, opts ...grpc.CallOption) (*PurgeDeadLettersResponse, error) {
+	out := new(PurgeDeadLettersResponse)
+	err := c.cc.Invoke(ctx, "/londoapi.v1.CertService/PurgeDeadLetters", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *certServiceClient) ResolveEnrollment(ctx context.Context, in *ResolveEnrollmentRequest, opts ...grpc.CallOption) (*ResolveEnrollmentResponse, error) {
+	out := new(ResolveEnrollmentResponse)
+	err := c.cc.Invoke(ctx, "/londoapi.v1.CertService/ResolveEnrollment", in, out, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -1103,9 +3261,94 @@ type CertServiceServer interface {
 	GetSubjectForTarget(*ForTargetRequest, CertService_GetSubjectForTargetServer) error
 	AddNewSubject(context.Context, *AddNewSubjectRequest) (*AddNewSubjectResponse, error)
 	DeleteSubject(context.Context, *DeleteSubjectRequest) (*DeleteSubjectResponse, error)
+	// Brings back a deleted subject until its retention is over
+	RestoreSubject(context.Context, *RestoreSubjectRequest) (*RestoreSubjectResponse, error)
 	GetExpiringSubject(*GetExpiringSubjectsRequest, CertService_GetExpiringSubjectServer) error
 	RenewSubjects(*RenewSubjectRequest, CertService_RenewSubjectsServer) error
+	// A page of subjects matching a filter, pass next_page_token back to get the next one
+	ListSubjects(context.Context, *ListSubjectsRequest) (*ListSubjectsResponse, error)
+	// Every certificate ever issued for a subject, oldest first
+	GetSubjectHistory(*GetSubjectHistoryRequest, CertService_GetSubjectHistoryServer) error
 	GetToken(context.Context, *GetTokenRequest) (*GetTokenResponse, error)
+	// Audit entries within a time range, optionally limited to one actor
+	GetAuditLog(*GetAuditLogRequest, CertService_GetAuditLogServer) error
+	// Applies pending database migrations, or reports what they would change on a dry run
+	MigrateSchema(*MigrateSchemaRequest, CertService_MigrateSchemaServer) error
+	// Every subject with its private key in plain text, and every certificate record
+	ExportSubjects(*ExportSubjectsRequest, CertService_ExportSubjectsServer) error
+	ImportSubjects(CertService_ImportSubjectsServer) error
+	// Re-wraps private keys of all subjects with current key encryption key
+	RewrapKeys(context.Context, *RewrapKeysRequest) (*RewrapKeysResponse, error)
+	// Messages which failed every attempt of their queue's retry policy
+	ListDeadLetters(*ListDeadLettersRequest, CertService_ListDeadLettersServer) error
+	ReplayDeadLetters(context.Context, *ReplayDeadLettersRequest) (*ReplayDeadLettersResponse, error)
+	PurgeDeadLetters(context.Context, *PurgeDeadLettersRequest) (*PurgeDeadLettersResponse, error)
+	ResolveEnrollment(context.Context, *ResolveEnrollmentRequest) (*ResolveEnrollmentResponse, error)
+}
+
+// UnimplementedCertServiceServer can be embedded to have forward compatible implementations.
+type UnimplementedCertServiceServer struct {
+}
+
+func (*UnimplementedCertServiceServer) GetSubject(ctx context.Context, req *GetSubjectRequest) (*GetSubjectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSubject not implemented")
+}
+func (*UnimplementedCertServiceServer) GetSubjectsByTarget(req *TargetRequest, srv CertService_GetSubjectsByTargetServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetSubjectsByTarget not implemented")
+}
+func (*UnimplementedCertServiceServer) GetSubjectForTarget(req *ForTargetRequest, srv CertService_GetSubjectForTargetServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetSubjectForTarget not implemented")
+}
+func (*UnimplementedCertServiceServer) AddNewSubject(ctx context.Context, req *AddNewSubjectRequest) (*AddNewSubjectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddNewSubject not implemented")
+}
+func (*UnimplementedCertServiceServer) DeleteSubject(ctx context.Context, req *DeleteSubjectRequest) (*DeleteSubjectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteSubject not implemented")
+}
+func (*UnimplementedCertServiceServer) RestoreSubject(ctx context.Context, req *RestoreSubjectRequest) (*RestoreSubjectResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreSubject not implemented")
+}
+func (*UnimplementedCertServiceServer) GetExpiringSubject(req *GetExpiringSubjectsRequest, srv CertService_GetExpiringSubjectServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetExpiringSubject not implemented")
+}
+func (*UnimplementedCertServiceServer) RenewSubjects(req *RenewSubjectRequest, srv CertService_RenewSubjectsServer) error {
+	return status.Errorf(codes.Unimplemented, "method RenewSubjects not implemented")
+}
+func (*UnimplementedCertServiceServer) ListSubjects(ctx context.Context, req *ListSubjectsRequest) (*ListSubjectsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSubjects not implemented")
+}
+func (*UnimplementedCertServiceServer) GetSubjectHistory(req *GetSubjectHistoryRequest, srv CertService_GetSubjectHistoryServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetSubjectHistory not implemented")
+}
+func (*UnimplementedCertServiceServer) GetToken(ctx context.Context, req *GetTokenRequest) (*GetTokenResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetToken not implemented")
+}
+func (*UnimplementedCertServiceServer) GetAuditLog(req *GetAuditLogRequest, srv CertService_GetAuditLogServer) error {
+	return status.Errorf(codes.Unimplemented, "method GetAuditLog not implemented")
+}
+func (*UnimplementedCertServiceServer) MigrateSchema(req *MigrateSchemaRequest, srv CertService_MigrateSchemaServer) error {
+	return status.Errorf(codes.Unimplemented, "method MigrateSchema not implemented")
+}
+func (*UnimplementedCertServiceServer) ExportSubjects(req *ExportSubjectsRequest, srv CertService_ExportSubjectsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ExportSubjects not implemented")
+}
+func (*UnimplementedCertServiceServer) ImportSubjects(srv CertService_ImportSubjectsServer) error {
+	return status.Errorf(codes.Unimplemented, "method ImportSubjects not implemented")
+}
+func (*UnimplementedCertServiceServer) RewrapKeys(ctx context.Context, req *RewrapKeysRequest) (*RewrapKeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RewrapKeys not implemented")
+}
+func (*UnimplementedCertServiceServer) ListDeadLetters(req *ListDeadLettersRequest, srv CertService_ListDeadLettersServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListDeadLetters not implemented")
+}
+func (*UnimplementedCertServiceServer) ReplayDeadLetters(ctx context.Context, req *ReplayDeadLettersRequest) (*ReplayDeadLettersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReplayDeadLetters not implemented")
+}
+func (*UnimplementedCertServiceServer) PurgeDeadLetters(ctx context.Context, req *PurgeDeadLettersRequest) (*PurgeDeadLettersResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PurgeDeadLetters not implemented")
+}
+func (*UnimplementedCertServiceServer) ResolveEnrollment(ctx context.Context, req *ResolveEnrollmentRequest) (*ResolveEnrollmentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ResolveEnrollment not implemented")
 }
 
 func RegisterCertServiceServer(s *grpc.Server, srv CertServiceServer) {
@@ -1208,6 +3451,24 @@ func _CertService_DeleteSubject_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CertService_RestoreSubject_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreSubjectRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertServiceServer).RestoreSubject(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/londoapi.v1.CertService/RestoreSubject",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertServiceServer).RestoreSubject(ctx, req.(*RestoreSubjectRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _CertService_GetExpiringSubject_Handler(srv interface{}, stream grpc.ServerStream) error {
 	m := new(GetExpiringSubjectsRequest)
 	if err := stream.RecvMsg(m); err != nil {
@@ -1250,6 +3511,45 @@ func (x *certServiceRenewSubjectsServer) Send(m *RenewResponse) error {
 	return x.ServerStream.SendMsg(m)
 }
 
+func _CertService_ListSubjects_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSubjectsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertServiceServer).ListSubjects(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/londoapi.v1.CertService/ListSubjects",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertServiceServer).ListSubjects(ctx, req.(*ListSubjectsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CertService_GetSubjectHistory_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetSubjectHistoryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CertServiceServer).GetSubjectHistory(m, &certServiceGetSubjectHistoryServer{stream})
+}
+
+type CertService_GetSubjectHistoryServer interface {
+	Send(*GetSubjectHistoryResponse) error
+	grpc.ServerStream
+}
+
+type certServiceGetSubjectHistoryServer struct {
+	grpc.ServerStream
+}
+
+func (x *certServiceGetSubjectHistoryServer) Send(m *GetSubjectHistoryResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 func _CertService_GetToken_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(GetTokenRequest)
 	if err := dec(in); err != nil {
@@ -1268,6 +3568,188 @@ func _CertService_GetToken_Handler(srv interface{}, ctx context.Context, dec fun
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CertService_GetAuditLog_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetAuditLogRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CertServiceServer).GetAuditLog(m, &certServiceGetAuditLogServer{stream})
+}
+
+type CertService_GetAuditLogServer interface {
+	Send(*GetAuditLogResponse) error
+	grpc.ServerStream
+}
+
+type certServiceGetAuditLogServer struct {
+	grpc.ServerStream
+}
+
+func (x *certServiceGetAuditLogServer) Send(m *GetAuditLogResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CertService_MigrateSchema_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(MigrateSchemaRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CertServiceServer).MigrateSchema(m, &certServiceMigrateSchemaServer{stream})
+}
+
+type CertService_MigrateSchemaServer interface {
+	Send(*MigrateSchemaResponse) error
+	grpc.ServerStream
+}
+
+type certServiceMigrateSchemaServer struct {
+	grpc.ServerStream
+}
+
+func (x *certServiceMigrateSchemaServer) Send(m *MigrateSchemaResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CertService_ExportSubjects_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ExportSubjectsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CertServiceServer).ExportSubjects(m, &certServiceExportSubjectsServer{stream})
+}
+
+type CertService_ExportSubjectsServer interface {
+	Send(*ExportSubjectsResponse) error
+	grpc.ServerStream
+}
+
+type certServiceExportSubjectsServer struct {
+	grpc.ServerStream
+}
+
+func (x *certServiceExportSubjectsServer) Send(m *ExportSubjectsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CertService_ImportSubjects_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CertServiceServer).ImportSubjects(&certServiceImportSubjectsServer{stream})
+}
+
+type CertService_ImportSubjectsServer interface {
+	SendAndClose(*ImportSubjectsResponse) error
+	Recv() (*ImportSubjectsRequest, error)
+	grpc.ServerStream
+}
+
+type certServiceImportSubjectsServer struct {
+	grpc.ServerStream
+}
+
+func (x *certServiceImportSubjectsServer) SendAndClose(m *ImportSubjectsResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *certServiceImportSubjectsServer) Recv() (*ImportSubjectsRequest, error) {
+	m := new(ImportSubjectsRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _CertService_RewrapKeys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RewrapKeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertServiceServer).RewrapKeys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/londoapi.v1.CertService/RewrapKeys",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertServiceServer).RewrapKeys(ctx, req.(*RewrapKeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CertService_ListDeadLetters_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListDeadLettersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CertServiceServer).ListDeadLetters(m, &certServiceListDeadLettersServer{stream})
+}
+
+type CertService_ListDeadLettersServer interface {
+	Send(*ListDeadLettersResponse) error
+	grpc.ServerStream
+}
+
+type certServiceListDeadLettersServer struct {
+	grpc.ServerStream
+}
+
+func (x *certServiceListDeadLettersServer) Send(m *ListDeadLettersResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _CertService_ReplayDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReplayDeadLettersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertServiceServer).ReplayDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/londoapi.v1.CertService/ReplayDeadLetters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertServiceServer).ReplayDeadLetters(ctx, req.(*ReplayDeadLettersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CertService_PurgeDeadLetters_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeDeadLettersRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertServiceServer).PurgeDeadLetters(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/londoapi.v1.CertService/PurgeDeadLetters",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertServiceServer).PurgeDeadLetters(ctx, req.(*PurgeDeadLettersRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CertService_ResolveEnrollment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ResolveEnrollmentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CertServiceServer).ResolveEnrollment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/londoapi.v1.CertService/ResolveEnrollment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CertServiceServer).ResolveEnrollment(ctx, req.(*ResolveEnrollmentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _CertService_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "londoapi.v1.CertService",
 	HandlerType: (*CertServiceServer)(nil),
@@ -1284,10 +3766,34 @@ var _CertService_serviceDesc = grpc.ServiceDesc{
 			MethodName: "DeleteSubject",
 			Handler:    _CertService_DeleteSubject_Handler,
 		},
+		{
+			MethodName: "RestoreSubject",
+			Handler:    _CertService_RestoreSubject_Handler,
+		},
+		{
+			MethodName: "ListSubjects",
+			Handler:    _CertService_ListSubjects_Handler,
+		},
 		{
 			MethodName: "GetToken",
 			Handler:    _CertService_GetToken_Handler,
 		},
+		{
+			MethodName: "RewrapKeys",
+			Handler:    _CertService_RewrapKeys_Handler,
+		},
+		{
+			MethodName: "ReplayDeadLetters",
+			Handler:    _CertService_ReplayDeadLetters_Handler,
+		},
+		{
+			MethodName: "PurgeDeadLetters",
+			Handler:    _CertService_PurgeDeadLetters_Handler,
+		},
+		{
+			MethodName: "ResolveEnrollment",
+			Handler:    _CertService_ResolveEnrollment_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -1310,6 +3816,36 @@ var _CertService_serviceDesc = grpc.ServiceDesc{
 			Handler:       _CertService_RenewSubjects_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "GetSubjectHistory",
+			Handler:       _CertService_GetSubjectHistory_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "GetAuditLog",
+			Handler:       _CertService_GetAuditLog_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "MigrateSchema",
+			Handler:       _CertService_MigrateSchema_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ExportSubjects",
+			Handler:       _CertService_ExportSubjects_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ImportSubjects",
+			Handler:       _CertService_ImportSubjects_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ListDeadLetters",
+			Handler:       _CertService_ListDeadLetters_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "londopb/londo.proto",
 }
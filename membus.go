@@ -0,0 +1,589 @@
+package londo
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+var (
+	ErrExchangeNotFound = errors.New("exchange not found")
+	ErrQueueNotFound    = errors.New("queue not found")
+	ErrUnknownDelivery  = errors.New("unknown delivery tag")
+)
+
+// MemoryBus is a Bus which lives within a single process, so every londo role can run in one
+// process without RabbitMQ. Messages are lost once a process exits. Queues honour x-message-ttl,
+// message expiration, x-max-length and x-dead-letter-exchange, so retries through delay queues
+// and rate limits work as they do with RabbitMQ.
+type MemoryBus struct {
+	mu        sync.Mutex
+	exchanges map[string]string
+	bindings  map[string]map[string][]string
+	queues    map[string]*memQueue
+	closed    bool
+
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+type memQueue struct {
+	bus  *MemoryBus
+	name string
+	args amqp.Table
+	cond *sync.Cond
+
+	// a reply queue is consumed until Shutdown
+	reply bool
+
+	ready   []*memMessage
+	unacked map[uint64]*memMessage
+	owners  map[uint64]chan struct{}
+	tag     uint64
+}
+
+type memMessage struct {
+	exchange    string
+	key         string
+	msg         amqp.Publishing
+	redelivered bool
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{
+		exchanges: make(map[string]string),
+		bindings:  make(map[string]map[string][]string),
+		queues:    make(map[string]*memQueue),
+		stopping:  make(chan struct{}),
+	}
+}
+
+func (b *MemoryBus) DeclareExchange(exchange string, kind string) error {
+	if kind != amqp.ExchangeDirect {
+		return errors.New("unsupported exchange kind " + kind)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if k, ok := b.exchanges[exchange]; ok && k != kind {
+		return errors.New("exchange " + exchange + " is already declared as " + k)
+	}
+
+	log.WithFields(logrus.Fields{logger.Exchange: exchange}).Info("declaring")
+	b.exchanges[exchange] = kind
+
+	return nil
+}
+
+func (b *MemoryBus) Declare(exchange string, queue string, kind string, args amqp.Table) error {
+	if err := b.DeclareExchange(exchange, kind); err != nil {
+		return err
+	}
+
+	return b.declareQueue(exchange, queue, args)
+}
+
+func (b *MemoryBus) DeclareQueue(queue string, args amqp.Table) error {
+	return b.declareQueue("", queue, args)
+}
+
+func (b *MemoryBus) DeclareReplyQueue(exchange string, queue string) error {
+	if err := b.declareQueue(exchange, queue, nil); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	b.queues[queue].reply = true
+	b.mu.Unlock()
+
+	return nil
+}
+
+// declareQueue declares a queue, and binds it unless exchange is empty. A queue which is already
+// declared keeps its arguments.
+func (b *MemoryBus) declareQueue(exchange string, queue string, args amqp.Table) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.queues[queue]; !ok {
+		log.WithFields(logrus.Fields{logger.Queue: queue}).Info("declaring")
+
+		q := &memQueue{
+			bus:     b,
+			name:    queue,
+			args:    args,
+			unacked: make(map[uint64]*memMessage),
+			owners:  make(map[uint64]chan struct{}),
+		}
+		q.cond = sync.NewCond(&b.mu)
+
+		b.queues[queue] = q
+	}
+
+	if exchange == "" {
+		return nil
+	}
+
+	if _, ok := b.exchanges[exchange]; !ok {
+		return errors.New(ErrExchangeNotFound.Error() + ": " + exchange)
+	}
+
+	if b.bindings[exchange] == nil {
+		b.bindings[exchange] = make(map[string][]string)
+	}
+
+	for _, q := range b.bindings[exchange][queue] {
+		if q == queue {
+			return nil
+		}
+	}
+
+	log.WithFields(logrus.Fields{logger.Queue: queue}).Info("binding")
+	b.bindings[exchange][queue] = append(b.bindings[exchange][queue], queue)
+
+	return nil
+}
+
+// route finds queues a message goes to, the default exchange routes to a queue named by a key
+func (b *MemoryBus) route(exchange string, key string) ([]*memQueue, error) {
+	if exchange == "" {
+		if q, ok := b.queues[key]; ok {
+			return []*memQueue{q}, nil
+		}
+		return nil, nil
+	}
+
+	if _, ok := b.exchanges[exchange]; !ok {
+		return nil, errors.New(ErrExchangeNotFound.Error() + ": " + exchange)
+	}
+
+	var res []*memQueue
+	for _, name := range b.bindings[exchange][key] {
+		res = append(res, b.queues[name])
+	}
+
+	return res, nil
+}
+
+func (b *MemoryBus) Emit(exchange string, key string, msg amqp.Publishing) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrNotConnected
+	}
+
+	queues, err := b.route(exchange, key)
+	if err != nil {
+		return err
+	}
+
+	if len(queues) == 0 {
+		return errors.New(ErrUnroutable.Error() + ": " + exchange + "/" + key)
+	}
+
+	for _, q := range queues {
+		q.push(&memMessage{exchange: exchange, key: key, msg: msg})
+	}
+
+	return nil
+}
+
+// push appends a message to a queue, and expires it after a queue's x-message-ttl or its own
+// expiration. A queue over its x-max-length drops its oldest messages.
+func (q *memQueue) push(m *memMessage) {
+	q.ready = append(q.ready, m)
+	q.cond.Broadcast()
+
+	if max, ok := q.arg("x-max-length"); ok && len(q.ready) > int(max) {
+		q.ready = q.ready[len(q.ready)-int(max):]
+	}
+
+	ttl, ok := q.arg("x-message-ttl")
+	if e, err := strconv.ParseInt(m.msg.Expiration, 10, 64); err == nil && (!ok || e < ttl) {
+		ttl, ok = e, true
+	}
+
+	if !ok {
+		return
+	}
+
+	time.AfterFunc(time.Duration(ttl)*time.Millisecond, func() {
+		q.bus.mu.Lock()
+		defer q.bus.mu.Unlock()
+
+		if q.remove(m) {
+			q.deadLetter(m)
+		}
+	})
+}
+
+func (q *memQueue) arg(name string) (int64, bool) {
+	switch v := q.args[name].(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+// remove takes a message out of a queue, unless it has already been delivered
+func (q *memQueue) remove(m *memMessage) bool {
+	for i := range q.ready {
+		if q.ready[i] == m {
+			q.ready = append(q.ready[:i], q.ready[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+// deadLetter publishes an expired or rejected message to a queue's x-dead-letter-exchange,
+// a message is dropped when a queue has none
+func (q *memQueue) deadLetter(m *memMessage) {
+	exchange, ok := q.args["x-dead-letter-exchange"].(string)
+	if !ok {
+		return
+	}
+
+	key, ok := q.args["x-dead-letter-routing-key"].(string)
+	if !ok {
+		key = m.key
+	}
+
+	queues, err := q.bus.route(exchange, key)
+	if err != nil || len(queues) == 0 {
+		log.WithFields(logrus.Fields{logger.Queue: q.name, logger.Exchange: exchange, logger.Reason: err}).Warn(logger.Skip)
+		return
+	}
+
+	// a dead-lettered message doesn't expire again
+	msg := m.msg
+	msg.Expiration = ""
+
+	for _, dl := range queues {
+		dl.push(&memMessage{exchange: exchange, key: key, msg: msg})
+	}
+}
+
+// requeue puts messages back in front of a queue, in the order they were delivered
+func (q *memQueue) requeue(ms []*memMessage) {
+	for _, m := range ms {
+		m.redelivered = true
+	}
+
+	q.ready = append(ms, q.ready...)
+	q.cond.Broadcast()
+}
+
+// pop waits for the next message unless done is closed, and holds it for a consumer done belongs
+// to until it is acknowledged or rejected. A nil done doesn't wait.
+func (q *memQueue) pop(done chan struct{}) (amqp.Delivery, bool) {
+	for len(q.ready) == 0 && !q.bus.closed && done != nil && !isDone(done) {
+		q.cond.Wait()
+	}
+
+	if len(q.ready) == 0 || q.bus.closed || (done != nil && isDone(done)) {
+		return amqp.Delivery{}, false
+	}
+
+	m := q.ready[0]
+	q.ready = q.ready[1:]
+
+	q.tag++
+	q.unacked[q.tag] = m
+
+	if done != nil {
+		q.owners[q.tag] = done
+	}
+
+	return amqp.Delivery{
+		Acknowledger:    q,
+		Headers:         m.msg.Headers,
+		ContentType:     m.msg.ContentType,
+		ContentEncoding: m.msg.ContentEncoding,
+		DeliveryMode:    m.msg.DeliveryMode,
+		Priority:        m.msg.Priority,
+		CorrelationId:   m.msg.CorrelationId,
+		ReplyTo:         m.msg.ReplyTo,
+		Expiration:      m.msg.Expiration,
+		MessageId:       m.msg.MessageId,
+		Timestamp:       m.msg.Timestamp,
+		Type:            m.msg.Type,
+		UserId:          m.msg.UserId,
+		AppId:           m.msg.AppId,
+		DeliveryTag:     q.tag,
+		Redelivered:     m.redelivered,
+		Exchange:        m.exchange,
+		RoutingKey:      m.key,
+		Body:            m.msg.Body,
+	}, true
+}
+
+// settle takes messages up to a tag, or a single message, off the unacknowledged ones
+func (q *memQueue) settle(tag uint64, multiple bool) ([]*memMessage, error) {
+	if !multiple {
+		m, ok := q.unacked[tag]
+		if !ok {
+			return nil, ErrUnknownDelivery
+		}
+
+		delete(q.unacked, tag)
+		delete(q.owners, tag)
+		return []*memMessage{m}, nil
+	}
+
+	var tags []uint64
+	for t := range q.unacked {
+		if t <= tag {
+			tags = append(tags, t)
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	var res []*memMessage
+	for _, t := range tags {
+		res = append(res, q.unacked[t])
+		delete(q.unacked, t)
+		delete(q.owners, t)
+	}
+
+	return res, nil
+}
+
+// release requeues messages a consumer has left unacknowledged, as RabbitMQ does once a channel
+// of a consumer is closed
+func (q *memQueue) release(done chan struct{}) int {
+	var tags []uint64
+	for t, owner := range q.owners {
+		if owner == done {
+			tags = append(tags, t)
+		}
+	}
+
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	var ms []*memMessage
+	for _, t := range tags {
+		ms = append(ms, q.unacked[t])
+		delete(q.unacked, t)
+		delete(q.owners, t)
+	}
+
+	q.requeue(ms)
+	return len(ms)
+}
+
+func (q *memQueue) Ack(tag uint64, multiple bool) error {
+	q.bus.mu.Lock()
+	defer q.bus.mu.Unlock()
+
+	_, err := q.settle(tag, multiple)
+	return err
+}
+
+func (q *memQueue) Nack(tag uint64, multiple bool, requeue bool) error {
+	q.bus.mu.Lock()
+	defer q.bus.mu.Unlock()
+
+	ms, err := q.settle(tag, multiple)
+	if err != nil {
+		return err
+	}
+
+	if requeue {
+		q.requeue(ms)
+		return nil
+	}
+
+	for _, m := range ms {
+		q.deadLetter(m)
+	}
+
+	return nil
+}
+
+func (q *memQueue) Reject(tag uint64, requeue bool) error {
+	return q.Nack(tag, false, requeue)
+}
+
+func (b *MemoryBus) queue(name string) (*memQueue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		return nil, errors.New(ErrQueueNotFound.Error() + ": " + name)
+	}
+
+	return q, nil
+}
+
+// Consume hands deliveries to a pool's workers one at a time, so a prefetch makes no difference
+// within a process
+func (b *MemoryBus) Consume(queue string, p Pool, f func(d amqp.Delivery) bool) {
+	q, err := b.queue(queue)
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.Queue: queue, logger.Reason: err}).Error()
+		return
+	}
+
+	log.WithFields(logrus.Fields{logger.Queue: queue, logger.Workers: p.workers()}).Info("consuming")
+
+	var (
+		delivery = make(chan amqp.Delivery)
+		done     = make(chan struct{})
+	)
+
+	go func() {
+		defer close(delivery)
+
+		for {
+			b.mu.Lock()
+			d, ok := q.pop(done)
+			b.mu.Unlock()
+
+			if !ok {
+				return
+			}
+
+			select {
+			case delivery <- d:
+			case <-done:
+				d.Reject(true)
+				return
+			}
+		}
+	}()
+
+	cancel := func() {
+		close(done)
+
+		b.mu.Lock()
+		q.cond.Broadcast()
+		b.mu.Unlock()
+	}
+
+	stop := b.stopping
+	if q.reply {
+		stop = nil
+	}
+
+	if !work(p, delivery, stop, cancel, f) {
+		log.WithFields(logrus.Fields{logger.Queue: queue}).Debug("closed")
+	}
+
+	b.mu.Lock()
+	n := q.release(done)
+	b.mu.Unlock()
+
+	if n > 0 {
+		log.WithFields(logrus.Fields{logger.Queue: queue, logger.Count: n}).Warn(logger.Requeue)
+	}
+}
+
+func (b *MemoryBus) Drain(queue string, max int, f func(d *amqp.Delivery) bool) error {
+	q, err := b.queue(queue)
+	if err != nil {
+		return err
+	}
+
+	var kept []uint64
+
+	for n := 0; max <= 0 || n < max; n++ {
+		b.mu.Lock()
+		d, ok := q.pop(nil)
+		b.mu.Unlock()
+
+		if !ok {
+			break
+		}
+
+		if !f(&d) {
+			kept = append(kept, d.DeliveryTag)
+			continue
+		}
+
+		if err := d.Ack(false); err != nil {
+			return err
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var ms []*memMessage
+	for _, tag := range kept {
+		m, err := q.settle(tag, false)
+		if err != nil {
+			return err
+		}
+		ms = append(ms, m...)
+	}
+
+	q.requeue(ms)
+	return nil
+}
+
+func (b *MemoryBus) Count(queue string) (int, error) {
+	q, err := b.queue(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(q.ready), nil
+}
+
+func (b *MemoryBus) Purge(queue string) (int, error) {
+	q, err := b.queue(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(q.ready)
+	q.ready = nil
+
+	return n, nil
+}
+
+func (b *MemoryBus) Ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return !b.closed
+}
+
+func (b *MemoryBus) Stop() {
+	b.stopOnce.Do(func() { close(b.stopping) })
+}
+
+// Shutdown stops every consumer, messages which are still queued are lost
+func (b *MemoryBus) Shutdown() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+
+	for _, q := range b.queues {
+		q.cond.Broadcast()
+	}
+}
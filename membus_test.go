@@ -0,0 +1,349 @@
+package londo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestMemoryBusEmit(t *testing.T) {
+	tests := []struct {
+		name     string
+		exchange string
+		key      string
+		wantErr  bool
+	}{
+		{"bound queue", "test", "a", false},
+		{"default exchange", "", "a", false},
+		{"unbound key", "test", "missing", true},
+		{"unknown exchange", "missing", "a", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBus(t, "a")
+
+			err := b.Emit(tt.exchange, tt.key, amqp.Publishing{Body: []byte("x")})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Emit() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			want := 1
+			if tt.wantErr {
+				want = 0
+			}
+
+			if n := count(t, b, "a"); n != want {
+				t.Errorf("Count() = %d, want %d", n, want)
+			}
+		})
+	}
+}
+
+func TestMemoryBusSettle(t *testing.T) {
+	tests := []struct {
+		name      string
+		settle    func(d amqp.Delivery)
+		wantQueue int
+		wantDead  int
+	}{
+		{"ack", func(d amqp.Delivery) { d.Ack(false) }, 0, 0},
+		{"reject", func(d amqp.Delivery) { d.Reject(false) }, 0, 1},
+		{"nack", func(d amqp.Delivery) { d.Nack(false, false) }, 0, 1},
+		{"requeue", func(d amqp.Delivery) { d.Reject(true) }, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBus(t, "dead")
+			if err := b.Declare("test", "a", amqp.ExchangeDirect, amqp.Table{
+				"x-dead-letter-exchange":    "test",
+				"x-dead-letter-routing-key": "dead",
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			emit(t, b, "a", "x")
+
+			tt.settle(get(t, b, "a"))
+
+			if n := count(t, b, "a"); n != tt.wantQueue {
+				t.Errorf("queue has %d, want %d", n, tt.wantQueue)
+			}
+
+			if n := count(t, b, "dead"); n != tt.wantDead {
+				t.Errorf("dead letters have %d, want %d", n, tt.wantDead)
+			}
+		})
+	}
+}
+
+func TestMemoryBusConsumeRequeue(t *testing.T) {
+	b := newTestBus(t, "a")
+	defer b.Shutdown()
+
+	emit(t, b, "a", "x")
+
+	var first = true
+	got, _ := consumeAsync(b, "a", func(d amqp.Delivery) {
+		if first {
+			first = false
+			d.Reject(true)
+			return
+		}
+		d.Ack(false)
+	})
+
+	if d := next(t, got); d.Redelivered {
+		t.Error("first delivery is marked redelivered")
+	}
+
+	d := next(t, got)
+	if !d.Redelivered {
+		t.Error("requeued delivery isn't marked redelivered")
+	}
+
+	if string(d.Body) != "x" {
+		t.Errorf("body = %q, want %q", d.Body, "x")
+	}
+}
+
+func TestMemoryBusDelayQueue(t *testing.T) {
+	b := newTestBus(t, "a")
+	defer b.Shutdown()
+
+	if err := b.DeclareQueue("a.delay", amqp.Table{
+		"x-message-ttl":             int64(50),
+		"x-dead-letter-exchange":    "test",
+		"x-dead-letter-routing-key": "a",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, _ := consumeAsync(b, "a", func(d amqp.Delivery) { d.Ack(false) })
+
+	sent := time.Now()
+	if err := b.Emit("", "a.delay", amqp.Publishing{Body: []byte("later")}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := next(t, got)
+	if waited := time.Since(sent); waited < 50*time.Millisecond {
+		t.Errorf("delivered after %s, before a delay of 50ms", waited)
+	}
+
+	if string(d.Body) != "later" || d.RoutingKey != "a" {
+		t.Errorf("got %q through %q, want %q through %q", d.Body, d.RoutingKey, "later", "a")
+	}
+
+	if n := count(t, b, "a.delay"); n != 0 {
+		t.Errorf("delay queue has %d, want 0", n)
+	}
+}
+
+func TestMemoryBusExpiration(t *testing.T) {
+	b := newTestBus(t, "a")
+
+	if err := b.Emit("test", "a", amqp.Publishing{Body: []byte("x"), Expiration: "10"}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	if n := count(t, b, "a"); n != 0 {
+		t.Errorf("expired message is still queued, count = %d", n)
+	}
+}
+
+func TestMemoryBusMaxLength(t *testing.T) {
+	b := NewMemoryBus()
+	if err := b.Declare("test", "a", amqp.ExchangeDirect, amqp.Table{"x-max-length": int64(2)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"1", "2", "3"} {
+		emit(t, b, "a", body)
+	}
+
+	var bodies []string
+	if err := b.Drain("a", 0, func(d *amqp.Delivery) bool {
+		bodies = append(bodies, string(d.Body))
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bodies) != 2 || bodies[0] != "2" || bodies[1] != "3" {
+		t.Errorf("got %v, want [2 3]", bodies)
+	}
+}
+
+func TestMemoryBusCancelRequeuesUnacked(t *testing.T) {
+	b := newTestBus(t, "a")
+
+	emit(t, b, "a", "x")
+
+	// a consumer which never acknowledges, like a daemon stopped mid-way
+	got, done := consumeAsync(b, "a", func(d amqp.Delivery) {})
+	next(t, got)
+
+	if n := count(t, b, "a"); n != 0 {
+		t.Fatalf("unacked message is still ready, count = %d", n)
+	}
+
+	b.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("consumer didn't stop")
+	}
+
+	if n := count(t, b, "a"); n != 1 {
+		t.Fatalf("count = %d after a consumer stopped, want 1", n)
+	}
+
+	var redelivered bool
+	if err := b.Drain("a", 1, func(d *amqp.Delivery) bool {
+		redelivered = d.Redelivered
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !redelivered {
+		t.Error("requeued message isn't marked redelivered")
+	}
+}
+
+func TestMemoryBusDrainKeeps(t *testing.T) {
+	b := newTestBus(t, "a")
+
+	for _, body := range []string{"keep", "take", "keep"} {
+		emit(t, b, "a", body)
+	}
+
+	if err := b.Drain("a", 0, func(d *amqp.Delivery) bool {
+		return string(d.Body) == "take"
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if n := count(t, b, "a"); n != 2 {
+		t.Errorf("count = %d, want 2", n)
+	}
+}
+
+func TestMemoryBusDeclare(t *testing.T) {
+	b := newTestBus(t, "a")
+
+	tests := []struct {
+		name    string
+		declare func() error
+		wantErr bool
+	}{
+		{"same queue again", func() error { return b.Declare("test", "a", amqp.ExchangeDirect, nil) }, false},
+		{"another queue", func() error { return b.Declare("test", "b", amqp.ExchangeDirect, nil) }, false},
+		{"unsupported kind", func() error { return b.DeclareExchange("topic", amqp.ExchangeTopic) }, true},
+		{"reply queue of a missing exchange", func() error { return b.DeclareReplyQueue("missing", "reply") }, true},
+		{"unbound queue", func() error { return b.DeclareQueue("c", amqp.Table{"x-max-length": int64(1)}) }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.declare(); (err != nil) != tt.wantErr {
+				t.Errorf("declare error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// a queue declared again keeps its arguments
+	if err := b.DeclareQueue("c", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"1", "2"} {
+		if err := b.Emit("", "c", amqp.Publishing{Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := count(t, b, "c"); n != 1 {
+		t.Errorf("count = %d, want 1", n)
+	}
+}
+
+func TestMemoryBusPurge(t *testing.T) {
+	b := newTestBus(t, "a")
+
+	for _, body := range []string{"1", "2", "3"} {
+		emit(t, b, "a", body)
+	}
+
+	// a message being handled isn't purged
+	get(t, b, "a")
+
+	if n, err := b.Purge("a"); err != nil || n != 2 {
+		t.Errorf("Purge() = %d, %v, want 2", n, err)
+	}
+
+	if _, err := b.Purge("missing"); err == nil {
+		t.Error("Purge() of a missing queue succeeded")
+	}
+}
+
+func TestMemoryBusShutdown(t *testing.T) {
+	b := newTestBus(t, "a")
+
+	_, done := consumeAsync(b, "a", func(d amqp.Delivery) { d.Ack(false) })
+
+	if !b.Ready() {
+		t.Error("a new bus isn't ready")
+	}
+
+	b.Shutdown()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a consumer has not stopped")
+	}
+
+	if b.Ready() {
+		t.Error("a bus which is shut down is ready")
+	}
+}
+
+func TestMemoryBusStopReplies(t *testing.T) {
+	b := newTestBus(t, "a")
+
+	if err := b.DeclareReplyQueue("test", "replies"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, stopped := consumeAsync(b, "a", func(d amqp.Delivery) { d.Ack(false) })
+	got, done := consumeAsync(b, "replies", func(d amqp.Delivery) { d.Ack(false) })
+
+	b.Stop()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a consumer has not stopped")
+	}
+
+	// replies of calls still in progress come until a bus is shut down
+	emit(t, b, "replies", "late")
+	if d := next(t, got); string(d.Body) != "late" {
+		t.Errorf("got a reply %q, want %q", d.Body, "late")
+	}
+
+	b.Shutdown()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("a consumer of a reply queue has not stopped")
+	}
+}
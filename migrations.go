@@ -0,0 +1,222 @@
+package londo
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/sirupsen/logrus"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Migration changes raw subject documents to match the current Subject layout.
+// Apply must be idempotent and report whether a document has changed.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(doc bson.M) bool
+}
+
+// Migrations are applied in order, a new migration always goes to the end with the next version.
+var Migrations = []Migration{
+	{
+		Version:     1,
+		Description: "set match to false where it is missing",
+		Apply: func(doc bson.M) bool {
+			if _, ok := doc["match"]; ok {
+				return false
+			}
+
+			doc["match"] = false
+			return true
+		},
+	},
+	{
+		Version:     2,
+		Description: "set updated_at to created_at where it is missing",
+		Apply: func(doc bson.M) bool {
+			if _, ok := doc["updated_at"]; ok {
+				return false
+			}
+
+			c, ok := doc["created_at"]
+			if !ok {
+				return false
+			}
+
+			doc["updated_at"] = c
+			return true
+		},
+	},
+	{
+		Version:     3,
+		Description: "remove unresolvable_at holding zero time or null",
+		Apply: func(doc bson.M) bool {
+			v, ok := doc["unresolvable_at"]
+			if !ok {
+				return false
+			}
+
+			if v != nil && v != zeroDateTime {
+				return false
+			}
+
+			delete(doc, "unresolvable_at")
+			return true
+		},
+	},
+	{
+		Version:     4,
+		Description: "set revision to 0 where it is missing",
+		Apply: func(doc bson.M) bool {
+			if _, ok := doc["revision"]; ok {
+				return false
+			}
+
+			doc["revision"] = int64(0)
+			return true
+		},
+	},
+}
+
+// zeroDateTime is how an explicitly set zero time.Time is stored
+var zeroDateTime = primitive.DateTime(time.Time{}.Unix() * 1000)
+
+// MigrationReport tells which subjects a migration has changed, or would change on a dry run
+type MigrationReport struct {
+	Version     int
+	Description string
+	Subjects    []string
+	Applied     bool
+}
+
+func (MigrationReport) EventName() string {
+	return "db.migration"
+}
+
+type MigrateEvent struct {
+	DryRun bool
+}
+
+func (MigrateEvent) EventName() string {
+	return "db.migrate"
+}
+
+// migrateSubject applies migrations newer than from, up to to, to a single subject
+func migrateSubject(s *Subject, from int, to int) error {
+	raw, err := bson.Marshal(s)
+	if err != nil {
+		return err
+	}
+
+	var doc bson.M
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return err
+	}
+
+	var changed bool
+
+	for _, m := range Migrations {
+		if m.Version > from && m.Version <= to && m.Apply(doc) {
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if raw, err = bson.Marshal(doc); err != nil {
+		return err
+	}
+
+	var res Subject
+	if err := bson.Unmarshal(raw, &res); err != nil {
+		return err
+	}
+
+	*s = res
+	return nil
+}
+
+func LatestSchemaVersion() int {
+	return Migrations[len(Migrations)-1].Version
+}
+
+// Migrate applies every migration newer than a stored schema version. Schema version is updated
+// after each migration, so an interrupted run continues where it stopped. On a dry run, nothing is
+// written, and each migration is reported against documents as they are now.
+func (l *Londo) Migrate(dryRun bool) ([]MigrationReport, error) {
+	current, err := l.Db.SchemaVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	if current > LatestSchemaVersion() {
+		return nil, errors.New("database schema version " + strconv.Itoa(current) +
+			" is newer than supported " + strconv.Itoa(LatestSchemaVersion()))
+	}
+
+	var reports []MigrationReport
+
+	for _, m := range Migrations {
+		if m.Version <= current {
+			continue
+		}
+
+		subjs, err := l.Db.MigrateSubjects(m.Apply, dryRun)
+		if err != nil {
+			return reports, errors.New("migration " + strconv.Itoa(m.Version) + ": " + err.Error())
+		}
+
+		if !dryRun {
+			if err := l.Db.SetSchemaVersion(m.Version); err != nil {
+				return reports, err
+			}
+		}
+
+		reports = append(reports, MigrationReport{
+			Version:     m.Version,
+			Description: m.Description,
+			Subjects:    subjs,
+			Applied:     !dryRun,
+		})
+
+		log.WithFields(logrus.Fields{
+			logger.Version: m.Version,
+			logger.Count:   len(subjs),
+			logger.DryRun:  dryRun}).Info(m.Description)
+	}
+
+	return reports, nil
+}
+
+// CheckSchema runs pending migrations when migrate is set, otherwise it only warns about them.
+// A database with a newer schema than this build knows about is never touched.
+func (l *Londo) CheckSchema(migrate bool) *Londo {
+	current, err := l.Db.SchemaVersion()
+	Fail(err)
+
+	latest := LatestSchemaVersion()
+	fields := logrus.Fields{logger.Service: "db", logger.Version: current}
+
+	switch {
+	case current > latest:
+		Fail(errors.New("database schema version " + strconv.Itoa(current) +
+			" is newer than supported " + strconv.Itoa(latest)))
+
+	case current == latest:
+		log.WithFields(fields).Info("schema is up to date")
+
+	case migrate:
+		_, err := l.Migrate(false)
+		Fail(err)
+
+	default:
+		log.WithFields(fields).Warnf("%d pending migrations, run londo-admin db migrate", latest-current)
+	}
+
+	return l
+}
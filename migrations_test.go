@@ -0,0 +1,184 @@
+package londo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMigrationVersions(t *testing.T) {
+	for i, m := range Migrations {
+		if m.Version != i+1 {
+			t.Errorf("migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	created := primitive.NewDateTimeFromTime(time.Now())
+	later := primitive.NewDateTimeFromTime(time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name    string
+		version int
+		doc     bson.M
+		want    bson.M
+	}{
+		{"match missing", 1, bson.M{}, bson.M{"match": false}},
+		{"match set", 1, bson.M{"match": true}, bson.M{"match": true}},
+		{"updated_at missing", 2, bson.M{"created_at": created}, bson.M{"created_at": created, "updated_at": created}},
+		{"updated_at set", 2, bson.M{"created_at": created, "updated_at": later}, bson.M{"created_at": created, "updated_at": later}},
+		{"created_at missing", 2, bson.M{}, bson.M{}},
+		{"unresolvable_at zero", 3, bson.M{"unresolvable_at": zeroDateTime}, bson.M{}},
+		{"unresolvable_at null", 3, bson.M{"unresolvable_at": nil}, bson.M{}},
+		{"unresolvable_at set", 3, bson.M{"unresolvable_at": later}, bson.M{"unresolvable_at": later}},
+		{"revision missing", 4, bson.M{}, bson.M{"revision": int64(0)}},
+		{"revision set", 4, bson.M{"revision": int64(3)}, bson.M{"revision": int64(3)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Migrations[tt.version-1]
+			wantChanged := !reflect.DeepEqual(tt.doc, tt.want)
+
+			if changed := m.Apply(tt.doc); changed != wantChanged {
+				t.Errorf("Apply() = %t, want %t", changed, wantChanged)
+			}
+
+			if !reflect.DeepEqual(tt.doc, tt.want) {
+				t.Errorf("document = %v, want %v", tt.doc, tt.want)
+			}
+
+			// a migration which is run again changes nothing
+			if m.Apply(tt.doc) {
+				t.Error("second Apply() has changed a document")
+			}
+		})
+	}
+}
+
+func TestMigrateSubject(t *testing.T) {
+	prev := Migrations
+	t.Cleanup(func() { Migrations = prev })
+
+	// every migration adds its version to a port, so a port tells which ones have run
+	Migrations = nil
+	for v := 1; v <= 3; v++ {
+		v := v
+		Migrations = append(Migrations, Migration{Version: v, Apply: func(doc bson.M) bool {
+			doc["port"] = doc["port"].(int32) + int32(v*10)
+			return true
+		}})
+	}
+
+	tests := []struct {
+		name     string
+		from, to int
+		want     int32
+	}{
+		{"all", 0, 3, 61},
+		{"up to date", 3, 3, 1},
+		{"newer ones", 1, 3, 51},
+		{"older ones", 0, 2, 31},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &Subject{Subject: "a.example.com", Port: 1, CertID: 7}
+
+			if err := migrateSubject(s, tt.from, tt.to); err != nil {
+				t.Fatal(err)
+			}
+
+			if s.Port != tt.want || s.Subject != "a.example.com" || s.CertID != 7 {
+				t.Errorf("migrated subject = %s:%d as %d, want port %d", s.Subject, s.Port, s.CertID, tt.want)
+			}
+		})
+	}
+}
+
+// putLegacy stores a document the way an older release has written it
+func putLegacy(t *testing.T, db *BoltDB, doc bson.M) {
+	t.Helper()
+
+	id := primitive.NewObjectID()
+	doc["_id"] = id
+
+	raw, err := bson.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(subjBucket).Put([]byte(id.Hex()), raw)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	db := newTestBolt(t)
+	l := &Londo{Name: "test", Db: db}
+
+	created := primitive.NewDateTimeFromTime(time.Now())
+
+	putLegacy(t, db, bson.M{"subject": "a.example.com", "cert_id": 1, "created_at": created, "unresolvable_at": nil})
+	putLegacy(t, db, bson.M{"subject": "b.example.com", "cert_id": 2, "created_at": created, "updated_at": created,
+		"match": true, "revision": int64(2)})
+
+	want := []int{1, 1, 1, 1}
+
+	reports, err := l.Migrate(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := migrated(reports); !reflect.DeepEqual(got, want) {
+		t.Errorf("dry run would change %v subjects, want %v", got, want)
+	}
+
+	if v, _ := db.SchemaVersion(); v != 0 {
+		t.Errorf("schema version after a dry run = %d, want 0", v)
+	}
+
+	if reports, err = l.Migrate(false); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := migrated(reports); !reflect.DeepEqual(got, want) {
+		t.Errorf("migrations changed %v subjects, want %v", got, want)
+	}
+
+	if v, _ := db.SchemaVersion(); v != LatestSchemaVersion() {
+		t.Errorf("schema version = %d, want %d", v, LatestSchemaVersion())
+	}
+
+	s, err := db.FindSubject("a.example.com")
+	if err != nil || s.UpdatedAt.IsZero() || s.Revision != 0 {
+		t.Errorf("migrated subject = %+v, %v", s, err)
+	}
+
+	if reports, err = l.Migrate(false); err != nil || len(reports) != 0 {
+		t.Errorf("second run = %v, %v, want nothing to do", reports, err)
+	}
+
+	if err := db.SetSchemaVersion(LatestSchemaVersion() + 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Migrate(false); err == nil {
+		t.Error("a newer schema was migrated")
+	}
+}
+
+func migrated(reports []MigrationReport) []int {
+	var res []int
+	for _, r := range reports {
+		res = append(res, len(r.Subjects))
+	}
+	return res
+}
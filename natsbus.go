@@ -0,0 +1,757 @@
+package londo
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// NATSAckWait is how long JetStream waits for a delivery to be acknowledged before it sends
+	// it again. Deliveries which are still being handled are reported in progress meanwhile.
+	NATSAckWait = 30 * time.Second
+
+	natsPrefix  = "londo"
+	natsDurable = "londo"
+
+	// how long a consumer waits for messages before it looks whether it has to stop
+	natsFetchWait = 5 * time.Second
+
+	// how long Drain waits for more messages of a queue which looks empty
+	natsDrainWait  = 100 * time.Millisecond
+	natsDrainBatch = 64
+)
+
+// Message properties are kept in headers, as NATS messages have none
+const (
+	natsTypeHeader          = "Londo-Type"
+	natsContentTypeHeader   = "Londo-Content-Type"
+	natsEncodingHeader      = "Londo-Content-Encoding"
+	natsCorrelationIDHeader = "Londo-Correlation-Id"
+	natsReplyToHeader       = "Londo-Reply-To"
+	natsExpirationHeader    = "Londo-Expiration"
+	natsMessageIDHeader     = "Londo-Message-Id"
+	natsTimestampHeader     = "Londo-Timestamp"
+	natsAppIDHeader         = "Londo-App-Id"
+	natsHeadersHeader       = "Londo-Headers"
+)
+
+// NATS is a Bus over NATS JetStream. Every queue is a work queue stream with a durable consumer
+// shared by replicas of a daemon, and an exchange is a subject every queue bound to it listens on.
+// Queues with a dead letter exchange are delay queues, a daemon declaring one moves its messages
+// on once they expire. Reply queues of an exchange share a stream, each is read by a consumer
+// which is gone once its daemon is.
+type NATS struct {
+	nc     *nats.Conn
+	js     nats.JetStreamContext
+	config *Config
+
+	mu     sync.Mutex
+	queues map[string]natsQueue
+
+	stopping chan struct{}
+	stopOnce sync.Once
+}
+
+type natsQueue struct {
+	stream   string
+	consumer string
+	filter   string
+	reply    bool
+}
+
+func NewNATSConnection(c *Config) (*NATS, error) {
+	n := &NATS{
+		config:   c,
+		queues:   make(map[string]natsQueue),
+		stopping: make(chan struct{}),
+	}
+
+	opts := []nats.Option{
+		nats.Name(natsPrefix),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(MinReconnectDelay),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.WithFields(logrus.Fields{logger.Service: "nats", logger.Reason: err}).Error("disconnected")
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.WithFields(logrus.Fields{logger.Service: "nats", logger.IP: nc.ConnectedUrl()}).Info("reconnected")
+		}),
+	}
+
+	if c.NATS.Credentials != "" {
+		opts = append(opts, nats.UserCredentials(c.NATS.Credentials))
+	}
+
+	nc, err := nats.Connect(c.NATS.URL, opts...)
+	if err != nil {
+		return n, err
+	}
+
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return n, err
+	}
+
+	n.nc = nc
+	n.js = js
+
+	return n, nil
+}
+
+// subject is where a message published to an exchange with a routing key goes, the default
+// exchange routes to a queue named by a key
+func subject(exchange string, key string) string {
+	if exchange == "" {
+		exchange = "_"
+	}
+
+	return natsPrefix + "." + exchange + "." + key
+}
+
+// natsName makes a queue name usable as a stream or a consumer name
+func natsName(name string) string {
+	return natsPrefix + "_" + strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(name)
+}
+
+func replyStream(exchange string) string {
+	return natsName(exchange + ".replies")
+}
+
+func (n *NATS) replicas() int {
+	if n.config == nil || n.config.NATS.Replicas < 1 {
+		return 1
+	}
+
+	return n.config.NATS.Replicas
+}
+
+// queue tells where a queue lives, a queue which wasn't declared by this daemon is a plain queue
+func (n *NATS) queue(name string) natsQueue {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if q, ok := n.queues[name]; ok {
+		return q
+	}
+
+	return natsQueue{stream: natsName(name), consumer: natsDurable}
+}
+
+// DeclareExchange only logs, an exchange is nothing but subjects of queues bound to it
+func (n *NATS) DeclareExchange(exchange string, kind string) error {
+	if kind != amqp.ExchangeDirect {
+		return errors.New("unsupported exchange kind " + kind)
+	}
+
+	log.WithFields(logrus.Fields{logger.Exchange: exchange}).Info("declaring")
+	return nil
+}
+
+func (n *NATS) Declare(exchange string, queue string, kind string, args amqp.Table) error {
+	if err := n.DeclareExchange(exchange, kind); err != nil {
+		return err
+	}
+
+	return n.declareQueue(exchange, queue, args)
+}
+
+func (n *NATS) DeclareQueue(queue string, args amqp.Table) error {
+	return n.declareQueue("", queue, args)
+}
+
+// declareQueue declares a stream of a queue and its durable consumer, and binds it unless exchange
+// is empty. A queue which is already declared keeps its arguments, only new bindings are added.
+func (n *NATS) declareQueue(exchange string, queue string, args amqp.Table) error {
+	name := natsName(queue)
+	subjects := []string{subject("", queue)}
+
+	if exchange != "" {
+		subjects = append(subjects, subject(exchange, queue))
+	}
+
+	log.WithFields(logrus.Fields{logger.Queue: queue}).Info("declaring")
+
+	info, err := n.js.StreamInfo(name)
+
+	switch err {
+	case nats.ErrStreamNotFound:
+		sc := &nats.StreamConfig{
+			Name:      name,
+			Subjects:  subjects,
+			Retention: nats.WorkQueuePolicy,
+			Storage:   nats.FileStorage,
+			Discard:   nats.DiscardOld,
+			Replicas:  n.replicas(),
+		}
+
+		if max, ok := tableInt(args, "x-max-length"); ok {
+			sc.MaxMsgs = max
+		}
+
+		_, err = n.js.AddStream(sc)
+
+	case nil:
+		if missing := without(subjects, info.Config.Subjects); len(missing) != 0 {
+			log.WithFields(logrus.Fields{logger.Queue: queue}).Info("binding")
+
+			sc := info.Config
+			sc.Subjects = append(sc.Subjects, missing...)
+			_, err = n.js.UpdateStream(&sc)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := n.js.AddConsumer(name, &nats.ConsumerConfig{
+		Durable:       natsDurable,
+		AckPolicy:     nats.AckExplicitPolicy,
+		AckWait:       NATSAckWait,
+		MaxDeliver:    -1,
+		MaxAckPending: -1,
+	}); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	_, declared := n.queues[queue]
+	n.queues[queue] = natsQueue{stream: name, consumer: natsDurable}
+	n.mu.Unlock()
+
+	if !declared && isDelayQueue(args) {
+		go n.expire(queue, args)
+	}
+
+	return nil
+}
+
+// DeclareReplyQueue declares a consumer of an exchange's reply stream, which is dropped by
+// JetStream once it is inactive for ReplyTimeout, so a reply queue is gone with its daemon.
+// Replies nobody reads expire after ReplyTimeout too.
+func (n *NATS) DeclareReplyQueue(exchange string, queue string) error {
+	stream := replyStream(exchange)
+
+	log.WithFields(logrus.Fields{logger.Queue: queue}).Info("declaring")
+
+	_, err := n.js.StreamInfo(stream)
+	if err == nats.ErrStreamNotFound {
+		_, err = n.js.AddStream(&nats.StreamConfig{
+			Name:      stream,
+			Subjects:  []string{subject(exchange, ">")},
+			Retention: nats.WorkQueuePolicy,
+			Storage:   nats.MemoryStorage,
+			MaxAge:    ReplyTimeout,
+			Replicas:  n.replicas(),
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	consumer := natsName(queue)
+	filter := subject(exchange, queue)
+
+	if _, err := n.js.AddConsumer(stream, &nats.ConsumerConfig{
+		Durable:           consumer,
+		FilterSubject:     filter,
+		AckPolicy:         nats.AckExplicitPolicy,
+		AckWait:           NATSAckWait,
+		MaxDeliver:        -1,
+		InactiveThreshold: ReplyTimeout,
+	}); err != nil {
+		return err
+	}
+
+	n.mu.Lock()
+	n.queues[queue] = natsQueue{stream: stream, consumer: consumer, filter: filter, reply: true}
+	n.mu.Unlock()
+
+	return nil
+}
+
+func without(a []string, b []string) []string {
+	var res []string
+
+	for _, s := range a {
+		found := false
+		for _, t := range b {
+			if s == t {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			res = append(res, s)
+		}
+	}
+
+	return res
+}
+
+func tableInt(t amqp.Table, name string) (int64, bool) {
+	switch v := t[name].(type) {
+	case int64:
+		return v, true
+	case int32:
+		return int64(v), true
+	case int:
+		return int64(v), true
+	default:
+		return 0, false
+	}
+}
+
+func isDelayQueue(args amqp.Table) bool {
+	_, ttl := tableInt(args, "x-message-ttl")
+	_, dl := args["x-dead-letter-exchange"]
+
+	return ttl || dl
+}
+
+// Emit publishes a message, and waits until JetStream has stored it. A message no stream
+// listens for is unroutable.
+func (n *NATS) Emit(exchange string, key string, msg amqp.Publishing) error {
+	m, err := natsMsg(subject(exchange, key), msg)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.js.PublishMsg(m, nats.AckWait(ConfirmTimeout))
+
+	switch err {
+	case nil:
+		return nil
+	case nats.ErrNoStreamResponse:
+		return errors.New(ErrUnroutable.Error() + ": " + exchange + "/" + key)
+	case nats.ErrConnectionClosed, nats.ErrDisconnected:
+		return ErrNotConnected
+	case nats.ErrTimeout:
+		return ErrNoConfirm
+	default:
+		return err
+	}
+}
+
+// natsMsg keeps message properties in headers. Header values of a table are kept as JSON,
+// so integers are read back as integers.
+func natsMsg(subj string, msg amqp.Publishing) (*nats.Msg, error) {
+	m := nats.NewMsg(subj)
+	m.Data = msg.Body
+
+	set := func(name string, v string) {
+		if v != "" {
+			m.Header.Set(name, v)
+		}
+	}
+
+	set(natsTypeHeader, msg.Type)
+	set(natsContentTypeHeader, msg.ContentType)
+	set(natsEncodingHeader, msg.ContentEncoding)
+	set(natsCorrelationIDHeader, msg.CorrelationId)
+	set(natsReplyToHeader, msg.ReplyTo)
+	set(natsExpirationHeader, msg.Expiration)
+	set(natsMessageIDHeader, msg.MessageId)
+	set(natsAppIDHeader, msg.AppId)
+
+	if !msg.Timestamp.IsZero() {
+		set(natsTimestampHeader, msg.Timestamp.UTC().Format(time.RFC3339Nano))
+	}
+
+	if len(msg.Headers) != 0 {
+		b, err := json.Marshal(msg.Headers)
+		if err != nil {
+			return nil, err
+		}
+		set(natsHeadersHeader, string(b))
+	}
+
+	return m, nil
+}
+
+// delivery turns a JetStream message into a delivery, which is acknowledged through a
+// given acknowledger
+func delivery(m *nats.Msg, ack amqp.Acknowledger) amqp.Delivery {
+	d := amqp.Delivery{
+		Acknowledger:    ack,
+		DeliveryMode:    amqp.Persistent,
+		Type:            m.Header.Get(natsTypeHeader),
+		ContentType:     m.Header.Get(natsContentTypeHeader),
+		ContentEncoding: m.Header.Get(natsEncodingHeader),
+		CorrelationId:   m.Header.Get(natsCorrelationIDHeader),
+		ReplyTo:         m.Header.Get(natsReplyToHeader),
+		Expiration:      m.Header.Get(natsExpirationHeader),
+		MessageId:       m.Header.Get(natsMessageIDHeader),
+		AppId:           m.Header.Get(natsAppIDHeader),
+		Body:            m.Data,
+	}
+
+	if t, err := time.Parse(time.RFC3339Nano, m.Header.Get(natsTimestampHeader)); err == nil {
+		d.Timestamp = t
+	}
+
+	if h := m.Header.Get(natsHeadersHeader); h != "" {
+		dec := json.NewDecoder(bytes.NewReader([]byte(h)))
+		dec.UseNumber()
+
+		var t map[string]interface{}
+		if err := dec.Decode(&t); err == nil {
+			d.Headers = amqp.Table{}
+
+			for k, v := range t {
+				if num, ok := v.(json.Number); ok {
+					if i, err := num.Int64(); err == nil {
+						v = i
+					} else if f, err := num.Float64(); err == nil {
+						v = f
+					}
+				}
+				d.Headers[k] = v
+			}
+		}
+	}
+
+	if meta, err := m.Metadata(); err == nil {
+		d.DeliveryTag = meta.Sequence.Consumer
+		d.Redelivered = meta.NumDelivered > 1
+	}
+
+	if parts := strings.SplitN(m.Subject, ".", 3); len(parts) == 3 {
+		d.Exchange, d.RoutingKey = parts[1], parts[2]
+
+		if d.Exchange == "_" {
+			d.Exchange = ""
+		}
+	}
+
+	return d
+}
+
+// natsAck acknowledges a single JetStream message, and tells JetStream it is in progress until then
+type natsAck struct {
+	msg  *nats.Msg
+	done chan struct{}
+	once sync.Once
+}
+
+func newNATSAck(m *nats.Msg) *natsAck {
+	a := &natsAck{msg: m, done: make(chan struct{})}
+
+	go func() {
+		t := time.NewTicker(NATSAckWait / 3)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-t.C:
+				a.msg.InProgress()
+			case <-a.done:
+				return
+			}
+		}
+	}()
+
+	return a
+}
+
+func (a *natsAck) settle(f func() error) error {
+	err := ErrUnknownDelivery
+
+	a.once.Do(func() {
+		close(a.done)
+		err = f()
+	})
+
+	return err
+}
+
+func (a *natsAck) Ack(tag uint64, multiple bool) error {
+	return a.settle(func() error { return a.msg.Ack() })
+}
+
+// Nack without requeue drops a message, queues aren't dead-lettered on rejection
+func (a *natsAck) Nack(tag uint64, multiple bool, requeue bool) error {
+	if requeue {
+		return a.settle(func() error { return a.msg.Nak() })
+	}
+
+	return a.settle(func() error { return a.msg.Term() })
+}
+
+func (a *natsAck) Reject(tag uint64, requeue bool) error {
+	return a.Nack(tag, false, requeue)
+}
+
+func (n *NATS) subscribe(q natsQueue) (*nats.Subscription, error) {
+	return n.js.PullSubscribe(q.filter, q.consumer, nats.Bind(q.stream, q.consumer))
+}
+
+// Consume passes deliveries to a pool of workers running f, until f returns true. A pool's prefetch
+// is how many messages are fetched at once, as JetStream doesn't limit a single subscriber.
+func (n *NATS) Consume(queue string, p Pool, f func(d amqp.Delivery) bool) {
+	q := n.queue(queue)
+
+	sub, err := n.subscribe(q)
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.Queue: queue, logger.Reason: err}).Error()
+		return
+	}
+	defer sub.Unsubscribe()
+
+	log.WithFields(logrus.Fields{
+		logger.Queue: queue, logger.Workers: p.workers(), logger.Prefetch: p.Prefetch}).Info("consuming")
+
+	batch := p.Prefetch
+	if batch < 1 {
+		batch = p.workers()
+	}
+
+	var (
+		deliveries  = make(chan amqp.Delivery)
+		ctx, cancel = context.WithCancel(context.Background())
+	)
+
+	go func() {
+		defer close(deliveries)
+
+		for ctx.Err() == nil {
+			msgs, err := n.fetch(ctx, sub, batch)
+			if err != nil {
+				if n.nc.IsClosed() {
+					return
+				}
+
+				log.WithFields(logrus.Fields{logger.Queue: queue, logger.Reason: err}).Warn(logger.Lost)
+				time.Sleep(MinReconnectDelay)
+				continue
+			}
+
+			ds := make([]amqp.Delivery, len(msgs))
+			for i, m := range msgs {
+				ds[i] = delivery(m, newNATSAck(m))
+			}
+
+			for i := range ds {
+				select {
+				case deliveries <- ds[i]:
+				case <-ctx.Done():
+					for _, d := range ds[i:] {
+						d.Reject(true)
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	// a reply queue is consumed until Shutdown
+	stop := n.stopping
+	if q.reply {
+		stop = nil
+	}
+
+	if !work(p, deliveries, stop, cancel, f) {
+		log.WithFields(logrus.Fields{logger.Queue: queue}).Debug("closed")
+	}
+}
+
+// fetch waits for up to batch messages, no messages within natsFetchWait is no error
+func (n *NATS) fetch(ctx context.Context, sub *nats.Subscription, batch int) ([]*nats.Msg, error) {
+	ctx, cancel := context.WithTimeout(ctx, natsFetchWait)
+	defer cancel()
+
+	msgs, err := sub.Fetch(batch, nats.Context(ctx))
+	if err == context.DeadlineExceeded || err == context.Canceled || err == nats.ErrTimeout {
+		return msgs, nil
+	}
+
+	return msgs, err
+}
+
+// expire moves messages of a delay queue to its dead letter exchange once they expire after
+// x-message-ttl or their own expiration, whichever is sooner. Messages which aren't due yet
+// are put back until they are. A delay queue without a dead letter exchange drops them.
+func (n *NATS) expire(queue string, args amqp.Table) {
+	sub, err := n.subscribe(n.queue(queue))
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.Queue: queue, logger.Reason: err}).Error()
+		return
+	}
+	defer sub.Unsubscribe()
+
+	ttl, hasTTL := tableInt(args, "x-message-ttl")
+	exchange, dl := args["x-dead-letter-exchange"].(string)
+
+	key, ok := args["x-dead-letter-routing-key"].(string)
+	if !ok {
+		key = queue
+	}
+
+	for !n.nc.IsClosed() {
+		msgs, err := n.fetch(context.Background(), sub, natsDrainBatch)
+		if err != nil {
+			if !n.nc.IsClosed() {
+				log.WithFields(logrus.Fields{logger.Queue: queue, logger.Reason: err}).Warn(logger.Lost)
+				time.Sleep(MinReconnectDelay)
+			}
+			continue
+		}
+
+		for _, m := range msgs {
+			meta, err := m.Metadata()
+			if err != nil {
+				m.Term()
+				continue
+			}
+
+			expires, ok := ttl, hasTTL
+			if e, err := strconv.ParseInt(m.Header.Get(natsExpirationHeader), 10, 64); err == nil && (!ok || e < expires) {
+				expires, ok = e, true
+			}
+
+			// a message which never expires stays, and is looked at again once in a while
+			if !ok {
+				m.NakWithDelay(MaxReconnectDelay)
+				continue
+			}
+
+			if wait := time.Until(meta.Timestamp.Add(time.Duration(expires) * time.Millisecond)); wait > 0 {
+				m.NakWithDelay(wait)
+				continue
+			}
+
+			if !dl {
+				m.Term()
+				continue
+			}
+
+			// a dead-lettered message doesn't expire again
+			d := delivery(m, nil)
+			msg := publishing(&d)
+			msg.Expiration = ""
+
+			if err := n.Emit(exchange, key, msg); err != nil {
+				log.WithFields(logrus.Fields{logger.Queue: queue, logger.Exchange: exchange, logger.Reason: err}).Warn(logger.Skip)
+				m.NakWithDelay(MinReconnectDelay)
+				continue
+			}
+
+			m.Ack()
+		}
+	}
+}
+
+// Drain gets up to max messages from a queue, zero max is all of them. A message is acknowledged
+// when f returns true, otherwise it is put back once all messages are read.
+func (n *NATS) Drain(queue string, max int, f func(d *amqp.Delivery) bool) error {
+	sub, err := n.subscribe(n.queue(queue))
+	if err != nil {
+		return err
+	}
+	defer sub.Unsubscribe()
+
+	var (
+		kept  []*nats.Msg
+		count int
+	)
+
+	defer func() {
+		for _, m := range kept {
+			m.Nak()
+		}
+	}()
+
+	for max <= 0 || count < max {
+		batch := natsDrainBatch
+		if max > 0 && max-count < batch {
+			batch = max - count
+		}
+
+		msgs, err := sub.Fetch(batch, nats.MaxWait(natsDrainWait))
+		if err == nats.ErrTimeout {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if len(msgs) == 0 {
+			return nil
+		}
+
+		for _, m := range msgs {
+			count++
+
+			d := delivery(m, nil)
+			if !f(&d) {
+				kept = append(kept, m)
+				continue
+			}
+
+			if err := m.Ack(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Count tells how many messages a queue holds. JetStream doesn't tell messages which were put
+// back from those being handled, so both are counted.
+func (n *NATS) Count(queue string) (int, error) {
+	si, err := n.js.StreamInfo(n.queue(queue).stream)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(si.State.Msgs), nil
+}
+
+func (n *NATS) Purge(queue string) (int, error) {
+	q := n.queue(queue)
+
+	si, err := n.js.StreamInfo(q.stream)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(si.State.Msgs), n.js.PurgeStream(q.stream)
+}
+
+func (n *NATS) Ready() bool {
+	return n.nc != nil && n.nc.IsConnected()
+}
+
+func (n *NATS) Stop() {
+	n.stopOnce.Do(func() { close(n.stopping) })
+}
+
+// Shutdown drops reply queues of a daemon and closes its connection. Unacknowledged deliveries
+// are sent again to other replicas.
+func (n *NATS) Shutdown() {
+	n.mu.Lock()
+	for _, q := range n.queues {
+		if q.reply {
+			n.js.DeleteConsumer(q.stream, q.consumer)
+		}
+	}
+	n.mu.Unlock()
+
+	n.nc.Close()
+}
@@ -0,0 +1,218 @@
+package londo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/streadway/amqp"
+)
+
+// startNATS starts an embedded JetStream server, which is shut down with a test
+func startNATS(t *testing.T) *server.Server {
+	t.Helper()
+
+	s, err := server.NewServer(&server.Options{Host: "127.0.0.1", Port: -1, JetStream: true, StoreDir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go s.Start()
+	t.Cleanup(s.Shutdown)
+
+	if !s.ReadyForConnections(5 * time.Second) {
+		t.Fatal("nats server isn't ready")
+	}
+
+	return s
+}
+
+// natsBus connects to a server like a separate daemon would
+func natsBus(t *testing.T, s *server.Server) *NATS {
+	t.Helper()
+
+	c := &Config{}
+	c.NATS.URL = s.ClientURL()
+
+	n, err := NewNATSConnection(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(n.Shutdown)
+
+	return n
+}
+
+func natsConsume(n *NATS, queue string, f func(d amqp.Delivery)) <-chan amqp.Delivery {
+	got := make(chan amqp.Delivery, 16)
+
+	go n.Consume(queue, Single, func(d amqp.Delivery) bool {
+		f(d)
+		got <- d
+		return false
+	})
+
+	return got
+}
+
+func natsNext(t *testing.T, got <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+
+	select {
+	case d := <-got:
+		return d
+	case <-time.After(10 * time.Second):
+		t.Fatal("no delivery")
+		return amqp.Delivery{}
+	}
+}
+
+func TestNATSAck(t *testing.T) {
+	n := natsBus(t, startNATS(t))
+	defer n.Stop()
+
+	if err := n.Declare("test", "a", amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// a queue is declared by every replica of a daemon
+	if err := n.Declare("test", "a", amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Emit("test", "missing", amqp.Publishing{Body: []byte("x")}); err == nil {
+		t.Error("a message nobody listens for was published")
+	}
+
+	msg := amqp.Publishing{
+		Type:          DbGetSubjectCmd,
+		CorrelationId: "1",
+		ReplyTo:       "replies",
+		Headers:       amqp.Table{VersionHeader: int32(2)},
+		Body:          []byte("x"),
+	}
+
+	if err := n.Emit("test", "a", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	d := natsNext(t, natsConsume(n, "a", func(d amqp.Delivery) { d.Ack(false) }))
+
+	if string(d.Body) != "x" || d.Type != msg.Type || d.CorrelationId != "1" || d.ReplyTo != "replies" {
+		t.Errorf("properties weren't kept: %+v", d)
+	}
+
+	if v, ok := tableInt(d.Headers, VersionHeader); !ok || v != 2 {
+		t.Errorf("%s = %#v, want 2", VersionHeader, d.Headers[VersionHeader])
+	}
+
+	waitFor(t, "an acknowledged message to be gone", func() bool {
+		c, err := n.Count("a")
+		return err == nil && c == 0
+	})
+}
+
+func TestNATSRedelivery(t *testing.T) {
+	n := natsBus(t, startNATS(t))
+	defer n.Stop()
+
+	if err := n.Declare("test", "a", amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.Emit("test", "a", amqp.Publishing{Body: []byte("x")}); err != nil {
+		t.Fatal(err)
+	}
+
+	var first = true
+	got := natsConsume(n, "a", func(d amqp.Delivery) {
+		if first {
+			first = false
+			d.Reject(true)
+			return
+		}
+		d.Ack(false)
+	})
+
+	if d := natsNext(t, got); d.Redelivered {
+		t.Error("first delivery is marked redelivered")
+	}
+
+	if d := natsNext(t, got); !d.Redelivered || string(d.Body) != "x" {
+		t.Errorf("redelivered %t %q, want a redelivery of %q", d.Redelivered, d.Body, "x")
+	}
+}
+
+func TestNATSDelayQueue(t *testing.T) {
+	n := natsBus(t, startNATS(t))
+	defer n.Stop()
+
+	if err := n.Declare("test", "a", amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := n.DeclareQueue("a.delay", amqp.Table{
+		"x-message-ttl":             int64(500),
+		"x-dead-letter-exchange":    "test",
+		"x-dead-letter-routing-key": "a",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	got := natsConsume(n, "a", func(d amqp.Delivery) { d.Ack(false) })
+
+	sent := time.Now()
+	if err := n.Emit("", "a.delay", amqp.Publishing{Body: []byte("later")}); err != nil {
+		t.Fatal(err)
+	}
+
+	d := natsNext(t, got)
+	if waited := time.Since(sent); waited < 500*time.Millisecond {
+		t.Errorf("delivered after %s, before a delay of 500ms", waited)
+	}
+
+	if string(d.Body) != "later" {
+		t.Errorf("body = %q, want %q", d.Body, "later")
+	}
+}
+
+func TestNATSDrain(t *testing.T) {
+	n := natsBus(t, startNATS(t))
+
+	if err := n.Declare("test", "a", amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{"keep", "take", "keep"} {
+		if err := n.Emit("test", "a", amqp.Publishing{Body: []byte(body)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seen int
+	if err := n.Drain("a", 0, func(d *amqp.Delivery) bool {
+		seen++
+		return string(d.Body) == "take"
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if seen != 3 {
+		t.Errorf("drained %d messages, want 3", seen)
+	}
+
+	waitFor(t, "kept messages", func() bool {
+		c, err := n.Count("a")
+		return err == nil && c == 2
+	})
+}
+
+func TestNATSRequestReply(t *testing.T) {
+	s := startNATS(t)
+	testRequestReply(t, natsBus(t, s), natsBus(t, s))
+}
+
+func TestNATSEnrollPipeline(t *testing.T) {
+	s := startNATS(t)
+	testEnrollPipeline(t, natsBus(t, s), natsBus(t, s))
+}
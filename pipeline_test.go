@@ -0,0 +1,457 @@
+package londo
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// fakeCA issues self-signed certificates, it counts calls so tests can tell what was ordered
+type fakeCA struct {
+	mu        sync.Mutex
+	certs     map[int]string
+	csrs      []string
+	enrolled  int
+	collected int
+
+	// lost fails the next order once a certificate is issued, like a response which never arrived
+	lost error
+}
+
+func newFakeCA() *fakeCA {
+	return &fakeCA{certs: make(map[int]string)}
+}
+
+func (c *fakeCA) Enroll(s *Subject) (Order, error) {
+	cert, err := selfSigned(s.Subject)
+	if err != nil {
+		return Order{}, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.enrolled++
+	id := c.enrolled
+	c.certs[id] = cert
+	c.csrs = append(c.csrs, s.CSR)
+
+	if err := c.lost; err != nil {
+		c.lost = nil
+		return Order{}, err
+	}
+
+	return Order{CertID: id, OrderID: "order-" + s.Subject}, nil
+}
+
+func (c *fakeCA) Collect(certId int) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cert, ok := c.certs[certId]
+	if !ok {
+		return "", caError(404, "unknown certificate")
+	}
+
+	c.collected++
+	return cert, nil
+}
+
+func (c *fakeCA) Renew(certId int) (Order, error) {
+	return Order{}, caError(400, "not supported")
+}
+
+func (c *fakeCA) Revoke(certId int, reason string) error {
+	return nil
+}
+
+func (c *fakeCA) List() ([]IssuedCert, error) {
+	return nil, nil
+}
+
+func (c *fakeCA) Stop() {}
+
+func (c *fakeCA) calls() (int, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.enrolled, c.collected
+}
+
+func selfSigned(cn string) (string, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     []string{cn},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: PublicKeyType, Bytes: der})), nil
+}
+
+// startEnrollPipeline runs londo-dbd on one bus, and londo-enrolld with londo-collectd on another.
+// Both are stopped with a test.
+func startEnrollPipeline(t *testing.T, dbBus Bus, daemonBus Bus, ca CAProvider) (*BoltDB, *Londo) {
+	t.Helper()
+
+	withConfig(t, &Config{CertParams: CertParams{BitSize: 1024}})
+
+	db := newTestBolt(t)
+
+	declarePipeline(t, dbBus)
+	declarePipeline(t, daemonBus)
+
+	dbd := &Londo{Name: "londo-dbd", Db: db, Bus: dbBus}
+	dbd.ConsumeDbRPC()
+	t.Cleanup(func() { stopDaemon(dbd) })
+
+	d := &Londo{Name: "londo-enrolld", Bus: daemonBus, CA: ca}
+	d.DeclareRetries(EnrollQueue).DeclareRetries(CollectQueue).RPCClient().ConsumeEnroll().ConsumeCollect()
+	t.Cleanup(func() { stopDaemon(d) })
+
+	return db, d
+}
+
+// testEnrollPipeline checks that an enroll request ends with a stored certificate, and that
+// a redelivered request isn't ordered again
+func testEnrollPipeline(t *testing.T, dbBus Bus, daemonBus Bus) {
+	ca := newFakeCA()
+	db, d := startEnrollPipeline(t, dbBus, daemonBus, ca)
+
+	e := EnrollEvent{Subject: "a.example.com", Port: 443, Targets: []string{"10.0.0.1"}, Key: newID()}
+	if err := d.Publish(EnrollExchange, EnrollQueue, "", "", e); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		s   Subject
+		err error
+	)
+	waitFor(t, "a certificate", func() bool {
+		s, err = db.FindSubject(e.Subject)
+		return err == nil && s.Certificate != ""
+	})
+
+	if s.CertID != 1 || s.PrivateKey == "" || s.CSR == "" || s.Serial == "" {
+		t.Errorf("stored subject is incomplete: cert id %d, key %t, csr %t, serial %q",
+			s.CertID, s.PrivateKey != "", s.CSR != "", s.Serial)
+	}
+
+	enr, err := db.FindEnrollment(e.Subject)
+	if err != nil || enr.State != EnrollOrdered || enr.CertID != s.CertID {
+		t.Errorf("enrollment = %+v, %v, want ordered as cert id %d", enr, err, s.CertID)
+	}
+
+	// a redelivered request only has its certificate collected again
+	if err := d.Publish(EnrollExchange, EnrollQueue, "", "", e); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "a second collect", func() bool {
+		_, collected := ca.calls()
+		return collected >= 2
+	})
+
+	if enrolled, _ := ca.calls(); enrolled != 1 {
+		t.Errorf("a certificate was ordered %d times, want once", enrolled)
+	}
+}
+
+// testRequestReply asks londo-dbd on one bus through an RPC client on another
+func testRequestReply(t *testing.T, dbBus Bus, clientBus Bus) {
+	db := newTestBolt(t)
+
+	declarePipeline(t, dbBus)
+	declarePipeline(t, clientBus)
+
+	dbd := &Londo{Name: "londo-dbd", Db: db, Bus: dbBus}
+	dbd.ConsumeDbRPC()
+	defer stopDaemon(dbd)
+
+	c := &Londo{Name: "londo-grpcd", Bus: clientBus}
+	c.RPCClient()
+	defer stopDaemon(c)
+
+	var s Subject
+	if err := c.call(DbGetSubjectCmd, GetSubjectEvent{Subject: "a.example.com"}, &s); !IsNotFound(err) {
+		t.Errorf("get of a missing subject = %v, want not found", err)
+	}
+
+	var r ClaimEnrollReply
+	if err := c.call(DbClaimEnrollCmd, ClaimEnrollEvent{Subject: "a.example.com", Key: "k1"}, &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Outcome != ClaimProceed {
+		t.Errorf("first claim = %q, want %q", r.Outcome, ClaimProceed)
+	}
+
+	if err := c.call(DbClaimEnrollCmd, ClaimEnrollEvent{Subject: "a.example.com", Key: "k2"}, &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Outcome != ClaimDuplicate {
+		t.Errorf("claim of another request = %q, want %q", r.Outcome, ClaimDuplicate)
+	}
+}
+
+func TestMemoryBusEnrollPipeline(t *testing.T) {
+	b := NewMemoryBus()
+	testEnrollPipeline(t, b, b)
+}
+
+func TestMemoryBusRequestReply(t *testing.T) {
+	b := NewMemoryBus()
+	testRequestReply(t, b, b)
+}
+
+// TestMemoryBusEnrollInDoubt orders a request whose response is lost, so it is dead-lettered in doubt.
+// Once an operator resolves it, a replay either orders the same CSR again, or records the certificate
+// a CA has issued.
+func TestMemoryBusEnrollInDoubt(t *testing.T) {
+	tests := []struct {
+		name         string
+		certId       int
+		wantState    string
+		wantEnrolled int
+	}{
+		{"not ordered", 0, EnrollReleased, 2},
+		{"ordered", 1, EnrollOrdered, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBus()
+			ca := newFakeCA()
+			ca.lost = caError(502, "bad gateway")
+
+			db, d := startEnrollPipeline(t, b, b, ca)
+
+			e := EnrollEvent{Subject: "a.example.com", Port: 443, Key: newID()}
+			if err := d.Publish(EnrollExchange, EnrollQueue, "", "", e); err != nil {
+				t.Fatal(err)
+			}
+
+			waitFor(t, "a dead letter", func() bool {
+				return count(t, b, DeadLetterQueue(EnrollQueue)) == 1
+			})
+
+			enr, err := db.FindEnrollment(e.Subject)
+			if err != nil || enr.State != EnrollPending || enr.CSR == "" || enr.PrivateKey == "" {
+				t.Fatalf("enrollment = %+v, %v, want pending with a key and a CSR", enr, err)
+			}
+
+			// a replay before a request is resolved stays in doubt
+			if _, err := d.ReplayDeadLetters(EnrollQueue, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			waitFor(t, "a dead letter again", func() bool {
+				return count(t, b, DeadLetterQueue(EnrollQueue)) == 1
+			})
+
+			var r ResolveEnrollReply
+			if err := d.call(DbResolveEnrollCmd, ResolveEnrollEvent{Subject: e.Subject, CertID: tt.certId}, &r); err != nil {
+				t.Fatal(err)
+			}
+
+			if r.State != tt.wantState {
+				t.Errorf("resolved as %q, want %q", r.State, tt.wantState)
+			}
+
+			err = d.call(DbResolveEnrollCmd, ResolveEnrollEvent{Subject: e.Subject}, &r)
+			if e, ok := err.(*RPCError); !ok || e.Code != ConflictCode {
+				t.Errorf("second resolve = %v, want a conflict", err)
+			}
+
+			if _, err := d.ReplayDeadLetters(EnrollQueue, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			var s Subject
+			waitFor(t, "a certificate", func() bool {
+				s, err = db.FindSubject(e.Subject)
+				return err == nil && s.Certificate != ""
+			})
+
+			ca.mu.Lock()
+			enrolled, csrs := ca.enrolled, ca.csrs
+			ca.mu.Unlock()
+
+			if enrolled != tt.wantEnrolled {
+				t.Errorf("ordered %d times, want %d", enrolled, tt.wantEnrolled)
+			}
+
+			for _, csr := range csrs {
+				if csr != enr.CSR || s.CSR != enr.CSR {
+					t.Error("a CSR differs from the one recorded with a claim")
+				}
+			}
+
+			if s.PrivateKey != enr.PrivateKey {
+				t.Error("a stored key differs from the one recorded with a claim")
+			}
+
+			enr, err = db.FindEnrollment(e.Subject)
+			if err != nil || enr.State != EnrollOrdered || enr.CSR != "" || enr.PrivateKey != "" {
+				t.Errorf("enrollment = %+v, %v, want ordered without a key", enr, err)
+			}
+		})
+	}
+}
+
+// TestMemoryBusEnrollClaimed redelivers a request which has claimed its subject before. A claim whose
+// key was recorded, but which never asked a CA, goes on with that key. An attempted one is in doubt.
+func TestMemoryBusEnrollClaimed(t *testing.T) {
+	tests := []struct {
+		name         string
+		attempted    bool
+		wantEnrolled int
+	}{
+		{"key recorded", false, 1},
+		{"attempted", true, 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewMemoryBus()
+			ca := newFakeCA()
+
+			db, d := startEnrollPipeline(t, b, b, ca)
+
+			e := EnrollEvent{Subject: "a.example.com", Port: 443, Key: newID()}
+			if err := db.SaveEnrollment(&Enrollment{
+				Subject:    e.Subject,
+				Key:        e.Key,
+				State:      EnrollPending,
+				Claim:      newID(),
+				Attempted:  tt.attempted,
+				CSR:        "csr",
+				PrivateKey: "key",
+				ClaimedAt:  time.Now(),
+			}, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := d.Publish(EnrollExchange, EnrollQueue, "", "", e); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.attempted {
+				waitFor(t, "a dead letter", func() bool {
+					return count(t, b, DeadLetterQueue(EnrollQueue)) == 1
+				})
+			} else {
+				waitFor(t, "a recorded subject", func() bool {
+					s, err := db.FindSubject(e.Subject)
+					return err == nil && s.CertID == 1
+				})
+			}
+
+			ca.mu.Lock()
+			enrolled, csrs := ca.enrolled, ca.csrs
+			ca.mu.Unlock()
+
+			if enrolled != tt.wantEnrolled {
+				t.Errorf("ordered %d times, want %d", enrolled, tt.wantEnrolled)
+			}
+
+			if len(csrs) > 0 && csrs[0] != "csr" {
+				t.Error("a CSR differs from the one recorded with a claim")
+			}
+		})
+	}
+}
+
+// TestMemoryBusEnrollUnroutable orders a certificate which can't be collected, because nothing is bound
+// to collect it. A request is retried, and a retry only collects an ordered certificate.
+func TestMemoryBusEnrollUnroutable(t *testing.T) {
+	withConfig(t, &Config{CertParams: CertParams{BitSize: 1024}})
+
+	db := newTestBolt(t)
+	b := NewMemoryBus()
+
+	for _, q := range []struct{ exchange, queue string }{
+		{DbReplyExchange, DbReplyQueue},
+		{EnrollExchange, EnrollQueue},
+	} {
+		if err := b.Declare(q.exchange, q.queue, amqp.ExchangeDirect, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, e := range []string{CollectExchange, GRPCServerExchange} {
+		if err := b.DeclareExchange(e, amqp.ExchangeDirect); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbd := &Londo{Name: "londo-dbd", Db: db, Bus: b}
+	dbd.ConsumeDbRPC()
+	t.Cleanup(func() { stopDaemon(dbd) })
+
+	ca := newFakeCA()
+
+	d := &Londo{Name: "londo-enrolld", Bus: b, CA: ca}
+	d.DeclareRetries(EnrollQueue).RPCClient().ConsumeEnroll()
+	t.Cleanup(func() { stopDaemon(d) })
+
+	e := EnrollEvent{Subject: "a.example.com", Port: 443, Key: newID()}
+	if err := d.Publish(EnrollExchange, EnrollQueue, "", "", e); err != nil {
+		t.Fatal(err)
+	}
+
+	delayed := DelayQueue(EnrollQueue, time.Minute)
+	waitFor(t, "a retry", func() bool {
+		return count(t, b, delayed) == 1
+	})
+
+	r := get(t, b, delayed)
+	if cause, _ := r.Headers[ErrorHeader].(string); !strings.HasPrefix(cause, ErrUnroutable.Error()) {
+		t.Errorf("retried because of %q, want %q", cause, ErrUnroutable)
+	}
+
+	// londo-dbd records a subject on its own time
+	waitFor(t, "an ordered enrollment", func() bool {
+		enr, err := db.FindEnrollment(e.Subject)
+		return err == nil && enr.State == EnrollOrdered
+	})
+
+	if err := b.Declare(CollectExchange, CollectQueue, amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// a delay is over
+	if err := b.Emit(EnrollExchange, EnrollQueue, publishing(&r)); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "a collect", func() bool {
+		return count(t, b, CollectQueue) == 1
+	})
+
+	if enrolled, _ := ca.calls(); enrolled != 1 {
+		t.Errorf("a certificate was ordered %d times, want once", enrolled)
+	}
+}
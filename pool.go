@@ -0,0 +1,52 @@
+package londo
+
+// Pool tells how many deliveries of a queue are handled at once, and how many a broker sends
+// ahead before they are acknowledged. Zero prefetch is no limit.
+type Pool struct {
+	Workers  int
+	Prefetch int
+}
+
+// Single handles one delivery at a time in order, with no prefetch limit
+var Single = Pool{Workers: 1}
+
+// Pools are defaults for consumers, consumers section of config overrides them. Queues which talk
+// to Sectigo don't prefetch more than they handle, so replicas waiting on a rate limit don't hoard messages.
+var Pools = map[string]Pool{
+	EnrollQueue:  {Workers: 4, Prefetch: 4},
+	CollectQueue: {Workers: 4, Prefetch: 4},
+	RevokeQueue:  {Workers: 2, Prefetch: 2},
+	CheckQueue:   {Workers: 10, Prefetch: 20},
+	DbReplyQueue: {Workers: 1, Prefetch: 10},
+}
+
+func consumerPool(queue string) Pool {
+	p, ok := Pools[queue]
+	if !ok {
+		p = Single
+	}
+
+	if cfg == nil {
+		return p
+	}
+
+	if c, ok := cfg.Consumers[queue]; ok {
+		if c.Workers > 0 {
+			p.Workers = c.Workers
+		}
+
+		if c.Prefetch > 0 {
+			p.Prefetch = c.Prefetch
+		}
+	}
+
+	return p
+}
+
+func (p Pool) workers() int {
+	if p.Workers < 1 {
+		return 1
+	}
+
+	return p.Workers
+}
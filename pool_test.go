@@ -0,0 +1,148 @@
+package londo
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestConsumerPool(t *testing.T) {
+	withConfig(t, &Config{Consumers: map[string]Consumer{
+		EnrollQueue: {Workers: 8},
+		CheckQueue:  {Prefetch: 50},
+		"other":     {Workers: 3, Prefetch: 3},
+	}})
+
+	tests := []struct {
+		queue string
+		want  Pool
+	}{
+		{EnrollQueue, Pool{Workers: 8, Prefetch: 4}},
+		{CheckQueue, Pool{Workers: 10, Prefetch: 50}},
+		{RevokeQueue, Pools[RevokeQueue]},
+		{"other", Pool{Workers: 3, Prefetch: 3}},
+		{"unknown", Single},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.queue, func(t *testing.T) {
+			if got := consumerPool(tt.queue); got != tt.want {
+				t.Errorf("consumerPool() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if w := (Pool{}).workers(); w != 1 {
+		t.Errorf("workers() of an empty pool = %d, want 1", w)
+	}
+}
+
+// TestWork hands deliveries to a pool, and counts how many are handled at once
+func TestWork(t *testing.T) {
+	tests := []struct {
+		name    string
+		pool    Pool
+		stopAt  int
+		wantMax int32
+	}{
+		{"single", Single, 0, 1},
+		{"pool", Pool{Workers: 4}, 0, 4},
+		{"asked to stop", Pool{Workers: 2}, 5, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				delivery = make(chan amqp.Delivery)
+				canceled = make(chan struct{})
+				cancels  int32
+				running  int32
+				max      int32
+				handled  int32
+			)
+
+			// like a broker, deliveries end once a consumer is canceled
+			cancel := func() {
+				if atomic.AddInt32(&cancels, 1) == 1 {
+					close(canceled)
+				}
+			}
+
+			go func() {
+				defer close(delivery)
+
+				for i := 1; i <= 20; i++ {
+					select {
+					case delivery <- amqp.Delivery{DeliveryTag: uint64(i)}:
+					case <-canceled:
+						return
+					}
+				}
+			}()
+
+			stopped := work(tt.pool, delivery, make(chan struct{}), cancel, func(d amqp.Delivery) bool {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+
+				for {
+					m := atomic.LoadInt32(&max)
+					if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+						break
+					}
+				}
+
+				time.Sleep(10 * time.Millisecond)
+				atomic.AddInt32(&handled, 1)
+
+				return tt.stopAt != 0 && d.DeliveryTag == uint64(tt.stopAt)
+			})
+
+			if stopped != (tt.stopAt != 0) {
+				t.Errorf("work() = %t, want %t", stopped, tt.stopAt != 0)
+			}
+
+			if max != tt.wantMax {
+				t.Errorf("%d deliveries were handled at once, want %d", max, tt.wantMax)
+			}
+
+			if tt.stopAt == 0 && (handled != 20 || cancels != 0) {
+				t.Errorf("%d deliveries were handled, %d cancels, want 20 and none", handled, cancels)
+			}
+
+			if tt.stopAt != 0 && cancels != 1 {
+				t.Errorf("deliveries were canceled %d times, want once", cancels)
+			}
+		})
+	}
+}
+
+func TestWorkStop(t *testing.T) {
+	var (
+		delivery = make(chan amqp.Delivery)
+		stop     = make(chan struct{})
+		canceled = make(chan struct{})
+	)
+
+	done := make(chan bool)
+	go func() {
+		done <- work(Pool{Workers: 2}, delivery, stop, func() {
+			close(canceled)
+			close(delivery)
+		}, func(d amqp.Delivery) bool { return false })
+	}()
+
+	delivery <- amqp.Delivery{}
+	close(stop)
+
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("deliveries weren't canceled once stopped")
+	}
+
+	if <-done {
+		t.Error("work() has been asked to stop by a handler")
+	}
+}
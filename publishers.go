@@ -1,32 +1,54 @@
 package londo
 
 import (
-	"encoding/json"
 	"time"
 
 	"github.com/alexyermolaev/londo/logger"
 	"github.com/roylee0704/gron"
 	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
 )
 
 func (l *Londo) Publish(exchange string, queue string, reply string, cmd string, e Event) error {
-	msg := e.GetMessage()
-	msg.ContentType = ContentType
+	return l.publish(exchange, queue, reply, "", cmd, e)
+}
+
+// Reply answers a request of londo-grpcd with a correlation id of the request
+func (l *Londo) Reply(d *amqp.Delivery, cmd string, e Event) error {
+	return l.publish(GRPCServerExchange, d.ReplyTo, "", d.CorrelationId, cmd, e)
+}
+
+// ReplyError tells londo-grpcd that a request has failed, no more replies follow
+func (l *Londo) ReplyError(d *amqp.Delivery, err error) error {
+	e := rpcError(err, "", "")
+
+	return l.Reply(d, ErrorReplyCmd, ErrorReply{
+		Code:     e.Code,
+		Error:    e.Error(),
+		Resource: e.Resource,
+		Name:     e.Name,
+	})
+}
+
+func (l *Londo) publish(exchange string, queue string, reply string, id string, cmd string, e Event) error {
+	msg, err := seal(e, l.Name)
+	if err != nil {
+		return err
+	}
 
 	if reply != "" {
 		msg.ReplyTo = reply
 	}
 
-	if cmd != "" {
-		msg.Type = cmd
+	if id != "" {
+		msg.CorrelationId = id
 	}
 
-	msg.Body, err = json.Marshal(&e)
-	if err != nil {
-		return err
+	if cmd != "" {
+		msg.Type = cmd
 	}
 
-	if err := l.AMQP.Emit(exchange, queue, msg); err != nil {
+	if err := l.Bus.Emit(exchange, queue, msg); err != nil {
 		return err
 	}
 
@@ -0,0 +1,318 @@
+package londo
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/go-resty/resty/v2"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// ThrottledRetries is how many times a call throttled by Sectigo is repeated before it fails
+	ThrottledRetries = 3
+
+	// how often a limiter looks for a token while a budget is used up
+	tokenPoll = time.Second
+
+	// PausedUntilHeader is carried by a marker of a pause, which every replica honours
+	PausedUntilHeader = "x-londo-paused-until"
+)
+
+// ErrStopped is returned to calls which were still waiting for a budget when a daemon stopped
+var ErrStopped = errors.New("rate limiter stopped")
+
+// RateLimitPolicy is a budget of Sectigo calls, Requests per Interval with up to Burst of them at once
+type RateLimitPolicy struct {
+	Requests int
+	Interval time.Duration
+	Burst    int
+}
+
+// RateLimits are defaults for every budget, rate_limits section of config overrides them. Enroll and
+// collect budgets match a call per minute daemons used to make.
+var RateLimits = map[string]RateLimitPolicy{
+	EnrollQueue:  {Requests: 60, Interval: time.Hour, Burst: 1},
+	CollectQueue: {Requests: 60, Interval: time.Hour, Burst: 1},
+	RevokeQueue:  {Requests: 60, Interval: time.Hour, Burst: 5},
+}
+
+func rateLimitPolicy(budget string) (RateLimitPolicy, error) {
+	p, ok := RateLimits[budget]
+	if !ok {
+		return p, errors.New("no rate limit for budget " + budget)
+	}
+
+	if cfg == nil {
+		return p, nil
+	}
+
+	if c, ok := cfg.RateLimits[budget]; ok {
+		if c.Requests > 0 {
+			p.Requests = c.Requests
+		}
+
+		if c.Interval > 0 {
+			p.Interval = time.Duration(c.Interval) * time.Second
+		}
+
+		if c.Burst > 0 {
+			p.Burst = c.Burst
+		}
+	}
+
+	return p, nil
+}
+
+// cooldown is how long a token rests after a call, so Burst tokens make Requests calls per Interval
+func (p RateLimitPolicy) cooldown() time.Duration {
+	return p.Interval * time.Duration(p.Burst) / time.Duration(p.Requests)
+}
+
+// RateLimiter is a token bucket kept on a bus, so every replica of a daemon shares it. A call takes
+// a token from a budget's queue, and puts it to a cooldown queue, which returns it once it expires.
+// A budget's queue holds at most Burst tokens, extra ones are dropped. A pause is shared through
+// a marker queue, tokens taken while it lasts rest in a pause queue until it is over.
+type RateLimiter struct {
+	bus    Bus
+	budget string
+	policy RateLimitPolicy
+	done   chan struct{}
+
+	mu     sync.Mutex
+	paused time.Time
+}
+
+func TokenQueue(budget string) string {
+	return "rate-limit." + budget
+}
+
+func cooldownQueue(budget string) string {
+	return TokenQueue(budget) + ".cooldown"
+}
+
+// pauseQueue holds tokens while Sectigo asks to slow down, every token expires on its own
+func pauseQueue(budget string) string {
+	return TokenQueue(budget) + ".paused"
+}
+
+// markerQueue holds a single marker of the latest pause, a newer one replaces it
+func markerQueue(budget string) string {
+	return TokenQueue(budget) + ".throttled"
+}
+
+// NewRateLimiter declares queues of a budget, and tops its tokens up to Burst. Replicas starting
+// at once may add a few more, those are dropped once a budget is full again.
+func NewRateLimiter(b Bus, budget string, done chan struct{}) (*RateLimiter, error) {
+	p, err := rateLimitPolicy(budget)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Requests <= 0 || p.Interval <= 0 || p.Burst <= 0 {
+		return nil, errors.New("invalid rate limit for budget " + budget)
+	}
+
+	q := TokenQueue(budget)
+
+	back := amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": q,
+	}
+
+	if err := b.DeclareQueue(q, amqp.Table{"x-max-length": int32(p.Burst)}); err != nil {
+		return nil, err
+	}
+
+	cool := amqp.Table{"x-message-ttl": int64(p.cooldown() / time.Millisecond)}
+	for k, v := range back {
+		cool[k] = v
+	}
+
+	if err := b.DeclareQueue(cooldownQueue(budget), cool); err != nil {
+		return nil, err
+	}
+
+	if err := b.DeclareQueue(pauseQueue(budget), back); err != nil {
+		return nil, err
+	}
+
+	if err := b.DeclareQueue(markerQueue(budget), amqp.Table{"x-max-length": int32(1)}); err != nil {
+		return nil, err
+	}
+
+	var tokens int
+	for _, name := range []string{q, cooldownQueue(budget), pauseQueue(budget)} {
+		n, err := b.Count(name)
+		if err != nil {
+			return nil, err
+		}
+		tokens += n
+	}
+
+	for i := tokens; i < p.Burst; i++ {
+		if err := b.Emit("", q, amqp.Publishing{DeliveryMode: amqp.Persistent}); err != nil {
+			return nil, err
+		}
+	}
+
+	log.WithFields(logrus.Fields{
+		logger.Budget:   budget,
+		logger.Count:    p.Requests,
+		logger.Interval: p.Interval.String(),
+		logger.Burst:    p.Burst}).Info("rate limited")
+
+	return &RateLimiter{bus: b, budget: budget, policy: p, done: done}, nil
+}
+
+// Wait blocks until a budget allows a call, or done is closed. A token taken while a budget
+// is paused is put to rest until a pause is over.
+func (r *RateLimiter) Wait() error {
+	for {
+		until := r.pausedUntil()
+
+		var took bool
+
+		err := r.bus.Drain(TokenQueue(r.budget), 1, func(d *amqp.Delivery) bool {
+			if paused := time.Until(until); paused > 0 {
+				return r.rest(d, paused)
+			}
+
+			if err := r.bus.Emit("", cooldownQueue(r.budget), publishing(d)); err != nil {
+				log.WithFields(logrus.Fields{logger.Budget: r.budget, logger.Reason: err}).Error(logger.Skip)
+				return false
+			}
+
+			took = true
+			return true
+		})
+		if err != nil {
+			return err
+		}
+
+		if took {
+			return nil
+		}
+
+		wait := tokenPoll
+		if paused := time.Until(until); paused > 0 {
+			wait = paused
+		}
+
+		if r.sleep(wait) {
+			return ErrStopped
+		}
+	}
+}
+
+// pausedUntil tells until when a budget is paused, by this or by any other replica
+func (r *RateLimiter) pausedUntil() time.Time {
+	r.mu.Lock()
+	until := r.paused
+	r.mu.Unlock()
+
+	// a marker held by another replica may come back behind a newer one, so every one is read
+	err := r.bus.Drain(markerQueue(r.budget), 0, func(d *amqp.Delivery) bool {
+		if v, ok := d.Headers[PausedUntilHeader].(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil && t.After(until) {
+				until = t
+			}
+		}
+		return false
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.Budget: r.budget, logger.Reason: err}).Error(logger.Skip)
+	}
+
+	return until
+}
+
+// rest puts a token to a pause queue, which returns it once d is over
+func (r *RateLimiter) rest(t *amqp.Delivery, d time.Duration) bool {
+	msg := publishing(t)
+	msg.Expiration = strconv.FormatInt(int64(d/time.Millisecond), 10)
+
+	return r.bus.Emit("", pauseQueue(r.budget), msg) == nil
+}
+
+// sleep tells whether done was closed meanwhile
+func (r *RateLimiter) sleep(d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return false
+	case <-r.done:
+		return true
+	}
+}
+
+// Pause stops calls of every replica for a while. A marker tells other replicas about it, and
+// tokens which are left are put to rest. Tokens which come back from a cooldown meanwhile are
+// put to rest by whichever replica takes them.
+func (r *RateLimiter) Pause(d time.Duration) {
+	until := time.Now().Add(d)
+
+	if until.After(r.pausedUntil()) {
+		err := r.bus.Emit("", markerQueue(r.budget), amqp.Publishing{
+			Headers:      amqp.Table{PausedUntilHeader: until.UTC().Format(time.RFC3339Nano)},
+			DeliveryMode: amqp.Persistent,
+			Expiration:   strconv.FormatInt(int64(d/time.Millisecond), 10),
+		})
+		if err != nil {
+			log.WithFields(logrus.Fields{logger.Budget: r.budget, logger.Reason: err}).Error(logger.Skip)
+		}
+	}
+
+	r.mu.Lock()
+	if until.After(r.paused) {
+		r.paused = until
+	}
+	r.mu.Unlock()
+
+	err := r.bus.Drain(TokenQueue(r.budget), 0, func(t *amqp.Delivery) bool {
+		return r.rest(t, d)
+	})
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.Budget: r.budget, logger.Reason: err}).Error(logger.Skip)
+	}
+
+	log.WithFields(logrus.Fields{logger.Budget: r.budget, logger.Delay: d.String()}).Warn(logger.Throttled)
+}
+
+// Do makes a call within a budget. A call Sectigo has throttled is repeated once it is allowed
+// to, up to ThrottledRetries times.
+func (r *RateLimiter) Do(f func() (*resty.Response, error)) (*resty.Response, error) {
+	for i := 0; ; i++ {
+		if err := r.Wait(); err != nil {
+			return nil, err
+		}
+
+		res, err := f()
+		if err != nil || res.StatusCode() != http.StatusTooManyRequests || i >= ThrottledRetries {
+			return res, err
+		}
+
+		r.Pause(retryAfter(res, r.policy.cooldown()))
+	}
+}
+
+// retryAfter reads a Retry-After header, either in seconds or a date
+func retryAfter(res *resty.Response, fallback time.Duration) time.Duration {
+	h := res.Header().Get("Retry-After")
+
+	if s, err := strconv.Atoi(h); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+
+	if t, err := http.ParseTime(h); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+
+	return fallback
+}
@@ -0,0 +1,239 @@
+package londo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/streadway/amqp"
+)
+
+func TestRateLimitCooldown(t *testing.T) {
+	tests := []struct {
+		policy RateLimitPolicy
+		want   time.Duration
+	}{
+		{RateLimitPolicy{Requests: 60, Interval: time.Hour, Burst: 1}, time.Minute},
+		{RateLimitPolicy{Requests: 60, Interval: time.Hour, Burst: 5}, 5 * time.Minute},
+		{RateLimitPolicy{Requests: 10, Interval: time.Second, Burst: 10}, time.Second},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.cooldown(); got != tt.want {
+			t.Errorf("cooldown() of %+v = %v, want %v", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestRateLimitPolicy(t *testing.T) {
+	withConfig(t, &Config{RateLimits: map[string]RateLimit{
+		EnrollQueue: {Requests: 10, Interval: 60},
+		RevokeQueue: {Burst: 2},
+	}})
+
+	tests := []struct {
+		budget  string
+		want    RateLimitPolicy
+		wantErr bool
+	}{
+		{EnrollQueue, RateLimitPolicy{Requests: 10, Interval: time.Minute, Burst: 1}, false},
+		{RevokeQueue, RateLimitPolicy{Requests: 60, Interval: time.Hour, Burst: 2}, false},
+		{CollectQueue, RateLimits[CollectQueue], false},
+		{CheckQueue, RateLimitPolicy{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.budget, func(t *testing.T) {
+			got, err := rateLimitPolicy(tt.budget)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("rateLimitPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("rateLimitPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRateLimiter(t *testing.T) {
+	b := newTestBus(t)
+	r, _ := newTestRateLimiter(t, b, 3)
+
+	if n := count(t, b, TokenQueue(EnrollQueue)); n != 3 {
+		t.Errorf("%d tokens, want 3", n)
+	}
+
+	if err := r.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a replica which starts later counts resting tokens too
+	newTestRateLimiter(t, b, 3)
+
+	if n := count(t, b, TokenQueue(EnrollQueue)); n != 2 {
+		t.Errorf("%d tokens after another replica has started, want 2", n)
+	}
+
+	if _, err := NewRateLimiter(b, CheckQueue, nil); err == nil {
+		t.Error("NewRateLimiter() of a budget without a policy succeeded")
+	}
+
+	prev := RateLimits[RevokeQueue]
+	RateLimits[RevokeQueue] = RateLimitPolicy{Requests: 1, Interval: time.Hour}
+	t.Cleanup(func() { RateLimits[RevokeQueue] = prev })
+
+	if _, err := NewRateLimiter(b, RevokeQueue, nil); err == nil {
+		t.Error("NewRateLimiter() of a budget without a burst succeeded")
+	}
+}
+
+func TestRateLimiterWait(t *testing.T) {
+	b := newTestBus(t)
+	r, done := newTestRateLimiter(t, b, 2)
+
+	for i := 0; i < 2; i++ {
+		if err := r.Wait(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := count(t, b, cooldownQueue(EnrollQueue)); n != 2 {
+		t.Errorf("%d tokens are resting, want 2", n)
+	}
+
+	errs := make(chan error, 1)
+	go func() { errs <- r.Wait() }()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("Wait() of a used up budget = %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(done)
+
+	select {
+	case err := <-errs:
+		if err != ErrStopped {
+			t.Errorf("Wait() = %v, want %v", err, ErrStopped)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() has not returned once stopped")
+	}
+}
+
+func TestRateLimiterPauseReplicas(t *testing.T) {
+	b := newTestBus(t)
+	paused, _ := newTestRateLimiter(t, b, 2)
+	other, _ := newTestRateLimiter(t, b, 2)
+
+	paused.Pause(300 * time.Millisecond)
+
+	if n := count(t, b, pauseQueue(EnrollQueue)); n != 2 {
+		t.Errorf("%d tokens are paused, want 2", n)
+	}
+
+	// a token which comes back from a cooldown during a pause
+	if err := b.Emit("", TokenQueue(EnrollQueue), amqp.Publishing{}); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 1)
+	start := time.Now()
+	go func() { errs <- other.Wait() }()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("Wait() of another replica during a pause = %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if n := count(t, b, pauseQueue(EnrollQueue)); n != 3 {
+		t.Errorf("%d tokens are paused, want 3", n)
+	}
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < 250*time.Millisecond {
+			t.Errorf("Wait() returned after %v, before a pause was over", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait() has not returned once a pause was over")
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	fallback := time.Minute
+
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{"seconds", "120", 2 * time.Minute},
+		{"none", "", fallback},
+		{"zero", "0", fallback},
+		{"garbage", "soon", fallback},
+		{"past date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), fallback},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &resty.Response{RawResponse: &http.Response{Header: http.Header{}}}
+			res.RawResponse.Header.Set("Retry-After", tt.header)
+
+			if got := retryAfter(res, fallback); got != tt.want {
+				t.Errorf("retryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	res := &resty.Response{RawResponse: &http.Response{Header: http.Header{}}}
+	res.RawResponse.Header.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+
+	if got := retryAfter(res, fallback); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("retryAfter() of a date = %v, want about an hour", got)
+	}
+}
+
+// TestRateLimiterDo is throttled by Sectigo once, and repeats a call after it is asked to wait
+func TestRateLimiterDo(t *testing.T) {
+	var calls int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	b := newTestBus(t)
+	r, _ := newTestRateLimiter(t, b, 2)
+
+	start := time.Now()
+
+	res, err := r.Do(func() (*resty.Response, error) {
+		return resty.New().R().Get(srv.URL)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.StatusCode() != http.StatusOK || atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("status = %d after %d calls, want %d after 2", res.StatusCode(), calls, http.StatusOK)
+	}
+
+	if d := time.Since(start); d < time.Second {
+		t.Errorf("a throttled call was repeated after %v, want a second", d)
+	}
+}
@@ -2,15 +2,18 @@ package londo
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
 	"strconv"
+	"sync"
 
 	"github.com/go-resty/resty/v2"
 )
 
 const (
 	contentType = "application/json"
+
+	// how many certificates a single list call asks for
+	listPageSize = 200
 )
 
 type enrollReqBody struct {
@@ -30,24 +33,52 @@ type EnrollResponse struct {
 	SslId   int    `json:"sslId"`
 }
 
+type listItem struct {
+	SslId        int    `json:"sslId"`
+	CommonName   string `json:"commonName"`
+	SerialNumber string `json:"serialNumber"`
+}
+
 type ErrorResponse struct {
 	Code        int    `json:"code"`
 	Description string `json:"description"`
 }
 
+// RestAPI is a Sectigo Certificate Manager client, the CAProvider used by default
 type RestAPI struct {
-	Client *resty.Client
-	config *Config
+	Client   *resty.Client
+	config   *Config
+	limiters map[string]*RateLimiter
+	done     chan struct{}
+	stopOnce sync.Once
 }
 
-func NewRestClient(c *Config) *RestAPI {
-	return &RestAPI{
-		Client: resty.New(),
-		config: c,
+// NewRestClient makes a client which calls Sectigo within rate limits shared through a bus
+func NewRestClient(c *Config, b Bus) (*RestAPI, error) {
+	r := &RestAPI{
+		Client:   resty.New(),
+		config:   c,
+		limiters: make(map[string]*RateLimiter),
+		done:     make(chan struct{}),
+	}
+
+	for budget := range RateLimits {
+		l, err := NewRateLimiter(b, budget, r.done)
+		if err != nil {
+			return nil, err
+		}
+		r.limiters[budget] = l
 	}
+
+	return r, nil
+}
+
+// Stop fails calls which are waiting for a rate limit with ErrStopped, it may be called more than once
+func (r *RestAPI) Stop() {
+	r.stopOnce.Do(func() { close(r.done) })
 }
 
-func (r RestAPI) request() *resty.Request {
+func (r *RestAPI) request() *resty.Request {
 	return r.Client.R().
 		SetHeader("Content-Type", contentType).
 		SetHeader("login", r.config.Rest.Username).
@@ -55,7 +86,7 @@ func (r RestAPI) request() *resty.Request {
 		SetHeader("customerUri", r.config.Rest.CustomerURI)
 }
 
-func (r RestAPI) Enroll(s *Subject) (*resty.Response, error) {
+func (r *RestAPI) Enroll(s *Subject) (Order, error) {
 	var alts string
 
 	certType := r.config.CertParams.CertType
@@ -84,38 +115,129 @@ func (r RestAPI) Enroll(s *Subject) (*resty.Response, error) {
 
 	//log.Debug("request: " + string(j))
 
-	return r.request().
-		SetBody(j).
-		Post(r.config.Rest.Url +
-			r.config.Rest.Endpoints.Enroll)
+	res, err := r.limiters[EnrollQueue].Do(func() (*resty.Response, error) {
+		return r.request().
+			SetBody(j).
+			Post(r.config.Rest.Url +
+				r.config.Rest.Endpoints.Enroll)
+	})
+
+	return r.order(res, err)
+}
+
+// Renew orders a certificate again with the key and CSR it was enrolled with
+func (r *RestAPI) Renew(certId int) (Order, error) {
+	res, err := r.limiters[EnrollQueue].Do(func() (*resty.Response, error) {
+		return r.request().
+			Post(r.config.Rest.Url +
+				r.config.Rest.Endpoints.Renew +
+				"/" + strconv.Itoa(certId))
+	})
+
+	return r.order(res, err)
+}
+
+// order reads a certificate enroll and renew calls have ordered
+func (r *RestAPI) order(res *resty.Response, err error) (Order, error) {
+	if err != nil {
+		return Order{}, err
+	}
+
+	log.Debug("response: " + string(res.Body()))
+
+	if err := r.VerifyStatusCode(res, http.StatusOK); err != nil {
+		return Order{}, err
+	}
+
+	var j EnrollResponse
+	if err := json.Unmarshal(res.Body(), &j); err != nil {
+		return Order{}, err
+	}
+
+	return Order{CertID: j.SslId, OrderID: j.RenewID}, nil
 }
 
 type Revoke struct {
 	Reason string `json:"reason"`
 }
 
-func (r RestAPI) Revoke(certId int, reason string) (*resty.Response, error) {
+func (r *RestAPI) Revoke(certId int, reason string) error {
 
 	j, err := json.Marshal(Revoke{Reason: reason})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return r.request().
-		SetBody(j).
-		Post(r.config.Rest.Url +
-			r.config.Rest.Endpoints.Revoke +
-			"/" + strconv.Itoa(certId))
+	res, err := r.limiters[RevokeQueue].Do(func() (*resty.Response, error) {
+		return r.request().
+			SetBody(j).
+			Post(r.config.Rest.Url +
+				r.config.Rest.Endpoints.Revoke +
+				"/" + strconv.Itoa(certId))
+	})
+	if err != nil {
+		return err
+	}
+
+	return r.VerifyStatusCode(res, http.StatusNoContent)
 }
 
-func (r RestAPI) Collect(certId int) (*resty.Response, error) {
-	return r.request().
-		Get(r.config.Rest.Url +
-			r.config.Rest.Endpoints.Collect +
-			"/" + strconv.Itoa(certId) + "/" + r.config.CertParams.FormatType)
+// Collect returns an issued certificate in a configured format
+func (r *RestAPI) Collect(certId int) (string, error) {
+	res, err := r.limiters[CollectQueue].Do(func() (*resty.Response, error) {
+		return r.request().
+			Get(r.config.Rest.Url +
+				r.config.Rest.Endpoints.Collect +
+				"/" + strconv.Itoa(certId) + "/" + r.config.CertParams.FormatType)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if err := r.VerifyStatusCode(res, http.StatusOK); err != nil {
+		return "", err
+	}
+
+	return string(res.Body()), nil
+}
+
+// List pages through every certificate of a customer, a page at a time within the collect budget
+func (r *RestAPI) List() ([]IssuedCert, error) {
+	var certs []IssuedCert
+
+	for pos := 0; ; pos += listPageSize {
+		res, err := r.limiters[CollectQueue].Do(func() (*resty.Response, error) {
+			return r.request().
+				SetQueryParam("size", strconv.Itoa(listPageSize)).
+				SetQueryParam("position", strconv.Itoa(pos)).
+				Get(r.config.Rest.Url +
+					r.config.Rest.Endpoints.List)
+		})
+		if err != nil {
+			return certs, err
+		}
+
+		if err := r.VerifyStatusCode(res, http.StatusOK); err != nil {
+			return certs, err
+		}
+
+		var page []listItem
+		if err := json.Unmarshal(res.Body(), &page); err != nil {
+			return certs, err
+		}
+
+		for _, i := range page {
+			certs = append(certs, IssuedCert{CertID: i.SslId, Subject: i.CommonName, Serial: i.SerialNumber})
+		}
+
+		if len(page) < listPageSize {
+			return certs, nil
+		}
+	}
 }
 
-func (r RestAPI) VerifyStatusCode(res *resty.Response, expected int) error {
+// VerifyStatusCode turns a response other than expected into a CAError
+func (r *RestAPI) VerifyStatusCode(res *resty.Response, expected int) error {
 	switch res.StatusCode() {
 	case expected:
 		return nil
@@ -123,20 +245,23 @@ func (r RestAPI) VerifyStatusCode(res *resty.Response, expected int) error {
 	case http.StatusBadRequest:
 		var e ErrorResponse
 		if err := json.Unmarshal(res.Body(), &e); err != nil {
-			return errors.New("bad request, cannot parse response")
+			return caError(res.StatusCode(), "bad request, cannot parse response")
 		}
-		return errors.New("bad request: " + e.Description)
+		return caError(res.StatusCode(), "bad request: "+e.Description)
 
 	case http.StatusUnauthorized:
-		return errors.New("unauthorized")
+		return caError(res.StatusCode(), "unauthorized")
 
 	case http.StatusInternalServerError:
-		return errors.New("server error")
+		return caError(res.StatusCode(), "server error")
 
 	case http.StatusNotFound:
-		return errors.New("page not found, wrong endpoint")
+		return caError(res.StatusCode(), "page not found, wrong endpoint")
+
+	case http.StatusTooManyRequests:
+		return caError(res.StatusCode(), "too many requests")
 
 	default:
-		return errors.New("unhandled http error, status code: " + strconv.Itoa(res.StatusCode()))
+		return statusError(res.StatusCode())
 	}
 }
@@ -0,0 +1,153 @@
+package londo
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestRestAPIEnroll(t *testing.T) {
+	r := newTestRest(t, func(w http.ResponseWriter, req *http.Request) {
+		var body enrollReqBody
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+
+		if req.Method != http.MethodPost || req.URL.Path != "/ssl/v1/enroll" {
+			t.Errorf("request = %s %s", req.Method, req.URL.Path)
+		}
+
+		if req.Header.Get("login") != "user" || req.Header.Get("password") != "secret" || req.Header.Get("customerUri") != "acme" {
+			t.Errorf("credentials weren't sent: %v", req.Header)
+		}
+
+		if body.Csr != "csr" || body.SubjAltNames != ",b.example.com" {
+			t.Errorf("body = %+v", body)
+		}
+
+		w.Write([]byte(`{"sslId": 7, "renewId": "r7"}`))
+	})
+
+	o, err := r.Enroll(&Subject{Subject: "a.example.com", CSR: "csr", AltNames: []string{"b.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if o.CertID != 7 || o.OrderID != "r7" {
+		t.Errorf("order = %+v, want 7 as r7", o)
+	}
+}
+
+func TestRestAPIStatus(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantMessage string
+		wantRefused bool
+	}{
+		{"bad request", http.StatusBadRequest, `{"code": -1, "description": "invalid csr"}`, "bad request: invalid csr", true},
+		{"unparsable bad request", http.StatusBadRequest, "<html>", "bad request, cannot parse response", true},
+		{"unauthorized", http.StatusUnauthorized, "", "unauthorized", true},
+		{"not found", http.StatusNotFound, "", "page not found, wrong endpoint", true},
+		{"server error", http.StatusInternalServerError, "", "server error", false},
+		{"bad gateway", http.StatusBadGateway, "", "unhandled http error, status code: 502", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRest(t, func(w http.ResponseWriter, req *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			_, err := r.Enroll(&Subject{Subject: "a.example.com", CSR: "csr"})
+
+			e, ok := err.(*CAError)
+			if !ok {
+				t.Fatalf("Enroll() error = %v, want a CAError", err)
+			}
+
+			if e.Status != tt.status || e.Error() != tt.wantMessage {
+				t.Errorf("Enroll() error = %d %q, want %d %q", e.Status, e.Error(), tt.status, tt.wantMessage)
+			}
+
+			if IsRefused(err) != tt.wantRefused {
+				t.Errorf("IsRefused() = %t, want %t", !tt.wantRefused, tt.wantRefused)
+			}
+		})
+	}
+}
+
+func TestRestAPICollectRevoke(t *testing.T) {
+	r := newTestRest(t, func(w http.ResponseWriter, req *http.Request) {
+		switch req.Method + " " + req.URL.Path {
+		case "GET /ssl/v1/collect/7/x509CO":
+			w.Write([]byte("certificate"))
+		case "POST /ssl/v1/revoke/7":
+			var body Revoke
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Reason != "superseded" {
+				t.Errorf("revoke body = %+v, %v", body, err)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	if c, err := r.Collect(7); err != nil || c != "certificate" {
+		t.Errorf("Collect() = %q, %v", c, err)
+	}
+
+	if err := r.Revoke(7, "superseded"); err != nil {
+		t.Errorf("Revoke() = %v", err)
+	}
+
+	if _, err := r.Collect(8); !IsRefused(err) {
+		t.Errorf("Collect() of an unknown certificate = %v, want refused", err)
+	}
+}
+
+func TestRestAPIList(t *testing.T) {
+	const total = listPageSize + 3
+
+	r := newTestRest(t, func(w http.ResponseWriter, req *http.Request) {
+		pos, _ := strconv.Atoi(req.URL.Query().Get("position"))
+		size, _ := strconv.Atoi(req.URL.Query().Get("size"))
+
+		var page []listItem
+		for i := pos; i < total && i < pos+size; i++ {
+			page = append(page, listItem{SslId: i + 1, CommonName: "a.example.com", SerialNumber: strconv.Itoa(i)})
+		}
+
+		json.NewEncoder(w).Encode(page)
+	})
+
+	certs, err := r.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(certs) != total || certs[total-1].CertID != total {
+		t.Errorf("listed %d certificates, want %d", len(certs), total)
+	}
+}
+
+func TestRestAPIStop(t *testing.T) {
+	r := newTestRest(t, func(w http.ResponseWriter, req *http.Request) {
+		w.Write([]byte("certificate"))
+	})
+
+	// a budget without tokens, a call has to wait for one
+	if _, err := r.limiters[CollectQueue].bus.Purge(TokenQueue(CollectQueue)); err != nil {
+		t.Fatal(err)
+	}
+
+	r.Stop()
+	r.Stop()
+
+	if _, err := r.Collect(7); err != ErrStopped {
+		t.Errorf("Collect() after Stop() = %v, want %v", err, ErrStopped)
+	}
+}
@@ -0,0 +1,345 @@
+package londo
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+const (
+	DeadLetterExchange = "dead-letter"
+
+	// Headers a retried message carries
+	AttemptsHeader = "x-londo-attempts"
+	ErrorHeader    = "x-londo-error"
+	FailedAtHeader = "x-londo-failed-at"
+)
+
+// RetryPolicy tells how many times a failed message is delivered to a queue, and how long
+// it waits before each next attempt. A delay doubles with every attempt, up to MaxDelay.
+type RetryPolicy struct {
+	Exchange    string
+	MaxAttempts int
+	Delay       time.Duration
+	MaxDelay    time.Duration
+}
+
+// RetryPolicies are defaults for queues which talk to Sectigo, retries section of config overrides them
+var RetryPolicies = map[string]RetryPolicy{
+	EnrollQueue:  {Exchange: EnrollExchange, MaxAttempts: 5, Delay: time.Minute, MaxDelay: time.Hour},
+	RevokeQueue:  {Exchange: RevokeExchange, MaxAttempts: 5, Delay: time.Minute, MaxDelay: time.Hour},
+	CollectQueue: {Exchange: CollectExchange, MaxAttempts: 10, Delay: time.Minute, MaxDelay: time.Hour},
+}
+
+// DeadLetter is a message which has used up its attempts
+type DeadLetter struct {
+	Queue    string
+	Type     string
+	Attempts int
+	Error    string
+	FailedAt time.Time
+	Body     []byte
+}
+
+func retryPolicy(queue string) (RetryPolicy, error) {
+	p, ok := RetryPolicies[queue]
+	if !ok {
+		return p, errors.New("no retry policy for queue " + queue)
+	}
+
+	if cfg == nil {
+		return p, nil
+	}
+
+	if c, ok := cfg.Retries[queue]; ok {
+		if c.MaxAttempts > 0 {
+			p.MaxAttempts = c.MaxAttempts
+		}
+
+		if c.Delay > 0 {
+			p.Delay = time.Duration(c.Delay) * time.Second
+		}
+
+		if c.MaxDelay > 0 {
+			p.MaxDelay = time.Duration(c.MaxDelay) * time.Second
+		}
+	}
+
+	return p, nil
+}
+
+// delay before an attempt following a given number of failed ones
+func (p RetryPolicy) delay(failed int) time.Duration {
+	d := p.Delay
+
+	for i := 1; i < failed && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+
+	return d
+}
+
+// DelayQueue holds messages until their delay is over, and dead-letters them back to a queue.
+// Its name includes a delay, so a changed policy doesn't clash with a queue declared before.
+func DelayQueue(queue string, d time.Duration) string {
+	return queue + ".retry." + strconv.Itoa(int(d.Seconds()))
+}
+
+func DeadLetterQueue(queue string) string {
+	return queue + ".dlq"
+}
+
+// DeclareRetries declares delay queues for every attempt of a queue's retry policy, and its dead letter queue
+func (l *Londo) DeclareRetries(queue string) *Londo {
+	p, err := retryPolicy(queue)
+	Fail(err)
+
+	declared := make(map[string]bool)
+
+	for i := 1; i < p.MaxAttempts; i++ {
+		d := p.delay(i)
+		name := DelayQueue(queue, d)
+
+		if declared[name] {
+			continue
+		}
+		declared[name] = true
+
+		Fail(l.Bus.DeclareQueue(name, amqp.Table{
+			"x-message-ttl":             int64(d / time.Millisecond),
+			"x-dead-letter-exchange":    p.Exchange,
+			"x-dead-letter-routing-key": queue,
+		}))
+	}
+
+	Fail(l.Bus.Declare(DeadLetterExchange, DeadLetterQueue(queue), amqp.ExchangeDirect, nil))
+
+	return l
+}
+
+// DeclareDeadLetters declares dead letter queues of every retry policy, so they can be inspected
+// before a consumer of a queue has ever run
+func (l *Londo) DeclareDeadLetters() *Londo {
+	for _, q := range retryQueues() {
+		Fail(l.Bus.Declare(DeadLetterExchange, DeadLetterQueue(q), amqp.ExchangeDirect, nil))
+	}
+
+	return l
+}
+
+func retryQueues() []string {
+	var queues []string
+	for q := range RetryPolicies {
+		queues = append(queues, q)
+	}
+
+	sort.Strings(queues)
+	return queues
+}
+
+// Attempts tells how many times a message has already failed
+func Attempts(d *amqp.Delivery) int {
+	switch v := d.Headers[AttemptsHeader].(type) {
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case int:
+		return v
+	default:
+		return 0
+	}
+}
+
+// retry sends a failed delivery to a delay queue, or to a dead letter queue once its attempts are
+// used up. A delivery is only requeued as is when neither can be published.
+func (l *Londo) retry(d *amqp.Delivery, queue string, cause error) {
+	attempts := Attempts(d) + 1
+
+	fields := logrus.Fields{logger.Queue: queue, logger.Attempt: attempts, logger.Reason: cause}
+
+	// a call which never happened because a daemon is stopping doesn't use an attempt up
+	if cause == ErrStopped {
+		d.Reject(true)
+		fields[logger.Attempt] = attempts - 1
+		log.WithFields(fields).Warn(logger.Requeue)
+		return
+	}
+
+	p, err := retryPolicy(queue)
+	if err != nil {
+		d.Reject(true)
+		log.WithFields(fields).Error(logger.Requeue)
+		return
+	}
+
+	// a call which may have happened already isn't repeated, it waits for an operator instead
+	if cause == ErrInDoubt {
+		attempts = p.MaxAttempts
+		fields[logger.Attempt] = attempts
+	}
+
+	msg := publishing(d)
+
+	msg.Headers[AttemptsHeader] = int32(attempts)
+	msg.Headers[ErrorHeader] = cause.Error()
+
+	if attempts >= p.MaxAttempts {
+		msg.Headers[FailedAtHeader] = time.Now().UTC().Format(time.RFC3339)
+		err = l.Bus.Emit(DeadLetterExchange, DeadLetterQueue(queue), msg)
+	} else {
+		fields[logger.Delay] = p.delay(attempts).String()
+		err = l.Bus.Emit("", DelayQueue(queue, p.delay(attempts)), msg)
+	}
+
+	if err != nil {
+		d.Reject(true)
+		fields[logger.Reason] = err
+		log.WithFields(fields).Error(logger.Requeue)
+		return
+	}
+
+	d.Ack(false)
+
+	if attempts >= p.MaxAttempts {
+		log.WithFields(fields).Error(logger.DeadLettered)
+		return
+	}
+	log.WithFields(fields).Warn(logger.Retry)
+}
+
+func deadLetter(queue string, d *amqp.Delivery) DeadLetter {
+	dl := DeadLetter{
+		Queue:    queue,
+		Type:     d.Type,
+		Attempts: Attempts(d),
+		Body:     d.Body,
+	}
+
+	dl.Error, _ = d.Headers[ErrorHeader].(string)
+
+	if s, ok := d.Headers[FailedAtHeader].(string); ok {
+		dl.FailedAt, _ = time.Parse(time.RFC3339, s)
+	}
+
+	return dl
+}
+
+// deadLetterQueues returns either a given queue, or every queue with a retry policy
+func deadLetterQueues(queue string) ([]string, error) {
+	if queue == "" {
+		return retryQueues(), nil
+	}
+
+	if _, err := retryPolicy(queue); err != nil {
+		return nil, err
+	}
+
+	return []string{queue}, nil
+}
+
+// remaining tells how many more messages fit into a limit, zero limit is no limit
+func remaining(limit int, count int) (int, bool) {
+	if limit <= 0 {
+		return 0, true
+	}
+
+	return limit - count, count < limit
+}
+
+// DeadLetters returns up to limit dead letters of a queue, or of every queue, leaving them in place
+func (l *Londo) DeadLetters(queue string, limit int) ([]DeadLetter, error) {
+	queues, err := deadLetterQueues(queue)
+	if err != nil {
+		return nil, err
+	}
+
+	var res []DeadLetter
+
+	for _, q := range queues {
+		max, ok := remaining(limit, len(res))
+		if !ok {
+			break
+		}
+
+		err := l.Bus.Drain(DeadLetterQueue(q), max, func(d *amqp.Delivery) bool {
+			res = append(res, deadLetter(q, d))
+			return false
+		})
+		if err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// ReplayDeadLetters publishes up to limit dead letters back to their queues with a fresh
+// number of attempts
+func (l *Londo) ReplayDeadLetters(queue string, limit int) (int, error) {
+	queues, err := deadLetterQueues(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+
+	for _, q := range queues {
+		p, _ := retryPolicy(q)
+
+		max, ok := remaining(limit, count)
+		if !ok {
+			break
+		}
+
+		err := l.Bus.Drain(DeadLetterQueue(q), max, func(d *amqp.Delivery) bool {
+			msg := publishing(d)
+
+			delete(msg.Headers, AttemptsHeader)
+			delete(msg.Headers, FailedAtHeader)
+
+			if err := l.Bus.Emit(p.Exchange, q, msg); err != nil {
+				log.WithFields(logrus.Fields{logger.Queue: q, logger.Reason: err}).Error(logger.Skip)
+				return false
+			}
+
+			count++
+			return true
+		})
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// PurgeDeadLetters drops every dead letter of a queue, or of every queue
+func (l *Londo) PurgeDeadLetters(queue string) (int, error) {
+	queues, err := deadLetterQueues(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+
+	for _, q := range queues {
+		n, err := l.Bus.Purge(DeadLetterQueue(q))
+		count += n
+
+		if err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
@@ -0,0 +1,197 @@
+package londo
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Delay: time.Minute, MaxDelay: 5 * time.Minute}
+
+	tests := []struct {
+		failed int
+		want   time.Duration
+	}{
+		{0, time.Minute},
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := p.delay(tt.failed); got != tt.want {
+			t.Errorf("delay(%d) = %v, want %v", tt.failed, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyConfig(t *testing.T) {
+	withConfig(t, &Config{Retries: map[string]Retry{
+		EnrollQueue:  {MaxAttempts: 3, Delay: 10},
+		CollectQueue: {MaxDelay: 60},
+	}})
+
+	tests := []struct {
+		queue   string
+		want    RetryPolicy
+		wantErr bool
+	}{
+		{EnrollQueue, RetryPolicy{Exchange: EnrollExchange, MaxAttempts: 3, Delay: 10 * time.Second, MaxDelay: time.Hour}, false},
+		{CollectQueue, RetryPolicy{Exchange: CollectExchange, MaxAttempts: 10, Delay: time.Minute, MaxDelay: time.Minute}, false},
+		{RevokeQueue, RetryPolicies[RevokeQueue], false},
+		{CheckQueue, RetryPolicy{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.queue, func(t *testing.T) {
+			got, err := retryPolicy(tt.queue)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("retryPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("retryPolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAttempts(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{"none", nil, 0},
+		{"int32", amqp.Table{AttemptsHeader: int32(2)}, 2},
+		{"int64", amqp.Table{AttemptsHeader: int64(3)}, 3},
+		{"int", amqp.Table{AttemptsHeader: 4}, 4},
+		{"string", amqp.Table{AttemptsHeader: "5"}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Attempts(&amqp.Delivery{Headers: tt.headers}); got != tt.want {
+				t.Errorf("Attempts() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	errSectigo := errors.New("sectigo is down")
+
+	tests := []struct {
+		name     string
+		attempts int
+		cause    error
+		queue    string
+		want     int
+	}{
+		{"first", 0, errSectigo, DelayQueue(EnrollQueue, time.Minute), 1},
+		{"second", 1, errSectigo, DelayQueue(EnrollQueue, 2*time.Minute), 2},
+		{"last", 2, errSectigo, DeadLetterQueue(EnrollQueue), 3},
+		{"in doubt", 0, ErrInDoubt, DeadLetterQueue(EnrollQueue), 3},
+		{"stopped", 1, ErrStopped, EnrollQueue, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, b := newTestRetries(t)
+
+			if err := b.Emit(EnrollExchange, EnrollQueue, amqp.Publishing{
+				Type:    "enroll",
+				Headers: amqp.Table{AttemptsHeader: int32(tt.attempts)},
+				Body:    []byte("{}"),
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			d := get(t, b, EnrollQueue)
+			l.retry(&d, EnrollQueue, tt.cause)
+
+			if n := count(t, b, tt.queue); n != 1 {
+				t.Fatalf("%s has %d messages, want 1", tt.queue, n)
+			}
+
+			got := get(t, b, tt.queue)
+			if Attempts(&got) != tt.want || got.Type != "enroll" {
+				t.Errorf("attempts = %d, type = %q, want %d", Attempts(&got), got.Type, tt.want)
+			}
+
+			if tt.cause != ErrStopped && got.Headers[ErrorHeader] != tt.cause.Error() {
+				t.Errorf("error = %v, want %v", got.Headers[ErrorHeader], tt.cause)
+			}
+
+			_, failed := got.Headers[FailedAtHeader]
+			if failed != (tt.queue == DeadLetterQueue(EnrollQueue)) {
+				t.Errorf("failed at = %v", got.Headers[FailedAtHeader])
+			}
+		})
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	l, b := newTestRetries(t)
+
+	for i := 0; i < 3; i++ {
+		if err := b.Emit(EnrollExchange, EnrollQueue, amqp.Publishing{Type: "enroll", Body: []byte("{}")}); err != nil {
+			t.Fatal(err)
+		}
+
+		d := get(t, b, EnrollQueue)
+		l.retry(&d, EnrollQueue, ErrInDoubt)
+	}
+
+	tests := []struct {
+		queue   string
+		limit   int
+		want    int
+		wantErr bool
+	}{
+		{EnrollQueue, 0, 3, false},
+		{EnrollQueue, 2, 2, false},
+		{"", 0, 3, false},
+		{CheckQueue, 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		dl, err := l.DeadLetters(tt.queue, tt.limit)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("DeadLetters(%q) error = %v, wantErr %v", tt.queue, err, tt.wantErr)
+		}
+
+		if len(dl) != tt.want {
+			t.Errorf("DeadLetters(%q, %d) = %d, want %d", tt.queue, tt.limit, len(dl), tt.want)
+		}
+
+		for _, d := range dl {
+			if d.Queue != EnrollQueue || d.Attempts != 3 || d.Error != ErrInDoubt.Error() || d.FailedAt.IsZero() {
+				t.Errorf("dead letter = %+v", d)
+			}
+		}
+	}
+
+	// dead letters are left in place
+	if n := count(t, b, DeadLetterQueue(EnrollQueue)); n != 3 {
+		t.Fatalf("%d dead letters, want 3", n)
+	}
+
+	if n, err := l.ReplayDeadLetters(EnrollQueue, 1); err != nil || n != 1 {
+		t.Fatalf("ReplayDeadLetters() = %d, %v, want 1", n, err)
+	}
+
+	d := get(t, b, EnrollQueue)
+	if Attempts(&d) != 0 || d.Headers[FailedAtHeader] != nil {
+		t.Errorf("a replayed message has used attempts up: %v", d.Headers)
+	}
+
+	if n, err := l.PurgeDeadLetters(""); err != nil || n != 2 {
+		t.Errorf("PurgeDeadLetters() = %d, %v, want 2", n, err)
+	}
+}
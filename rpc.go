@@ -0,0 +1,388 @@
+package londo
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// ReplyTimeout is how long a request waits for each next reply
+	ReplyTimeout = time.Minute
+)
+
+// MaxPendingReplies is how many replies a request keeps for a slow reader, a request which
+// falls further behind fails, so it doesn't hold replies of other requests up
+var MaxPendingReplies = 10000
+
+// Codes of a failed request to londo-dbd, londo-grpcd maps them to gRPC status codes
+const (
+	NotFoundCode = "not_found"
+	ExistsCode   = "exists"
+	InvalidCode  = "invalid"
+	ConflictCode = "conflict"
+	AbortedCode  = "aborted"
+	InternalCode = "internal"
+)
+
+// Resources a failure is reported about
+const (
+	SubjectResource    = "subject"
+	EnrollmentResource = "enrollment"
+)
+
+var (
+	ErrReplyTimeout  = errors.New("timed out waiting for a reply")
+	ErrReplyOverflow = errors.New("too many replies waiting to be read")
+)
+
+// ErrorReply is sent instead of a reply when a request has failed. Resource and Name tell
+// what a failure is about, if anything in particular.
+type ErrorReply struct {
+	Code     string
+	Error    string
+	Resource string
+	Name     string
+}
+
+func (ErrorReply) EventName() string {
+	return "error"
+}
+
+// RPCError is a failure of a request to londo-dbd, it travels as an ErrorReply
+type RPCError struct {
+	Code     string
+	Resource string
+	Name     string
+	Err      error
+}
+
+func (e *RPCError) Error() string {
+	return e.Err.Error()
+}
+
+// rpcError classifies a failure of a request about a resource. Failures which aren't
+// known to be caused by a request are internal.
+func rpcError(err error, resource string, name string) *RPCError {
+	if e, ok := err.(*RPCError); ok {
+		return e
+	}
+
+	e := &RPCError{Code: InternalCode, Resource: resource, Name: name, Err: err}
+
+	switch {
+	case err == ErrSubjectNotFound, err == ErrEnrollmentNotFound:
+		e.Code = NotFoundCode
+	case err == ErrSubjectExists:
+		e.Code = ExistsCode
+	case err == ErrConflict:
+		e.Code = ConflictCode
+	case IsMalformed(err):
+		e.Code = InvalidCode
+	}
+
+	return e
+}
+
+// IsNotFound tells whether londo-dbd has failed a request as it couldn't find anything
+func IsNotFound(err error) bool {
+	e, ok := err.(*RPCError)
+	return ok && e.Code == NotFoundCode
+}
+
+// rpcClient sends requests to londo-dbd on behalf of londo-grpcd, or any other daemon. Replies of every request come
+// to a single reply queue, and are told apart by a correlation id.
+type rpcClient struct {
+	bus   Bus
+	queue string
+
+	mu      sync.Mutex
+	pending map[string]*requestSetup
+
+	// canceled once a daemon is stopping, calls waiting for replies return then
+	stopping context.Context
+	stop     context.CancelFunc
+}
+
+func newRPCClient(b Bus) (*rpcClient, error) {
+	host, _ := os.Hostname()
+
+	c := &rpcClient{
+		bus:     b,
+		queue:   GRPCServerExchange + "." + host + "." + newID()[:8],
+		pending: make(map[string]*requestSetup),
+	}
+	c.stopping, c.stop = context.WithCancel(context.Background())
+
+	if err := b.DeclareReplyQueue(GRPCServerExchange, c.queue); err != nil {
+		return nil, err
+	}
+
+	// replies of a request have to stay in order
+	go b.Consume(c.queue, Single, func(d amqp.Delivery) bool {
+		c.dispatch(&d)
+		d.Ack(false)
+		return false
+	})
+
+	return c, nil
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// dispatch passes a reply to a request it belongs to, without waiting for a request to read it.
+// Replies of requests which are gone, i.e. timed out, are dropped.
+func (c *rpcClient) dispatch(d *amqp.Delivery) {
+	c.mu.Lock()
+	sr, ok := c.pending[d.CorrelationId]
+	c.mu.Unlock()
+
+	if !ok {
+		log.WithFields(logrus.Fields{logger.Queue: c.queue, logger.Cmd: d.Type, logger.ID: d.CorrelationId}).Debug(logger.Skip)
+		return
+	}
+
+	sr.push(d)
+}
+
+type requestSetup struct {
+	id   string
+	ctx  context.Context
+	rpc  *rpcClient
+	last bool
+	ip   string
+	addr string
+
+	// replies wait in a queue until they are read, arrived is signalled whenever one is added
+	mu       sync.Mutex
+	replies  []amqp.Delivery
+	overflow bool
+	arrived  chan struct{}
+}
+
+// push queues a reply. Once a request falls behind, its replies are dropped, and it fails.
+func (sr *requestSetup) push(d *amqp.Delivery) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if sr.overflow {
+		return
+	}
+
+	if len(sr.replies) >= MaxPendingReplies {
+		log.WithFields(logrus.Fields{logger.ID: sr.id, logger.Count: len(sr.replies)}).Error(ErrReplyOverflow)
+
+		sr.overflow = true
+		sr.replies = nil
+	} else {
+		sr.replies = append(sr.replies, *d)
+	}
+
+	select {
+	case sr.arrived <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes the first queued reply
+func (sr *requestSetup) pop() (amqp.Delivery, bool, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if sr.overflow {
+		return amqp.Delivery{}, false, ErrReplyOverflow
+	}
+
+	if len(sr.replies) == 0 {
+		return amqp.Delivery{}, false, nil
+	}
+
+	d := sr.replies[0]
+	sr.replies = sr.replies[1:]
+
+	return d, true, nil
+}
+
+// newRequest registers a request, so its replies can be told apart from the others
+func (c *rpcClient) newRequest(ctx context.Context) *requestSetup {
+	sr := &requestSetup{
+		id:      newID(),
+		ctx:     ctx,
+		rpc:     c,
+		arrived: make(chan struct{}, 1),
+	}
+
+	c.mu.Lock()
+	c.pending[sr.id] = sr
+	c.mu.Unlock()
+
+	return sr
+}
+
+func (g *GRPCServer) setupRequest(ctx context.Context) (*requestSetup, error) {
+	ip, addr, err := ParseIPAddr(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sr := g.rpc.newRequest(ctx)
+	sr.ip = ip
+	sr.addr = addr
+
+	return sr, nil
+}
+
+// close forgets a request, late replies are dropped from then on
+func (sr *requestSetup) close() {
+	sr.rpc.mu.Lock()
+	delete(sr.rpc.pending, sr.id)
+	sr.rpc.mu.Unlock()
+}
+
+// request publishes a request to londo-dbd, replies are read with next
+func (g *GRPCServer) request(sr *requestSetup, cmd string, e Event) error {
+	return g.Londo.publish(DbReplyExchange, DbReplyQueue, sr.rpc.queue, sr.id, cmd, e)
+}
+
+// call sends a request to londo-dbd from a daemon other than londo-grpcd, and waits for its single reply.
+// Once a daemon is stopping, a call returns ErrStopped instead, so its delivery is handled again later.
+func (l *Londo) call(cmd string, e Event, reply Event) error {
+	sr := l.rpc.newRequest(l.rpc.stopping)
+	defer sr.close()
+
+	if sr.ctx.Err() != nil {
+		return ErrStopped
+	}
+
+	if err := l.publish(DbReplyExchange, DbReplyQueue, sr.rpc.queue, sr.id, cmd, e); err != nil {
+		return err
+	}
+
+	if err := sr.reply(reply); err != nil {
+		if sr.ctx.Err() != nil {
+			return ErrStopped
+		}
+		return err
+	}
+
+	return nil
+}
+
+// next waits for the next reply. The last reply is marked with CloseChannelCmd, and after it
+// next returns io.EOF, an empty last reply only marks the end. An error reply is returned as an RPCError.
+func (sr *requestSetup) next() (*amqp.Delivery, error) {
+	if sr.last {
+		return nil, io.EOF
+	}
+
+	timeout := time.After(ReplyTimeout)
+
+	for {
+		d, ok, err := sr.pop()
+		if err != nil {
+			sr.last = true
+			return nil, err
+		}
+
+		if ok {
+			return sr.read(d)
+		}
+
+		select {
+		case <-sr.arrived:
+		case <-timeout:
+			return nil, ErrReplyTimeout
+		case <-sr.ctx.Done():
+			return nil, sr.ctx.Err()
+		}
+	}
+}
+
+// read tells a reply apart from the last one and from an error reply
+func (sr *requestSetup) read(d amqp.Delivery) (*amqp.Delivery, error) {
+	switch d.Type {
+	case CloseChannelCmd:
+		sr.last = true
+
+		if env, err := Open(&d); err == nil && env.Event == (EmptyEvent{}).EventName() {
+			return nil, io.EOF
+		}
+
+	case ErrorReplyCmd:
+		sr.last = true
+
+		var e ErrorReply
+		if err := Decode(&d, &e); err != nil {
+			return nil, err
+		}
+
+		return nil, &RPCError{Code: e.Code, Resource: e.Resource, Name: e.Name, Err: errors.New(e.Error)}
+	}
+
+	return &d, nil
+}
+
+// reply waits for a single reply and decodes it
+func (sr *requestSetup) reply(v Event) error {
+	d, err := sr.next()
+	if err != nil {
+		return err
+	}
+
+	return Decode(d, v)
+}
+
+// subject waits for a single reply and decodes it as a subject
+func (sr *requestSetup) subject() (Subject, error) {
+	var s Subject
+	err := sr.reply(&s)
+	return s, err
+}
+
+func (g *GRPCServer) getManyReplies(sr *requestSetup, f func(rs Subject) error) error {
+	return g.getReplies(sr, func(d *amqp.Delivery) error {
+		var rs Subject
+		if err := Decode(d, &rs); err != nil {
+			log.WithFields(logrus.Fields{logger.IP: sr.ip}).Error(err)
+			return internalError()
+		}
+
+		if rs.Subject == "" {
+			log.WithFields(logrus.Fields{logger.IP: sr.ip}).Error(notFound)
+			return notFoundError()
+		}
+
+		return f(rs)
+	})
+}
+
+func (g *GRPCServer) getReplies(sr *requestSetup, f func(d *amqp.Delivery) error) error {
+	for {
+		d, err := sr.next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			log.WithFields(logrus.Fields{logger.IP: sr.ip, logger.Reason: err}).Error()
+			return rpcStatus(sr, err)
+		}
+
+		if err := f(d); err != nil {
+			return err
+		}
+	}
+}
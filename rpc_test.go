@@ -0,0 +1,234 @@
+package londo
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/streadway/amqp"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestRPCStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"not found", rpcError(ErrSubjectNotFound, SubjectResource, "a"), codes.NotFound},
+		{"exists", rpcError(ErrSubjectExists, SubjectResource, "a"), codes.AlreadyExists},
+		{"conflict", rpcError(ErrConflict, SubjectResource, "a"), codes.Aborted},
+		{"malformed", rpcError(malformed(errors.New("x")), "", ""), codes.InvalidArgument},
+		{"aborted", &RPCError{Code: AbortedCode, Err: errors.New("x")}, codes.Aborted},
+		{"internal", rpcError(errors.New("x"), "", ""), codes.Internal},
+		{"plain error", errors.New("x"), codes.Internal},
+		{"timeout", ErrReplyTimeout, codes.DeadlineExceeded},
+		{"canceled", context.Canceled, codes.Canceled},
+		{"overflow", ErrReplyOverflow, codes.ResourceExhausted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := status.Code(rpcStatus(&requestSetup{id: "1"}, tt.err)); got != tt.want {
+				t.Errorf("rpcStatus() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRPCErrorKeepsCode(t *testing.T) {
+	e := &RPCError{Code: InvalidCode, Name: "filter", Err: errors.New("x")}
+
+	if got := rpcError(e, SubjectResource, "a"); got != e {
+		t.Errorf("rpcError() = %v, want an error passed through", got)
+	}
+}
+
+// reply is a reply of londo-dbd, sent with a correlation id of a request
+type reply struct {
+	cmd string
+	e   Event
+}
+
+func TestRPCClientReplies(t *testing.T) {
+	tests := []struct {
+		name     string
+		replies  []reply
+		subjects []string
+		wantErr  bool
+	}{
+		{"single", []reply{{CloseChannelCmd, Subject{Subject: "a"}}}, []string{"a"}, false},
+		{"many", []reply{
+			{DbGetSubjectCmd, Subject{Subject: "a"}},
+			{DbGetSubjectCmd, Subject{Subject: "b"}},
+			{CloseChannelCmd, EmptyEvent{}},
+		}, []string{"a", "b"}, false},
+		{"none", []reply{{CloseChannelCmd, EmptyEvent{}}}, nil, false},
+		{"error", []reply{
+			{DbGetSubjectCmd, Subject{Subject: "a"}},
+			{ErrorReplyCmd, ErrorReply{Code: NotFoundCode, Error: "not found", Resource: SubjectResource, Name: "b"}},
+		}, []string{"a"}, true},
+	}
+
+	b := newTestBus(t)
+	t.Cleanup(b.Shutdown)
+
+	if err := b.DeclareExchange(GRPCServerExchange, amqp.ExchangeDirect); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newRPCClient(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbd := &Londo{Name: "londo-dbd", Bus: b}
+
+	// every request is registered before any replies are sent, so replies of all of them interleave
+	requests := make([]*requestSetup, len(tests))
+	for i := range tests {
+		requests[i] = c.newRequest(context.Background())
+		defer requests[i].close()
+	}
+
+	for n := 0; n < 3; n++ {
+		for i, tt := range tests {
+			if n >= len(tt.replies) {
+				continue
+			}
+
+			r := tt.replies[n]
+			if err := dbd.publish(GRPCServerExchange, c.queue, "", requests[i].id, r.cmd, r.e); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for i, tt := range tests {
+		sr := requests[i]
+
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+
+			for {
+				d, err := sr.next()
+				if err == io.EOF {
+					break
+				}
+
+				if err != nil {
+					if !tt.wantErr || !IsNotFound(err) {
+						t.Errorf("next() error = %v, wantErr %v", err, tt.wantErr)
+					}
+					break
+				}
+
+				var s Subject
+				if err := Decode(d, &s); err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, s.Subject)
+			}
+
+			if strings.Join(got, ",") != strings.Join(tt.subjects, ",") {
+				t.Errorf("replies = %v, want %v", got, tt.subjects)
+			}
+
+			if _, err := sr.next(); err != io.EOF {
+				t.Errorf("next() after the last reply = %v, want %v", err, io.EOF)
+			}
+		})
+	}
+}
+
+func TestRPCClientLateReply(t *testing.T) {
+	b := newTestBus(t)
+	t.Cleanup(b.Shutdown)
+
+	if err := b.DeclareExchange(GRPCServerExchange, amqp.ExchangeDirect); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newRPCClient(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sr := c.newRequest(ctx)
+
+	cancel()
+	if _, err := sr.next(); err != context.Canceled {
+		t.Errorf("next() of a canceled request = %v, want %v", err, context.Canceled)
+	}
+	sr.close()
+
+	// a reply of a request which is gone is dropped, and doesn't hold replies of other requests up
+	dbd := &Londo{Name: "londo-dbd", Bus: b}
+	if err := dbd.publish(GRPCServerExchange, c.queue, "", sr.id, CloseChannelCmd, EmptyEvent{}); err != nil {
+		t.Fatal(err)
+	}
+
+	next := c.newRequest(context.Background())
+	defer next.close()
+
+	if err := dbd.publish(GRPCServerExchange, c.queue, "", next.id, CloseChannelCmd, Subject{Subject: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := next.subject(); err != nil || s.Subject != "a" {
+		t.Errorf("subject() = %q, %v, want a", s.Subject, err)
+	}
+}
+
+// TestRPCClientSlowReader streams more replies than a request keeps, without holding up another request
+func TestRPCClientSlowReader(t *testing.T) {
+	prev := MaxPendingReplies
+	MaxPendingReplies = 4
+	t.Cleanup(func() { MaxPendingReplies = prev })
+
+	b := newTestBus(t)
+	t.Cleanup(b.Shutdown)
+
+	if err := b.DeclareExchange(GRPCServerExchange, amqp.ExchangeDirect); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := newRPCClient(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbd := &Londo{Name: "londo-dbd", Bus: b}
+
+	slow := c.newRequest(context.Background())
+	defer slow.close()
+
+	fast := c.newRequest(context.Background())
+	defer fast.close()
+
+	for i := 0; i < 2*MaxPendingReplies; i++ {
+		if err := dbd.publish(GRPCServerExchange, c.queue, "", slow.id, DbGetSubjectCmd, Subject{Subject: "a"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := dbd.publish(GRPCServerExchange, c.queue, "", fast.id, CloseChannelCmd, Subject{Subject: "b"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if s, err := fast.subject(); err != nil || s.Subject != "b" {
+		t.Errorf("subject() behind a slow request = %q, %v, want b", s.Subject, err)
+	}
+
+	if _, err := slow.next(); err != ErrReplyOverflow {
+		t.Errorf("next() of a request which fell behind = %v, want %v", err, ErrReplyOverflow)
+	}
+
+	if _, err := slow.next(); err != io.EOF {
+		t.Errorf("next() after an overflow = %v, want %v", err, io.EOF)
+	}
+}
@@ -0,0 +1,156 @@
+package londo
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+	"google.golang.org/grpc"
+)
+
+// ShutdownTimeout limits how long a stopping daemon waits for work in progress
+var ShutdownTimeout = 30 * time.Second
+
+// inflight keeps track of deliveries being handled, so a shutdown can tell which were abandoned
+type inflight struct {
+	mu         sync.Mutex
+	seq        uint64
+	deliveries map[uint64]inflightDelivery
+}
+
+type inflightDelivery struct {
+	queue string
+	cmd   string
+	id    string
+	since time.Time
+}
+
+func (i *inflight) add(queue string, d *amqp.Delivery) uint64 {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.deliveries == nil {
+		i.deliveries = make(map[uint64]inflightDelivery)
+	}
+
+	i.seq++
+	i.deliveries[i.seq] = inflightDelivery{queue: queue, cmd: d.Type, id: d.MessageId, since: time.Now()}
+
+	return i.seq
+}
+
+func (i *inflight) done(seq uint64) {
+	i.mu.Lock()
+	delete(i.deliveries, seq)
+	i.mu.Unlock()
+}
+
+func (i *inflight) report() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, d := range i.deliveries {
+		log.WithFields(logrus.Fields{
+			logger.Queue:    d.queue,
+			logger.Cmd:      d.cmd,
+			logger.ID:       d.id,
+			logger.Duration: time.Since(d.since).Round(time.Millisecond).String()}).Warn(logger.Abandoned)
+	}
+
+	return len(i.deliveries)
+}
+
+// consume runs a consumer a shutdown waits for
+func (l *Londo) consume(queue string, f func(d amqp.Delivery) bool) {
+	l.consumers.Add(1)
+
+	go func() {
+		defer l.consumers.Done()
+
+		l.Bus.Consume(queue, consumerPool(queue), func(d amqp.Delivery) bool {
+			seq := l.inflight.add(queue, &d)
+			defer l.inflight.done(seq)
+
+			return f(d)
+		})
+	}()
+}
+
+// Stopping tells whether a daemon is shutting down
+func (l *Londo) Stopping() bool {
+	return atomic.LoadInt32(&l.stopping) == 1
+}
+
+// stop stops taking new work, and waits for work in progress until ShutdownTimeout. gRPC calls
+// finish first, as they may still wait for replies. Deliveries which are left unacknowledged are
+// reported, a broker delivers them again once a connection is closed.
+func (l *Londo) stop() int {
+	atomic.StoreInt32(&l.stopping, 1)
+	deadline := time.Now().Add(ShutdownTimeout)
+
+	log.WithFields(logrus.Fields{logger.Timeout: ShutdownTimeout.String()}).Info("stopping")
+
+	if l.GRPC != nil {
+		stopGRPC(l.GRPC.srv, time.Until(deadline))
+	}
+
+	if l.CA != nil {
+		l.CA.Stop()
+	}
+
+	if l.Bus == nil {
+		return 0
+	}
+
+	l.Bus.Stop()
+
+	// a handler waiting for londo-dbd gets its delivery requeued rather than wait for a reply
+	if l.rpc != nil {
+		l.rpc.stop()
+	}
+
+	var abandoned int
+	if !wait(&l.consumers, time.Until(deadline)) {
+		abandoned = l.inflight.report()
+	}
+
+	l.Bus.Shutdown()
+	return abandoned
+}
+
+// stopGRPC waits for calls in progress, and cancels those which outlive a timeout
+func stopGRPC(srv *grpc.Server, timeout time.Duration) {
+	done := make(chan struct{})
+
+	go func() {
+		srv.GracefulStop()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		log.WithFields(logrus.Fields{logger.Service: "grpc"}).Warn(logger.Abandoned)
+		srv.Stop()
+	}
+}
+
+// wait tells whether a wait group is done within a timeout
+func wait(wg *sync.WaitGroup, timeout time.Duration) bool {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
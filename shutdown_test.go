@@ -0,0 +1,114 @@
+package londo
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+func TestStop(t *testing.T) {
+	tests := []struct {
+		name          string
+		handling      time.Duration
+		timeout       time.Duration
+		call          bool
+		wantAbandoned int
+	}{
+		{"finished", 50 * time.Millisecond, 5 * time.Second, false, 0},
+		{"abandoned", 5 * time.Second, 50 * time.Millisecond, false, 1},
+		{"waiting for a reply", 0, 5 * time.Second, true, 0},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			prev := ShutdownTimeout
+			ShutdownTimeout = tt.timeout
+			t.Cleanup(func() { ShutdownTimeout = prev })
+
+			b := newTestBus(t, "a")
+			l := &Londo{Name: "test", Bus: b}
+
+			if tt.call {
+				declarePipeline(t, b)
+
+				var err error
+				if l.rpc, err = newRPCClient(b); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var once sync.Once
+
+			started := make(chan struct{})
+			release := make(chan struct{})
+			t.Cleanup(func() { close(release) })
+
+			called := make(chan error, 1)
+
+			// a requeued delivery may come again before a consumer is stopped
+			l.consume("a", func(d amqp.Delivery) bool {
+				once.Do(func() { close(started) })
+
+				// londo-dbd never replies, a call only returns once a daemon is stopping
+				if tt.handling == 0 {
+					err := l.call(DbGetSubjectCmd, &GetSubjectEvent{Subject: "a"}, &Subject{})
+					select {
+					case called <- err:
+					default:
+					}
+					l.retry(&d, EnrollQueue, err)
+					return false
+				}
+
+				select {
+				case <-time.After(tt.handling):
+				case <-release:
+				}
+
+				d.Ack(false)
+				return false
+			})
+
+			emit(t, b, "a", "work")
+			<-started
+
+			start := time.Now()
+
+			if got := l.stop(); got != tt.wantAbandoned {
+				t.Errorf("stop() = %d abandoned deliveries, want %d", got, tt.wantAbandoned)
+			}
+
+			if !l.Stopping() || b.Ready() {
+				t.Error("a stopped daemon is still ready")
+			}
+
+			if tt.handling != 0 {
+				return
+			}
+
+			if err := <-called; err != ErrStopped {
+				t.Errorf("call() = %v, want %v", err, ErrStopped)
+			}
+
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("stop() took %v, a call kept waiting for a reply", d)
+			}
+		})
+	}
+}
+
+func TestInflight(t *testing.T) {
+	var i inflight
+
+	a := i.add("a", &amqp.Delivery{Type: "enroll", MessageId: "1"})
+	i.add("b", &amqp.Delivery{Type: "collect", MessageId: "2"})
+
+	i.done(a)
+
+	if n := i.report(); n != 1 {
+		t.Errorf("report() = %d, want 1", n)
+	}
+}
@@ -0,0 +1,113 @@
+package londo
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	MongoBackend = "mongodb"
+	BoltBackend  = "bolt"
+)
+
+var (
+	ErrSubjectNotFound = errors.New("subject not found")
+	ErrSubjectExists   = errors.New("subject already exists")
+
+	ErrEnrollmentNotFound = errors.New("enrollment not found")
+
+	// ErrConflict means a subject was modified after it was read, so an update wasn't applied
+	ErrConflict = errors.New("subject was modified concurrently")
+)
+
+// Store is a persistence backend for subjects. Every Db*Cmd handler works through it,
+// so londo-dbd doesn't care whether subjects live in MongoDB or in an embedded file.
+// Deleted subjects are only visible to FindDeletedSubjects, RestoreSubject and ListSubjects.
+// Updates and purges take a revision a subject was read with, and return ErrConflict if it has changed since,
+// so do saves of an enrollment, a new one is saved with a zero revision. InsertSubject returns
+// ErrConflict when a live subject of the same name, or any subject of the same cert id, exists.
+type Store interface {
+	FindAllSubjects() ([]*Subject, error)
+	FindExpiringSubjects(hours int) ([]*Subject, error)
+	FindSubject(s string) (Subject, error)
+	FindSubjectByCertID(certId int) (Subject, error)
+	FindManySubjects(s []string, filter string) ([]Subject, error)
+	ListSubjects(f *SubjectFilter) ([]Subject, string, error)
+	InsertSubject(s *Subject) error
+	DeleteSubject(hexId string, certid int, rev int64, t *Tombstone) error
+	FindDeletedSubjects() ([]*Subject, error)
+	RestoreSubject(s string) (Subject, error)
+	PurgeSubject(hexId string, rev int64) error
+	ImportSubject(s *Subject, replace bool) ([]string, error)
+	UpdateSubjCert(certId *int, rev int64, cert *string, na *time.Time, sn *big.Int) error
+	UpdateUnreachable(e *CheckCertEvent) error
+	UpdateSubjKey(hexId string, rev int64, k *EncryptedKey) error
+	InsertCertRecord(r *CertRecord) error
+	FindCertHistory(s string) ([]CertRecord, error)
+	FindAllCertRecords() ([]CertRecord, error)
+	ImportCertRecord(r *CertRecord) (bool, error)
+	RevokeCertRecord(certId int, reason string, at time.Time) error
+	InsertAuditEntry(e *AuditEntry) error
+	FindAuditEntries(from time.Time, to time.Time, actor string) ([]AuditEntry, error)
+	FindEnrollment(s string) (Enrollment, error)
+	SaveEnrollment(e *Enrollment, rev int64) error
+	DeleteEnrollment(certId int) error
+	EnsureIndexes() error
+	SchemaVersion() (int, error)
+	SetSchemaVersion(v int) error
+	MigrateSubjects(f func(doc bson.M) bool, dryRun bool) ([]string, error)
+	Disconnect() error
+}
+
+// NewStore connects to a backend selected by storage section of configuration file.
+// MongoDB is used when nothing was specified.
+func NewStore(c *Config) (Store, error) {
+	switch c.Storage.Backend {
+	case "", MongoBackend:
+		m, err := NewDBConnection(c)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+
+	case BoltBackend:
+		b, err := NewBoltDB(c)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+
+	default:
+		return nil, errors.New("unknown storage backend " + c.Storage.Backend)
+	}
+}
+
+// conflictFields tells which unique fields of an imported subject are taken by existing ones
+func conflictFields(s *Subject, existing []Subject) []string {
+	var subj, certId bool
+
+	for _, e := range existing {
+		if e.Subject == s.Subject && e.Deleted == nil && s.Deleted == nil {
+			subj = true
+		}
+
+		if e.CertID == s.CertID {
+			certId = true
+		}
+	}
+
+	var fields []string
+
+	if subj {
+		fields = append(fields, "subject")
+	}
+
+	if certId {
+		fields = append(fields, "cert_id")
+	}
+
+	return fields
+}
@@ -0,0 +1,165 @@
+package londo
+
+import (
+	"time"
+
+	"github.com/alexyermolaev/londo/logger"
+	"github.com/roylee0704/gron"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultRetentionDays is how long a deleted subject is kept when storage section doesn't say
+const DefaultRetentionDays = 30
+
+// Tombstone marks a deleted subject. Deleted subjects keep their private keys,
+// so they can be restored until a purge removes them.
+type Tombstone struct {
+	At     time.Time `bson:"at"`
+	Reason string    `bson:"reason,omitempty"`
+	Actor  string    `bson:"actor,omitempty"`
+
+	// a certificate is revoked when a subject is purged, rather than when it was deleted
+	Revoke bool `bson:"revoke,omitempty"`
+}
+
+// RestoreSubjectReply tells whether a certificate of a restored subject was revoked meanwhile,
+// in which case the subject has to be renewed.
+type RestoreSubjectReply struct {
+	Subject string
+	Revoked bool
+}
+
+func (RestoreSubjectReply) EventName() string {
+	return "subject.restored"
+}
+
+func retention() time.Duration {
+	days := cfg.Storage.RetentionDays
+	if days <= 0 {
+		days = DefaultRetentionDays
+	}
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// PurgeDeleted removes deleted subjects once their retention is over, checking every hour
+func (l *Londo) PurgeDeleted() *Londo {
+	c := gron.New()
+	c.AddFunc(gron.Every(time.Hour), l.purgeDeleted)
+
+	log.WithFields(logrus.Fields{
+		logger.Service: "purge",
+		logger.Days:    int(retention().Hours() / 24)}).Info("scheduled")
+
+	c.Start()
+
+	return l
+}
+
+// purgeDeleted runs in every replica of londo-dbd. A purge only removes a subject of the revision
+// it was found with, so a single replica purges a subject, and only that one revokes its certificate.
+func (l *Londo) purgeDeleted() {
+	subjs, err := l.Db.FindDeletedSubjects()
+	if err != nil {
+		log.WithFields(logrus.Fields{logger.Service: "purge", logger.Reason: err}).Error()
+		return
+	}
+
+	cutoff := time.Now().Add(-retention())
+
+	var count int
+
+	for _, s := range subjs {
+		if s.Deleted.At.After(cutoff) {
+			continue
+		}
+
+		fields := logrus.Fields{logger.Service: "purge", logger.Subject: s.Subject}
+
+		err := l.Db.PurgeSubject(s.ID.Hex(), s.Revision)
+
+		// another replica has purged or restored a subject meanwhile
+		if err == ErrConflict || err == ErrSubjectNotFound {
+			fields[logger.Reason] = err
+			log.WithFields(fields).Debug(logger.Skip)
+			continue
+		}
+
+		l.Audit(l.Name, "", "PurgeSubject", s.Subject, err)
+
+		if err != nil {
+			fields[logger.Reason] = err
+			log.WithFields(fields).Error(logger.Skip)
+			continue
+		}
+
+		// a subject whose certificate can't be revoked yet is put back, and purged on a next run
+		if s.Deleted.Revoke && !l.revokePurged(s) {
+			conflicts, err := l.Db.ImportSubject(s, false)
+			if err == nil && len(conflicts) != 0 {
+				err = ErrConflict
+			}
+
+			if err != nil {
+				fields[logger.CertID] = s.CertID
+				fields[logger.Reason] = err
+				log.WithFields(fields).Error(logger.Lost)
+			}
+			continue
+		}
+
+		count++
+	}
+
+	log.WithFields(logrus.Fields{logger.Service: "purge", logger.Count: count}).Info(logger.Success)
+}
+
+// revokePurged asks for a certificate of a subject being purged to be revoked
+func (l *Londo) revokePurged(s *Subject) bool {
+	fields := logrus.Fields{
+		logger.Exchange: RevokeExchange,
+		logger.Queue:    RevokeQueue,
+		logger.Subject:  s.Subject,
+		logger.CertID:   s.CertID}
+
+	err := l.Publish(RevokeExchange, RevokeQueue, "", "", RevokeEvent{
+		ID:     s.ID.Hex(),
+		CertID: s.CertID,
+		Reason: s.Deleted.Reason,
+		Actor:  l.Name,
+	})
+	l.Audit(l.Name, "", RevokeQueue, s.Subject, err)
+
+	if err != nil {
+		fields[logger.Reason] = err
+		log.WithFields(fields).Error(logger.Skip)
+		return false
+	}
+
+	log.WithFields(fields).Info(logger.Published)
+	return true
+}
+
+// restoreSubject undeletes a subject, and looks up its certificate history for a revocation
+func (l *Londo) restoreSubject(subject string) (RestoreSubjectReply, error) {
+	r := RestoreSubjectReply{Subject: subject}
+
+	s, err := l.Db.RestoreSubject(subject)
+	if err != nil {
+		return r, err
+	}
+
+	h, err := l.Db.FindCertHistory(subject)
+	if err != nil {
+		// subject is already restored, so only log it
+		log.WithFields(logrus.Fields{logger.Subject: subject, logger.Reason: err}).Error()
+	}
+
+	for _, c := range h {
+		if c.CertID == s.CertID && !c.RevokedAt.IsZero() {
+			r.Revoked = true
+		}
+	}
+
+	return r, nil
+}
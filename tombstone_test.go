@@ -0,0 +1,264 @@
+package londo
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alexyermolaev/londo/londopb"
+	"github.com/streadway/amqp"
+	"google.golang.org/grpc/peer"
+)
+
+func TestRestoreSubject(t *testing.T) {
+	day := 24 * time.Hour
+
+	tests := []struct {
+		name        string
+		subjects    []*Subject
+		revoked     int
+		wantErr     error
+		wantCertID  int
+		wantRevoked bool
+	}{
+		{"missing", nil, 0, ErrSubjectNotFound, 0, false},
+		{"live", []*Subject{{CertID: 1}}, 0, ErrSubjectExists, 0, false},
+		{"deleted", []*Subject{{CertID: 1, Deleted: &Tombstone{At: time.Now()}}}, 0, nil, 1, false},
+		{"revoked meanwhile", []*Subject{{CertID: 1, Deleted: &Tombstone{At: time.Now()}}}, 1, nil, 1, true},
+		{"another revoked", []*Subject{{CertID: 1, Deleted: &Tombstone{At: time.Now()}}}, 2, nil, 1, false},
+		{"latest deleted", []*Subject{
+			{CertID: 1, Deleted: &Tombstone{At: time.Now().Add(-2 * day)}},
+			{CertID: 2, Deleted: &Tombstone{At: time.Now().Add(-day)}},
+		}, 0, nil, 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestDbd(t)
+
+			for _, s := range tt.subjects {
+				s.Subject = "a.example.com"
+				if err := l.Db.InsertSubject(s); err != nil {
+					t.Fatal(err)
+				}
+
+				if err := l.Db.InsertCertRecord(&CertRecord{Subject: s.Subject, CertID: s.CertID}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if tt.revoked != 0 {
+				if err := l.Db.RevokeCertRecord(tt.revoked, "key compromise", time.Now()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			r, err := l.restoreSubject("a.example.com")
+			if err != tt.wantErr {
+				t.Fatalf("restoreSubject() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if r.Revoked != tt.wantRevoked {
+				t.Errorf("Revoked = %t, want %t", r.Revoked, tt.wantRevoked)
+			}
+
+			s, err := l.Db.FindSubject("a.example.com")
+			if err != nil || s.CertID != tt.wantCertID || s.Deleted != nil {
+				t.Errorf("restored subject = %+v, %v, want cert id %d", s, err, tt.wantCertID)
+			}
+		})
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	withConfig(t, &Config{Storage: Storage{RetentionDays: 30}})
+
+	l := newTestDbd(t)
+	b := l.Bus.(*MemoryBus)
+
+	if err := b.Declare(RevokeExchange, RevokeQueue, amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-31 * 24 * time.Hour)
+
+	for _, s := range []*Subject{
+		{Subject: "live.example.com", CertID: 1},
+		{Subject: "recent.example.com", CertID: 2, Deleted: &Tombstone{At: time.Now()}},
+		{Subject: "old.example.com", CertID: 3, Deleted: &Tombstone{At: old}},
+		{Subject: "revoke.example.com", CertID: 4, Deleted: &Tombstone{At: old, Revoke: true, Reason: "superseded"}},
+	} {
+		if err := l.Db.InsertSubject(s); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l.purgeDeleted()
+
+	deleted, err := l.Db.FindDeletedSubjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 1 || deleted[0].Subject != "recent.example.com" {
+		t.Errorf("%d deleted subjects are left, want only recent.example.com", len(deleted))
+	}
+
+	if _, err := l.Db.FindSubject("live.example.com"); err != nil {
+		t.Errorf("a live subject was purged: %v", err)
+	}
+
+	d := get(t, b, RevokeQueue)
+
+	var e RevokeEvent
+	if err := Decode(&d, &e); err != nil {
+		t.Fatal(err)
+	}
+
+	if e.CertID != 4 || e.Reason != "superseded" {
+		t.Errorf("revoke request = %+v, want cert id 4", e)
+	}
+
+	if n := count(t, b, RevokeQueue); n != 0 {
+		t.Errorf("%d more revoke requests, want none", n)
+	}
+}
+
+// a subject whose certificate can't be revoked yet stays until a next run
+func TestPurgeDeletedWithoutRevoke(t *testing.T) {
+	withConfig(t, &Config{})
+
+	l := newTestDbd(t)
+
+	if err := l.Db.InsertSubject(&Subject{
+		Subject: "revoke.example.com",
+		CertID:  1,
+		Deleted: &Tombstone{At: time.Now().Add(-DefaultRetentionDays*24*time.Hour - time.Hour), Revoke: true},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	l.purgeDeleted()
+
+	if deleted, err := l.Db.FindDeletedSubjects(); err != nil || len(deleted) != 1 {
+		t.Errorf("deleted subjects = %d, %v, want the one which wasn't revoked", len(deleted), err)
+	}
+}
+
+// replicas of londo-dbd purge at once, a subject is only purged and revoked by one of them
+func TestPurgeDeletedReplicas(t *testing.T) {
+	withConfig(t, &Config{})
+
+	l := newTestDbd(t)
+	b := l.Bus.(*MemoryBus)
+
+	if err := b.Declare(RevokeExchange, RevokeQueue, amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-DefaultRetentionDays*24*time.Hour - time.Hour)
+	for i, subject := range []string{"a.example.com", "b.example.com", "c.example.com"} {
+		if err := l.Db.InsertSubject(&Subject{
+			Subject: subject,
+			CertID:  i + 1,
+			Deleted: &Tombstone{At: old, Revoke: true},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			(&Londo{Name: "londo-dbd", Db: l.Db, Bus: b}).purgeDeleted()
+		}()
+	}
+	wg.Wait()
+
+	if n := count(t, b, RevokeQueue); n != 3 {
+		t.Errorf("%d revoke requests, want 3", n)
+	}
+}
+
+func TestPurgeSubjectRevision(t *testing.T) {
+	db := newTestBolt(t)
+
+	s := &Subject{Subject: "a.example.com", CertID: 1, Deleted: &Tombstone{At: time.Now()}}
+	if err := db.InsertSubject(s); err != nil {
+		t.Fatal(err)
+	}
+
+	live := &Subject{Subject: "b.example.com", CertID: 2}
+	if err := db.InsertSubject(live); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		rev     int64
+		wantErr error
+	}{
+		{"live", live.ID.Hex(), live.Revision, ErrConflict},
+		{"stale", s.ID.Hex(), s.Revision + 1, ErrConflict},
+		{"deleted", s.ID.Hex(), s.Revision, nil},
+		{"purged", s.ID.Hex(), s.Revision, ErrSubjectNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := db.PurgeSubject(tt.id, tt.rev); err != tt.wantErr {
+				t.Errorf("PurgeSubject() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestDeleteSubject deletes a subject through gRPC, its certificate is left alone until a purge
+func TestDeleteSubject(t *testing.T) {
+	dbd := newTestDbd(t)
+	b := dbd.Bus.(*MemoryBus)
+
+	if err := b.Declare(RevokeExchange, RevokeQueue, amqp.ExchangeDirect, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := dbd.Db.InsertSubject(&Subject{Subject: "a.example.com", CertID: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	dbd.ConsumeDbRPC()
+	t.Cleanup(func() { stopDaemon(dbd) })
+
+	c := &Londo{Name: "londo-grpcd", Bus: b}
+	c.RPCClient()
+
+	g := &GRPCServer{Londo: c, rpc: c.rpc}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}})
+
+	if _, err := g.DeleteSubject(ctx, &londopb.DeleteSubjectRequest{Subject: "a.example.com", Reason: "mistake"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var deleted []*Subject
+	waitFor(t, "a deleted subject", func() bool {
+		deleted, _ = dbd.Db.FindDeletedSubjects()
+		return len(deleted) == 1
+	})
+
+	if !deleted[0].Deleted.Revoke || deleted[0].Deleted.Reason != "mistake" {
+		t.Errorf("tombstone = %+v, want a revocation once purged", deleted[0].Deleted)
+	}
+
+	if n := count(t, b, RevokeQueue); n != 0 {
+		t.Errorf("%d revoke requests of a deleted subject, want none until it is purged", n)
+	}
+}